@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// AccessLogConfig sets how many requests get an access log record.
+// SampleRate is the fraction of successful and client-error requests
+// logged; 5xx responses are always logged, so sampling never hides a
+// failure.
+type AccessLogConfig struct {
+	SampleRate float64
+}
+
+func loadAccessLogConfig() AccessLogConfig {
+	cfg := AccessLogConfig{SampleRate: 1}
+	if val := os.Getenv("ACCESS_LOG_SAMPLE_RATE"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed >= 0 && parsed <= 1 {
+			cfg.SampleRate = parsed
+		}
+	}
+	return cfg
+}
+
+// logAccess writes the access log record for r, answered as m says. roll is
+// a uniform random number in [0, 1) deciding whether a sampled request is
+// logged.
+func (s *Server) logAccess(r *http.Request, route string, m httpsnoop.Metrics, roll float64) {
+	level, msg := slog.LevelInfo, "request"
+	if m.Code >= http.StatusInternalServerError {
+		level, msg = slog.LevelError, "request failed"
+	} else if roll >= s.config.AccessLog.SampleRate {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", route),
+		slog.Int("status", m.Code),
+		slog.Int64("bytes", m.Written),
+		slog.Duration("duration", m.Duration),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("user_agent", r.UserAgent()),
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		attrs = append(attrs, slog.String("forwarded_for", forwarded))
+	}
+	if cert := clientCertificate(r); cert != nil {
+		attrs = append(attrs, slog.String("client_cn", cert.Subject.CommonName))
+	}
+	slog.LogAttrs(r.Context(), level, msg, attrs...)
+}
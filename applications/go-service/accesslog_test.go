@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+func TestLogAccess(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(newLogger(&buf, LogFormatJSON, slog.LevelInfo, Config{ServiceName: "go-service"}))
+
+	tests := []struct {
+		name      string
+		rate      float64
+		roll      float64
+		code      int
+		wantLevel string
+	}{
+		{"logged when sampled", 0.5, 0.25, 200, "INFO"},
+		{"skipped when not sampled", 0.5, 0.75, 404, ""},
+		{"all logged at rate 1", 1, 0.99, 201, "INFO"},
+		{"errors logged at rate 0", 0, 0.5, 503, "ERROR"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		s := &Server{config: Config{AccessLog: AccessLogConfig{SampleRate: tt.rate}}}
+		req := httptest.NewRequest("GET", "/api/v1/transactions/42?q=secret", nil)
+		req.Header.Set("User-Agent", "k6/0.49")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		s.logAccess(req, "/api/v1/transactions/{id}", httpsnoop.Metrics{Code: tt.code, Written: 128, Duration: 250 * time.Millisecond}, tt.roll)
+
+		if tt.wantLevel == "" {
+			if buf.Len() != 0 {
+				t.Errorf("%s: logged %s", tt.name, buf.String())
+			}
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("%s: %q: %v", tt.name, buf.String(), err)
+		}
+		want := map[string]any{
+			"level":         tt.wantLevel,
+			"method":        "GET",
+			"path":          "/api/v1/transactions/42",
+			"route":         "/api/v1/transactions/{id}",
+			"status":        float64(tt.code),
+			"bytes":         float64(128),
+			"duration":      0.25,
+			"remote_addr":   "192.0.2.1:1234",
+			"user_agent":    "k6/0.49",
+			"forwarded_for": "203.0.113.7",
+		}
+		for key, value := range want {
+			if record[key] != value {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, record[key], value)
+			}
+		}
+	}
+}
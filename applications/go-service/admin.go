@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// registerOperational adds the probes and, unless it is turned off, the
+// Prometheus scrape endpoint to mux
+func (s *Server) registerOperational(mux *http.ServeMux) {
+	handle(mux, "/health", s.healthHandler)
+	handle(mux, "GET /ready", s.readyHandler)
+	if s.config.MetricExporters.Prometheus {
+		handle(mux, "/metrics", s.metricsHandler().ServeHTTP)
+	}
+}
+
+// adminHandler serves the operational endpoints on ADMIN_PORT, away from the
+// API so the ingress never exposes them and probes and scrapes don't queue
+// behind API traffic or share its timeouts. Besides registerOperational's
+// routes it has the runtime diagnostics:
+//
+//   - /debug/pprof/ profiles, such as /debug/pprof/profile?seconds=30 for CPU
+//     and /debug/pprof/heap
+//   - /debug/vars, the expvar variables, including memstats and cmdline
+//   - POST /debug/gc, running a collection and returning freed memory to the
+//     OS, to tell a leak from garbage not yet collected
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerOperational(mux)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("POST /debug/gc", gcHandler)
+	return mux
+}
+
+// GCResponse is the heap before and after a forced collection, in bytes
+type GCResponse struct {
+	HeapAllocBefore uint64  `json:"heap_alloc_before"`
+	HeapAllocAfter  uint64  `json:"heap_alloc_after"`
+	HeapSysAfter    uint64  `json:"heap_sys_after"`
+	HeapReleased    uint64  `json:"heap_released"`
+	Duration        float64 `json:"duration_seconds"`
+}
+
+func gcHandler(w http.ResponseWriter, r *http.Request) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	// FreeOSMemory runs a collection itself before returning memory
+	debug.FreeOSMemory()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	slog.InfoContext(r.Context(), "garbage collection forced", "heap_alloc_before", before.HeapAlloc,
+		"heap_alloc_after", after.HeapAlloc, "duration", elapsed)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(GCResponse{
+		HeapAllocBefore: before.HeapAlloc,
+		HeapAllocAfter:  after.HeapAlloc,
+		HeapSysAfter:    after.HeapSys,
+		HeapReleased:    after.HeapReleased,
+		Duration:        elapsed.Seconds(),
+	})
+}
+
+// newAdminServer listens on port for adminHandler. The write timeout leaves
+// room for a five minute CPU profile or execution trace, which pprof
+// refuses when it would run past it.
+func (s *Server) newAdminServer(port string) *http.Server {
+	return &http.Server{
+		Addr:         ":" + port,
+		Handler:      s.adminHandler(),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 5*time.Minute + 15*time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
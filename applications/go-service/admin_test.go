@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	s := newMemoryServer()
+	s.config.MetricExporters = MetricExporters{Prometheus: true}
+	handler := s.adminHandler()
+
+	tests := []struct {
+		method, path string
+		status       int
+		contains     string
+	}{
+		{"GET", "/debug/pprof/", http.StatusOK, "goroutine"},
+		{"GET", "/debug/pprof/heap?debug=1", http.StatusOK, "heap profile"},
+		{"GET", "/debug/pprof/cmdline", http.StatusOK, ""},
+		{"GET", "/debug/vars", http.StatusOK, `"memstats"`},
+		{"GET", "/debug/vars", http.StatusOK, `"transactions_processed"`},
+		{"GET", "/debug/gc", http.StatusMethodNotAllowed, ""},
+		{"GET", "/health", http.StatusOK, `"healthy"`},
+		{"GET", "/metrics", http.StatusOK, "go_goroutines"},
+		{"GET", "/api/v1/stats", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+		if !strings.Contains(rec.Body.String(), tt.contains) {
+			t.Errorf("%s %s: body doesn't contain %q", tt.method, tt.path, tt.contains)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/debug/gc", nil))
+	var gc GCResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &gc); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("POST /debug/gc: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if gc.HeapAllocBefore == 0 || gc.HeapAllocAfter == 0 || gc.HeapSysAfter < gc.HeapAllocAfter {
+		t.Errorf("POST /debug/gc = %+v, want the heap before and after", gc)
+	}
+
+	// With the scrape endpoint turned off it isn't served here either
+	s.config.MetricExporters = MetricExporters{}
+	rec = httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/metrics with OTEL_METRICS_EXPORTER=none: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyPrefix starts every key, so a leaked one is easy to recognize
+const apiKeyPrefix = "gsk_"
+
+// APIKey identifies one client. The key itself is never stored, only its
+// hash, so it can't be listed again after it is minted.
+type APIKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+	RevokedAt  *string  `json:"revoked_at,omitempty"`
+}
+
+type APIKeyListResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreateAPIKeyResponse is the only response that includes the key
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+var errAPIKeyNotFound = errors.New("API key not found")
+
+// generateAPIKey returns a new key and the prefix shown for it in listings
+func generateAPIKey() (key, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+// hashAPIKey is what api_keys stores for key. The keys are 256 random bits,
+// so a plain SHA-256 can't be brute-forced and a slow password hash isn't
+// needed; it also lets a key be found by its hash.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes checks and de-duplicates the scopes a key is granted,
+// keeping their order
+func normalizeScopes(scopes []string) ([]string, error) {
+	normalized := make([]string, 0, len(scopes))
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if _, ok := scopeRank[scope]; !ok {
+			return nil, fmt.Errorf("unknown scope %q: use %s, %s, or %s", scope, scopeReader, scopeWriter, scopeAdmin)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+const apiKeyColumns = `id, name, prefix, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var (
+		key                 APIKey
+		id                  uuid.UUID
+		createdAt           time.Time
+		lastUsed, revokedAt *time.Time
+	)
+	if err := row.Scan(&id, &key.Name, &key.Prefix, &key.Scopes, &createdAt, &lastUsed, &revokedAt); err != nil {
+		return APIKey{}, err
+	}
+	key.ID = id.String()
+	key.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	key.LastUsedAt = optionalRFC3339(lastUsed)
+	key.RevokedAt = optionalRFC3339(revokedAt)
+	return key, nil
+}
+
+func optionalRFC3339(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.UTC().Format(time.RFC3339)
+	return &formatted
+}
+
+// createAPIKey mints a key for name and stores its hash
+func createAPIKey(ctx context.Context, q querier, name string, scopes []string) (CreateAPIKeyResponse, error) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		return CreateAPIKeyResponse{}, fmt.Errorf("generate API key: %w", err)
+	}
+	created, err := scanAPIKey(q.QueryRow(ctx, `
+		INSERT INTO api_keys (id, name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+apiKeyColumns,
+		uuid.New(), name, prefix, hashAPIKey(key), scopes,
+	))
+	if err != nil {
+		return CreateAPIKeyResponse{}, fmt.Errorf("insert API key: %w", err)
+	}
+	return CreateAPIKeyResponse{APIKey: created, Key: key}, nil
+}
+
+// apiKeyTouchInterval is how stale last_used_at gets before a request
+// updates it, so a busy client doesn't write to the row on every request
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyAuth checks X-API-Key against the api_keys table
+type apiKeyAuth struct {
+	// find returns the unrevoked key with the hash, or errAPIKeyNotFound
+	find func(ctx context.Context, hash string) (APIKey, error)
+}
+
+func newAPIKeyAuth(q querier, timeout time.Duration) *apiKeyAuth {
+	return &apiKeyAuth{find: func(ctx context.Context, hash string) (APIKey, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return findAPIKey(ctx, q, hash)
+	}}
+}
+
+// findAPIKey looks up an unrevoked key by its hash, recording that it was
+// used
+func findAPIKey(ctx context.Context, q querier, hash string) (APIKey, error) {
+	key, err := scanAPIKey(q.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, errAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("query API key: %w", err)
+	}
+	if olderThan(key.LastUsedAt, apiKeyTouchInterval) {
+		if _, err := q.Exec(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE key_hash = $1`, hash); err != nil {
+			slog.WarnContext(ctx, "failed to record API key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return key, nil
+}
+
+// olderThan reports whether the RFC3339 time at is unset or older than age
+func olderThan(at *string, age time.Duration) bool {
+	if at == nil {
+		return true
+	}
+	parsed, err := time.Parse(time.RFC3339, *at)
+	return err != nil || time.Since(parsed) >= age
+}
+
+// authenticate lets a request through to next only with a valid API key,
+// putting the key's ID and scopes in the request context as the claims a
+// bearer token would have. Anything else is answered 401.
+func (a *apiKeyAuth) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := strings.TrimSpace(r.Header.Get(apiKeyHeader))
+		if raw == "" {
+			http.Error(w, "Missing API key", http.StatusUnauthorized)
+			return
+		}
+		key, err := a.find(r.Context(), hashAPIKey(raw))
+		if errors.Is(err, errAPIKeyNotFound) {
+			slog.InfoContext(r.Context(), "rejected API key", "prefix", keyPrefix(raw))
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			reportError(r.Context(), err)
+			http.Error(w, "Failed to check API key", http.StatusInternalServerError)
+			return
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("enduser.id", key.ID),
+			attribute.String("api_key.name", key.Name),
+		)
+		claims := &Claims{Scope: strings.Join(key.Scopes, " ")}
+		claims.Subject = key.ID
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	}
+}
+
+// keyPrefix is as much of an unrecognized key as is safe to log
+func keyPrefix(raw string) string {
+	if len(raw) > len(apiKeyPrefix)+8 {
+		return raw[:len(apiKeyPrefix)+8]
+	}
+	return ""
+}
+
+func (s *Server) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	created, err := createAPIKey(ctx, s.db, name, scopes)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "minted API key", "api_key_id", created.ID, "name", created.Name, "scopes", created.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := APIKeyListResponse{APIKeys: []APIKey{}}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			http.Error(w, "Failed to read API keys", http.StatusInternalServerError)
+			return
+		}
+		response.APIKeys = append(response.APIKeys, key)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// revokeAPIKeyHandler stops a key from authenticating. The row is kept, so
+// the key still shows in listings with when it was revoked.
+func (s *Server) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	key, err := scanAPIKey(s.db.QueryRow(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+		RETURNING `+apiKeyColumns,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "revoked API key", "api_key_id", key.ID, "name", key.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(key)
+}
+
+const apiKeyUsage = `usage: go-service api-key create -name NAME [-scopes SCOPE,...]
+
+Mints an API key and prints it, for creating the first admin key before
+any client can call the admin API.
+`
+
+// runAPIKeyCommand implements `go-service api-key`. It returns the process
+// exit code.
+func runAPIKeyCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprint(stderr, apiKeyUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("api-key create", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "client the key is for")
+	scopeList := flags.String("scopes", "", "comma-separated scopes to grant")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || strings.TrimSpace(*name) == "" {
+		fmt.Fprint(stderr, apiKeyUsage)
+		return 2
+	}
+	var scopes []string
+	if *scopeList != "" {
+		scopes = strings.Split(*scopeList, ",")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n\n%s", err, apiKeyUsage)
+		return 2
+	}
+
+	config := loadConfig()
+	ctx := context.Background()
+	pool, err := initDatabase(ctx, config, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to connect to Postgres: %v\n", err)
+		return 1
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeouts.Write)
+	defer cancel()
+	created, err := createAPIKey(ctx, pool, strings.TrimSpace(*name), scopes)
+	if err != nil {
+		fmt.Fprintf(stderr, "api-key create: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\t%s\n", created.ID, created.Key)
+	return 0
+}
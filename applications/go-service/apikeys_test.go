@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) != len(apiKeyPrefix)+43 {
+		t.Errorf("key = %q, want %s and 32 random bytes", key, apiKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != len(apiKeyPrefix)+8 {
+		t.Errorf("prefix = %q, want the key's first characters", prefix)
+	}
+	other, _, _ := generateAPIKey()
+	if other == key || hashAPIKey(other) == hashAPIKey(key) {
+		t.Error("two keys minted alike")
+	}
+	if len(hashAPIKey(key)) != 64 {
+		t.Errorf("hash = %q, want a hex SHA-256", hashAPIKey(key))
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   []string
+	}{
+		{nil, []string{}},
+		{[]string{"reader"}, []string{"reader"}},
+		{[]string{" Writer ", "reader", "writer"}, []string{"writer", "reader"}},
+		{[]string{"ADMIN"}, []string{"admin"}},
+		{[]string{""}, nil},
+		{[]string{"reader writer"}, nil},
+		{[]string{"transactions:write"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := normalizeScopes(tt.scopes)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("normalizeScopes(%q) = %q, want an error", tt.scopes, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeScopes(%q) = %q, %v, want %q", tt.scopes, got, err, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key, _, _ := generateAPIKey()
+	s := &Server{auth: issuer.auth(), apiKeys: &apiKeyAuth{find: func(ctx context.Context, hash string) (APIKey, error) {
+		switch {
+		case hash == hashAPIKey(key):
+			return APIKey{ID: "4f7c", Name: "demo", Scopes: []string{"reader", "writer"}}, nil
+		case hash == hashAPIKey("gsk_database_down"):
+			return APIKey{}, errors.New("connection refused")
+		}
+		return APIKey{}, errAPIKeyNotFound
+	}}}
+	var seen *Claims
+	handler := s.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		seen = claimsFromContext(r.Context())
+	})
+
+	tests := []struct {
+		name, header, value string
+		status              int
+		subject, scope      string
+	}{
+		{"key", apiKeyHeader, key, http.StatusOK, "4f7c", "reader writer"},
+		{"token", "Authorization", "Bearer " + issuer.sign(t, "k1", validClaims("admin")), http.StatusOK, "client-42", "admin"},
+		{"unknown key", apiKeyHeader, "gsk_revoked", http.StatusUnauthorized, "", ""},
+		{"lookup fails", apiKeyHeader, "gsk_database_down", http.StatusInternalServerError, "", ""},
+		{"neither", "", "", http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		seen = nil
+		req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if tt.subject == "" && seen != nil {
+			t.Errorf("%s: handler ran with %+v", tt.name, seen)
+		}
+		if tt.subject != "" && (seen == nil || seen.Subject != tt.subject || seen.Scope != tt.scope) {
+			t.Errorf("%s: claims = %+v, want subject %s and scope %q", tt.name, seen, tt.subject, tt.scope)
+		}
+	}
+}
+
+func TestRunAPIKeyCommandUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"revoke"}, {"create"}, {"create", "-name", " "}, {"create", "-name", "demo", "-scopes", "read write"}} {
+		var stdout, stderr bytes.Buffer
+		if code := runAPIKeyCommand(args, &stdout, &stderr); code != 2 {
+			t.Errorf("runAPIKeyCommand(%q) = %d, want 2", args, code)
+		}
+		if !strings.Contains(stderr.String(), "usage: go-service api-key") {
+			t.Errorf("runAPIKeyCommand(%q) printed no usage", args)
+		}
+	}
+}
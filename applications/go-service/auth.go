@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AuthConfig turns on bearer token authentication for the API routes when
+// JWKSURL is set. Tokens must be signed by a key the JWKS publishes and,
+// when Issuer and Audience are set, carry them in iss and aud. APIKeys
+// accepts keys from the api_keys table in X-API-Key as well, or instead when
+// JWKSURL isn't set.
+type AuthConfig struct {
+	JWKSURL  string
+	Issuer   string
+	Audience string
+	// JWKSRefreshInterval is how often the keys are fetched again, so a
+	// rotated key is picked up
+	JWKSRefreshInterval time.Duration
+	APIKeys             bool
+}
+
+func loadAuthConfig() AuthConfig {
+	cfg := AuthConfig{
+		JWKSURL:             os.Getenv("AUTH_JWKS_URL"),
+		Issuer:              os.Getenv("AUTH_ISSUER"),
+		Audience:            os.Getenv("AUTH_AUDIENCE"),
+		JWKSRefreshInterval: time.Hour,
+	}
+	if val := os.Getenv("AUTH_JWKS_REFRESH_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.JWKSRefreshInterval = parsed
+		}
+	}
+	if val := os.Getenv("AUTH_API_KEYS"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			cfg.APIKeys = parsed
+		}
+	}
+	return cfg
+}
+
+// Claims are what the API reads from a caller's token
+type Claims struct {
+	jwt.RegisteredClaims
+	// Scope is the space-separated list of scopes granted, as in RFC 8693
+	Scope string `json:"scope,omitempty"`
+}
+
+type claimsKey struct{}
+
+// claimsFromContext returns the claims of the token the request was
+// authenticated with, or nil when it wasn't
+func claimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	return claims
+}
+
+// jwtAuth checks bearer tokens against the keys in a JWKS
+type jwtAuth struct {
+	keys   *jwks
+	parser *jwt.Parser
+}
+
+// signingMethods are the asymmetric algorithms accepted. HMAC and "none"
+// are refused, so a token can't be signed with the public key as a secret.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+func newJWTAuth(cfg AuthConfig) *jwtAuth {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		// Allows for clock skew between the issuer and this pod
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &jwtAuth{keys: newJWKS(cfg.JWKSURL), parser: jwt.NewParser(opts...)}
+}
+
+// authenticate lets a request through to next only with a valid bearer
+// token, putting its claims in the request context and the subject on the
+// request's span. Anything else is answered 401 with a WWW-Authenticate
+// challenge saying what was wrong.
+func (a *jwtAuth) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		claims := &Claims{}
+		if _, err := a.parser.ParseWithClaims(raw, claims, a.keys.keyfunc); err != nil {
+			slog.InfoContext(r.Context(), "rejected bearer token", "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		if claims.Subject != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", claims.Subject))
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// authenticate lets a request through with whichever credentials are
+// turned on: an API key when it sends X-API-Key, a bearer token otherwise
+func (s *Server) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	var withToken, withKey http.HandlerFunc
+	if s.auth != nil {
+		withToken = s.auth.authenticate(next)
+	}
+	if s.apiKeys != nil {
+		withKey = s.apiKeys.authenticate(next)
+	}
+	switch {
+	case withKey == nil:
+		return withToken
+	case withToken == nil:
+		return withKey
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeader) != "" {
+			withKey(w, r)
+			return
+		}
+		if _, ok := bearerToken(r); !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "Missing bearer token or API key", http.StatusUnauthorized)
+			return
+		}
+		withToken(w, r)
+	}
+}
+
+// requireAuth puts every route behind authenticate, and lets through only
+// callers granted the route's scope
+func requireAuth(routes []apiRoute, authenticate func(http.HandlerFunc) http.HandlerFunc) {
+	for i := range routes {
+		routes[i].Handler = authenticate(requireScope(routes[i].scope(), routes[i].Handler))
+	}
+}
+
+// The roles a token's scope or an API key's scopes grant. Each includes the
+// ones before it: writers can read, and admins can do anything.
+const (
+	scopeReader = "reader"
+	scopeWriter = "writer"
+	scopeAdmin  = "admin"
+)
+
+var scopeRank = map[string]int{scopeReader: 1, scopeWriter: 2, scopeAdmin: 3}
+
+// hasScope reports whether the claims grant scope, directly or through a
+// role that includes it. Scopes other than the three roles are ignored.
+func (c *Claims) hasScope(scope string) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if scopeRank[granted] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope answers 403 to an authenticated caller that wasn't granted
+// scope
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if claims := claimsFromContext(r.Context()); claims == nil || !claims.hasScope(scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			http.Error(w, "Requires the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// jwksMinRefresh limits how often a token with a key ID the set doesn't have
+// makes it fetch again, so made-up key IDs can't hammer the issuer
+const jwksMinRefresh = time.Minute
+
+// jwks holds the public keys published at url, by key ID
+type jwks struct {
+	url    string
+	client *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]any
+	fetched time.Time
+	// refreshing serializes fetches
+	refreshing sync.Mutex
+}
+
+func newJWKS(url string) *jwks {
+	return &jwks{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// keyfunc finds the key a token names in its kid header. A key ID it
+// doesn't know, as after the issuer rotates keys, fetches the set again.
+func (k *jwks) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	if k.stale(jwksMinRefresh) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := k.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := k.lookup(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key %q in the JWKS", kid)
+}
+
+func (k *jwks) lookup(kid string) (any, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *jwks) stale(age time.Duration) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return time.Since(k.fetched) >= age
+}
+
+// refresh replaces the keys with what url publishes now. On failure the
+// keys already held are kept.
+func (k *jwks) refresh(ctx context.Context) error {
+	k.refreshing.Lock()
+	defer k.refreshing.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	keys, err := parseJWKS(body)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.fetched = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// runJWKSRefresh fetches the keys at startup and every
+// Auth.JWKSRefreshInterval
+func (s *Server) runJWKSRefresh(ctx context.Context) {
+	runEvery(ctx, s.config.Auth.JWKSRefreshInterval, func(ctx context.Context) {
+		if err := s.auth.keys.refresh(ctx); err != nil {
+			slog.ErrorContext(ctx, "JWKS refresh failed", "error", err)
+		}
+	})
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the RSA and EC signing keys in a JWK Set (RFC 7517).
+// Encryption keys and key types it doesn't handle are skipped.
+func parseJWKS(body []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("parse JWKS: no signing keys")
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64URLInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64URLInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errUnsupportedKey
+		}
+		x, err := base64URLInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64URLInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errUnsupportedKey
+}
+
+func base64URLInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer signs tokens with an RSA key it publishes in a JWKS
+type testIssuer struct {
+	key     *rsa.PrivateKey
+	server  *httptest.Server
+	fetches atomic.Int64
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, kid string, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (i *testIssuer) auth() *jwtAuth {
+	return newJWTAuth(AuthConfig{JWKSURL: i.server.URL, Issuer: "https://auth.example.com", Audience: "go-service"})
+}
+
+func validClaims(scope string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://auth.example.com",
+			Subject:   "client-42",
+			Audience:  jwt.ClaimStrings{"go-service"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Scope: scope,
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth := issuer.auth()
+	var seen *Claims
+	handler := auth.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		seen = claimsFromContext(r.Context())
+	})
+
+	expired := validClaims("")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongIssuer := validClaims("")
+	wrongIssuer.Issuer = "https://evil.example.com"
+	wrongAudience := validClaims("")
+	wrongAudience.Audience = jwt.ClaimStrings{"python-service"}
+	noExpiry := validClaims("")
+	noExpiry.ExpiresAt = nil
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims("")).SignedString(issuer.key.N.Bytes())
+
+	tests := []struct {
+		name, header string
+		status       int
+	}{
+		{"valid", "Bearer " + issuer.sign(t, "k1", validClaims("transactions:write")), http.StatusOK},
+		{"lowercase scheme", "bearer " + issuer.sign(t, "k1", validClaims("")), http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"basic", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"malformed", "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"expired", "Bearer " + issuer.sign(t, "k1", expired), http.StatusUnauthorized},
+		{"wrong issuer", "Bearer " + issuer.sign(t, "k1", wrongIssuer), http.StatusUnauthorized},
+		{"wrong audience", "Bearer " + issuer.sign(t, "k1", wrongAudience), http.StatusUnauthorized},
+		{"no expiry", "Bearer " + issuer.sign(t, "k1", noExpiry), http.StatusUnauthorized},
+		{"unknown key", "Bearer " + issuer.sign(t, "k2", validClaims("")), http.StatusUnauthorized},
+		{"hmac", "Bearer " + hmac, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		seen = nil
+		req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && (seen == nil || seen.Subject != "client-42") {
+			t.Errorf("%s: claims in context = %+v", tt.name, seen)
+		}
+		if tt.status == http.StatusUnauthorized && (seen != nil || rec.Header().Get("WWW-Authenticate") == "") {
+			t.Errorf("%s: handler ran or no challenge", tt.name)
+		}
+	}
+	if seen := issuer.fetches.Load(); seen != 1 {
+		t.Errorf("fetched the JWKS %d times, want once: an unknown key ID refetches at most every %v", seen, jwksMinRefresh)
+	}
+}
+
+func TestAPIRoutesRequireAuth(t *testing.T) {
+	issuer := newTestIssuer(t)
+	s := newMemoryServer()
+	s.auth = issuer.auth()
+	mux := http.NewServeMux()
+	s.registerOperational(mux)
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+	token := func(scope string) string { return "Bearer " + issuer.sign(t, "k1", validClaims(scope)) }
+
+	tests := []struct {
+		method, path, scope string
+		status              int
+	}{
+		{"GET", "/health", "", http.StatusOK},
+		{"GET", "/api/v1/stats", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/transactions", "", http.StatusUnauthorized},
+		{"GET", "/api/v2/transactions/6f1c2a4e-8b0d-4c3e-9f7a-1b2c3d4e5f60", "", http.StatusUnauthorized},
+		{"GET", "/api/v1/stats", "reader", http.StatusOK},
+		{"GET", "/api/v1/transactions", "reader", http.StatusOK},
+		{"GET", "/api/v1/stats", "transactions:read", http.StatusForbidden},
+		{"GET", "/api/v1/stats", "writer", http.StatusOK},
+		{"POST", "/api/v2/transactions", "reader", http.StatusForbidden},
+		{"POST", "/api/v2/transactions", "writer", http.StatusBadRequest},
+		{"POST", "/api/v1/process-transaction", "reader", http.StatusForbidden},
+		{"POST", "/api/v1/admin/discount-codes", "writer", http.StatusForbidden},
+		{"POST", "/api/v1/admin/discount-codes", "reader admin", http.StatusServiceUnavailable},
+		{"GET", "/api/v1/admin/settings", "admin", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.scope != "" {
+			req.Header.Set("Authorization", token(tt.scope))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s, scope %q: status %d, want %d", tt.method, tt.path, tt.scope, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusForbidden && !strings.Contains(rec.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+			t.Errorf("%s %s, scope %q: challenge %q", tt.method, tt.path, tt.scope, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestRouteScopes(t *testing.T) {
+	tests := []struct {
+		route apiRoute
+		want  string
+	}{
+		{apiRoute{Method: "GET", Path: "/transactions"}, scopeReader},
+		{apiRoute{Method: "POST", Path: "/transactions/{id}/refund"}, scopeWriter},
+		{apiRoute{Path: "/process-transaction"}, scopeWriter},
+		{apiRoute{Path: "/stats", Scope: scopeReader}, scopeReader},
+		{apiRoute{Method: "GET", Path: "/admin/settings"}, scopeAdmin},
+		{apiRoute{Method: "PUT", Path: "/admin/settings/{key}"}, scopeAdmin},
+	}
+	for _, tt := range tests {
+		if got := tt.route.scope(); got != tt.want {
+			t.Errorf("%s %s needs %q, want %q", tt.route.Method, tt.route.Path, got, tt.want)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	body, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": enc(ec.X.Bytes()), "y": enc(ec.Y.Bytes())},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+	}})
+	keys, err := parseJWKS(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("keys = %v, want only the EC signing key", keys)
+	}
+	if got, ok := keys["ec"].(*ecdsa.PublicKey); !ok || !got.Equal(&ec.PublicKey) {
+		t.Errorf("ec key = %v", keys["ec"])
+	}
+
+	offCurve, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "EC", "kid": "bad", "crv": "P-256", "x": enc([]byte{1}), "y": enc([]byte{2})},
+	}})
+	for _, bad := range [][]byte{[]byte(`{"keys":[]}`), []byte(`not json`), offCurve} {
+		if _, err := parseJWKS(bad); err == nil {
+			t.Errorf("parseJWKS(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestJWKSKeepsKeysWhenRefreshFails(t *testing.T) {
+	issuer := newTestIssuer(t)
+	keys := newJWKS(issuer.server.URL)
+	if err := keys.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	issuer.server.Close()
+	if err := keys.refresh(context.Background()); err == nil {
+		t.Fatal("refresh from a closed server succeeded")
+	}
+	if _, ok := keys.lookup("k1"); !ok {
+		t.Error("failed refresh dropped the keys already fetched")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// startWorker runs fn in a goroutine tracked by the server so shutdown can
+// wait for background work to finish before the database pool is closed.
+func (s *Server) startWorker(ctx context.Context, name string, fn func(context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		slog.Info("starting background worker", "worker", name)
+		fn(ctx)
+		slog.Info("background worker stopped", "worker", name)
+	}()
+}
+
+// runEvery calls fn immediately and then once per interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const maxBatchSize = 100
+
+// BatchResult reports the outcome of one entry in a batch submission, in the
+// same position as the request that produced it.
+type BatchResult struct {
+	Index       int                  `json:"index"`
+	Status      int                  `json:"status"`
+	Transaction *TransactionResponse `json:"transaction,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Violations  []Violation          `json:"violations,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// processTransactionsHandler accepts an array of transactions. By default each
+// entry is committed independently and failures are reported per entry;
+// ?mode=atomic commits all of them in a single database transaction or none.
+func (s *Server) processTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "independent"
+	}
+	if mode != "independent" && mode != "atomic" {
+		http.Error(w, "mode must be independent or atomic", http.StatusBadRequest)
+		return
+	}
+
+	var reqs []TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		writeValidationError(w, http.StatusBadRequest, "Invalid request body", decodeViolations(err))
+		return
+	}
+
+	if len(reqs) == 0 {
+		http.Error(w, "Batch must contain at least one transaction", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Batch must not exceed %d transactions", maxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Budget the same per-transaction timeout the single endpoint uses
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(len(reqs))*s.config.Timeouts.Write)
+	defer cancel()
+
+	var (
+		response BatchResponse
+		status   = http.StatusOK
+	)
+	if mode == "atomic" {
+		response, status = s.processBatchAtomic(ctx, reqs, start)
+	} else {
+		response = s.processBatchIndependent(ctx, reqs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) processBatchIndependent(ctx context.Context, reqs []TransactionRequest) BatchResponse {
+	response := BatchResponse{Mode: "independent", Results: make([]BatchResult, 0, len(reqs))}
+
+	for i, req := range reqs {
+		itemStart := time.Now()
+		transaction, err := s.store.ProcessTransaction(ctx, req, itemStart)
+		if err != nil {
+			status, message := errorStatus(err)
+			if status >= http.StatusInternalServerError {
+				reportError(ctx, err)
+			}
+			response.Results = append(response.Results, BatchResult{Index: i, Status: status, Error: message, Violations: errorViolations(err)})
+			response.Failed++
+			continue
+		}
+
+		transaction.ProcessingTime = fmt.Sprintf("%.2f", time.Since(itemStart).Seconds()*1000)
+		response.Results = append(response.Results, BatchResult{Index: i, Status: http.StatusOK, Transaction: &transaction})
+		response.Succeeded++
+	}
+
+	return response
+}
+
+// processBatchAtomic stops at the first failing entry and rolls everything
+// back, returning that entry's status for the whole request.
+func (s *Server) processBatchAtomic(ctx context.Context, reqs []TransactionRequest, start time.Time) (BatchResponse, int) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return failedBatch(ctx, len(reqs), 0, serverError("Failed to start transaction", err))
+	}
+	defer tx.Rollback(ctx)
+
+	response, status := persistBatch(ctx, reqs, func(req TransactionRequest) (TransactionResponse, error) {
+		return s.persistTransaction(ctx, tx, req, start)
+	}, func() error {
+		return tx.Commit(ctx)
+	})
+	if status != http.StatusOK {
+		return response, status
+	}
+
+	elapsed := fmt.Sprintf("%.2f", time.Since(start).Seconds()*1000)
+	for i := range response.Results {
+		s.recordCommitted(*response.Results[i].Transaction)
+		response.Results[i].Transaction.ProcessingTime = elapsed
+	}
+	return response, http.StatusOK
+}
+
+// persistBatch persists each entry in turn and commits them together. At the
+// first failure it stops, leaving the caller to roll back what was persisted.
+func persistBatch(ctx context.Context, reqs []TransactionRequest, persist func(TransactionRequest) (TransactionResponse, error), commit func() error) (BatchResponse, int) {
+	response := BatchResponse{Mode: "atomic", Results: make([]BatchResult, 0, len(reqs))}
+	for i, req := range reqs {
+		transaction, err := persist(req)
+		if err != nil {
+			return failedBatch(ctx, len(reqs), i, err)
+		}
+		response.Results = append(response.Results, BatchResult{Index: i, Status: http.StatusOK, Transaction: &transaction})
+	}
+
+	if err := commit(); err != nil {
+		return failedBatch(ctx, len(reqs), len(reqs)-1, serverError("Failed to commit transaction", err))
+	}
+	response.Succeeded = len(reqs)
+	return response, http.StatusOK
+}
+
+// failedBatch reports an atomic batch of size entries that was rolled back
+// because the one at index failed with err
+func failedBatch(ctx context.Context, size, index int, err error) (BatchResponse, int) {
+	status, message := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		reportError(ctx, err)
+	}
+	return BatchResponse{
+		Mode:    "atomic",
+		Failed:  size,
+		Results: []BatchResult{{Index: index, Status: status, Error: message, Violations: errorViolations(err)}},
+	}, status
+}
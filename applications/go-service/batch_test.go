@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestProcessBatchIndependent(t *testing.T) {
+	s := newMemoryServer()
+	reqs := []TransactionRequest{
+		{Items: []Item{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 1}}},
+		{Items: []Item{{ID: "p2", Name: "Gadget", Price: 500, Quantity: 0}}},
+		{Items: []Item{{ID: "p3", Name: "Gizmo", Price: 250, Quantity: 2}}},
+	}
+
+	response := s.processBatchIndependent(context.Background(), reqs)
+	if response.Mode != "independent" || response.Succeeded != 2 || response.Failed != 1 || len(response.Results) != len(reqs) {
+		t.Fatalf("response = %+v, want 2 of 3 succeeded with a result each", response)
+	}
+	for i, result := range response.Results {
+		if result.Index != i {
+			t.Errorf("result %d has index %d", i, result.Index)
+		}
+	}
+	if ok := response.Results[0]; ok.Status != http.StatusOK || ok.Transaction == nil || ok.Transaction.Subtotal != 1000 {
+		t.Errorf("result 0 = %+v, want the created transaction", ok)
+	}
+	if failed := response.Results[1]; failed.Status != http.StatusUnprocessableEntity || failed.Transaction != nil || len(failed.Violations) == 0 {
+		t.Errorf("result 1 = %+v, want a 422 with violations", failed)
+	}
+	if ok := response.Results[2]; ok.Status != http.StatusOK || ok.Transaction == nil || ok.Transaction.Subtotal != 500 {
+		t.Errorf("result 2 = %+v, want the created transaction", ok)
+	}
+}
+
+func TestPersistBatch(t *testing.T) {
+	reqs := make([]TransactionRequest, 4)
+	errCommit := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		failAt    int
+		commitErr error
+		status    int
+		index     int
+		persisted int
+		committed bool
+	}{
+		{"all persisted", -1, nil, http.StatusOK, 0, 4, true},
+		{"entry fails", 2, nil, http.StatusUnprocessableEntity, 2, 3, false},
+		{"first entry fails", 0, nil, http.StatusUnprocessableEntity, 0, 1, false},
+		{"commit fails", -1, errCommit, http.StatusInternalServerError, len(reqs) - 1, 4, true},
+	}
+	for _, tt := range tests {
+		persisted, committed := 0, false
+		response, status := persistBatch(context.Background(), reqs, func(req TransactionRequest) (TransactionResponse, error) {
+			persisted++
+			if persisted-1 == tt.failAt {
+				return TransactionResponse{}, validationError("Transaction failed validation", []Violation{{Field: "items", Rule: "required"}})
+			}
+			return TransactionResponse{Status: string(StatusCompleted)}, nil
+		}, func() error {
+			committed = true
+			return tt.commitErr
+		})
+
+		if status != tt.status || persisted != tt.persisted || committed != tt.committed {
+			t.Errorf("%s: status %d after %d persisted, committed %v; want %d, %d, %v", tt.name, status, persisted, committed, tt.status, tt.persisted, tt.committed)
+		}
+		if response.Mode != "atomic" {
+			t.Errorf("%s: mode %q", tt.name, response.Mode)
+		}
+		if tt.status == http.StatusOK {
+			if response.Succeeded != len(reqs) || response.Failed != 0 || len(response.Results) != len(reqs) {
+				t.Errorf("%s: response = %+v, want every entry succeeded", tt.name, response)
+			}
+			continue
+		}
+		// Everything was rolled back, so only the failing entry is reported
+		if response.Succeeded != 0 || response.Failed != len(reqs) || len(response.Results) != 1 {
+			t.Errorf("%s: succeeded %d, failed %d, %d results; want 0, %d, 1", tt.name, response.Succeeded, response.Failed, len(response.Results), len(reqs))
+			continue
+		}
+		if result := response.Results[0]; result.Index != tt.index || result.Status != tt.status || result.Transaction != nil {
+			t.Errorf("%s: result = %+v, want index %d with status %d", tt.name, result, tt.index, tt.status)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig lets browsers on AllowedOrigins call the API cross-origin, as
+// the React frontend does when it isn't served through the gateway. No
+// origins, the default, leaves CORS off.
+type CORSConfig struct {
+	// AllowedOrigins are scheme://host[:port] origins, or "*" for any
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge is how long a browser may cache a preflight's answer
+	MaxAge time.Duration
+}
+
+func loadCORSConfig() CORSConfig {
+	cfg := CORSConfig{
+		AllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", apiKeyHeader, idempotencyKeyHeader, requestIDHeader},
+		MaxAge:         10 * time.Minute,
+	}
+	if val := splitList(os.Getenv("CORS_ALLOWED_METHODS")); len(val) > 0 {
+		cfg.AllowedMethods = val
+	}
+	if val := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(val) > 0 {
+		cfg.AllowedHeaders = val
+	}
+	if val := os.Getenv("CORS_MAX_AGE"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed >= 0 {
+			cfg.MaxAge = parsed
+		}
+	}
+	return cfg
+}
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// corsExposedHeaders are the response headers scripts may read: the
+// correlation IDs to quote in a bug report, the deprecation headers, and
+// how long to back off when rate limited
+var corsExposedHeaders = strings.Join([]string{requestIDHeader, "X-Trace-Id", "Deprecation", "Sunset", "Link", "Retry-After"}, ", ")
+
+// cors answers preflight requests from allowed origins itself, before they
+// reach authentication or a route that only matches other methods, and adds
+// the CORS headers to their actual requests. Requests from other origins
+// get no CORS headers, so browsers refuse to hand their scripts the
+// response; requests without an Origin are passed through untouched.
+func cors(cfg CORSConfig, next http.Handler) http.Handler {
+	allowAny := false
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if !allowAny {
+			// The answer depends on the origin, so caches must keep one per
+			// origin
+			h.Add("Vary", "Origin")
+		}
+		if !allowAny && !origins[strings.ToLower(origin)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowAny {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			h.Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
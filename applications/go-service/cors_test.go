@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins: []string{"http://localhost:3000", "https://portfolio.example.com/"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         5 * time.Minute,
+	}
+	reached := false
+	handler := cors(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.Header().Set(requestIDHeader, "req-1")
+	}))
+
+	tests := []struct {
+		name, method, origin, requestMethod string
+		status                              int
+		allowOrigin, allowMethods, expose   string
+		reached                             bool
+	}{
+		{"same origin", "GET", "", "", http.StatusOK, "", "", "", true},
+		{"allowed origin", "GET", "http://localhost:3000", "", http.StatusOK, "http://localhost:3000", "", corsExposedHeaders, true},
+		{"trailing slash in config", "POST", "https://portfolio.example.com", "", http.StatusOK, "https://portfolio.example.com", "", corsExposedHeaders, true},
+		{"other origin", "GET", "https://evil.example.com", "", http.StatusOK, "", "", "", true},
+		{"preflight", "OPTIONS", "http://localhost:3000", "POST", http.StatusNoContent, "http://localhost:3000", "GET, POST", "", false},
+		{"preflight from other origin", "OPTIONS", "https://evil.example.com", "POST", http.StatusOK, "", "", "", true},
+		{"plain OPTIONS", "OPTIONS", "http://localhost:3000", "", http.StatusOK, "http://localhost:3000", "", corsExposedHeaders, true},
+	}
+	for _, tt := range tests {
+		reached = false
+		req := httptest.NewRequest(tt.method, "/api/v1/stats", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		h := rec.Header()
+		if rec.Code != tt.status || reached != tt.reached {
+			t.Errorf("%s: status %d, reached handler %v, want %d, %v", tt.name, rec.Code, reached, tt.status, tt.reached)
+		}
+		if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.allowOrigin)
+		}
+		if got := h.Get("Access-Control-Allow-Methods"); got != tt.allowMethods {
+			t.Errorf("%s: Access-Control-Allow-Methods %q, want %q", tt.name, got, tt.allowMethods)
+		}
+		if got := h.Get("Access-Control-Expose-Headers"); got != tt.expose {
+			t.Errorf("%s: Access-Control-Expose-Headers %q, want %q", tt.name, got, tt.expose)
+		}
+		if tt.origin != "" && h.Get("Vary") != "Origin" {
+			t.Errorf("%s: Vary %q, want Origin", tt.name, h.Values("Vary"))
+		}
+		if tt.status == http.StatusNoContent && (h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" || h.Get("Access-Control-Max-Age") != "300") {
+			t.Errorf("%s: preflight allows headers %q for %q seconds", tt.name, h.Get("Access-Control-Allow-Headers"), h.Get("Access-Control-Max-Age"))
+		}
+	}
+
+	wildcard := cors(CORSConfig{AllowedOrigins: []string{"*"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	rec := httptest.NewRecorder()
+	wildcard.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" || rec.Header().Get("Vary") != "" {
+		t.Errorf("any origin: Access-Control-Allow-Origin %q, Vary %q", got, rec.Header().Get("Vary"))
+	}
+}
+
+func TestLoadCORSConfig(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " http://localhost:3000, ,https://portfolio.example.com")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET")
+	t.Setenv("CORS_MAX_AGE", "1h")
+	cfg := loadCORSConfig()
+	if len(cfg.AllowedOrigins) != 2 || cfg.AllowedOrigins[0] != "http://localhost:3000" {
+		t.Errorf("AllowedOrigins = %q", cfg.AllowedOrigins)
+	}
+	if len(cfg.AllowedMethods) != 1 || cfg.MaxAge != time.Hour {
+		t.Errorf("AllowedMethods = %q, MaxAge = %v", cfg.AllowedMethods, cfg.MaxAge)
+	}
+	if len(cfg.AllowedHeaders) == 0 {
+		t.Error("no default AllowedHeaders")
+	}
+}
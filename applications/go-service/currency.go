@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var errUnsupportedCurrency = errors.New("unsupported currency")
+
+// ExchangeRate converts one unit of Currency into Rate units of the
+// reporting currency.
+type ExchangeRate struct {
+	Currency  string  `json:"currency"`
+	Rate      float64 `json:"rate"`
+	UpdatedAt string  `json:"updated_at,omitempty"`
+}
+
+type ExchangeRateListResponse struct {
+	ReportingCurrency string         `json:"reporting_currency"`
+	Rates             []ExchangeRate `json:"rates"`
+}
+
+type UpdateExchangeRateRequest struct {
+	Rate float64 `json:"rate"`
+}
+
+func normalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+func validCurrencyCode(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// loadExchangeRate returns how many units of the reporting currency one unit
+// of currency is worth. The reporting currency itself is always 1.
+func loadExchangeRate(ctx context.Context, q querier, currency, reporting string) (float64, error) {
+	if currency == reporting {
+		return 1, nil
+	}
+	var rate float64
+	err := q.QueryRow(ctx, `SELECT rate::float8 FROM exchange_rates WHERE currency = $1`, currency).Scan(&rate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errUnsupportedCurrency
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query exchange rate: %w", err)
+	}
+	return rate, nil
+}
+
+// toReporting converts an amount booked at rate into the reporting currency
+func toReporting(amount Money, rate float64) Money {
+	return amount.MulRate(rate)
+}
+
+// fromReporting converts a reporting-currency amount, such as a catalog price
+// or shipping rate, into a currency booked at rate
+func fromReporting(amount Money, rate float64) Money {
+	if rate == 1 {
+		return amount
+	}
+	return amount.MulRate(1 / rate)
+}
+
+func (s *Server) listExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT currency, rate::float8, updated_at FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		http.Error(w, "Failed to fetch exchange rates", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := ExchangeRateListResponse{
+		ReportingCurrency: s.config.ReportingCurrency,
+		Rates:             []ExchangeRate{{Currency: s.config.ReportingCurrency, Rate: 1}},
+	}
+	for rows.Next() {
+		var (
+			rate      ExchangeRate
+			updatedAt time.Time
+		)
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &updatedAt); err != nil {
+			http.Error(w, "Failed to read exchange rates", http.StatusInternalServerError)
+			return
+		}
+		if rate.Currency == s.config.ReportingCurrency {
+			continue
+		}
+		rate.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+		response.Rates = append(response.Rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) putExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	currency := normalizeCurrency(r.PathValue("currency"))
+	if !validCurrencyCode(currency) {
+		http.Error(w, "currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	if currency == s.config.ReportingCurrency {
+		http.Error(w, "The reporting currency always has rate 1", http.StatusConflict)
+		return
+	}
+
+	var req UpdateExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Rate <= 0 {
+		http.Error(w, "rate must be positive", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	var (
+		rate      = ExchangeRate{Currency: currency}
+		updatedAt time.Time
+	)
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO exchange_rates (currency, rate) VALUES ($1, $2)
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+		RETURNING rate::float8, updated_at
+	`, currency, req.Rate).Scan(&rate.Rate, &updatedAt)
+	if err != nil {
+		http.Error(w, "Failed to save exchange rate", http.StatusInternalServerError)
+		return
+	}
+	rate.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(rate)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var errCustomerNotFound = errors.New("customer not found")
+
+type Customer struct {
+	ID                   string         `json:"id"`
+	Email                string         `json:"email"`
+	Name                 string         `json:"name,omitempty"`
+	Tier                 string         `json:"tier"`
+	LoyaltyPoints        int64          `json:"loyalty_points"`
+	TaxExempt            bool           `json:"tax_exempt"`
+	ExemptionCertificate string         `json:"exemption_certificate,omitempty"`
+	Metadata             map[string]any `json:"metadata"`
+	CreatedAt            string         `json:"created_at"`
+	UpdatedAt            string         `json:"updated_at"`
+
+	createdAt time.Time
+}
+
+type CreateCustomerRequest struct {
+	Email                string         `json:"email"`
+	Name                 string         `json:"name,omitempty"`
+	Tier                 string         `json:"tier,omitempty"`
+	TaxExempt            bool           `json:"tax_exempt,omitempty"`
+	ExemptionCertificate string         `json:"exemption_certificate,omitempty"`
+	Metadata             map[string]any `json:"metadata,omitempty"`
+}
+
+// UpdateCustomerRequest only touches fields that are present in the body
+type UpdateCustomerRequest struct {
+	Email                *string        `json:"email,omitempty"`
+	Name                 *string        `json:"name,omitempty"`
+	Tier                 *string        `json:"tier,omitempty"`
+	TaxExempt            *bool          `json:"tax_exempt,omitempty"`
+	ExemptionCertificate *string        `json:"exemption_certificate,omitempty"`
+	Metadata             map[string]any `json:"metadata,omitempty"`
+}
+
+type CustomerListResponse struct {
+	Customers  []Customer `json:"customers"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+const customerColumns = `id, email, COALESCE(name, ''), tier, loyalty_points, tax_exempt, COALESCE(exemption_certificate, ''),
+	metadata, created_at, updated_at`
+
+func scanCustomer(row pgx.Row) (Customer, error) {
+	var (
+		id        uuid.UUID
+		customer  Customer
+		updatedAt time.Time
+	)
+	if err := row.Scan(&id, &customer.Email, &customer.Name, &customer.Tier, &customer.LoyaltyPoints, &customer.TaxExempt,
+		&customer.ExemptionCertificate, &customer.Metadata, &customer.createdAt, &updatedAt); err != nil {
+		return Customer{}, err
+	}
+
+	customer.ID = id.String()
+	customer.CreatedAt = customer.createdAt.UTC().Format(time.RFC3339)
+	customer.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	if customer.Metadata == nil {
+		customer.Metadata = map[string]any{}
+	}
+	return customer, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("email must be a valid address")
+	}
+	return strings.ToLower(email), nil
+}
+
+func (s *Server) createCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Metadata == nil {
+		req.Metadata = map[string]any{}
+	}
+	metadata, _ := json.Marshal(req.Metadata)
+
+	tier := normalizeTier(req.Tier)
+	if tier == "" {
+		tier = TierStandard
+	}
+
+	certificate := strings.TrimSpace(req.ExemptionCertificate)
+	if req.TaxExempt && certificate == "" {
+		http.Error(w, "exemption_certificate is required for tax-exempt customers", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	customer, err := scanCustomer(s.db.QueryRow(ctx, `
+		INSERT INTO customers (id, email, name, tier, tax_exempt, exemption_certificate, metadata)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7)
+		RETURNING `+customerColumns,
+		uuid.New(), email, strings.TrimSpace(req.Name), tier, req.TaxExempt, certificate, metadata,
+	))
+	if isUniqueViolation(err) {
+		http.Error(w, "A customer with this email already exists", http.StatusConflict)
+		return
+	}
+	if isForeignKeyViolation(err) {
+		http.Error(w, "Unknown customer tier", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create customer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(customer)
+}
+
+func (s *Server) getCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	customer, err := loadCustomer(ctx, s.db, customerID)
+	if errors.Is(err, errCustomerNotFound) {
+		http.Error(w, "Customer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch customer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(customer)
+}
+
+func (s *Server) listCustomersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, cursor, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	var rows pgx.Rows
+	if cursor == nil {
+		rows, err = s.readQuery(ctx, `
+			SELECT `+customerColumns+`
+			FROM customers
+			ORDER BY created_at DESC, id DESC
+			LIMIT $1
+		`, limit+1)
+	} else {
+		rows, err = s.readQuery(ctx, `
+			SELECT `+customerColumns+`
+			FROM customers
+			WHERE (created_at, id) < ($1, $2)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $3
+		`, cursor.CreatedAt, cursor.ID, limit+1)
+	}
+	if err != nil {
+		http.Error(w, "Failed to list customers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := CustomerListResponse{Customers: []Customer{}}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			http.Error(w, "Failed to list customers", http.StatusInternalServerError)
+			return
+		}
+
+		if len(response.Customers) == limit {
+			last := response.Customers[limit-1]
+			response.NextCursor = listCursor{CreatedAt: last.createdAt, ID: uuid.MustParse(last.ID)}.encode()
+			break
+		}
+		response.Customers = append(response.Customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to list customers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) updateCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var email *string
+	if req.Email != nil {
+		normalized, err := normalizeEmail(*req.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		email = &normalized
+	}
+
+	var metadata []byte
+	if req.Metadata != nil {
+		metadata, _ = json.Marshal(req.Metadata)
+	}
+
+	var tier *string
+	if req.Tier != nil {
+		normalized := normalizeTier(*req.Tier)
+		tier = &normalized
+	}
+
+	var certificate *string
+	if req.ExemptionCertificate != nil {
+		trimmed := strings.TrimSpace(*req.ExemptionCertificate)
+		certificate = &trimmed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	customer, err := scanCustomer(s.db.QueryRow(ctx, `
+		UPDATE customers
+		SET email = COALESCE($2, email),
+			name = CASE WHEN $3::text IS NULL THEN name ELSE NULLIF($3, '') END,
+			metadata = COALESCE($4, metadata),
+			tier = COALESCE($5, tier),
+			tax_exempt = COALESCE($6, tax_exempt),
+			exemption_certificate = CASE WHEN $7::text IS NULL THEN exemption_certificate ELSE NULLIF($7, '') END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+customerColumns,
+		customerID, email, req.Name, metadata, tier, req.TaxExempt, certificate,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Customer not found", http.StatusNotFound)
+		return
+	}
+	if isUniqueViolation(err) {
+		http.Error(w, "A customer with this email already exists", http.StatusConflict)
+		return
+	}
+	if isForeignKeyViolation(err) {
+		http.Error(w, "Unknown customer tier", http.StatusBadRequest)
+		return
+	}
+	if isCheckViolation(err) {
+		http.Error(w, "exemption_certificate is required for tax-exempt customers", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update customer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(customer)
+}
+
+func (s *Server) customerTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit, cursor, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	if _, err := loadCustomer(ctx, s.db, customerID); err != nil {
+		if errors.Is(err, errCustomerNotFound) {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch customer", http.StatusInternalServerError)
+		return
+	}
+
+	filter := transactionFilter{CustomerID: &customerID, From: from, To: to}
+	response, err := s.listTransactionSummaries(ctx, filter, cursor, limit)
+	if err != nil {
+		http.Error(w, "Failed to list customer transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// loadCustomer fetches a customer using either the pool or an open
+// transaction, so callers can validate references inside their own tx.
+func loadCustomer(ctx context.Context, q querier, customerID uuid.UUID) (Customer, error) {
+	customer, err := scanCustomer(q.QueryRow(ctx, `SELECT `+customerColumns+` FROM customers WHERE id = $1`, customerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Customer{}, errCustomerNotFound
+	}
+	if err != nil {
+		return Customer{}, fmt.Errorf("query customer: %w", err)
+	}
+	return customer, nil
+}
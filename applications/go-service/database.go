@@ -2,31 +2,86 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/exaring/otelpgx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/down/*.sql
 var migrationFiles embed.FS
 
-func initDatabase(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx so read helpers can
+// run inside or outside an explicit transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// connString is DATABASE_URL when it is set, and is otherwise assembled from
+// the POSTGRES_* settings
+func (cfg Config) connString() string {
+	if cfg.DatabaseURL != "" {
+		return cfg.DatabaseURL
+	}
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName, cfg.DBSSLMode,
 	)
+}
 
-	poolConfig, err := pgxpool.ParseConfig(connString)
+// newPool builds a pool from cfg's connection settings. A non-empty host or
+// port points it at another server, such as a replica, with the same
+// credentials, database, and options. Connections are opened lazily. Queries
+// run inside a traced request get a child span, and slow, when not nil, times
+// every query the pool runs.
+func newPool(ctx context.Context, cfg Config, host, port string, slow *slowQueryLog) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.connString())
 	if err != nil {
 		return nil, fmt.Errorf("parse postgres config: %w", err)
 	}
+	if err := retarget(poolConfig.ConnConfig, host, port); err != nil {
+		return nil, err
+	}
 
 	if cfg.DBMaxConns > 0 {
 		poolConfig.MaxConns = cfg.DBMaxConns
 	}
+	if mode, ok := queryExecModes[cfg.QueryExecMode]; ok {
+		poolConfig.ConnConfig.DefaultQueryExecMode = mode
+	}
+	poolConfig.ConnConfig.Tracer = poolTracer{Tracer: newQuerySpans(otel.GetTracerProvider()), slow: slow}
+	if path := cfg.DBCredentialsFile; path != "" {
+		poolConfig.BeforeConnect = func(ctx context.Context, conn *pgx.ConnConfig) error {
+			return applyCredentialsFile(conn, path)
+		}
+	}
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		registerArgumentTypes(conn.TypeMap())
+		return nil
+	}
+	// A statement_timeout given in DATABASE_URL wins
+	if _, set := poolConfig.ConnConfig.RuntimeParams["statement_timeout"]; !set && cfg.Timeouts.Statement > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.Timeouts.Statement.Milliseconds(), 10)
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, cfg.DBConnectTimeout)
 	defer cancel()
@@ -35,14 +90,252 @@ func initDatabase(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create postgres pool: %w", err)
 	}
-
 	return pool, nil
 }
 
-func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
+// newQuerySpans traces queries under the spans of their requests, naming them
+// as slow_queries_total labels them
+func newQuerySpans(tp trace.TracerProvider) *otelpgx.Tracer {
+	return otelpgx.NewTracer(
+		otelpgx.WithTracerProvider(tp),
+		otelpgx.WithTrimSQLInSpanName(),
+		otelpgx.WithSpanNameFunc(queryName),
+	)
+}
+
+// poolTracer adds the slow query log, when there is one, and the db_errors
+// count to otelpgx, which also traces batches, COPY, connects, and prepares
+type poolTracer struct {
+	*otelpgx.Tracer
+	slow *slowQueryLog
+}
+
+func (t poolTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx = t.Tracer.TraceQueryStart(ctx, conn, data)
+	if t.slow == nil {
+		return ctx
+	}
+	return t.slow.TraceQueryStart(ctx, conn, data)
+}
+
+func (t poolTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if data.Err != nil {
+		dbErrors.Add(1)
+	}
+	if t.slow != nil {
+		t.slow.TraceQueryEnd(ctx, conn, data)
+	}
+	t.Tracer.TraceQueryEnd(ctx, conn, data)
+}
+
+func (t poolTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if data.Err != nil {
+		dbErrors.Add(1)
+	}
+	t.Tracer.TraceBatchQuery(ctx, conn, data)
+}
+
+// queryExecModes are the POSTGRES_QUERY_EXEC_MODE values, named as in
+// pgx's default_query_exec_mode. Behind PgBouncer in transaction pooling
+// mode, prepared statements don't survive between transactions, so one of
+// the last three is needed unless PgBouncer tracks them itself
+// (max_prepared_statements, from 1.21).
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// registerArgumentTypes maps the Go types this service passes as query
+// arguments to their Postgres types, for the exec and simple_protocol modes,
+// which encode arguments without asking Postgres what they are. Money would
+// otherwise go out as its integer cents. The service has no bytea columns,
+// so every []byte it sends is a JSON document.
+func registerArgumentTypes(m *pgtype.Map) {
+	m.RegisterDefaultPgType(Money(0), "numeric")
+	m.RegisterDefaultPgType([]byte(nil), "jsonb")
+	m.RegisterDefaultPgType(uuid.UUID{}, "uuid")
+	m.RegisterDefaultPgType([]uuid.UUID(nil), "_uuid")
+}
+
+// retarget points conn at host and port where they are set. Fallback hosts
+// from a multi-host URL are dropped, as they belong to the original server.
+func retarget(conn *pgx.ConnConfig, host, port string) error {
+	if host == "" && port == "" {
+		return nil
+	}
+	if host != "" {
+		conn.Host = host
+		if conn.TLSConfig != nil && conn.TLSConfig.ServerName != "" {
+			conn.TLSConfig = conn.TLSConfig.Clone()
+			conn.TLSConfig.ServerName = host
+		}
+	}
+	if port != "" {
+		parsed, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid postgres port %q: %w", port, err)
+		}
+		conn.Port = uint16(parsed)
+	}
+	conn.Fallbacks = nil
+	return nil
+}
+
+func initDatabase(ctx context.Context, cfg Config, slow *slowQueryLog) (*pgxpool.Pool, error) {
+	pool, err := newPool(ctx, cfg, "", "", slow)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pool connects lazily, so wait here for Postgres to accept a
+	// connection rather than failing on the first query while it starts up
+	deadline := time.Now().Add(cfg.DBConnectRetry.MaxWait)
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.DBConnectTimeout)
+		err := pool.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("connected to Postgres", "attempts", attempt)
+			}
+			return pool, nil
+		}
+
+		wait := cfg.DBConnectRetry.delay(attempt, rand.Float64())
+		if time.Now().Add(wait).After(deadline) {
+			pool.Close()
+			return nil, fmt.Errorf("connect to postgres (%d attempts): %w", attempt, err)
+		}
+		slog.Warn("postgres not ready, retrying", "attempt", attempt, "error", err, "retry_in", wait)
+
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ConnectRetry sets how long initDatabase keeps trying to reach Postgres.
+// Delays double from InitialDelay up to MaxDelay; giving up once the next
+// attempt would start after MaxWait. A zero MaxWait tries once.
+type ConnectRetry struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxWait      time.Duration
+}
+
+func loadConnectRetry() ConnectRetry {
+	retry := ConnectRetry{InitialDelay: 500 * time.Millisecond, MaxDelay: 15 * time.Second, MaxWait: 2 * time.Minute}
+
+	if val := os.Getenv("POSTGRES_CONNECT_RETRY_INITIAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			retry.InitialDelay = parsed
+		}
+	}
+	if val := os.Getenv("POSTGRES_CONNECT_RETRY_MAX"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			retry.MaxDelay = parsed
+		}
+	}
+	if val := os.Getenv("POSTGRES_CONNECT_MAX_WAIT"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed >= 0 {
+			retry.MaxWait = parsed
+		}
+	}
+
+	return retry
+}
+
+// delay is the wait after the given failed attempt (from 1). jitter, in
+// [0, 1), picks a point in the upper half of the backoff so replicas that
+// started together don't retry in lockstep.
+func (r ConnectRetry) delay(attempt int, jitter float64) time.Duration {
+	backoff := r.InitialDelay
+	for i := 1; i < attempt && backoff < r.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, r.MaxDelay)
+	return backoff/2 + time.Duration(jitter*float64(backoff/2))
+}
+
+// QueryTimeouts bound database work. Statement is enforced by Postgres on
+// every pooled connection, so a query that outlives its caller's context
+// still can't hold a connection indefinitely; zero leaves the server's
+// setting. The rest are context deadlines for each kind of operation.
+type QueryTimeouts struct {
+	Statement time.Duration
+	// Health covers health checks and replica pings
+	Health time.Duration
+	// Read covers lookups and listings
+	Read time.Duration
+	// Write covers creating and changing records; a batch gets one Write
+	// per transaction in it
+	Write time.Duration
+	// Report covers reports, search, and the time series
+	Report time.Duration
+	// Job covers processing one async transaction job
+	Job time.Duration
+	// Migration covers applying or rolling back one migration
+	Migration time.Duration
+}
+
+func loadQueryTimeouts() QueryTimeouts {
+	timeouts := QueryTimeouts{
+		Statement: 30 * time.Second,
+		Health:    2 * time.Second,
+		Read:      3 * time.Second,
+		Write:     5 * time.Second,
+		Report:    5 * time.Second,
+		Job:       10 * time.Second,
+		Migration: 30 * time.Second,
+	}
+	if val := os.Getenv("POSTGRES_STATEMENT_TIMEOUT"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed >= 0 {
+			timeouts.Statement = parsed
+		}
+	}
+	for env, timeout := range map[string]*time.Duration{
+		"QUERY_TIMEOUT_HEALTH":    &timeouts.Health,
+		"QUERY_TIMEOUT_READ":      &timeouts.Read,
+		"QUERY_TIMEOUT_WRITE":     &timeouts.Write,
+		"QUERY_TIMEOUT_REPORT":    &timeouts.Report,
+		"QUERY_TIMEOUT_JOB":       &timeouts.Job,
+		"QUERY_TIMEOUT_MIGRATION": &timeouts.Migration,
+	} {
+		if val := os.Getenv(env); val != "" {
+			if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+				*timeout = parsed
+			}
+		}
+	}
+	return timeouts
+}
+
+// migration is one embedded .sql file, the checksum of its contents, and
+// the statements in migrations/down that undo it, if any
+type migration struct {
+	Name     string
+	SQL      string
+	Down     string
+	Checksum string
+}
+
+// appliedMigration is a schema_migrations record
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// loadMigrations reads the embedded migrations in filename order
+func loadMigrations() ([]migration, error) {
 	entries, err := migrationFiles.ReadDir("migrations")
 	if err != nil {
-		return fmt.Errorf("read migrations: %w", err)
+		return nil, fmt.Errorf("read migrations: %w", err)
 	}
 
 	var files []string
@@ -57,25 +350,320 @@ func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 
 	sort.Strings(files)
 
+	migrations := make([]migration, 0, len(files))
 	for _, file := range files {
 		sqlBytes, err := migrationFiles.ReadFile("migrations/" + file)
 		if err != nil {
-			return fmt.Errorf("read migration %s: %w", file, err)
+			return nil, fmt.Errorf("read migration %s: %w", file, err)
 		}
+		downBytes, err := migrationFiles.ReadFile("migrations/down/" + file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read down migration %s: %w", file, err)
+		}
+		sum := sha256.Sum256(sqlBytes)
+		migrations = append(migrations, migration{
+			Name:     file,
+			SQL:      strings.TrimSpace(string(sqlBytes)),
+			Down:     strings.TrimSpace(string(downBytes)),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+	return migrations, nil
+}
 
-		statements := strings.TrimSpace(string(sqlBytes))
-		if statements == "" {
+// pendingMigrations returns the migrations not yet recorded in applied. A
+// recorded file whose contents have changed is an error: the database no
+// longer matches what the file says, and running it again or carrying on
+// would both hide that.
+func pendingMigrations(migrations []migration, applied map[string]appliedMigration) ([]migration, error) {
+	var pending []migration
+	for _, m := range migrations {
+		record, ok := applied[m.Name]
+		if !ok {
+			pending = append(pending, m)
 			continue
 		}
+		if record.Checksum != m.Checksum {
+			return nil, fmt.Errorf("migration %s has changed since it was applied (checksum %s, recorded %s)", m.Name, m.Checksum, record.Checksum)
+		}
+	}
+	return pending, nil
+}
 
-		execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-		if _, err := pool.Exec(execCtx, statements); err != nil {
-			cancel()
-			return fmt.Errorf("run migration %s: %w", file, err)
+// rollbackMigrations returns the last steps applied migrations, newest
+// first. Every one of them must still be embedded with a down file, so a
+// rollback never stops partway for lack of one.
+func rollbackMigrations(migrations []migration, applied map[string]appliedMigration, steps int) ([]migration, error) {
+	byName := make(map[string]migration, len(migrations))
+	for _, m := range migrations {
+		byName[m.Name] = m
+	}
+
+	names := make([]string, 0, len(applied))
+	for name := range applied {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	var rollback []migration
+	for _, name := range names[:min(steps, len(names))] {
+		m, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("migration %s is applied but not in this build", name)
 		}
-		cancel()
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %s has no down migration", name)
+		}
+		rollback = append(rollback, m)
+	}
+	return rollback, nil
+}
+
+// ensureMigrationTable creates schema_migrations, which records every
+// applied migration by filename and checksum
+func ensureMigrationTable(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			filename TEXT PRIMARY KEY,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// runMigrations applies the embedded migrations that schema_migrations has
+// no record of, each in its own transaction together with its record.
+// Databases created before schema_migrations existed re-run every file once;
+// the files are written to be idempotent, so that only fills in the records.
+func runMigrations(ctx context.Context, pool *pgxpool.Pool, limits migrationLimits) error {
+	applied, err := migrateUp(ctx, pool, limits)
+	if err == nil && len(applied) > 0 {
+		slog.Info("applied migrations", "count", len(applied), "schema", applied[len(applied)-1].Name)
+	}
+	return err
+}
+
+// migrationLimits bounds the wait for the migration lock and the time each
+// migration may run
+type migrationLimits struct {
+	LockWait time.Duration
+	Timeout  time.Duration
+}
+
+func (cfg Config) migrationLimits() migrationLimits {
+	return migrationLimits{LockWait: cfg.MigrationLockWait, Timeout: cfg.Timeouts.Migration}
+}
+
+// migrationLockName keys the advisory lock held while migrating
+const migrationLockName = "schema_migrations"
+
+// withMigrationLock runs fn holding a session advisory lock, so when several
+// replicas start at once one applies the migrations while the others wait,
+// then find nothing pending and check the schema matches their build.
+// Waiting longer than wait is an error. The lock lives on a connection of its
+// own, leaving the pool free for the migrations themselves.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, wait time.Duration, fn func() error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.Release()
+
+	lockCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	start := time.Now()
+	if _, err := conn.Exec(lockCtx, `SELECT pg_advisory_lock(hashtext($1))`, migrationLockName); err != nil {
+		return fmt.Errorf("acquire migration lock (waited %s): %w", time.Since(start).Round(time.Millisecond), err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		slog.Info("waited for another instance to finish migrating", "duration", waited)
+	}
+
+	defer func() {
+		// A connection that can't unlock is closed instead, which also
+		// releases the lock
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, migrationLockName); err != nil {
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return fn()
+}
+
+// unknownMigrations are the applied migrations this build doesn't embed,
+// which is expected while a newer version is rolling out
+func unknownMigrations(migrations []migration, applied map[string]appliedMigration) []string {
+	embedded := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		embedded[m.Name] = true
+	}
+	var unknown []string
+	for name := range applied {
+		if !embedded[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// migrateUp applies pending migrations under the migration lock and returns
+// the ones it applied, including on error, when it stops at the first that
+// fails
+func migrateUp(ctx context.Context, pool *pgxpool.Pool, limits migrationLimits) (applied []migration, err error) {
+	err = withMigrationLock(ctx, pool, limits.LockWait, func() error {
+		applied, err = migrateUpLocked(ctx, pool, limits.Timeout)
+		return err
+	})
+	return applied, err
+}
+
+func migrateUpLocked(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(ctx, pool); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+	if unknown := unknownMigrations(migrations, applied); len(unknown) > 0 {
+		slog.Warn("database has migrations this build doesn't include", "migrations", unknown)
+	}
+
+	for i, m := range pending {
+		if err := applyMigration(ctx, pool, timeout, m.Name, m.SQL, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (filename, checksum) VALUES ($1, $2)`, m.Name, m.Checksum)
+			return err
+		}); err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+// migrateDown undoes the last steps applied migrations, newest first, under
+// the migration lock, and returns the ones it rolled back as migrateUp does
+func migrateDown(ctx context.Context, pool *pgxpool.Pool, steps int, limits migrationLimits) (rolledBack []migration, err error) {
+	err = withMigrationLock(ctx, pool, limits.LockWait, func() error {
+		rolledBack, err = migrateDownLocked(ctx, pool, steps, limits.Timeout)
+		return err
+	})
+	return rolledBack, err
+}
+
+func migrateDownLocked(ctx context.Context, pool *pgxpool.Pool, steps int, timeout time.Duration) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(ctx, pool); err != nil {
+		return nil, err
 	}
 
+	applied, err := appliedMigrations(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	rollback, err := rollbackMigrations(migrations, applied, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range rollback {
+		if err := applyMigration(ctx, pool, timeout, m.Name, m.Down, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE filename = $1`, m.Name)
+			return err
+		}); err != nil {
+			return rollback[:i], err
+		}
+	}
+
+	return rollback, nil
+}
+
+// appliedMigrations reads schema_migrations keyed by filename
+func appliedMigrations(ctx context.Context, q querier) (map[string]appliedMigration, error) {
+	rows, err := q.Query(ctx, `SELECT filename, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[string]appliedMigration{}
+	for rows.Next() {
+		var (
+			filename string
+			record   appliedMigration
+		)
+		if err := rows.Scan(&filename, &record.Checksum, &record.AppliedAt); err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %w", err)
+		}
+		applied[filename] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// applyMigration runs statements and updates schema_migrations with record
+// in one transaction, so a failed migration leaves no trace. The migration
+// gets all of timeout, whatever the pool's statement_timeout.
+func applyMigration(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration, name, statements string, record func(pgx.Tx) error) error {
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tx, err := pool.Begin(execCtx)
+	if err != nil {
+		return fmt.Errorf("run migration %s: %w", name, err)
+	}
+	defer tx.Rollback(execCtx)
+
+	if _, err := tx.Exec(execCtx, `SELECT set_config('statement_timeout', $1, true)`, strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("run migration %s: %w", name, err)
+	}
+
+	if statements != "" {
+		if _, err := tx.Exec(execCtx, statements); err != nil {
+			return fmt.Errorf("run migration %s: %w", name, err)
+		}
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("record migration %s: %w", name, err)
+	}
+	if err := tx.Commit(execCtx); err != nil {
+		return fmt.Errorf("commit migration %s: %w", name, err)
+	}
 	return nil
 }
 
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+func isCheckViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514"
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Name != "001_init.sql" {
+		t.Fatalf("first migration = %+v, want 001_init.sql", migrations)
+	}
+	for i, m := range migrations {
+		if i > 0 && m.Name <= migrations[i-1].Name {
+			t.Errorf("migration %s sorts after %s", m.Name, migrations[i-1].Name)
+		}
+		if len(m.Checksum) != 64 {
+			t.Errorf("migration %s checksum = %q, want sha256 hex", m.Name, m.Checksum)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %s has no down migration", m.Name)
+		}
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []migration{
+		{Name: "001_init.sql", Checksum: "aaa"},
+		{Name: "002_items.sql", Checksum: "bbb"},
+		{Name: "003_refunds.sql", Checksum: "ccc"},
+	}
+
+	tests := []struct {
+		name    string
+		applied map[string]appliedMigration
+		want    []string
+		wantErr string
+	}{
+		{name: "fresh database", applied: map[string]appliedMigration{}, want: []string{"001_init.sql", "002_items.sql", "003_refunds.sql"}},
+		{name: "partly applied", applied: map[string]appliedMigration{"001_init.sql": {Checksum: "aaa"}}, want: []string{"002_items.sql", "003_refunds.sql"}},
+		{name: "up to date", applied: map[string]appliedMigration{"001_init.sql": {Checksum: "aaa"}, "002_items.sql": {Checksum: "bbb"}, "003_refunds.sql": {Checksum: "ccc"}}},
+		{name: "edited after applying", applied: map[string]appliedMigration{"001_init.sql": {Checksum: "aaa"}, "002_items.sql": {Checksum: "old"}}, wantErr: "002_items.sql has changed"},
+	}
+
+	for _, tt := range tests {
+		pending, err := pendingMigrations(migrations, tt.applied)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, m := range pending {
+			names = append(names, m.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: pending = %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	migrations := []migration{
+		{Name: "001_init.sql", Down: "DROP TABLE a"},
+		{Name: "002_items.sql"},
+		{Name: "003_refunds.sql", Down: "DROP TABLE c"},
+	}
+	applied := map[string]appliedMigration{"001_init.sql": {}, "002_items.sql": {}, "003_refunds.sql": {}}
+
+	tests := []struct {
+		name    string
+		applied map[string]appliedMigration
+		steps   int
+		want    []string
+		wantErr string
+	}{
+		{name: "last one", applied: applied, steps: 1, want: []string{"003_refunds.sql"}},
+		{name: "without a down file", applied: applied, steps: 2, wantErr: "002_items.sql has no down migration"},
+		{name: "more steps than applied", applied: map[string]appliedMigration{"001_init.sql": {}}, steps: 5, want: []string{"001_init.sql"}},
+		{name: "nothing applied", applied: map[string]appliedMigration{}, steps: 1},
+		{name: "applied by a newer build", applied: map[string]appliedMigration{"004_new.sql": {}}, steps: 1, wantErr: "004_new.sql is applied but not in this build"},
+	}
+
+	for _, tt := range tests {
+		rollback, err := rollbackMigrations(migrations, tt.applied, tt.steps)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, m := range rollback {
+			names = append(names, m.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: rollback = %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestUnknownMigrations(t *testing.T) {
+	migrations := []migration{{Name: "001_init.sql"}, {Name: "002_items.sql"}}
+	applied := map[string]appliedMigration{"001_init.sql": {}, "004_later.sql": {}, "003_newer.sql": {}}
+
+	got := strings.Join(unknownMigrations(migrations, applied), ",")
+	if got != "003_newer.sql,004_later.sql" {
+		t.Errorf("unknownMigrations = %s, want 003_newer.sql,004_later.sql", got)
+	}
+}
+
+func TestConnectRetryDelay(t *testing.T) {
+	retry := ConnectRetry{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		jitter  float64
+		want    time.Duration
+	}{
+		{1, 0, 500 * time.Millisecond},
+		{1, 0.5, 750 * time.Millisecond},
+		{2, 0, time.Second},
+		{3, 0.99, 3980 * time.Millisecond},
+		{4, 0, 4 * time.Second},
+		{5, 0, 5 * time.Second},
+		{50, 0, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := retry.delay(tt.attempt, tt.jitter); got != tt.want {
+			t.Errorf("delay(%d, %v) = %s, want %s", tt.attempt, tt.jitter, got, tt.want)
+		}
+	}
+}
+
+func TestConnString(t *testing.T) {
+	cfg := Config{DBUser: "app", DBPassword: "secret", DBHost: "db", DBPort: "5432", DBName: "portfolio", DBSSLMode: "disable"}
+	if got, want := cfg.connString(), "postgres://app:secret@db:5432/portfolio?sslmode=disable"; got != want {
+		t.Errorf("connString = %q, want %q", got, want)
+	}
+
+	cfg.DatabaseURL = "postgres://u:p@managed.example.com:6432/app?sslmode=verify-full&pool_max_conns=12&search_path=billing"
+	poolConfig, err := pgxpool.ParseConfig(cfg.connString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := poolConfig.ConnConfig
+	if conn.Host != "managed.example.com" || conn.Port != 6432 || conn.Database != "app" || conn.User != "u" {
+		t.Errorf("conn = %s:%d/%s as %s", conn.Host, conn.Port, conn.Database, conn.User)
+	}
+	if poolConfig.MaxConns != 12 || conn.RuntimeParams["search_path"] != "billing" {
+		t.Errorf("max conns %d, search_path %q", poolConfig.MaxConns, conn.RuntimeParams["search_path"])
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	poolConfig, err := pgxpool.ParseConfig("postgres://u:p@primary.example.com:6432/app?sslmode=verify-full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primaryTLS := poolConfig.ConnConfig.TLSConfig
+
+	conn := poolConfig.ConnConfig.Copy()
+	if err := retarget(conn, "replica.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if conn.Host != "replica.example.com" || conn.Port != 6432 || conn.Database != "app" {
+		t.Errorf("conn = %s:%d/%s, want replica.example.com:6432/app", conn.Host, conn.Port, conn.Database)
+	}
+	if conn.TLSConfig.ServerName != "replica.example.com" || primaryTLS.ServerName != "primary.example.com" {
+		t.Errorf("TLS server names: replica %q, primary %q", conn.TLSConfig.ServerName, primaryTLS.ServerName)
+	}
+	if len(conn.Fallbacks) != 0 {
+		t.Errorf("fallbacks = %d, want none", len(conn.Fallbacks))
+	}
+
+	if err := retarget(conn, "", "not-a-port"); err == nil {
+		t.Error("invalid port: no error")
+	}
+}
+
+func TestPoolStatementTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		databaseURL string
+		statement   time.Duration
+		want        string
+	}{
+		{"from config", "", 30 * time.Second, "30000"},
+		{"disabled", "", 0, ""},
+		{"url wins", "postgres://u:p@db:5432/app?statement_timeout=5000", 30 * time.Second, "5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				DBUser: "app", DBPassword: "secret", DBHost: "db", DBPort: "5432", DBName: "portfolio", DBSSLMode: "disable",
+				DatabaseURL:      tt.databaseURL,
+				DBConnectTimeout: time.Second,
+				Timeouts:         QueryTimeouts{Statement: tt.statement},
+			}
+			pool, err := newPool(context.Background(), cfg, "", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+			if got := pool.Config().ConnConfig.RuntimeParams["statement_timeout"]; got != tt.want {
+				t.Errorf("statement_timeout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Exec and simple protocol modes encode arguments by Go type alone
+func TestExecModeArgumentEncoding(t *testing.T) {
+	m := pgtype.NewMap()
+	registerArgumentTypes(m)
+
+	id := uuid.MustParse("6f1c8b4e-2d3a-4b5c-9d8e-7f6a5b4c3d2e")
+	args := []any{Money(1050), []byte(`{"source":"go-service"}`), id, []uuid.UUID{id}}
+	want := []string{"10.50", `{"source":"go-service"}`, id.String(), "{" + id.String() + "}"}
+
+	var eqb pgx.ExtendedQueryBuilder
+	if err := eqb.Build(m, nil, args); err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range eqb.ParamValues {
+		if eqb.ParamFormats[i] != pgtype.TextFormatCode {
+			t.Errorf("arg %d: binary format", i)
+		}
+		if string(value) != want[i] {
+			t.Errorf("arg %d (%T) = %q, want %q", i, args[i], value, want[i])
+		}
+	}
+}
+
+// registerArgumentTypes sends []byte as JSON, which breaks on a bytea column
+func TestNoByteaColumns(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if strings.Contains(strings.ToUpper(m.SQL), "BYTEA") {
+			t.Errorf("%s declares a bytea column; registerArgumentTypes sends []byte as jsonb", m.Name)
+		}
+	}
+}
+
+func TestPoolTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	slow := newSlowQueryLog(time.Nanosecond)
+	tracer := poolTracer{Tracer: newQuerySpans(tp), slow: slow}
+
+	ctx, request := tp.Tracer("test").Start(context.Background(), "POST /api/v1/process-transaction")
+	queryCtx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "INSERT INTO outbox (event_type) VALUES ($1)"})
+	time.Sleep(time.Millisecond)
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{})
+	request.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want the query and the request", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "query insert outbox" {
+		t.Errorf("span name = %q", query.Name())
+	}
+	if query.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Error("query span is not a child of the request span")
+	}
+	if n := testutil.ToFloat64(slow.counts.WithLabelValues("insert outbox")); n != 1 {
+		t.Errorf("slow count = %v, want 1", n)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errDiscountCodeNotFound = errors.New("discount code not found")
+	errDiscountNotYetValid  = errors.New("discount code is not valid yet")
+	errDiscountExpired      = errors.New("discount code has expired")
+	errDiscountExhausted    = errors.New("discount code has reached its redemption limit")
+)
+
+// DiscountCode takes PercentOff off the order, or only off the lines in
+// Categories or ProductIDs when either is set.
+type DiscountCode struct {
+	Code            string     `json:"code"`
+	PercentOff      float64    `json:"percent_off"`
+	Description     string     `json:"description,omitempty"`
+	Active          bool       `json:"active"`
+	Exclusive       bool       `json:"exclusive"`
+	Categories      []string   `json:"categories,omitempty"`
+	ProductIDs      []string   `json:"product_ids,omitempty"`
+	ValidFrom       *time.Time `json:"valid_from,omitempty"`
+	ValidUntil      *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions  *int       `json:"max_redemptions,omitempty"`
+	RedemptionCount int        `json:"redemption_count"`
+	CreatedAt       string     `json:"created_at"`
+	UpdatedAt       string     `json:"updated_at"`
+}
+
+type DiscountCodeListResponse struct {
+	DiscountCodes []DiscountCode `json:"discount_codes"`
+}
+
+type CreateDiscountCodeRequest struct {
+	Code           string     `json:"code"`
+	PercentOff     float64    `json:"percent_off"`
+	Description    string     `json:"description,omitempty"`
+	Active         *bool      `json:"active,omitempty"`
+	Exclusive      bool       `json:"exclusive,omitempty"`
+	Categories     []string   `json:"categories,omitempty"`
+	ProductIDs     []string   `json:"product_ids,omitempty"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions *int       `json:"max_redemptions,omitempty"`
+}
+
+// UpdateDiscountCodeRequest only touches fields that are present in the body;
+// an empty categories or product_ids list removes that restriction.
+// Codes are disabled rather than deleted so historical lookups stay meaningful.
+type UpdateDiscountCodeRequest struct {
+	PercentOff     *float64   `json:"percent_off,omitempty"`
+	Description    *string    `json:"description,omitempty"`
+	Active         *bool      `json:"active,omitempty"`
+	Exclusive      *bool      `json:"exclusive,omitempty"`
+	Categories     []string   `json:"categories,omitempty"`
+	ProductIDs     []string   `json:"product_ids,omitempty"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	MaxRedemptions *int       `json:"max_redemptions,omitempty"`
+}
+
+const (
+	StackBestOf   = "best_of"
+	StackAdditive = "additive"
+)
+
+// StackingPolicy decides how several submitted codes combine. best_of keeps
+// the largest; additive applies them all in order until their combined
+// percent_off reaches CapPercent. An exclusive code is never combined, so
+// its presence falls back to best_of.
+type StackingPolicy struct {
+	Mode       string
+	CapPercent float64
+}
+
+// DiscountCodeResult reports what happened to one submitted code
+type DiscountCodeResult struct {
+	Code       string  `json:"code"`
+	Applied    bool    `json:"applied"`
+	PercentOff float64 `json:"percent_off,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+const discountCodeColumns = `code, percent_off, COALESCE(description, ''), active, exclusive, categories, product_ids,
+	valid_from, valid_until, max_redemptions, redemption_count, created_at, updated_at`
+
+// normalizeDiscountCode makes code lookups case-insensitive
+func normalizeDiscountCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validPercentOff(percent float64) bool {
+	return percent > 0 && percent <= 100
+}
+
+func scanDiscountCode(row pgx.Row) (DiscountCode, error) {
+	var (
+		code                 DiscountCode
+		createdAt, updatedAt time.Time
+	)
+	err := row.Scan(
+		&code.Code, &code.PercentOff, &code.Description, &code.Active, &code.Exclusive, &code.Categories, &code.ProductIDs,
+		&code.ValidFrom, &code.ValidUntil, &code.MaxRedemptions, &code.RedemptionCount,
+		&createdAt, &updatedAt,
+	)
+	if err != nil {
+		return DiscountCode{}, err
+	}
+	code.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	code.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return code, nil
+}
+
+func loadDiscountCode(ctx context.Context, q querier, code string) (DiscountCode, error) {
+	discount, err := scanDiscountCode(q.QueryRow(ctx, `
+		SELECT `+discountCodeColumns+` FROM discount_codes WHERE code = $1
+	`, normalizeDiscountCode(code)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DiscountCode{}, errDiscountCodeNotFound
+	}
+	if err != nil {
+		return DiscountCode{}, fmt.Errorf("query discount code: %w", err)
+	}
+	return discount, nil
+}
+
+// checkRedeemable reports why a code cannot be redeemed at now, if at all
+func (d DiscountCode) checkRedeemable(now time.Time) error {
+	if d.ValidFrom != nil && now.Before(*d.ValidFrom) {
+		return errDiscountNotYetValid
+	}
+	if d.ValidUntil != nil && !now.Before(*d.ValidUntil) {
+		return errDiscountExpired
+	}
+	if d.MaxRedemptions != nil && d.RedemptionCount >= *d.MaxRedemptions {
+		return errDiscountExhausted
+	}
+	return nil
+}
+
+// submittedDiscountCodes merges the single discount_code field with the
+// discount_codes list, normalized and without duplicates
+func submittedDiscountCodes(code string, codes []string) []string {
+	seen := map[string]bool{}
+	submitted := []string{}
+	for _, c := range append([]string{code}, codes...) {
+		c = normalizeDiscountCode(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		submitted = append(submitted, c)
+	}
+	return submitted
+}
+
+// stack selects which of the redeemable codes apply under the policy. The
+// returned codes carry the percent_off actually granted.
+func (p StackingPolicy) stack(codes []DiscountCode) ([]DiscountCode, []DiscountCodeResult) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	var exclusive bool
+	for _, code := range codes {
+		exclusive = exclusive || code.Exclusive
+	}
+
+	results := make([]DiscountCodeResult, len(codes))
+	if p.Mode != StackAdditive || exclusive {
+		best := 0
+		for i, code := range codes {
+			if code.PercentOff > codes[best].PercentOff {
+				best = i
+			}
+		}
+		reason := "a larger discount code was applied"
+		if exclusive {
+			reason = "exclusive codes cannot be combined"
+		}
+		for i, code := range codes {
+			results[i] = DiscountCodeResult{Code: code.Code, Reason: reason}
+		}
+		results[best] = DiscountCodeResult{Code: codes[best].Code, Applied: true, PercentOff: codes[best].PercentOff}
+		return []DiscountCode{codes[best]}, results
+	}
+
+	var applied []DiscountCode
+	remaining := p.CapPercent
+	for i, code := range codes {
+		percent := min(code.PercentOff, remaining)
+		if percent <= 0 {
+			results[i] = DiscountCodeResult{Code: code.Code, Reason: "stacking cap reached"}
+			continue
+		}
+		remaining -= percent
+		code.PercentOff = percent
+		applied = append(applied, code)
+		results[i] = DiscountCodeResult{Code: code.Code, Applied: true, PercentOff: percent}
+	}
+	return applied, results
+}
+
+// redeemDiscounts locks the submitted codes inside the caller's transaction,
+// enforces their validity windows and redemption limits, applies the stacking
+// policy, and counts a redemption for each code that applies. Unknown and
+// inactive codes are reported as rejected so the transaction proceeds
+// without them; expired or exhausted codes return an error.
+func redeemDiscounts(ctx context.Context, tx querier, codes []string, policy StackingPolicy, now time.Time) ([]DiscountCode, []DiscountCodeResult, error) {
+	if len(codes) == 0 {
+		return nil, nil, nil
+	}
+	locked, err := lockDiscountCodes(ctx, tx, codes)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, results, err := chooseDiscounts(codes, locked, policy, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range applied {
+		_, err := tx.Exec(ctx, `
+			UPDATE discount_codes SET redemption_count = redemption_count + 1 WHERE code = $1
+		`, applied[i].Code)
+		if err != nil {
+			return nil, nil, fmt.Errorf("count discount redemption: %w", err)
+		}
+		applied[i].RedemptionCount++
+	}
+
+	return applied, results, nil
+}
+
+// lockDiscountCodes locks the rows of the codes that exist until tx ends.
+// They are locked in code order, whatever order they were submitted in, so
+// transactions sharing codes can't deadlock.
+func lockDiscountCodes(ctx context.Context, tx querier, codes []string) (map[string]DiscountCode, error) {
+	sorted := slices.Clone(codes)
+	slices.Sort(sorted)
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+discountCodeColumns+` FROM discount_codes WHERE code = ANY($1) ORDER BY code FOR UPDATE
+	`, sorted)
+	if err != nil {
+		return nil, fmt.Errorf("query discount codes: %w", err)
+	}
+	defer rows.Close()
+	locked := map[string]DiscountCode{}
+	for rows.Next() {
+		discount, err := scanDiscountCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan discount code: %w", err)
+		}
+		locked[discount.Code] = discount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read discount codes: %w", err)
+	}
+	return locked, nil
+}
+
+// chooseDiscounts checks the submitted codes against the locked rows in
+// submission order, so the first code submitted wins ties under the stacking
+// policy
+func chooseDiscounts(codes []string, locked map[string]DiscountCode, policy StackingPolicy, now time.Time) ([]DiscountCode, []DiscountCodeResult, error) {
+	var (
+		redeemable []DiscountCode
+		rejected   []DiscountCodeResult
+	)
+	for _, code := range codes {
+		discount, ok := locked[code]
+		if !ok {
+			rejected = append(rejected, DiscountCodeResult{Code: code, Reason: "unknown code"})
+			continue
+		}
+		if !discount.Active {
+			rejected = append(rejected, DiscountCodeResult{Code: code, Reason: "code is inactive"})
+			continue
+		}
+		if err := discount.checkRedeemable(now); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", code, err)
+		}
+		redeemable = append(redeemable, discount)
+	}
+
+	applied, results := policy.stack(redeemable)
+	return applied, append(results, rejected...), nil
+}
+
+// releaseDiscount gives back the redemptions held by a voided transaction
+func releaseDiscount(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE discount_codes
+		SET redemption_count = GREATEST(redemption_count - 1, 0)
+		WHERE code = ANY(SELECT unnest(discount_codes) FROM transactions WHERE id = $1)
+	`, transactionID)
+	if err != nil {
+		return fmt.Errorf("release discount redemption: %w", err)
+	}
+	return nil
+}
+
+// normalizeTargets trims a category or product list, lowercasing categories.
+// nil stays nil so updates can tell an absent list from an empty one.
+func normalizeTargets(values []string, categories bool) []string {
+	if values == nil {
+		return nil
+	}
+	normalized := []string{}
+	for _, value := range values {
+		if categories {
+			value = normalizeCategory(value)
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized
+}
+
+func validRedemptionWindow(from, until *time.Time) bool {
+	return from == nil || until == nil || from.Before(*until)
+}
+
+func (s *Server) createDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateDiscountCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	code := normalizeDiscountCode(req.Code)
+	if code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	if !validPercentOff(req.PercentOff) {
+		http.Error(w, "percent_off must be greater than 0 and at most 100", http.StatusBadRequest)
+		return
+	}
+
+	if !validRedemptionWindow(req.ValidFrom, req.ValidUntil) {
+		http.Error(w, "valid_from must be before valid_until", http.StatusBadRequest)
+		return
+	}
+	if req.MaxRedemptions != nil && *req.MaxRedemptions <= 0 {
+		http.Error(w, "max_redemptions must be positive", http.StatusBadRequest)
+		return
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	discount, err := scanDiscountCode(s.db.QueryRow(ctx, `
+		INSERT INTO discount_codes (code, percent_off, description, active, valid_from, valid_until, max_redemptions, exclusive,
+			categories, product_ids)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, COALESCE($9, '{}'), COALESCE($10, '{}'))
+		RETURNING `+discountCodeColumns,
+		code, req.PercentOff, req.Description, active, req.ValidFrom, req.ValidUntil, req.MaxRedemptions, req.Exclusive,
+		normalizeTargets(req.Categories, true), normalizeTargets(req.ProductIDs, false),
+	))
+	if isUniqueViolation(err) {
+		http.Error(w, "Discount code already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create discount code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(discount)
+}
+
+func (s *Server) listDiscountCodesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT `+discountCodeColumns+` FROM discount_codes ORDER BY code`)
+	if err != nil {
+		http.Error(w, "Failed to list discount codes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	codes := []DiscountCode{}
+	for rows.Next() {
+		code, err := scanDiscountCode(rows)
+		if err != nil {
+			http.Error(w, "Failed to list discount codes", http.StatusInternalServerError)
+			return
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to list discount codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(DiscountCodeListResponse{DiscountCodes: codes})
+}
+
+func (s *Server) getDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	discount, err := loadDiscountCode(ctx, s.db, r.PathValue("code"))
+	if errors.Is(err, errDiscountCodeNotFound) {
+		http.Error(w, "Discount code not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch discount code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(discount)
+}
+
+func (s *Server) updateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var req UpdateDiscountCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.PercentOff != nil && !validPercentOff(*req.PercentOff) {
+		http.Error(w, "percent_off must be greater than 0 and at most 100", http.StatusBadRequest)
+		return
+	}
+	if req.MaxRedemptions != nil && *req.MaxRedemptions <= 0 {
+		http.Error(w, "max_redemptions must be positive", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	discount, err := scanDiscountCode(s.db.QueryRow(ctx, `
+		UPDATE discount_codes
+		SET percent_off = COALESCE($2, percent_off),
+			description = CASE WHEN $3::text IS NULL THEN description ELSE NULLIF($3, '') END,
+			active = COALESCE($4, active),
+			valid_from = COALESCE($5, valid_from),
+			valid_until = COALESCE($6, valid_until),
+			max_redemptions = COALESCE($7, max_redemptions),
+			exclusive = COALESCE($8, exclusive),
+			categories = COALESCE($9, categories),
+			product_ids = COALESCE($10, product_ids),
+			updated_at = NOW()
+		WHERE code = $1
+		RETURNING `+discountCodeColumns,
+		normalizeDiscountCode(r.PathValue("code")), req.PercentOff, req.Description, req.Active,
+		req.ValidFrom, req.ValidUntil, req.MaxRedemptions, req.Exclusive,
+		normalizeTargets(req.Categories, true), normalizeTargets(req.ProductIDs, false),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Discount code not found", http.StatusNotFound)
+		return
+	}
+	if isCheckViolation(err) {
+		http.Error(w, "Update would leave valid_from after valid_until", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update discount code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(discount)
+}
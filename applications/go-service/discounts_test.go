@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestApplyDiscountCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []DiscountCode
+		want  Money
+	}{
+		{"no code", nil, 0},
+		{"active code", []DiscountCode{{Code: "SAVE20", PercentOff: 20, Active: true}}, 2000},
+		{"inactive code", []DiscountCode{{Code: "SAVE20", PercentOff: 20, Active: false}}, 0},
+		{"stacked codes", []DiscountCode{
+			{Code: "SAVE20", PercentOff: 20, Active: true},
+			{Code: "SAVE10", PercentOff: 10, Active: true},
+		}, 3000},
+	}
+
+	for _, tt := range tests {
+		got := applyPromotions(PromotionRuleset{}, tt.codes, promotionInput{Subtotal: 10000}, Rounding{}).Discount
+		if got != tt.want {
+			t.Errorf("%s: discount = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDiscountCode(t *testing.T) {
+	if got := normalizeDiscountCode("  save10 "); got != "SAVE10" {
+		t.Errorf("normalizeDiscountCode = %q, want SAVE10", got)
+	}
+}
+
+func TestSubmittedDiscountCodes(t *testing.T) {
+	got := submittedDiscountCodes(" save10", []string{"SAVE10", "", "vip20"})
+	if len(got) != 2 || got[0] != "SAVE10" || got[1] != "VIP20" {
+		t.Errorf("submittedDiscountCodes = %v, want [SAVE10 VIP20]", got)
+	}
+}
+
+func TestStackingPolicy(t *testing.T) {
+	save10 := DiscountCode{Code: "SAVE10", PercentOff: 10}
+	save20 := DiscountCode{Code: "SAVE20", PercentOff: 20}
+	save30 := DiscountCode{Code: "SAVE30", PercentOff: 30}
+	solo := DiscountCode{Code: "SOLO", PercentOff: 15, Exclusive: true}
+
+	tests := []struct {
+		name        string
+		policy      StackingPolicy
+		codes       []DiscountCode
+		wantApplied map[string]float64
+		wantReason  string
+	}{
+		{"single code", StackingPolicy{Mode: StackBestOf}, []DiscountCode{save10}, map[string]float64{"SAVE10": 10}, ""},
+		{"best of", StackingPolicy{Mode: StackBestOf}, []DiscountCode{save10, save20}, map[string]float64{"SAVE20": 20}, "a larger discount code was applied"},
+		{"additive", StackingPolicy{Mode: StackAdditive, CapPercent: 100}, []DiscountCode{save10, save20}, map[string]float64{"SAVE10": 10, "SAVE20": 20}, ""},
+		{"additive capped", StackingPolicy{Mode: StackAdditive, CapPercent: 35}, []DiscountCode{save20, save30, save10},
+			map[string]float64{"SAVE20": 20, "SAVE30": 15}, "stacking cap reached"},
+		{"exclusive", StackingPolicy{Mode: StackAdditive, CapPercent: 100}, []DiscountCode{save10, solo}, map[string]float64{"SOLO": 15}, "exclusive codes cannot be combined"},
+		{"exclusive loses", StackingPolicy{Mode: StackAdditive, CapPercent: 100}, []DiscountCode{save20, solo}, map[string]float64{"SAVE20": 20}, "exclusive codes cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		applied, results := tt.policy.stack(tt.codes)
+		got := map[string]float64{}
+		for _, code := range applied {
+			got[code.Code] = code.PercentOff
+		}
+		if len(got) != len(tt.wantApplied) {
+			t.Errorf("%s: applied %v, want %v", tt.name, got, tt.wantApplied)
+			continue
+		}
+		for code, percent := range tt.wantApplied {
+			if got[code] != percent {
+				t.Errorf("%s: %s applied at %v, want %v", tt.name, code, got[code], percent)
+			}
+		}
+		if len(results) != len(tt.codes) {
+			t.Errorf("%s: %d results for %d codes", tt.name, len(results), len(tt.codes))
+		}
+		for _, result := range results {
+			if !result.Applied && result.Reason != tt.wantReason {
+				t.Errorf("%s: %s rejected with %q, want %q", tt.name, result.Code, result.Reason, tt.wantReason)
+			}
+		}
+	}
+}
+
+func TestCheckRedeemable(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+	limit := 5
+
+	tests := []struct {
+		name string
+		code DiscountCode
+		want error
+	}{
+		{"no constraints", DiscountCode{}, nil},
+		{"inside window", DiscountCode{ValidFrom: &before, ValidUntil: &after}, nil},
+		{"not yet valid", DiscountCode{ValidFrom: &after}, errDiscountNotYetValid},
+		{"expired", DiscountCode{ValidUntil: &before}, errDiscountExpired},
+		{"expires exactly now", DiscountCode{ValidUntil: &now}, errDiscountExpired},
+		{"under limit", DiscountCode{MaxRedemptions: &limit, RedemptionCount: 4}, nil},
+		{"exhausted", DiscountCode{MaxRedemptions: &limit, RedemptionCount: 5}, errDiscountExhausted},
+	}
+
+	for _, tt := range tests {
+		if got := tt.code.checkRedeemable(now); !errors.Is(got, tt.want) {
+			t.Errorf("%s: checkRedeemable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// lockRecorder records the codes redeemDiscounts locks, then fails the query
+type lockRecorder struct {
+	errQuerier
+	sql   string
+	codes []string
+}
+
+func (q *lockRecorder) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.sql, q.codes = sql, args[0].([]string)
+	return nil, q.err
+}
+
+func TestRedeemDiscountsLockOrder(t *testing.T) {
+	now := time.Now()
+	locked := map[string]DiscountCode{
+		"SPRING": {Code: "SPRING", PercentOff: 20, Active: true},
+		"VIP":    {Code: "VIP", PercentOff: 20, Active: true},
+	}
+	policy := StackingPolicy{Mode: StackAdditive, CapPercent: 25}
+
+	for _, codes := range [][]string{{"SPRING", "VIP", "GONE"}, {"VIP", "GONE", "SPRING"}} {
+		// Both orders lock the rows the same way, so they can't deadlock
+		q := &lockRecorder{errQuerier: errQuerier{errors.New("stop")}}
+		if _, _, err := redeemDiscounts(context.Background(), q, codes, policy, now); err == nil {
+			t.Fatalf("%q: redeemDiscounts succeeded on a failed lock", codes)
+		}
+		if !slices.Equal(q.codes, []string{"GONE", "SPRING", "VIP"}) || !strings.Contains(q.sql, "ORDER BY code FOR UPDATE") {
+			t.Errorf("%q: locked %q with %s", codes, q.codes, q.sql)
+		}
+
+		// The first code submitted still takes the most under the cap
+		applied, results, err := chooseDiscounts(codes, locked, policy, now)
+		if err != nil {
+			t.Fatalf("%q: %v", codes, err)
+		}
+		if len(applied) != 2 || applied[0].Code != codes[0] || applied[0].PercentOff != 20 || applied[1].PercentOff != 5 {
+			t.Errorf("%q: applied %+v, want %s at 20%% then 5%%", codes, applied, codes[0])
+		}
+		if last := results[len(results)-1]; last.Code != "GONE" || last.Reason != "unknown code" {
+			t.Errorf("%q: results %+v, want GONE rejected as unknown", codes, results)
+		}
+	}
+}
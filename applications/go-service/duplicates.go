@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DuplicateFlag   = "flag"
+	DuplicateReject = "reject"
+)
+
+// DuplicateConfig controls near-duplicate detection: a transaction for the
+// same customer, items, and total as one created within Window is either
+// rejected or flagged with duplicate_of. A zero Window disables it.
+type DuplicateConfig struct {
+	Window time.Duration
+	Action string
+}
+
+func loadDuplicateConfig() DuplicateConfig {
+	cfg := DuplicateConfig{Action: DuplicateFlag}
+
+	if val := os.Getenv("DUPLICATE_WINDOW"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Window = parsed
+		}
+	}
+	if val := os.Getenv("DUPLICATE_ACTION"); val == DuplicateFlag || val == DuplicateReject {
+		cfg.Action = val
+	}
+
+	return cfg
+}
+
+// transactionFingerprint identifies a customer's item set in a currency
+// regardless of the order the lines were submitted in
+func transactionFingerprint(customerID, currency string, items []Item) string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%d", item.ID, strings.ToLower(strings.TrimSpace(item.Name)), item.Price, item.Quantity))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(customerID + "\n" + currency + "\n" + strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// findDuplicate returns the most recent live transaction with the same
+// fingerprint and total created since the window opened. It takes a
+// transaction-scoped advisory lock on the fingerprint first so concurrent
+// copies of a submission, on any instance, are checked one at a time.
+func findDuplicate(ctx context.Context, tx pgx.Tx, fingerprint string, total Money, since time.Time) (uuid.UUID, bool, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, fingerprint); err != nil {
+		return uuid.UUID{}, false, fmt.Errorf("lock fingerprint: %w", err)
+	}
+
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM transactions
+		WHERE fingerprint = $1 AND total = $2 AND created_at > $3 AND status <> 'voided' AND deleted_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, fingerprint, total, since).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.UUID{}, false, nil
+	}
+	if err != nil {
+		return uuid.UUID{}, false, fmt.Errorf("query duplicates: %w", err)
+	}
+	return id, true, nil
+}
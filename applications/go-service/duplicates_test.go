@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestTransactionFingerprint(t *testing.T) {
+	customer := "6f1c1e9e-2f0b-4d5e-9a31-2b8d0f6a7c11"
+	items := []Item{{ID: "mug", Name: "Mug", Price: 1200, Quantity: 1}, {Name: "Tea", Price: 350, Quantity: 2}}
+	base := transactionFingerprint(customer, "USD", items)
+
+	reordered := []Item{items[1], items[0]}
+	if got := transactionFingerprint(customer, "USD", reordered); got != base {
+		t.Errorf("line order changed the fingerprint")
+	}
+	if got := transactionFingerprint(customer, "USD", []Item{{ID: "mug", Name: " mug ", Price: 1200, Quantity: 1}, items[1]}); got != base {
+		t.Errorf("name case and spacing changed the fingerprint")
+	}
+
+	different := map[string]string{
+		"customer": transactionFingerprint("another", "USD", items),
+		"currency": transactionFingerprint(customer, "EUR", items),
+		"quantity": transactionFingerprint(customer, "USD", []Item{items[0], {Name: "Tea", Price: 350, Quantity: 3}}),
+		"price":    transactionFingerprint(customer, "USD", []Item{items[0], {Name: "Tea", Price: 351, Quantity: 2}}),
+		"items":    transactionFingerprint(customer, "USD", items[:1]),
+	}
+	for name, got := range different {
+		if got == base {
+			t.Errorf("changing the %s kept the fingerprint", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorReportingConfig sends server errors and panics to a Sentry-compatible
+// service. It is off unless SENTRY_DSN is set. Environment comes from
+// SENTRY_ENVIRONMENT, falling back to ENVIRONMENT.
+type ErrorReportingConfig struct {
+	DSN         string
+	Environment string
+}
+
+func loadErrorReportingConfig(env string) ErrorReportingConfig {
+	cfg := ErrorReportingConfig{DSN: os.Getenv("SENTRY_DSN"), Environment: env}
+	if val := os.Getenv("SENTRY_ENVIRONMENT"); val != "" {
+		cfg.Environment = val
+	}
+	return cfg
+}
+
+// initErrorReporting points the default hub at cfg.DSN. Events are tagged
+// with the release, so a spike can be tied to the deploy that caused it,
+// and carry the stack where they were reported.
+func initErrorReporting(cfg ErrorReportingConfig) error {
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		Release:          "go-service@" + version,
+		AttachStacktrace: true,
+	})
+}
+
+type reportedKey struct{}
+
+// reportServerErrors gives each request its own hub carrying the request,
+// with cookies and credentials left out, for reportError to use. A panic is
+// reported and then re-raised so net/http still logs it and drops the
+// connection. A 5xx that no handler reported, such as a bare http.Error, is
+// reported as a message so no server error goes unseen. It runs inside
+// instrumentHTTP to see the matched route.
+func reportServerErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetRequest(r)
+		reported := new(bool)
+		ctx := sentry.SetHubOnContext(r.Context(), hub)
+		ctx = context.WithValue(ctx, reportedKey{}, reported)
+		r = r.WithContext(ctx)
+
+		defer func() {
+			if v := recover(); v != nil {
+				if v != http.ErrAbortHandler {
+					hub.WithScope(func(scope *sentry.Scope) {
+						scope.SetTags(errorTags(ctx))
+						hub.RecoverWithContext(ctx, v)
+					})
+				}
+				panic(v)
+			}
+		}()
+		m := httpsnoop.CaptureMetrics(next, w, r)
+
+		if m.Code >= http.StatusInternalServerError && !*reported {
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetTags(errorTags(ctx))
+				scope.SetLevel(sentry.LevelError)
+				hub.CaptureMessage(fmt.Sprintf("%s %s returned %d", r.Method, routeFromContext(ctx), m.Code))
+			})
+		}
+	})
+}
+
+// reportError sends err, with the stack of the caller, to the hub of the
+// request in ctx, or the default hub outside one such as in a worker. It
+// does nothing when error reporting is off.
+func reportError(ctx context.Context, err error) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+	if reported, ok := ctx.Value(reportedKey{}).(*bool); ok {
+		*reported = true
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(errorTags(ctx))
+		hub.CaptureException(err)
+	})
+}
+
+// errorTags are the IDs that find an event's request in the logs and
+// Jaeger, and the route it was for
+func errorTags(ctx context.Context) map[string]string {
+	tags := map[string]string{}
+	if id := requestIDFromContext(ctx); id != "" {
+		tags["request_id"] = id
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		tags["trace_id"] = sc.TraceID().String()
+	}
+	if route := routeFromContext(ctx); route != "" {
+		tags["route"] = route
+	}
+	return tags
+}
+
+// routeFromContext is the route pattern handle matched, unmatchedRoute
+// before or without a match, or "" outside instrumentHTTP
+func routeFromContext(ctx context.Context) string {
+	if slot, ok := ctx.Value(routeKey{}).(*string); ok {
+		return *slot
+	}
+	return ""
+}
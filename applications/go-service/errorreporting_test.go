@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// recordingTransport keeps the events a client sends instead of posting them
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Configure(sentry.ClientOptions) {}
+func (t *recordingTransport) Flush(time.Duration) bool       { return true }
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingTransport) sent() []*sentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	t.events = nil
+	return events
+}
+
+func TestLoadErrorReportingConfig(t *testing.T) {
+	tests := []struct {
+		dsn, env string
+		want     ErrorReportingConfig
+	}{
+		{"", "", ErrorReportingConfig{Environment: "development"}},
+		{"https://key@sentry.example.com/1", "", ErrorReportingConfig{DSN: "https://key@sentry.example.com/1", Environment: "development"}},
+		{"https://key@sentry.example.com/1", "staging", ErrorReportingConfig{DSN: "https://key@sentry.example.com/1", Environment: "staging"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("SENTRY_DSN", tt.dsn)
+		t.Setenv("SENTRY_ENVIRONMENT", tt.env)
+		if got := loadErrorReportingConfig("development"); got != tt.want {
+			t.Errorf("SENTRY_DSN=%q SENTRY_ENVIRONMENT=%q: got %+v, want %+v", tt.dsn, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestReportServerErrors(t *testing.T) {
+	transport := &recordingTransport{}
+	if err := sentry.Init(sentry.ClientOptions{
+		Dsn: "https://key@sentry.example.com/1", Release: "go-service@" + version, AttachStacktrace: true, Transport: transport,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sentry.CurrentHub().BindClient(nil) })
+
+	server := newMemoryServer()
+	mux := http.NewServeMux()
+	handle(mux, "POST /api/v1/transactions", func(w http.ResponseWriter, r *http.Request) {
+		writeProcessError(w, r, serverError("Failed to persist transaction", errors.New("connection reset")))
+	})
+	handle(mux, "GET /boom", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed to load report", http.StatusInternalServerError)
+	})
+	handle(mux, "GET /invalid", func(w http.ResponseWriter, r *http.Request) {
+		writeProcessError(w, r, clientError(http.StatusBadRequest, "Invalid request body"))
+	})
+	handle(mux, "GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})
+	handler := correlationHeaders(server.instrumentHTTP(reportServerErrors(mux)))
+
+	tests := []struct {
+		method, path string
+		exception    bool
+		message      string
+	}{
+		{"POST", "/api/v1/transactions", true, ""},
+		{"GET", "/boom", false, "GET /boom returned 500"},
+		{"GET", "/invalid", false, ""},
+		{"GET", "/panic", false, "nil map"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(requestIDHeader, "req-1")
+		func() {
+			defer func() {
+				if v := recover(); (v != nil) != (tt.path == "/panic") {
+					t.Errorf("%s: recovered %v", tt.path, v)
+				}
+			}()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		events := transport.sent()
+		if tt.path == "/invalid" {
+			if len(events) != 0 {
+				t.Errorf("%s: sent %d events, want none for a client error", tt.path, len(events))
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%s: sent %d events, want 1", tt.path, len(events))
+		}
+		event := events[0]
+		if event.Tags["request_id"] != "req-1" || event.Release != "go-service@"+version {
+			t.Errorf("%s: tags %v release %q", tt.path, event.Tags, event.Release)
+		}
+		if event.Request == nil || event.Request.URL == "" {
+			t.Errorf("%s: event has no request", tt.path)
+		}
+		if tt.exception {
+			if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Stacktrace == nil {
+				t.Errorf("%s: exception %+v, want one with a stack trace", tt.path, event.Exception)
+			}
+			if event.Tags["route"] != tt.path {
+				t.Errorf("%s: route tag %q", tt.path, event.Tags["route"])
+			}
+			continue
+		}
+		if event.Message != tt.message {
+			t.Errorf("%s: message %q, want %q", tt.path, event.Message, tt.message)
+		}
+	}
+}
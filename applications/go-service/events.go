@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// transactionEventsChannel is the Postgres NOTIFY channel every instance
+// listens on, so a subscriber on one instance sees transactions created on
+// any of them
+const transactionEventsChannel = "transaction_events"
+
+const EventTransactionCreated = "transaction.created"
+
+// TransactionEvent is the NOTIFY payload and what subscribers receive. It
+// is kept small (NOTIFY payloads are limited to 8000 bytes); fetch the
+// transaction for the rest.
+type TransactionEvent struct {
+	Type          string `json:"type"`
+	TransactionID string `json:"transaction_id"`
+	CustomerID    string `json:"customer_id,omitempty"`
+	Status        string `json:"status"`
+	Currency      string `json:"currency"`
+	Total         Money  `json:"total"`
+	Timestamp     string `json:"timestamp"`
+}
+
+func transactionCreatedEvent(response TransactionResponse) TransactionEvent {
+	return TransactionEvent{
+		Type:          EventTransactionCreated,
+		TransactionID: response.TransactionID,
+		CustomerID:    response.CustomerID,
+		Status:        response.Status,
+		Currency:      response.Currency,
+		Total:         response.Total,
+		Timestamp:     response.Timestamp,
+	}
+}
+
+// notifyTransaction queues event on tx. Postgres delivers it to listeners
+// only if tx commits.
+func notifyTransaction(ctx context.Context, tx pgx.Tx, event TransactionEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, transactionEventsChannel, string(payload))
+	return err
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before further events are dropped for it
+const subscriberBuffer = 64
+
+// eventBroker fans events out to in-process subscribers. A subscriber that
+// isn't keeping up misses events rather than holding up the others.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan TransactionEvent]struct{}
+}
+
+// subscribe returns a channel of events and a func that closes it
+func (b *eventBroker) subscribe() (<-chan TransactionEvent, func()) {
+	ch := make(chan TransactionEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan TransactionEvent]struct{}{}
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish delivers event to every subscriber with room for it and returns
+// how many it was dropped for
+func (b *eventBroker) publish(event TransactionEvent) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dropped := 0
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// runEventListener relays NOTIFYs on transactionEventsChannel to the broker
+// over a connection of its own, reconnecting whenever it is lost. Events
+// sent while it is reconnecting are missed.
+func (s *Server) runEventListener(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := s.listenForEvents(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.WarnContext(ctx, "event listener failed, reconnecting", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Server) listenForEvents(ctx context.Context) error {
+	connConfig := s.db.Config().ConnConfig
+	if path := s.config.DBCredentialsFile; path != "" {
+		if err := applyCredentialsFile(connConfig, path); err != nil {
+			return err
+		}
+	}
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+transactionEventsChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+
+		var event TransactionEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			slog.WarnContext(ctx, "event listener ignoring malformed payload", "error", err)
+			continue
+		}
+		s.eventsDropped.Add(int64(s.events.publish(event)))
+	}
+}
+
+// sseKeepAlive is how often an idle event stream gets a comment line, so
+// proxies don't close it
+const sseKeepAlive = 15 * time.Second
+
+// transactionEventsHandler streams transaction events as server-sent events
+// until the client disconnects
+func (s *Server) transactionEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", event.Type, event.TransactionID, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBroker(t *testing.T) {
+	var b eventBroker
+	first, unsubscribeFirst := b.subscribe()
+	second, unsubscribeSecond := b.subscribe()
+	defer unsubscribeSecond()
+
+	event := TransactionEvent{Type: EventTransactionCreated, TransactionID: "t1"}
+	if dropped := b.publish(event); dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+	for _, ch := range []<-chan TransactionEvent{first, second} {
+		if got := <-ch; got.TransactionID != "t1" {
+			t.Errorf("got %+v, want t1", got)
+		}
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if _, ok := <-first; ok {
+		t.Error("unsubscribed channel still open")
+	}
+
+	for i := 0; i < subscriberBuffer; i++ {
+		b.publish(event)
+	}
+	if dropped := b.publish(event); dropped != 1 {
+		t.Errorf("full subscriber: dropped = %d, want 1", dropped)
+	}
+}
+
+func TestTransactionEventsStream(t *testing.T) {
+	s := newMemoryServer()
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/v1/events/transactions", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	created, err := s.store.ProcessTransaction(ctx, TransactionRequest{
+		Items: []Item{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 1}},
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || lines[0] != "event: transaction.created" || lines[1] != "id: "+created.TransactionID {
+		t.Fatalf("event = %q", lines)
+	}
+	var event TransactionEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Total != created.Total || event.Status != string(StatusCompleted) {
+		t.Errorf("event = %+v, want total %s completed", event, created.Total)
+	}
+}
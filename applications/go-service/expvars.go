@@ -0,0 +1,17 @@
+package main
+
+import "expvar"
+
+// The expvar counters on the admin listener's /debug/vars, for checking a
+// pod with curl when Prometheus isn't to hand. They count since the process
+// started, across every server in it.
+var (
+	// transactionsProcessed counts transactions created and committed, as
+	// recordCommitted sees them
+	transactionsProcessed = expvar.NewInt("transactions_processed")
+	// dbErrors counts queries and batched statements Postgres or the driver
+	// failed, including ones cancelled by a deadline
+	dbErrors = expvar.NewInt("db_errors")
+	// activeRequests is the number of API requests being served
+	activeRequests = expvar.NewInt("active_requests")
+)
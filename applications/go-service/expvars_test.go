@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestExpvarCounters(t *testing.T) {
+	s := newMemoryServer()
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+	var during int64
+	handle(mux, "GET /inflight", func(w http.ResponseWriter, r *http.Request) {
+		during = activeRequests.Value()
+	})
+	handler := s.instrumentHTTP(mux)
+
+	processed, active := transactionsProcessed.Value(), activeRequests.Value()
+	for _, body := range []string{`{"items":[{"id":"p1","name":"Widget","price":10,"quantity":1}]}`, `{`} {
+		req := httptest.NewRequest("POST", "/api/v1/process-transaction", strings.NewReader(body))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/inflight", nil))
+
+	if got := transactionsProcessed.Value() - processed; got != 1 {
+		t.Errorf("transactions_processed rose by %d, want 1 for the created transaction", got)
+	}
+	if during != active+1 || activeRequests.Value() != active {
+		t.Errorf("active_requests = %d during a request and %d after, want %d and %d", during, activeRequests.Value(), active+1, active)
+	}
+
+	tracer := poolTracer{Tracer: newQuerySpans(sdktrace.NewTracerProvider())}
+	failed := dbErrors.Value()
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("connection reset")})
+	tracer.TraceBatchQuery(context.Background(), nil, pgx.TraceBatchQueryData{SQL: "INSERT INTO outbox", Err: context.DeadlineExceeded})
+	if got := dbErrors.Value() - failed; got != 2 {
+		t.Errorf("db_errors rose by %d, want 2", got)
+	}
+}
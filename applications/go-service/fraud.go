@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// FraudInput is what a scorer sees of a transaction before it is committed.
+// Amounts are in the reporting currency.
+type FraudInput struct {
+	TransactionID string `json:"transaction_id"`
+	CustomerID    string `json:"customer_id,omitempty"`
+	Currency      string `json:"currency"`
+	Total         Money  `json:"total"`
+	Items         []Item `json:"items"`
+	Region        string `json:"region,omitempty"`
+	// RecentTransactions is how many transactions the customer made within
+	// the velocity window
+	RecentTransactions int `json:"recent_transactions"`
+}
+
+// FraudScore runs from 0 (no risk) to 100. Reasons are short codes
+// explaining what contributed.
+type FraudScore struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// FraudScorer rates a transaction before it is committed
+type FraudScorer interface {
+	Name() string
+	Score(ctx context.Context, in FraudInput) (FraudScore, error)
+}
+
+// FraudConfig selects the scorer and the score at which transactions are
+// blocked. A zero BlockScore records scores without blocking anything.
+type FraudConfig struct {
+	Scorer         string
+	URL            string
+	Timeout        time.Duration
+	BlockScore     float64
+	HighAmount     Money
+	VelocityWindow time.Duration
+	VelocityLimit  int
+}
+
+func loadFraudConfig() FraudConfig {
+	cfg := FraudConfig{
+		Scorer:         "rules",
+		Timeout:        2 * time.Second,
+		HighAmount:     100000,
+		VelocityWindow: 10 * time.Minute,
+		VelocityLimit:  5,
+	}
+
+	if val := os.Getenv("FRAUD_SCORER"); val == "rules" || val == "http" || val == "none" {
+		cfg.Scorer = val
+	}
+	cfg.URL = os.Getenv("FRAUD_SCORER_URL")
+	if val := os.Getenv("FRAUD_SCORER_TIMEOUT"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Timeout = parsed
+		}
+	}
+	if val := os.Getenv("FRAUD_BLOCK_SCORE"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed >= 0 && parsed <= 100 {
+			cfg.BlockScore = parsed
+		}
+	}
+	if val := os.Getenv("FRAUD_HIGH_AMOUNT"); val != "" {
+		if parsed, err := parseMoney(val); err == nil && parsed >= 0 {
+			cfg.HighAmount = parsed
+		}
+	}
+	if val := os.Getenv("FRAUD_VELOCITY_WINDOW"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.VelocityWindow = parsed
+		}
+	}
+	if val := os.Getenv("FRAUD_VELOCITY_LIMIT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			cfg.VelocityLimit = parsed
+		}
+	}
+
+	return cfg
+}
+
+// newFraudScorer builds the configured scorer, or nil when scoring is off.
+// The http scorer needs FRAUD_SCORER_URL.
+func newFraudScorer(cfg FraudConfig) (FraudScorer, error) {
+	switch cfg.Scorer {
+	case "none":
+		return nil, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("FRAUD_SCORER=http requires FRAUD_SCORER_URL")
+		}
+		return &httpFraudScorer{
+			url:    cfg.URL,
+			client: &http.Client{Timeout: cfg.Timeout, Transport: requestIDTransport{otelhttp.NewTransport(http.DefaultTransport)}},
+		}, nil
+	default:
+		return ruleFraudScorer{HighAmount: cfg.HighAmount, VelocityLimit: cfg.VelocityLimit}, nil
+	}
+}
+
+// countRecentTransactions is the velocity input: the customer's transactions
+// created since the window opened
+func countRecentTransactions(ctx context.Context, q querier, customerID uuid.UUID, since time.Time) (int, error) {
+	var count int
+	err := q.QueryRow(ctx, `
+		SELECT COUNT(*) FROM transactions WHERE customer_id = $1 AND created_at > $2 AND deleted_at IS NULL
+	`, customerID, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count recent transactions: %w", err)
+	}
+	return count, nil
+}
+
+// ruleFraudScorer scores on order size and how often the customer has
+// bought recently. Zero thresholds disable a rule.
+type ruleFraudScorer struct {
+	HighAmount    Money
+	VelocityLimit int
+}
+
+func (ruleFraudScorer) Name() string { return "rules" }
+
+func (r ruleFraudScorer) Score(_ context.Context, in FraudInput) (FraudScore, error) {
+	score := FraudScore{Reasons: []string{}}
+	if r.HighAmount > 0 && in.Total >= r.HighAmount {
+		score.Score += 40
+		score.Reasons = append(score.Reasons, "high_amount")
+		if in.CustomerID == "" {
+			score.Score += 20
+			score.Reasons = append(score.Reasons, "anonymous_high_amount")
+		}
+		if in.Total >= r.HighAmount.Mul(5) {
+			score.Score += 20
+			score.Reasons = append(score.Reasons, "very_high_amount")
+		}
+	}
+	if r.VelocityLimit > 0 && in.RecentTransactions >= r.VelocityLimit {
+		score.Score += 40
+		score.Reasons = append(score.Reasons, "velocity")
+	}
+	score.Score = min(score.Score, 100)
+	return score, nil
+}
+
+// httpFraudScorer posts the FraudInput as JSON and expects a FraudScore back
+type httpFraudScorer struct {
+	url    string
+	client *http.Client
+}
+
+func (*httpFraudScorer) Name() string { return "http" }
+
+func (h *httpFraudScorer) Score(ctx context.Context, in FraudInput) (FraudScore, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return FraudScore{}, fmt.Errorf("encode fraud input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return FraudScore{}, fmt.Errorf("build fraud request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return FraudScore{}, fmt.Errorf("call fraud scorer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return FraudScore{}, fmt.Errorf("fraud scorer returned %s", resp.Status)
+	}
+
+	var score FraudScore
+	if err := json.NewDecoder(resp.Body).Decode(&score); err != nil {
+		return FraudScore{}, fmt.Errorf("decode fraud score: %w", err)
+	}
+	if score.Score < 0 || score.Score > 100 {
+		return FraudScore{}, fmt.Errorf("fraud score %v out of range", score.Score)
+	}
+	if score.Reasons == nil {
+		score.Reasons = []string{}
+	}
+	return score, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRuleFraudScorer(t *testing.T) {
+	scorer := ruleFraudScorer{HighAmount: 100000, VelocityLimit: 3}
+
+	tests := []struct {
+		name    string
+		in      FraudInput
+		score   float64
+		reasons []string
+	}{
+		{"ordinary", FraudInput{CustomerID: "c1", Total: 2500, RecentTransactions: 1}, 0, []string{}},
+		{"high amount", FraudInput{CustomerID: "c1", Total: 100000}, 40, []string{"high_amount"}},
+		{"anonymous high amount", FraudInput{Total: 150000}, 60, []string{"high_amount", "anonymous_high_amount"}},
+		{"very high amount", FraudInput{CustomerID: "c1", Total: 500000}, 60, []string{"high_amount", "very_high_amount"}},
+		{"velocity", FraudInput{CustomerID: "c1", Total: 2500, RecentTransactions: 3}, 40, []string{"velocity"}},
+		{"capped", FraudInput{Total: 900000, RecentTransactions: 10}, 100,
+			[]string{"high_amount", "anonymous_high_amount", "very_high_amount", "velocity"}},
+	}
+
+	for _, tt := range tests {
+		got, err := scorer.Score(context.Background(), tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.Score != tt.score || !reflect.DeepEqual(got.Reasons, tt.reasons) {
+			t.Errorf("%s: got %+v, want %v %v", tt.name, got, tt.score, tt.reasons)
+		}
+	}
+
+	if got, _ := (ruleFraudScorer{}).Score(context.Background(), FraudInput{Total: 900000, RecentTransactions: 10}); got.Score != 0 {
+		t.Errorf("zero thresholds should disable rules, got %+v", got)
+	}
+}
+
+func TestHTTPFraudScorer(t *testing.T) {
+	var received FraudInput
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, "bad input", http.StatusBadRequest)
+			return
+		}
+		if received.Total > 10000 {
+			_, _ = w.Write([]byte(`{"score": 250}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"score": 72.5, "reasons": ["new_device"]}`))
+	}))
+	defer upstream.Close()
+
+	scorer, err := newFraudScorer(FraudConfig{Scorer: "http", URL: upstream.URL, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := scorer.Score(context.Background(), FraudInput{TransactionID: "t1", Total: 1250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Score != 72.5 || len(got.Reasons) != 1 || received.TransactionID != "t1" || received.Total != 1250 {
+		t.Errorf("got %+v, upstream received %+v", got, received)
+	}
+
+	if _, err := scorer.Score(context.Background(), FraudInput{Total: 20000}); err == nil {
+		t.Error("out-of-range score should be an error")
+	}
+
+	if _, err := newFraudScorer(FraudConfig{Scorer: "http"}); err == nil {
+		t.Error("http scorer without a URL should be rejected")
+	}
+	if scorer, _ := newFraudScorer(FraudConfig{Scorer: "none"}); scorer != nil {
+		t.Errorf("none should disable scoring, got %T", scorer)
+	}
+}
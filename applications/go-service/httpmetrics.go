@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unmatchedRoute labels requests no registered pattern matched, so probing
+// for random paths can't grow the label set
+const unmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// handle registers handler on mux under pattern and labels its requests
+// with the pattern's path in the HTTP metrics
+func handle(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if slot, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*slot = route
+		}
+		handler(w, r)
+	})
+}
+
+// newHTTPMetrics creates the request counter and latency histogram, labelled
+// by route, method, and status class
+func newHTTPMetrics() (*prometheus.CounterVec, *prometheus.HistogramVec) {
+	labels := []string{"route", "method", "status"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route, method, and status class",
+	}, labels)
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to serve HTTP requests, by route, method, and status class",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	return requests, durations
+}
+
+// instrumentHTTP records every request next serves in the HTTP metrics and
+// the access log.
+// When the request is traced it runs inside the otelhttp span, and the
+// duration carries the sampled trace's ID as an exemplar.
+func (s *Server) instrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, &route))
+		activeRequests.Add(1)
+		m := httpsnoop.CaptureMetrics(next, w, r)
+		activeRequests.Add(-1)
+
+		labels := prometheus.Labels{"route": route, "method": methodLabel(r.Method), "status": statusClass(m.Code)}
+		s.httpRequests.With(labels).Inc()
+		observeWithTrace(r.Context(), s.httpDurations.With(labels), m.Duration.Seconds())
+		if s.statsd != nil {
+			s.statsd.timing("http_request_duration", m.Duration,
+				statsdTag("route", route), statsdTag("method", labels["method"]), statsdTag("status", labels["status"]))
+		}
+		s.logAccess(r, route, m, rand.Float64())
+	})
+}
+
+// observeWithTrace observes value, attaching the trace ID as an exemplar
+// when ctx holds a sampled span, so a dashboard can link an outlier to its
+// trace. Unsampled trace IDs are left off since Jaeger wouldn't have them.
+func observeWithTrace(ctx context.Context, observer prometheus.Observer, value float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if exemplars, ok := observer.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		exemplars.ObserveWithExemplar(value, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	observer.Observe(value)
+}
+
+// methodLabel passes the standard methods through and folds anything else,
+// which a client can make up, into one value
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// statusClass is "2xx" for 200 through 299, and so on
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
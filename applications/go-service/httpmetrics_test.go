@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentHTTP(t *testing.T) {
+	s := newMemoryServer()
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+	handler := s.instrumentHTTP(mux)
+
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/api/v1/process-transaction", `{"items":[{"id":"p1","name":"Widget","price":10,"quantity":1}]}`},
+		{"POST", "/api/v1/process-transaction", `{`},
+		{"GET", "/api/v1/transactions/" + "00000000-0000-0000-0000-000000000000", ""},
+		{"GET", "/wp-login.php", ""},
+		{"BREW", "/api/v1/stats", ""},
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+	}
+
+	tests := []struct {
+		route, method, status string
+		want                  float64
+	}{
+		{"/api/v1/process-transaction", "POST", "2xx", 1},
+		{"/api/v1/process-transaction", "POST", "4xx", 1},
+		{"/api/v1/transactions/{id}", "GET", "4xx", 1},
+		{unmatchedRoute, "GET", "4xx", 1},
+		{"/api/v1/stats", "other", "2xx", 1},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(s.httpRequests.WithLabelValues(tt.route, tt.method, tt.status))
+		if got != tt.want {
+			t.Errorf("http_requests_total{route=%q,method=%q,status=%q} = %v, want %v", tt.route, tt.method, tt.status, got, tt.want)
+		}
+	}
+	if n := testutil.CollectAndCount(s.httpDurations); n != len(tests) {
+		t.Errorf("duration series = %d, want %d", n, len(tests))
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]string{200: "2xx", 201: "2xx", 304: "3xx", 404: "4xx", 503: "5xx", 0: "unknown", 700: "unknown"} {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestRequestDurationExemplars(t *testing.T) {
+	s := newMemoryServer()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	mux := http.NewServeMux()
+	handle(mux, "GET /sampled", func(w http.ResponseWriter, r *http.Request) {})
+	handle(mux, "GET /unsampled", func(w http.ResponseWriter, r *http.Request) {})
+	handler := s.instrumentHTTP(mux)
+
+	for path, flags := range map[string]trace.TraceFlags{"/sampled": trace.FlagsSampled, "/unsampled": 0} {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags})
+		req := httptest.NewRequest("GET", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(trace.ContextWithSpanContext(req.Context(), sc)))
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	s.metricsHandler().ServeHTTP(rec, req)
+
+	var sampled, unsampled int
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "http_request_duration_seconds_bucket") || !strings.Contains(line, " # ") {
+			continue
+		}
+		switch {
+		case strings.Contains(line, `route="/sampled"`) && strings.Contains(line, `trace_id="`+traceID.String()+`"`):
+			sampled++
+		case strings.Contains(line, `route="/unsampled"`):
+			unsampled++
+		}
+	}
+	if sampled != 1 {
+		t.Errorf("sampled request exemplars = %d, want 1:\n%s", sampled, rec.Body)
+	}
+	if unsampled != 0 {
+		t.Errorf("unsampled request exemplars = %d, want 0", unsampled)
+	}
+}
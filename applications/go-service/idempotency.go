@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// requestHash fingerprints a decoded request so a key can't be replayed with
+// a different payload.
+func requestHash(req TransactionRequest) string {
+	payload, _ := json.Marshal(req)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotentProcessor processes req at most once per key. replayed reports
+// whether the response came from an earlier request.
+type idempotentProcessor func(ctx context.Context, key string, req TransactionRequest, now time.Time) (response TransactionResponse, replayed bool, err error)
+
+// processIdempotentTransaction is the idempotentProcessor for Postgres. The
+// key is claimed in the same database transaction that persists the order: a
+// concurrent request with the same key blocks on the insert until the first
+// one commits, then replays its stored response.
+func (s *Server) processIdempotentTransaction(ctx context.Context, key string, req TransactionRequest, now time.Time) (TransactionResponse, bool, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return TransactionResponse{}, false, serverError("Failed to start transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	response, replayed, err := processOnce(ctx, tx, key, requestHash(req), func() (TransactionResponse, error) {
+		return s.persistTransaction(ctx, tx, req, now)
+	})
+	if err != nil || replayed {
+		return response, replayed, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return TransactionResponse{}, false, serverError("Failed to commit transaction", err)
+	}
+	s.recordCommitted(response)
+
+	return response, false, nil
+}
+
+// processOnce claims key for a request with the hash in q and runs process,
+// storing its response against the key. When an earlier request claimed the
+// key it returns that request's response instead, or a 422 if the request
+// was a different one.
+func processOnce(ctx context.Context, q querier, key, hash string, process func() (TransactionResponse, error)) (response TransactionResponse, replayed bool, err error) {
+	if len(key) > maxIdempotencyKeyLen {
+		return TransactionResponse{}, false, clientError(http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen))
+	}
+
+	tag, err := q.Exec(ctx, `
+		INSERT INTO idempotency_keys (key, request_hash) VALUES ($1, $2)
+		ON CONFLICT (key) DO NOTHING
+	`, key, hash)
+	if err != nil {
+		return TransactionResponse{}, false, serverError("Failed to claim idempotency key", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		var (
+			storedHash string
+			stored     []byte
+		)
+		err := q.QueryRow(ctx, `SELECT request_hash, response FROM idempotency_keys WHERE key = $1`, key).Scan(&storedHash, &stored)
+		if err != nil {
+			return TransactionResponse{}, false, serverError("Failed to look up idempotency key", err)
+		}
+		if storedHash != hash {
+			return TransactionResponse{}, false, clientError(http.StatusUnprocessableEntity, idempotencyKeyHeader+" was already used with a different request")
+		}
+		if err := json.Unmarshal(stored, &response); err != nil {
+			return TransactionResponse{}, false, serverError("Failed to decode stored response", err)
+		}
+		return response, true, nil
+	}
+
+	response, err = process()
+	if err != nil {
+		return TransactionResponse{}, false, err
+	}
+
+	stored, _ := json.Marshal(response)
+	_, err = q.Exec(ctx, `
+		UPDATE idempotency_keys SET transaction_id = $2, response = $3 WHERE key = $1
+	`, key, response.TransactionID, stored)
+	if err != nil {
+		return TransactionResponse{}, false, serverError("Failed to record idempotency key", err)
+	}
+	return response, false, nil
+}
+
+// processTransactionOnce routes through the idempotency store when the client
+// sent an Idempotency-Key, and marks replayed responses with a header. Keys
+// are kept in Postgres, so memory storage ignores them.
+func (s *Server) processTransactionOnce(ctx context.Context, w http.ResponseWriter, r *http.Request, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || s.idempotent == nil {
+		return s.store.ProcessTransaction(ctx, req, now)
+	}
+
+	response, replayed, err := s.idempotent(ctx, key, req, now)
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	return response, err
+}
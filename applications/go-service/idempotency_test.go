@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// idempotencyTable stands in for the idempotency_keys table, answering the
+// statements processOnce sends
+type idempotencyTable map[string]*idempotencyRow
+
+type idempotencyRow struct {
+	hash     string
+	response []byte
+}
+
+func (t idempotencyTable) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	key := args[0].(string)
+	switch {
+	case strings.Contains(sql, "INSERT INTO idempotency_keys"):
+		if _, ok := t[key]; ok {
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		}
+		t[key] = &idempotencyRow{hash: args[1].(string)}
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.Contains(sql, "UPDATE idempotency_keys"):
+		t[key].response = args[2].([]byte)
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	}
+	panic("unexpected statement: " + sql)
+}
+
+func (t idempotencyTable) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	panic("unexpected query: " + sql)
+}
+
+func (t idempotencyTable) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	row := t[args[0].(string)]
+	return scanFunc(func(dest ...any) error {
+		*dest[0].(*string) = row.hash
+		*dest[1].(*[]byte) = row.response
+		return nil
+	})
+}
+
+type scanFunc func(dest ...any) error
+
+func (f scanFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
+func TestProcessTransactionIdempotently(t *testing.T) {
+	s := newMemoryServer()
+	keys := idempotencyTable{}
+	processed := 0
+	s.idempotent = func(ctx context.Context, key string, req TransactionRequest, now time.Time) (TransactionResponse, bool, error) {
+		return processOnce(ctx, keys, key, requestHash(req), func() (TransactionResponse, error) {
+			processed++
+			return s.store.ProcessTransaction(ctx, req, now)
+		})
+	}
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+
+	order := `{"items":[{"id":"p1","name":"Widget","price":10,"quantity":1}]}`
+	tests := []struct {
+		name, key, body string
+		status          int
+		replayed        bool
+		processed       int
+	}{
+		{"first call", "order-1", order, http.StatusOK, false, 1},
+		{"replay", "order-1", order, http.StatusOK, true, 1},
+		{"different body", "order-1", `{"items":[{"id":"p1","name":"Widget","price":10,"quantity":2}]}`, http.StatusUnprocessableEntity, false, 1},
+		{"another key", "order-2", order, http.StatusOK, false, 2},
+		{"key too long", strings.Repeat("k", maxIdempotencyKeyLen+1), order, http.StatusBadRequest, false, 2},
+		{"no key", "", order, http.StatusOK, false, 2},
+	}
+	var first TransactionResponse
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/v1/process-transaction", strings.NewReader(tt.body))
+		if tt.key != "" {
+			req.Header.Set(idempotencyKeyHeader, tt.key)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body)
+		}
+		if got := rec.Header().Get("Idempotent-Replayed") == "true"; got != tt.replayed {
+			t.Errorf("%s: Idempotent-Replayed %q, want replayed %v", tt.name, rec.Header().Get("Idempotent-Replayed"), tt.replayed)
+		}
+		if processed != tt.processed {
+			t.Errorf("%s: processed %d times, want %d", tt.name, processed, tt.processed)
+		}
+
+		var response TransactionResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &response)
+		switch tt.name {
+		case "first call":
+			first = response
+		case "replay":
+			if response.TransactionID != first.TransactionID || response.Total != first.Total {
+				t.Errorf("replay: transaction %s for %v, want the first call's %s for %v", response.TransactionID, response.Total, first.TransactionID, first.Total)
+			}
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// InventoryLevel is a product's stock. Reserved units are held by pending
+// transactions and can't be sold until they are voided.
+type InventoryLevel struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	Reserved  int64  `json:"reserved"`
+	Available int64  `json:"available"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type InventoryListResponse struct {
+	Inventory []InventoryLevel `json:"inventory"`
+}
+
+type UpdateInventoryRequest struct {
+	Quantity int64 `json:"quantity"`
+}
+
+// OutOfStockItem is a product a transaction wants more of than is on hand.
+// Line is the index of the first item for the product.
+type OutOfStockItem struct {
+	ProductID string
+	Line      int
+	Requested int64
+	Available int64
+}
+
+// OutOfStockError lists every product a transaction could not be filled from
+type OutOfStockError struct {
+	Items []OutOfStockItem
+}
+
+func (e *OutOfStockError) Error() string {
+	parts := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		parts = append(parts, fmt.Sprintf("%s (%d requested, %d available)", item.ProductID, item.Requested, item.Available))
+	}
+	return "out of stock: " + strings.Join(parts, ", ")
+}
+
+func (e *OutOfStockError) violations() []Violation {
+	violations := make([]Violation, 0, len(e.Items))
+	for _, item := range e.Items {
+		violations = append(violations, Violation{
+			Field:   fmt.Sprintf("items[%d].quantity", item.Line),
+			Rule:    "in_stock",
+			Message: fmt.Sprintf("only %d of %s in stock, %d requested", item.Available, item.ProductID, item.Requested),
+		})
+	}
+	return violations
+}
+
+// stockRequested totals the units wanted per product ID across all lines.
+// Items without an ID are not stock-tracked.
+func stockRequested(items []Item) map[string]int64 {
+	requested := map[string]int64{}
+	for _, item := range items {
+		if item.ID != "" {
+			requested[item.ID] += int64(item.Quantity)
+		}
+	}
+	return requested
+}
+
+// stockShortages compares requested units with available stock. Products
+// missing from available are untracked and never short.
+func stockShortages(items []Item, requested, available map[string]int64) []OutOfStockItem {
+	var short []OutOfStockItem
+	seen := map[string]bool{}
+	for i, item := range items {
+		if item.ID == "" || seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		onHand, tracked := available[item.ID]
+		if tracked && requested[item.ID] > onHand {
+			short = append(short, OutOfStockItem{ProductID: item.ID, Line: i, Requested: requested[item.ID], Available: onHand})
+		}
+	}
+	return short
+}
+
+// holdStock takes the transaction's items out of available stock, locking
+// the rows until tx ends so concurrent transactions, on this instance or any
+// other, can't sell the same units. With reserve the units are only reserved
+// and stay on hand until captureStock; otherwise they are sold outright.
+// Nothing is changed when any product is short.
+func holdStock(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID, items []Item, reserve bool) error {
+	requested := stockRequested(items)
+	if len(requested) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(requested))
+	for id := range requested {
+		ids = append(ids, id)
+	}
+	// Lock in a fixed order so transactions sharing products can't deadlock
+	sort.Strings(ids)
+
+	rows, err := tx.Query(ctx, `
+		SELECT product_id, quantity - reserved FROM inventory WHERE product_id = ANY($1) ORDER BY product_id FOR UPDATE
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("lock inventory: %w", err)
+	}
+	available := map[string]int64{}
+	for rows.Next() {
+		var (
+			id       string
+			quantity int64
+		)
+		if err := rows.Scan(&id, &quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan inventory: %w", err)
+		}
+		available[id] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read inventory: %w", err)
+	}
+
+	if short := stockShortages(items, requested, available); len(short) > 0 {
+		return &OutOfStockError{Items: short}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	tracked := make([]string, 0, len(available))
+	for _, id := range ids {
+		if _, ok := available[id]; ok {
+			tracked = append(tracked, id)
+		}
+	}
+	if err := recordMovements(ctx, tx, transactionID, holdMovements(tracked, requested, reserve)); err != nil {
+		return fmt.Errorf("update inventory: %w", err)
+	}
+	return nil
+}
+
+// stockMovement is a row of inventory_movements: the change made to a
+// product's units on hand and reserved
+type stockMovement struct {
+	ProductID string
+	Quantity  int64
+	Reserved  int64
+	Reason    string
+}
+
+// holdMovements reserves the requested units of each product in ids, or
+// sells them outright when reserve is unset
+func holdMovements(ids []string, requested map[string]int64, reserve bool) []stockMovement {
+	movements := make([]stockMovement, 0, len(ids))
+	for _, id := range ids {
+		if reserve {
+			movements = append(movements, stockMovement{ProductID: id, Reserved: requested[id], Reason: "reserved"})
+		} else {
+			movements = append(movements, stockMovement{ProductID: id, Quantity: -requested[id], Reason: "sold"})
+		}
+	}
+	return movements
+}
+
+// captureMovements sells the units a transaction's movements still hold
+// reserved
+func captureMovements(movements []stockMovement) []stockMovement {
+	var captured []stockMovement
+	for _, net := range netMovements(movements) {
+		if net.Reserved != 0 {
+			captured = append(captured, stockMovement{ProductID: net.ProductID, Quantity: -net.Reserved, Reserved: -net.Reserved, Reason: "captured"})
+		}
+	}
+	return captured
+}
+
+// voidMovements undoes a transaction's movements, releasing reserved units
+// and putting sold ones back on hand
+func voidMovements(movements []stockMovement) []stockMovement {
+	var voided []stockMovement
+	for _, net := range netMovements(movements) {
+		if net.Quantity != 0 || net.Reserved != 0 {
+			voided = append(voided, stockMovement{ProductID: net.ProductID, Quantity: -net.Quantity, Reserved: -net.Reserved, Reason: "voided"})
+		}
+	}
+	return voided
+}
+
+// netMovements sums movements per product, in product order
+func netMovements(movements []stockMovement) []stockMovement {
+	byProduct := map[string]*stockMovement{}
+	var ids []string
+	for _, m := range movements {
+		net, ok := byProduct[m.ProductID]
+		if !ok {
+			net = &stockMovement{ProductID: m.ProductID}
+			byProduct[m.ProductID] = net
+			ids = append(ids, m.ProductID)
+		}
+		net.Quantity += m.Quantity
+		net.Reserved += m.Reserved
+	}
+	sort.Strings(ids)
+	nets := make([]stockMovement, 0, len(ids))
+	for _, id := range ids {
+		nets = append(nets, *byProduct[id])
+	}
+	return nets
+}
+
+// transactionMovements returns the movements recorded for a transaction
+func transactionMovements(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) ([]stockMovement, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT product_id, quantity, reserved, reason FROM inventory_movements WHERE transaction_id = $1 ORDER BY id
+	`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var movements []stockMovement
+	for rows.Next() {
+		var m stockMovement
+		if err := rows.Scan(&m.ProductID, &m.Quantity, &m.Reserved, &m.Reason); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// recordMovements applies movements to inventory and records them against
+// the transaction
+func recordMovements(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID, movements []stockMovement) error {
+	if len(movements) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(movements))
+	quantities := make([]int64, 0, len(movements))
+	reserved := make([]int64, 0, len(movements))
+	reasons := make([]string, 0, len(movements))
+	for _, m := range movements {
+		ids = append(ids, m.ProductID)
+		quantities = append(quantities, m.Quantity)
+		reserved = append(reserved, m.Reserved)
+		reasons = append(reasons, m.Reason)
+	}
+	_, err := tx.Exec(ctx, `
+		WITH moved AS (
+			SELECT * FROM unnest($1::text[], $2::bigint[], $3::bigint[], $4::text[]) AS m(product_id, quantity, reserved, reason)
+		), updated AS (
+			UPDATE inventory i
+			SET quantity = i.quantity + moved.quantity, reserved = i.reserved + moved.reserved, updated_at = NOW()
+			FROM moved
+			WHERE i.product_id = moved.product_id
+		)
+		INSERT INTO inventory_movements (product_id, transaction_id, quantity, reserved, reason)
+		SELECT product_id, $5, quantity, reserved, reason FROM moved
+	`, ids, quantities, reserved, reasons, transactionID)
+	return err
+}
+
+// captureStock sells the units a pending transaction reserved
+func captureStock(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) error {
+	movements, err := transactionMovements(ctx, tx, transactionID)
+	if err != nil {
+		return fmt.Errorf("read inventory movements: %w", err)
+	}
+	if err := recordMovements(ctx, tx, transactionID, captureMovements(movements)); err != nil {
+		return fmt.Errorf("capture inventory: %w", err)
+	}
+	return nil
+}
+
+// restockTransaction undoes a voided transaction's movements, releasing
+// reserved units and putting sold ones back on hand
+func restockTransaction(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) error {
+	movements, err := transactionMovements(ctx, tx, transactionID)
+	if err != nil {
+		return fmt.Errorf("read inventory movements: %w", err)
+	}
+	if err := recordMovements(ctx, tx, transactionID, voidMovements(movements)); err != nil {
+		return fmt.Errorf("restock inventory: %w", err)
+	}
+	return nil
+}
+
+const inventoryColumns = `i.product_id, p.name, i.quantity, i.reserved, i.quantity - i.reserved, i.updated_at`
+
+func scanInventoryLevel(row pgx.Row) (InventoryLevel, error) {
+	var (
+		level     InventoryLevel
+		updatedAt time.Time
+	)
+	if err := row.Scan(&level.ProductID, &level.Name, &level.Quantity, &level.Reserved, &level.Available, &updatedAt); err != nil {
+		return InventoryLevel{}, err
+	}
+	level.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return level, nil
+}
+
+func (s *Server) listInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT `+inventoryColumns+`
+		FROM inventory i
+		JOIN products p ON p.id = i.product_id
+		ORDER BY i.product_id
+	`)
+	if err != nil {
+		http.Error(w, "Failed to list inventory", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := InventoryListResponse{Inventory: []InventoryLevel{}}
+	for rows.Next() {
+		level, err := scanInventoryLevel(rows)
+		if err != nil {
+			http.Error(w, "Failed to list inventory", http.StatusInternalServerError)
+			return
+		}
+		response.Inventory = append(response.Inventory, level)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to list inventory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// putInventoryHandler sets a product's stock on hand, starting to track it
+// if it wasn't already. The change is recorded as an adjustment and can't
+// drop below what is reserved.
+func (s *Server) putInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	productID := r.PathValue("product_id")
+
+	var req UpdateInventoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity < 0 {
+		http.Error(w, "quantity must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	level, err := saveInventoryLevel(ctx, s.db, productID, req.Quantity)
+	if err != nil {
+		status, message := errorStatus(err)
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(level)
+}
+
+// saveInventoryLevel sets the product's stock on hand and records the
+// adjustment
+func saveInventoryLevel(ctx context.Context, q querier, productID string, quantity int64) (InventoryLevel, error) {
+	level, err := scanInventoryLevel(q.QueryRow(ctx, `
+		WITH previous AS (
+			SELECT quantity FROM inventory WHERE product_id = $1 FOR UPDATE
+		), saved AS (
+			INSERT INTO inventory (product_id, quantity) VALUES ($1, $2)
+			ON CONFLICT (product_id) DO UPDATE SET quantity = EXCLUDED.quantity, updated_at = NOW()
+			RETURNING product_id, quantity, reserved, updated_at
+		), adjusted AS (
+			INSERT INTO inventory_movements (product_id, quantity, reason)
+			SELECT product_id, quantity - COALESCE((SELECT quantity FROM previous), 0), 'adjusted' FROM saved
+			WHERE quantity <> COALESCE((SELECT quantity FROM previous), 0)
+		)
+		SELECT `+inventoryColumns+`
+		FROM saved i
+		JOIN products p ON p.id = i.product_id
+	`, productID, quantity))
+	switch {
+	case isForeignKeyViolation(err):
+		return InventoryLevel{}, clientError(http.StatusNotFound, "Product not found")
+	case isCheckViolation(err):
+		return InventoryLevel{}, clientError(http.StatusConflict, "quantity is below the reserved stock")
+	case err != nil:
+		return InventoryLevel{}, serverError("Failed to save inventory", err)
+	}
+	return level, nil
+}
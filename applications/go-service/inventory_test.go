@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestStockShortages(t *testing.T) {
+	items := []Item{
+		{ID: "mug", Quantity: 2},
+		{Name: "gift wrap", Quantity: 5},
+		{ID: "tea", Quantity: 1},
+		{ID: "mug", Quantity: 2},
+		{ID: "poster", Quantity: 9},
+	}
+	requested := stockRequested(items)
+	if requested["mug"] != 4 || requested["tea"] != 1 || len(requested) != 3 {
+		t.Fatalf("stockRequested = %v", requested)
+	}
+
+	tests := []struct {
+		name      string
+		available map[string]int64
+		want      []OutOfStockItem
+	}{
+		{"all in stock", map[string]int64{"mug": 4, "tea": 10}, nil},
+		{"untracked", map[string]int64{}, nil},
+		{"short across lines", map[string]int64{"mug": 3, "tea": 1}, []OutOfStockItem{{ProductID: "mug", Line: 0, Requested: 4, Available: 3}}},
+		{"several short", map[string]int64{"mug": 0, "tea": 0, "poster": 8}, []OutOfStockItem{
+			{ProductID: "mug", Line: 0, Requested: 4, Available: 0},
+			{ProductID: "tea", Line: 2, Requested: 1, Available: 0},
+			{ProductID: "poster", Line: 4, Requested: 9, Available: 8},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := stockShortages(items, requested, tt.available)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: shortage %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestOutOfStockError(t *testing.T) {
+	err := &OutOfStockError{Items: []OutOfStockItem{{ProductID: "mug", Line: 1, Requested: 3, Available: 2}}}
+	if !strings.Contains(err.Error(), "mug (3 requested, 2 available)") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	violations := err.violations()
+	if len(violations) != 1 || violations[0].Field != "items[1].quantity" || violations[0].Rule != "in_stock" {
+		t.Errorf("violations = %+v", violations)
+	}
+}
+
+func TestStockMovements(t *testing.T) {
+	type level struct{ quantity, reserved int64 }
+	hold := func(reserve bool) func([]stockMovement) []stockMovement {
+		return func([]stockMovement) []stockMovement {
+			return holdMovements([]string{"mug", "tea"}, map[string]int64{"mug": 3, "tea": 1}, reserve)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		steps   []func([]stockMovement) []stockMovement
+		want    map[string]level
+		reasons []string
+	}{
+		{"reserve", []func([]stockMovement) []stockMovement{hold(true)},
+			map[string]level{"mug": {10, 3}, "tea": {5, 1}}, []string{"reserved", "reserved"}},
+		{"reserve then capture", []func([]stockMovement) []stockMovement{hold(true), captureMovements},
+			map[string]level{"mug": {7, 0}, "tea": {4, 0}}, []string{"reserved", "reserved", "captured", "captured"}},
+		{"reserve then void", []func([]stockMovement) []stockMovement{hold(true), voidMovements},
+			map[string]level{"mug": {10, 0}, "tea": {5, 0}}, []string{"reserved", "reserved", "voided", "voided"}},
+		{"sell then void", []func([]stockMovement) []stockMovement{hold(false), voidMovements},
+			map[string]level{"mug": {10, 0}, "tea": {5, 0}}, []string{"sold", "sold", "voided", "voided"}},
+		{"capture then void", []func([]stockMovement) []stockMovement{hold(true), captureMovements, voidMovements},
+			map[string]level{"mug": {10, 0}, "tea": {5, 0}}, []string{"reserved", "reserved", "captured", "captured", "voided", "voided"}},
+		{"capture twice", []func([]stockMovement) []stockMovement{hold(true), captureMovements, captureMovements},
+			map[string]level{"mug": {7, 0}, "tea": {4, 0}}, []string{"reserved", "reserved", "captured", "captured"}},
+		{"void twice", []func([]stockMovement) []stockMovement{hold(false), voidMovements, voidMovements},
+			map[string]level{"mug": {10, 0}, "tea": {5, 0}}, []string{"sold", "sold", "voided", "voided"}},
+	}
+
+	for _, tt := range tests {
+		// As recordMovements applies them to the inventory rows
+		stock := map[string]level{"mug": {10, 0}, "tea": {5, 0}}
+		var ledger []stockMovement
+		for _, step := range tt.steps {
+			for _, m := range step(ledger) {
+				l := stock[m.ProductID]
+				stock[m.ProductID] = level{l.quantity + m.Quantity, l.reserved + m.Reserved}
+				ledger = append(ledger, m)
+			}
+		}
+		for id, want := range tt.want {
+			if stock[id] != want {
+				t.Errorf("%s: %s = %+v, want %+v", tt.name, id, stock[id], want)
+			}
+		}
+		reasons := make([]string, 0, len(ledger))
+		for _, m := range ledger {
+			reasons = append(reasons, m.Reason)
+		}
+		if !slices.Equal(reasons, tt.reasons) {
+			t.Errorf("%s: movements %q, want %q", tt.name, reasons, tt.reasons)
+		}
+	}
+}
+
+// errQuerier fails every query with err
+type errQuerier struct{ err error }
+
+func (q errQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, q.err
+}
+
+func (q errQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, q.err
+}
+
+func (q errQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return errRow{q.err}
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
+func TestSaveInventoryLevelErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"below reserved", &pgconn.PgError{Code: "23514", ConstraintName: "inventory_reserved_check"}, http.StatusConflict},
+		{"unknown product", &pgconn.PgError{Code: "23503"}, http.StatusNotFound},
+		{"connection lost", errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		_, err := saveInventoryLevel(context.Background(), errQuerier{tt.err}, "mug", 1)
+		if status, _ := errorStatus(err); status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// jobRun is one run of a batch command, such as `go-service migrate up` in
+// a Kubernetes Job
+type jobRun struct {
+	Job   string
+	Start time.Time
+	// Items is what the run got through: migrations applied or rolled
+	// back, or transactions purged
+	Items int64
+	Err   error
+}
+
+// pushJobMetrics sends run's outcome to the Pushgateway at url, since a Job
+// pod usually exits before Prometheus would scrape it. Each job keeps one
+// group, keyed by job and service rather than pod, so reruns replace it:
+//
+//   - batch_job_duration_seconds, batch_job_items, and batch_job_succeeded
+//     describe the latest run
+//   - batch_job_last_completion_timestamp_seconds is when it finished
+//   - batch_job_last_success_timestamp_seconds is only replaced by a run
+//     that succeeded, so an alert can fire when it gets too old
+//
+// It does nothing when url is empty.
+func pushJobMetrics(url, serviceName string, run jobRun) error {
+	if url == "" {
+		return nil
+	}
+	now := time.Now()
+	registry := prometheus.NewRegistry()
+	gauge := func(name, help string, value float64) {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+		g.Set(value)
+		registry.MustRegister(g)
+	}
+	succeeded := 0.0
+	if run.Err == nil {
+		succeeded = 1
+	}
+	gauge("batch_job_duration_seconds", "How long the latest run took", now.Sub(run.Start).Seconds())
+	gauge("batch_job_items", "Migrations or transactions the latest run got through", float64(run.Items))
+	gauge("batch_job_succeeded", "Whether the latest run succeeded", succeeded)
+	gauge("batch_job_last_completion_timestamp_seconds", "When the latest run finished", float64(now.Unix()))
+
+	pusher := push.New(url, run.Job).
+		Grouping("service", serviceName).
+		Client(&http.Client{Timeout: 10 * time.Second}).
+		Gatherer(registry)
+	if run.Err != nil {
+		// Add leaves the last success the group already has in place
+		return pusher.Add()
+	}
+	gauge("batch_job_last_success_timestamp_seconds", "When a run last succeeded", float64(now.Unix()))
+	return pusher.Push()
+}
+
+// reportJobRun pushes run's metrics for a batch command, warning on stderr
+// when that fails without failing the command
+func reportJobRun(stderr io.Writer, config Config, run jobRun) {
+	if err := pushJobMetrics(config.PushgatewayURL, config.ServiceName, run); err != nil {
+		fmt.Fprintf(stderr, "failed to push metrics to the Pushgateway: %v\n", err)
+	}
+}
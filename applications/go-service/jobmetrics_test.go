@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pushed is one request to the fake Pushgateway
+type pushed struct {
+	method, path string
+	metrics      map[string]float64
+}
+
+func fakePushgateway(t *testing.T) (*httptest.Server, *[]pushed) {
+	t.Helper()
+	var requests []pushed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := pushed{method: r.Method, path: r.URL.Path, metrics: map[string]float64{}}
+		// The decoder buffers each read itself, losing what it read ahead
+		// unless it is handed a bufio.Reader to reuse
+		decoder := expfmt.NewDecoder(bufio.NewReader(r.Body), expfmt.ResponseFormat(r.Header))
+		for {
+			var family dto.MetricFamily
+			if err := decoder.Decode(&family); err != nil {
+				if err != io.EOF {
+					t.Errorf("decode push: %v", err)
+				}
+				break
+			}
+			req.metrics[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+		}
+		requests = append(requests, req)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestPushJobMetrics(t *testing.T) {
+	gateway, requests := fakePushgateway(t)
+	start := time.Now().Add(-2 * time.Second)
+
+	if err := pushJobMetrics(gateway.URL, "go-service", jobRun{Job: "migrate-up", Start: start, Items: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pushJobMetrics(gateway.URL, "go-service", jobRun{Job: "retention-purge", Start: start, Items: 40, Err: errors.New("lock: connection reset")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pushJobMetrics("", "go-service", jobRun{Job: "migrate-up", Start: start}); err != nil || len(*requests) != 2 {
+		t.Fatalf("push without a URL: err %v, %d requests, want nothing sent", err, len(*requests))
+	}
+
+	ok, failed := (*requests)[0], (*requests)[1]
+	// A success replaces the group, a failure only the series it sends
+	if ok.method != http.MethodPut || ok.path != "/metrics/job/migrate-up/service/go-service" {
+		t.Errorf("success pushed with %s %s", ok.method, ok.path)
+	}
+	if failed.method != http.MethodPost || failed.path != "/metrics/job/retention-purge/service/go-service" {
+		t.Errorf("failure pushed with %s %s", failed.method, failed.path)
+	}
+
+	if ok.metrics["batch_job_succeeded"] != 1 || ok.metrics["batch_job_items"] != 3 || ok.metrics["batch_job_duration_seconds"] < 2 {
+		t.Errorf("success metrics = %v", ok.metrics)
+	}
+	if _, ok := ok.metrics["batch_job_last_success_timestamp_seconds"]; !ok {
+		t.Error("success didn't push batch_job_last_success_timestamp_seconds")
+	}
+	var names []string
+	for name := range failed.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"batch_job_duration_seconds", "batch_job_items", "batch_job_last_completion_timestamp_seconds", "batch_job_succeeded"}
+	if len(names) != len(want) || failed.metrics["batch_job_succeeded"] != 0 || failed.metrics["batch_job_items"] != 40 {
+		t.Errorf("failure metrics = %v, want %v without the last success", failed.metrics, want)
+	}
+}
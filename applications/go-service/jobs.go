@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	JobQueued    = "queued"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+
+	jobKindTransaction = "process_transaction"
+)
+
+type JobResponse struct {
+	JobID       string               `json:"job_id"`
+	Status      string               `json:"status"`
+	HTTPStatus  int                  `json:"http_status,omitempty"`
+	Transaction *TransactionResponse `json:"transaction,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	CreatedAt   string               `json:"created_at"`
+	CompletedAt string               `json:"completed_at,omitempty"`
+}
+
+// enqueueTransaction accepts a transaction for background processing
+// and returns 202 with a job that can be polled for the outcome.
+func (s *Server) enqueueTransaction(w http.ResponseWriter, r *http.Request, req TransactionRequest) {
+	if len(req.Items) == 0 {
+		http.Error(w, "Transaction must contain at least one item", http.StatusBadRequest)
+		return
+	}
+
+	payload, _ := json.Marshal(req)
+	jobID := uuid.New()
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	var createdAt time.Time
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO jobs (id, kind, status, payload) VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`, jobID, jobKindTransaction, JobQueued, payload).Scan(&createdAt)
+	if err != nil {
+		http.Error(w, "Failed to enqueue transaction", http.StatusInternalServerError)
+		return
+	}
+
+	response := JobResponse{
+		JobID:     jobID.String(),
+		Status:    JobQueued,
+		CreatedAt: createdAt.UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/jobs/"+jobID.String())
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	var (
+		response    JobResponse
+		httpStatus  pgtype.Int4
+		result      []byte
+		jobError    pgtype.Text
+		createdAt   time.Time
+		completedAt pgtype.Timestamptz
+	)
+	err = s.db.QueryRow(ctx, `
+		SELECT status, http_status, result, error, created_at, completed_at
+		FROM jobs
+		WHERE id = $1
+	`, jobID).Scan(&response.Status, &httpStatus, &result, &jobError, &createdAt, &completedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch job", http.StatusInternalServerError)
+		return
+	}
+
+	response.JobID = jobID.String()
+	response.HTTPStatus = int(httpStatus.Int32)
+	response.Error = jobError.String
+	response.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	if completedAt.Valid {
+		response.CompletedAt = completedAt.Time.UTC().Format(time.RFC3339)
+	}
+	if len(result) > 0 {
+		var transaction TransactionResponse
+		if err := json.Unmarshal(result, &transaction); err == nil {
+			response.Transaction = &transaction
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// runJobWorker drains queued jobs, then sleeps for the poll interval. Rows
+// are claimed with SKIP LOCKED so several replicas can share the queue.
+func (s *Server) runJobWorker(ctx context.Context) {
+	runEvery(ctx, s.config.JobPollInterval, func(ctx context.Context) {
+		for ctx.Err() == nil {
+			processed, err := s.processNextJob(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "job worker failed", "error", err)
+				return
+			}
+			if !processed {
+				return
+			}
+		}
+	})
+}
+
+// processNextJob claims one queued job and runs it in the same database
+// transaction, so a crash mid-way leaves the job queued rather than lost or
+// half-applied. It reports whether a job was found.
+func (s *Server) processNextJob(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeouts.Job)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, fmt.Errorf("begin job transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		jobID   uuid.UUID
+		payload []byte
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, payload FROM jobs
+		WHERE status = $1 AND kind = $2
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, JobQueued, jobKindTransaction).Scan(&jobID, &payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim job: %w", err)
+	}
+
+	var (
+		status      = JobSucceeded
+		httpStatus  = http.StatusOK
+		result      []byte
+		message     *string
+		transaction pgtype.UUID
+		created     *TransactionResponse
+	)
+
+	var req TransactionRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		status, httpStatus = JobFailed, http.StatusBadRequest
+		msg := "Invalid request body"
+		message = &msg
+	} else {
+		response, err := s.persistJobTransaction(ctx, tx, req)
+		if err != nil {
+			code, msg := errorStatus(err)
+			status, httpStatus, message = JobFailed, code, &msg
+			if code >= http.StatusInternalServerError {
+				slog.ErrorContext(ctx, "job failed", "job_id", jobID, "status", code, "error", err)
+				reportError(ctx, err)
+			}
+		} else {
+			result, _ = json.Marshal(response)
+			parsed, _ := uuid.Parse(response.TransactionID)
+			transaction = pgtype.UUID{Bytes: parsed, Valid: true}
+			created = &response
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE jobs
+		SET status = $2, http_status = $3, result = $4, error = $5, transaction_id = $6, completed_at = NOW()
+		WHERE id = $1
+	`, jobID, status, httpStatus, result, message, transaction)
+	if err != nil {
+		return false, fmt.Errorf("record job %s result: %w", jobID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit job %s: %w", jobID, err)
+	}
+	if created != nil {
+		s.recordCommitted(*created)
+	}
+
+	return true, nil
+}
+
+// persistJobTransaction runs the transaction inside a savepoint so a rejected
+// request can be rolled back while the job's failure is still recorded.
+func (s *Server) persistJobTransaction(ctx context.Context, tx pgx.Tx, req TransactionRequest) (TransactionResponse, error) {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return TransactionResponse{}, serverError("Failed to start transaction", err)
+	}
+	defer savepoint.Rollback(ctx)
+
+	response, err := s.persistTransaction(ctx, savepoint, req, time.Now())
+	if err != nil {
+		return TransactionResponse{}, err
+	}
+
+	if err := savepoint.Commit(ctx); err != nil {
+		return TransactionResponse{}, serverError("Failed to commit transaction", err)
+	}
+	return response, nil
+}
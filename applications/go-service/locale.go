@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// DisplayAmounts are a transaction's totals formatted for a reader in Locale,
+// e.g. "$1,234.56" for en-US or "€1.234,56" for de-DE, returned next to the
+// numeric fields when a locale is requested. The currency symbol is always
+// placed before the amount.
+type DisplayAmounts struct {
+	Locale   string `json:"locale"`
+	Subtotal string `json:"subtotal"`
+	Discount string `json:"discount"`
+	Tax      string `json:"tax"`
+	Tip      string `json:"tip"`
+	Shipping string `json:"shipping"`
+	Total    string `json:"total"`
+}
+
+var errInvalidLocale = errors.New("invalid locale")
+
+// requestLocale returns the locale display amounts are wanted in: the locale
+// query parameter, or else the preferred Accept-Language. An unparseable
+// query parameter is an error; an unusable header is ignored, since clients
+// send it whether or not they want display amounts.
+func requestLocale(r *http.Request) (language.Tag, bool, error) {
+	if value := r.URL.Query().Get("locale"); value != "" {
+		tag, err := language.Parse(value)
+		if err != nil {
+			return language.Und, false, errInvalidLocale
+		}
+		return tag, true, nil
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil {
+		return language.Und, false, nil
+	}
+	// Tags come sorted by preference; "*" parses as "mul", which says nothing
+	for _, tag := range tags {
+		if tag != language.Und && tag.String() != "mul" {
+			return tag, true, nil
+		}
+	}
+	return language.Und, false, nil
+}
+
+// displayAmounts formats response's totals in its own currency for tag
+func displayAmounts(tag language.Tag, response TransactionResponse) *DisplayAmounts {
+	format := func(m Money) string {
+		return formatLocalMoney(tag, response.Currency, m)
+	}
+	return &DisplayAmounts{
+		Locale:   tag.String(),
+		Subtotal: format(response.Subtotal),
+		Discount: format(response.Discount),
+		Tax:      format(response.Tax),
+		Tip:      format(response.Tip),
+		Shipping: format(response.Shipping),
+		Total:    format(response.Total),
+	}
+}
+
+// formatLocalMoney writes m with tag's digit grouping and decimal separator,
+// to the currency's usual number of decimals, after the symbol readers in tag
+// use for code. Codes x/text doesn't know are written after the amount.
+// Unlike formatMoney on receipts, it is meant for any locale.
+func formatLocalMoney(tag language.Tag, code string, m Money) string {
+	printer := message.NewPrinter(tag)
+
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	amount := float64(m.Cents()) / 100
+
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return sign + printer.Sprint(number.Decimal(amount, number.Scale(2))) + " " + code
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	formatted := printer.Sprint(number.Decimal(amount, number.Scale(scale)))
+
+	// Symbols that end in a letter, like "CHF", need a space before the digits
+	symbol := printer.Sprint(currency.Symbol(unit))
+	if r, _ := utf8.DecodeLastRuneInString(symbol); unicode.IsLetter(r) {
+		symbol += " "
+	}
+	return sign + symbol + formatted
+}
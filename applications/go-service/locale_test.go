@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		url            string
+		acceptLanguage string
+		want           string
+		wantOK         bool
+		wantErr        bool
+	}{
+		{url: "/", want: "und"},
+		{url: "/?locale=de-DE", want: "de-DE", wantOK: true},
+		{url: "/?locale=fr-FR", acceptLanguage: "en-US", want: "fr-FR", wantOK: true},
+		{url: "/", acceptLanguage: "da, en-GB;q=0.8", want: "da", wantOK: true},
+		{url: "/", acceptLanguage: "en-GB;q=0.5, ja;q=0.9", want: "ja", wantOK: true},
+		{url: "/", acceptLanguage: "*", want: "und"},
+		{url: "/", acceptLanguage: ";;;", want: "und"},
+		{url: "/?locale=not_a-locale!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		tag, ok, err := requestLocale(r)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("requestLocale(%s) succeeded, want error", tt.url)
+			}
+			continue
+		}
+		if err != nil || ok != tt.wantOK || tag.String() != tt.want {
+			t.Errorf("requestLocale(%s, %q) = %s, %v, %v; want %s, %v", tt.url, tt.acceptLanguage, tag, ok, err, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFormatLocalMoney(t *testing.T) {
+	tests := []struct {
+		locale   string
+		currency string
+		amount   Money
+		want     string
+	}{
+		{"en-US", "USD", 123456, "$1,234.56"},
+		{"en-US", "USD", -500, "-$5.00"},
+		{"de-DE", "EUR", 123456, "€1.234,56"},
+		{"en-US", "JPY", 123456, "¥1,235"},
+		{"en-US", "CHF", 99, "CHF 0.99"},
+		{"en-IN", "USD", 100, "US$1.00"},
+		{"en-US", "XYZ", 1050, "10.50 XYZ"},
+	}
+
+	for _, tt := range tests {
+		got := formatLocalMoney(language.MustParse(tt.locale), tt.currency, tt.amount)
+		if got != tt.want {
+			t.Errorf("formatLocalMoney(%s, %s, %d) = %q, want %q", tt.locale, tt.currency, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayAmounts(t *testing.T) {
+	response := TransactionResponse{Currency: "USD", Subtotal: 200000, Discount: 20000, Tax: 14400, Total: 194400}
+	display := displayAmounts(language.AmericanEnglish, response)
+	if display.Locale != "en-US" || display.Total != "$1,944.00" || display.Tip != "$0.00" {
+		t.Errorf("displayAmounts = %+v", display)
+	}
+}
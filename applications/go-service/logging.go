@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// loadLogFormat reads LOG_FORMAT: "json", the default, for the cluster's log
+// pipeline, or "text" for reading locally
+func loadLogFormat() string {
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), LogFormatText) {
+		return LogFormatText
+	}
+	return LogFormatJSON
+}
+
+// loadLogLevel reads LOG_LEVEL: debug, info (the default), warn, or error
+func loadLogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// logLevel is the minimum level written, starting at LOG_LEVEL and changed
+// at runtime by SIGHUP
+var logLevel slog.LevelVar
+
+// toggleDebug switches level to debug, or back to base when it is already
+// there, so an incident can get debug logs without a restart. It reports
+// the new level.
+func toggleDebug(level *slog.LevelVar, base slog.Level) slog.Level {
+	if level.Level() == slog.LevelDebug {
+		level.Set(base)
+	} else {
+		level.Set(slog.LevelDebug)
+	}
+	return level.Level()
+}
+
+// watchLogLevel toggles logLevel on every SIGHUP until ctx is done
+func watchLogLevel(ctx context.Context, base slog.Level) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			// Logged at warn so it shows whichever way the switch went
+			slog.Warn("log level changed by SIGHUP", "level", toggleDebug(&logLevel, base).String())
+		}
+	}
+}
+
+// newLogger writes records at level or above to w in format, each carrying
+// the service and environment so lines from every service can share one
+// index
+func newLogger(w io.Writer, format string, level slog.Leveler, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLogAttr}
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if format == LogFormatText {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler}).With("service", cfg.ServiceName, "env", cfg.Environment)
+}
+
+// contextHandler adds the request_id, and the trace_id and span_id of the
+// span, found in a record's context, so a log line links to its request
+// and trace. Records logged without a context, or outside a request, are
+// passed through unchanged.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// replaceLogAttr writes durations as seconds, like the metrics, rather than
+// slog's nanoseconds
+func replaceLogAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		return slog.Float64(a.Key, a.Value.Duration().Seconds())
+	}
+	return a
+}
+
+// fatal logs msg at error level and exits, for startup failures the service
+// can't run without
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewLogger(t *testing.T) {
+	cfg := Config{ServiceName: "go-service", Environment: "staging"}
+
+	var buf bytes.Buffer
+	newLogger(&buf, LogFormatJSON, slog.LevelInfo, cfg).Error("request failed",
+		"route", "/api/v1/process-transaction", "status", 500, "duration", 1500*time.Millisecond)
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("JSON line %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":    "ERROR",
+		"msg":      "request failed",
+		"service":  "go-service",
+		"env":      "staging",
+		"route":    "/api/v1/process-transaction",
+		"status":   float64(500),
+		"duration": 1.5,
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+
+	buf.Reset()
+	newLogger(&buf, LogFormatText, slog.LevelInfo, cfg).Info("starting server", "port", "8080")
+	if line := buf.String(); !strings.Contains(line, `msg="starting server"`) || !strings.Contains(line, "service=go-service env=staging port=8080") {
+		t.Errorf("text line = %q", line)
+	}
+}
+
+func TestLoadLogFormat(t *testing.T) {
+	for env, want := range map[string]string{"": LogFormatJSON, "json": LogFormatJSON, "TEXT": LogFormatText, "logfmt": LogFormatJSON} {
+		t.Setenv("LOG_FORMAT", env)
+		if got := loadLogFormat(); got != want {
+			t.Errorf("LOG_FORMAT=%q: got %q, want %q", env, got, want)
+		}
+	}
+}
+
+func TestToggleDebug(t *testing.T) {
+	tests := []struct {
+		base       slog.Level
+		start      slog.Level
+		wantToggle slog.Level
+	}{
+		{slog.LevelInfo, slog.LevelInfo, slog.LevelDebug},
+		{slog.LevelInfo, slog.LevelDebug, slog.LevelInfo},
+		{slog.LevelWarn, slog.LevelWarn, slog.LevelDebug},
+		{slog.LevelDebug, slog.LevelDebug, slog.LevelDebug},
+	}
+	for _, tt := range tests {
+		var level slog.LevelVar
+		level.Set(tt.start)
+		if got := toggleDebug(&level, tt.base); got != tt.wantToggle || level.Level() != tt.wantToggle {
+			t.Errorf("toggle from %v (base %v) = %v, want %v", tt.start, tt.base, got, tt.wantToggle)
+		}
+	}
+}
+
+func TestLoadLogLevel(t *testing.T) {
+	for env, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError, "verbose": slog.LevelInfo} {
+		t.Setenv("LOG_LEVEL", env)
+		if got := loadLogLevel(); got != want {
+			t.Errorf("LOG_LEVEL=%q: got %v, want %v", env, got, want)
+		}
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, LogFormatJSON, slog.LevelInfo, Config{ServiceName: "go-service"}).With("worker", "jobs")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.WithValue(context.Background(), requestIDKey{}, "req-1"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}))
+
+	tests := []struct {
+		name                string
+		ctx                 context.Context
+		wantTrace, wantSpan any
+		wantRequest         any
+	}{
+		{"traced", ctx, traceID.String(), spanID.String(), "req-1"},
+		{"untraced", context.Background(), nil, nil, nil},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		logger.InfoContext(tt.ctx, "job failed")
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["trace_id"] != tt.wantTrace || record["span_id"] != tt.wantSpan {
+			t.Errorf("%s: trace_id, span_id = %v, %v, want %v, %v", tt.name, record["trace_id"], record["span_id"], tt.wantTrace, tt.wantSpan)
+		}
+		if record["request_id"] != tt.wantRequest {
+			t.Errorf("%s: request_id = %v, want %v", tt.name, record["request_id"], tt.wantRequest)
+		}
+		if record["worker"] != "jobs" || record["service"] != "go-service" {
+			t.Errorf("%s: lost the logger's attributes: %v", tt.name, record)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// LoyaltyConfig sets how points are earned and what they are worth. Both
+// are expressed in the reporting currency: PointsPerUnit points for every
+// whole unit (e.g. 1.00 USD) spent, and PointValue per point redeemed.
+type LoyaltyConfig struct {
+	PointsPerUnit float64
+	PointValue    Money
+}
+
+type LoyaltyEntry struct {
+	TransactionID string `json:"transaction_id,omitempty"`
+	Points        int64  `json:"points"`
+	Reason        string `json:"reason"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type LoyaltyAccount struct {
+	CustomerID string         `json:"customer_id"`
+	Balance    int64          `json:"balance"`
+	Entries    []LoyaltyEntry `json:"entries"`
+}
+
+func loadLoyaltyConfig() LoyaltyConfig {
+	cfg := LoyaltyConfig{PointsPerUnit: 1, PointValue: 1}
+
+	if val := os.Getenv("LOYALTY_POINTS_PER_UNIT"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed >= 0 {
+			cfg.PointsPerUnit = parsed
+		}
+	}
+	if val := os.Getenv("LOYALTY_POINT_VALUE"); val != "" {
+		if parsed, err := parseMoney(val); err == nil && parsed >= 0 {
+			cfg.PointValue = parsed
+		}
+	}
+
+	return cfg
+}
+
+// pointsEarned converts a spend into whole points, rounding down
+func (c LoyaltyConfig) pointsEarned(amount Money) int64 {
+	if amount <= 0 {
+		return 0
+	}
+	return amount.decimal().Mul(decimal.NewFromFloat(c.PointsPerUnit)).Div(decimal.NewFromInt(100)).IntPart()
+}
+
+// redemption returns how many of the requested points can be spent without
+// the discount exceeding limit, and what they are worth
+func (c LoyaltyConfig) redemption(points int64, limit Money) (int64, Money) {
+	if c.PointValue <= 0 || points <= 0 || limit <= 0 {
+		return 0, 0
+	}
+	used := min(points, limit.Cents()/c.PointValue.Cents())
+	return used, c.PointValue.Mul(int(used))
+}
+
+// lockLoyaltyBalance reads a customer's balance and holds the row until the
+// caller's transaction ends, so concurrent redemptions can't overspend it
+func lockLoyaltyBalance(ctx context.Context, tx pgx.Tx, customerID uuid.UUID) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(ctx, `SELECT loyalty_points FROM customers WHERE id = $1 FOR UPDATE`, customerID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("lock loyalty balance: %w", err)
+	}
+	return balance, nil
+}
+
+// recordLoyalty applies a transaction's earned and redeemed points to the
+// customer's balance and ledger
+func recordLoyalty(ctx context.Context, tx pgx.Tx, customerID, transactionID uuid.UUID, earned, redeemed int64) error {
+	if earned == 0 && redeemed == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE customers SET loyalty_points = loyalty_points + $2 - $3 WHERE id = $1
+	`, customerID, earned, redeemed)
+	if err != nil {
+		return fmt.Errorf("update loyalty balance: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO loyalty_ledger (customer_id, transaction_id, points, reason)
+		SELECT $1, $2, points, reason
+		FROM (VALUES (-$4::bigint, 'redeemed'), ($3::bigint, 'earned')) AS entries(points, reason)
+		WHERE points <> 0
+	`, customerID, transactionID, earned, redeemed)
+	if err != nil {
+		return fmt.Errorf("record loyalty ledger: %w", err)
+	}
+	return nil
+}
+
+// reverseLoyalty undoes a voided transaction's points: earned points are
+// taken back and redeemed points returned
+func reverseLoyalty(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		WITH net AS (
+			SELECT customer_id, SUM(points) AS points
+			FROM loyalty_ledger
+			WHERE transaction_id = $1
+			GROUP BY customer_id
+			HAVING SUM(points) <> 0
+		), reversed AS (
+			UPDATE customers c
+			SET loyalty_points = GREATEST(c.loyalty_points - net.points, 0)
+			FROM net
+			WHERE c.id = net.customer_id
+		)
+		INSERT INTO loyalty_ledger (customer_id, transaction_id, points, reason)
+		SELECT customer_id, $1, -points, 'voided' FROM net
+	`, transactionID)
+	if err != nil {
+		return fmt.Errorf("reverse loyalty points: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) customerLoyaltyHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	account := LoyaltyAccount{CustomerID: customerID.String(), Entries: []LoyaltyEntry{}}
+	err = s.db.QueryRow(ctx, `SELECT loyalty_points FROM customers WHERE id = $1`, customerID).Scan(&account.Balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Customer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch loyalty balance", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT transaction_id, points, reason, created_at
+		FROM loyalty_ledger
+		WHERE customer_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 50
+	`, customerID)
+	if err != nil {
+		http.Error(w, "Failed to fetch loyalty history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entry         LoyaltyEntry
+			transactionID pgtype.UUID
+			createdAt     time.Time
+		)
+		if err := rows.Scan(&transactionID, &entry.Points, &entry.Reason, &createdAt); err != nil {
+			http.Error(w, "Failed to read loyalty history", http.StatusInternalServerError)
+			return
+		}
+		if transactionID.Valid {
+			entry.TransactionID = uuid.UUID(transactionID.Bytes).String()
+		}
+		entry.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		account.Entries = append(account.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read loyalty history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(account)
+}
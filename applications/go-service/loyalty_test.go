@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestPointsEarned(t *testing.T) {
+	cfg := LoyaltyConfig{PointsPerUnit: 1, PointValue: 1}
+	tests := []struct {
+		amount Money
+		want   int64
+	}{
+		{0, 0},
+		{-500, 0},
+		{99, 0},
+		{1999, 19},
+		{10000, 100},
+	}
+	for _, tt := range tests {
+		if got := cfg.pointsEarned(tt.amount); got != tt.want {
+			t.Errorf("pointsEarned(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+
+	double := LoyaltyConfig{PointsPerUnit: 2.5}
+	if got := double.pointsEarned(1000); got != 25 {
+		t.Errorf("pointsEarned at 2.5/unit = %d, want 25", got)
+	}
+}
+
+func TestRedemption(t *testing.T) {
+	cfg := LoyaltyConfig{PointValue: 5}
+	tests := []struct {
+		name      string
+		points    int64
+		limit     Money
+		wantUsed  int64
+		wantValue Money
+	}{
+		{"under limit", 100, 10000, 100, 500},
+		{"capped by limit", 100, 203, 40, 200},
+		{"nothing left to pay", 100, 0, 0, 0},
+		{"no points", 0, 10000, 0, 0},
+	}
+	for _, tt := range tests {
+		used, value := cfg.redemption(tt.points, tt.limit)
+		if used != tt.wantUsed || value != tt.wantValue {
+			t.Errorf("%s: redemption = %d, %v, want %d, %v", tt.name, used, value, tt.wantUsed, tt.wantValue)
+		}
+	}
+
+	if used, _ := (LoyaltyConfig{}).redemption(100, 10000); used != 0 {
+		t.Error("points without a value should not be redeemable")
+	}
+}
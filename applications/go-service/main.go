@@ -4,18 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/getsentry/sentry-go"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
@@ -23,6 +24,7 @@ type Config struct {
 	Port             string
 	ServiceName      string
 	Environment      string
+	DatabaseURL      string
 	DBHost           string
 	DBPort           string
 	DBName           string
@@ -32,104 +34,440 @@ type Config struct {
 	DBMaxConns       int32
 	DBConnectTimeout time.Duration
 	ShutdownTimeout  time.Duration
+	// DBConnectRetry sets how long startup waits for Postgres to come up
+	DBConnectRetry ConnectRetry
+	// Replica is an optional read replica for lag-tolerant queries
+	Replica ReplicaConfig
+	// JobPollInterval is how often the async worker checks for queued jobs
+	JobPollInterval time.Duration
+	// APIV1Sunset is announced in the Sunset header of deprecated v1 routes
+	APIV1Sunset time.Time
+	// CatalogPricing resolves item prices from the products table instead of
+	// trusting the prices submitted by the client
+	CatalogPricing bool
+	Shipping       ShippingConfig
+	// TaxRate applies unless overridden by the tax_rate setting
+	TaxRate float64
+	// CategoryTaxRates overrides the tax rate for item categories; the
+	// category_tax_rates table takes precedence
+	CategoryTaxRates map[string]float64
+	// ReportingCurrency is what stats and reports are normalized into
+	ReportingCurrency string
+	// Rounding is how computed tax and discounts are rounded to the cent
+	Rounding Rounding
+	// OrderLimits are the business rules every transaction must meet
+	OrderLimits OrderLimits
+	// Loyalty sets how loyalty points are earned and redeemed
+	Loyalty LoyaltyConfig
+	// DiscountStacking is how several submitted discount codes combine
+	DiscountStacking StackingPolicy
+	// PromotionsFile is a JSON ruleset used until one is stored in the database
+	PromotionsFile string
+	// PromotionsReloadInterval is how often the ruleset is re-read
+	PromotionsReloadInterval time.Duration
+	// Duplicates sets how near-duplicate submissions are caught
+	Duplicates DuplicateConfig
+	// Fraud selects the fraud scorer and when its score blocks a transaction
+	Fraud FraudConfig
+	// PricingEngine names the engine that prices transactions
+	PricingEngine string
+	// ItemCopyThreshold is the line count from which items are written with
+	// COPY instead of one INSERT each; zero always inserts
+	ItemCopyThreshold int
+	// MigrateOnStart applies pending migrations at startup; turn it off when
+	// they are run out-of-band with `go-service migrate up`
+	MigrateOnStart bool
+	// MigrationLockWait is how long to wait for another instance to finish
+	// migrating before giving up
+	MigrationLockWait time.Duration
+	// Storage is StoragePostgres, or StorageMemory to run without a database
+	Storage string
+	// Partitions sets how far ahead monthly transaction partitions exist
+	Partitions PartitionConfig
+	// Retention purges transactions past their retention period
+	Retention RetentionConfig
+	// Outbox delivers transaction events to a webhook or Kafka
+	Outbox OutboxConfig
+	// Reports sets how often the reporting views are refreshed
+	Reports ReportsConfig
+	// Timeouts bound statements and each kind of database operation
+	Timeouts QueryTimeouts
+	// QueryExecMode overrides how pgx sends queries, when set
+	QueryExecMode string
+	// SlowQueryThreshold is how long a query runs before it is logged; 0
+	// turns slow query logging off
+	SlowQueryThreshold time.Duration
+	// DBCredentialsFile, when set, is read for the user and password each
+	// time a connection is opened
+	DBCredentialsFile string
+	// PoolHealth sets when the primary counts as unreachable
+	PoolHealth PoolHealthConfig
+	// MetricsSyncInterval is how often the revenue totals in /metrics are
+	// reloaded from the database
+	MetricsSyncInterval time.Duration
+	// MetricExporters says whether /metrics is served and whether metrics
+	// are pushed over OTLP
+	MetricExporters MetricExporters
+	// LogFormat is LogFormatJSON or LogFormatText
+	LogFormat string
+	// LogLevel is the level logged at startup; SIGHUP toggles debug
+	LogLevel slog.Level
+	// AccessLog sets how many requests are logged
+	AccessLog AccessLogConfig
+	// ErrorReporting is where server errors and panics are reported
+	ErrorReporting ErrorReportingConfig
+	// StatsD is where metrics go when MetricExporters.StatsD is set
+	StatsD StatsDConfig
+	// Auth is how API callers are authenticated
+	Auth AuthConfig
+	// TLS is the certificate Port is served with, and the CAs client
+	// certificates must be signed by; empty serves plain HTTP
+	TLS TLSConfig
+	// CORS is which browser origins may call the API
+	CORS CORSConfig
+	// RateLimit is how many requests each client may make to the API
+	RateLimit RateLimitConfig
+	// PushgatewayURL is where batch commands push their metrics; empty
+	// leaves them unpushed
+	PushgatewayURL string
+	// AdminPort serves the probes, /metrics, pprof, and the other
+	// diagnostics instead of Port; empty leaves the probes and /metrics on
+	// Port and the diagnostics off
+	AdminPort string
 }
 
 type HealthResponse struct {
 	Status    string `json:"status"`
 	Service   string `json:"service"`
+	Replica   string `json:"replica,omitempty"`
 	Timestamp string `json:"timestamp"`
 }
 
 // Transaction request structure
 type TransactionRequest struct {
-	Items      []Item  `json:"items"`
-	CustomerID string `json:"customer_id"`
+	Items        []Item `json:"items"`
+	CustomerID   string `json:"customer_id"`
 	DiscountCode string `json:"discount_code,omitempty"`
+	// DiscountCodes are combined with DiscountCode under the stacking policy
+	DiscountCodes []string `json:"discount_codes,omitempty"`
+	// RedeemPoints spends the customer's loyalty points as a discount
+	RedeemPoints int64 `json:"redeem_points,omitempty"`
+	// AuthorizeOnly leaves the transaction pending until it is captured or voided
+	AuthorizeOnly bool `json:"authorize_only,omitempty"`
+	// Tip is added to the total after tax and is never taxed or discounted
+	Tip Money `json:"tip,omitempty"`
+	// Region selects the tax jurisdiction (e.g. US-CA); when empty the
+	// configured flat TAX_RATE applies
+	Region string `json:"region,omitempty"`
+	// Currency is an ISO 4217 code; defaults to the reporting currency
+	Currency string `json:"currency,omitempty"`
+	// Metadata and Notes are stored with the transaction and searchable
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Notes    string         `json:"notes,omitempty"`
 }
 
 type Item struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Quantity int     `json:"quantity"`
-	Category string  `json:"category"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Quantity int    `json:"quantity"`
+	Category string `json:"category"`
+	// Weight in kilograms per unit, used by weight-based shipping
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// TransactionLine is one item's gross amount and its share of the discount
+// and tax, including discounts targeted at that line
+type TransactionLine struct {
+	Line     int    `json:"line"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Amount   Money  `json:"amount"`
+	Discount Money  `json:"discount"`
+	Tax      Money  `json:"tax"`
 }
 
 // Transaction response structure
 type TransactionResponse struct {
-	TransactionID string            `json:"transaction_id"`
-	CustomerID    string            `json:"customer_id"`
-	Items         []Item            `json:"items"`
-	Subtotal      float64           `json:"subtotal"`
-	Tax           float64           `json:"tax"`
-	Discount      float64           `json:"discount"`
-	Total         float64           `json:"total"`
-	Timestamp     string            `json:"timestamp"`
-	ProcessingTime string           `json:"processing_time_ms"`
+	TransactionID  string               `json:"transaction_id"`
+	CustomerID     string               `json:"customer_id"`
+	Status         string               `json:"status"`
+	Currency       string               `json:"currency"`
+	ExchangeRate   float64              `json:"exchange_rate"`
+	Items          []Item               `json:"items"`
+	Lines          []TransactionLine    `json:"lines,omitempty"`
+	Subtotal       Money                `json:"subtotal"`
+	Tax            Money                `json:"tax"`
+	Discount       Money                `json:"discount"`
+	Promotions     []AppliedPromotion   `json:"promotions,omitempty"`
+	DiscountCodes  []DiscountCodeResult `json:"discount_codes,omitempty"`
+	PointsEarned   int64                `json:"points_earned,omitempty"`
+	PointsRedeemed int64                `json:"points_redeemed,omitempty"`
+	Tip            Money                `json:"tip,omitempty"`
+	Shipping       Money                `json:"shipping,omitempty"`
+	Total          Money                `json:"total"`
+	TaxRate        float64              `json:"tax_rate"`
+	TaxLines       []TaxLine            `json:"tax_lines,omitempty"`
+	TaxInclusive   bool                 `json:"tax_inclusive,omitempty"`
+	Region         string               `json:"region,omitempty"`
+	Rounding       string               `json:"rounding,omitempty"`
+	DuplicateOf    string               `json:"duplicate_of,omitempty"`
+	TaxExemption   string               `json:"tax_exemption,omitempty"`
+	InvoiceNumber  int64                `json:"invoice_number,omitempty"`
+	Metadata       map[string]any       `json:"metadata,omitempty"`
+	Notes          string               `json:"notes,omitempty"`
+	Timestamp      string               `json:"timestamp"`
+	ProcessingTime string               `json:"processing_time_ms,omitempty"`
+	Display        *DisplayAmounts      `json:"display,omitempty"`
 }
 
 // Service statistics
 type ServiceStats struct {
-	Service            string  `json:"service"`
-	TotalTransactions  int64   `json:"total_transactions"`
-	TotalRevenue       float64 `json:"total_revenue"`
-	AverageOrderValue  float64 `json:"average_order_value"`
-	Version            string  `json:"version"`
-	Environment        string  `json:"environment"`
+	Service           string          `json:"service"`
+	TotalTransactions int64           `json:"total_transactions"`
+	ReportingCurrency string          `json:"reporting_currency"`
+	TotalRevenue      Money           `json:"total_revenue"`
+	TotalRefunded     Money           `json:"total_refunded"`
+	TotalTips         Money           `json:"total_tips"`
+	AverageOrderValue Money           `json:"average_order_value"`
+	ByCurrency        []CurrencyStats `json:"by_currency"`
+	Version           string          `json:"version"`
+	Environment       string          `json:"environment"`
 }
 
-const (
-	TAX_RATE = 0.08 // 8% tax rate
-)
-
 type Server struct {
-	config Config
-	db     *pgxpool.Pool
+	config     Config
+	db         *pgxpool.Pool
+	workers    sync.WaitGroup
+	promotions atomic.Pointer[PromotionRuleset]
+	// fraud scores transactions before commit; nil when scoring is off
+	fraud FraudScorer
+	// pricing computes subtotals, discounts and tax
+	pricing PricingEngine
+	// store holds transactions; db is nil when it is the memory store
+	store TransactionStore
+	// idempotent processes requests sent with an Idempotency-Key; nil on
+	// memory storage, which ignores keys
+	idempotent idempotentProcessor
+	// replica serves reader() while replicaHealthy; nil when not configured
+	replica        *pgxpool.Pool
+	replicaHealthy atomic.Bool
+	// Near-duplicate submissions caught, by the action taken
+	duplicatesRejected atomic.Int64
+	duplicatesFlagged  atomic.Int64
+	// persistBatchSizes counts statements per batch that persists a transaction
+	persistBatchSizes prometheus.Histogram
+	// orderValues, orderItems, and orderDiscounts describe each transaction
+	// created; see recordCommitted
+	orderValues    prometheus.Histogram
+	orderItems     prometheus.Histogram
+	orderDiscounts prometheus.Histogram
+	// retentionPurged counts transactions purged by this instance, and
+	// retentionPending what the last dry run would have purged
+	retentionPurged  atomic.Int64
+	retentionPending atomic.Int64
+	// events fans transaction events out to stream subscribers, counting in
+	// eventsDropped those lost to subscribers that fell behind
+	events        eventBroker
+	eventsDropped atomic.Int64
+	// outbox is nil unless a sink is configured
+	outbox          outboxSink
+	outboxPublished atomic.Int64
+	outboxFailures  atomic.Int64
+	outboxPending   atomic.Int64
+	// slowQueries traces the pools' queries; nil when the threshold is 0
+	slowQueries *slowQueryLog
+	// dbReady is false while the pool supervisor finds the primary down
+	dbReady    atomic.Bool
+	poolResets atomic.Int64
+	// registry holds everything /metrics reports; see initMetrics
+	registry      *prometheus.Registry
+	httpRequests  *prometheus.CounterVec
+	httpDurations *prometheus.HistogramVec
+	// revenue backs the revenue series in /metrics
+	revenue revenueCounter
+	// statsd is nil unless METRICS_BACKEND is statsd
+	statsd *statsdSink
+	// auth checks the API routes' bearer tokens; nil when AUTH_JWKS_URL
+	// isn't set
+	auth *jwtAuth
+	// apiKeys checks X-API-Key; nil unless AUTH_API_KEYS is set
+	apiKeys *apiKeyAuth
+	// tls holds the certificate Port is served with; nil for plain HTTP
+	tls *certReloader
+	// limiter is nil unless RATE_LIMIT_RPS is set, ipLimiter unless it or
+	// RATE_LIMIT_IP_RPS is; rateLimited counts the requests they refused
+	limiter     *rateLimiter
+	ipLimiter   *rateLimiter
+	rateLimited atomic.Int64
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		os.Exit(runPurgeCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "api-key" {
+		os.Exit(runAPIKeyCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	config := loadConfig()
+	logLevel.Set(config.LogLevel)
+	slog.SetDefault(newLogger(os.Stderr, config.LogFormat, &logLevel, config))
+
 	// Initialize OpenTelemetry tracing first
 	tp, err := initTracing()
 	if err != nil {
-		log.Printf("failed to initialize tracing: %v (continuing without tracing)", err)
+		slog.Warn("failed to initialize tracing, continuing without tracing", "error", err)
 	} else {
 		defer func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 			if err := tp.Shutdown(ctx); err != nil {
-				log.Printf("failed to shutdown tracer provider: %v", err)
+				slog.Error("failed to shutdown tracer provider", "error", err)
 			}
 		}()
 	}
 
-	config := loadConfig()
+	if config.ErrorReporting.DSN != "" {
+		if err := initErrorReporting(config.ErrorReporting); err != nil {
+			slog.Warn("failed to configure error reporting, continuing without it", "error", err)
+		} else {
+			defer sentry.Flush(2 * time.Second)
+		}
+	}
 
 	ctx := context.Background()
-	dbPool, err := initDatabase(ctx, config)
+	server := &Server{config: config}
+	if config.Storage == StorageMemory {
+		slog.Warn("storage is in memory: transactions are lost on exit and routes that need Postgres answer 503")
+		server.store = newMemoryStore(server)
+	} else {
+		server.slowQueries = newSlowQueryLog(config.SlowQueryThreshold)
+		dbPool, err := initDatabase(ctx, config, server.slowQueries)
+		if err != nil {
+			fatal("failed to connect to Postgres", "error", err)
+		}
+		defer dbPool.Close()
+
+		if config.MigrateOnStart {
+			if err := runMigrations(ctx, dbPool, config.migrationLimits()); err != nil {
+				fatal("failed to run migrations", "error", err)
+			}
+		}
+		server.db = dbPool
+		server.dbReady.Store(true)
+		server.store = postgresStore{s: server}
+		server.idempotent = server.processIdempotentTransaction
+	}
+
+	server.fraud, err = newFraudScorer(config.Fraud)
 	if err != nil {
-		log.Fatalf("failed to connect to Postgres: %v", err)
+		slog.Warn("failed to configure fraud scorer, continuing with rule-based scoring", "error", err)
+		server.fraud = ruleFraudScorer{HighAmount: config.Fraud.HighAmount, VelocityLimit: config.Fraud.VelocityLimit}
 	}
-	defer dbPool.Close()
 
-	if err := runMigrations(ctx, dbPool); err != nil {
-		log.Fatalf("failed to run migrations: %v", err)
+	server.pricing, err = newPricingEngine(config.PricingEngine)
+	if err != nil {
+		slog.Warn("failed to configure pricing engine, continuing with standard pricing", "error", err)
+		server.pricing = standardPricing{}
+	}
+
+	server.outbox, err = newOutboxSink(config.Outbox)
+	if err != nil {
+		slog.Warn("failed to configure outbox sink, events are kept in the outbox until it is", "error", err)
+	}
+	if server.outbox != nil {
+		defer server.outbox.Close()
+	}
+
+	if err := server.initReplica(ctx); err != nil {
+		slog.Warn("failed to configure read replica, continuing with reads on the primary", "error", err)
+	}
+	if server.replica != nil {
+		defer server.replica.Close()
+	}
+
+	if _, err := server.reloadPromotions(ctx); err != nil {
+		slog.Warn("failed to load promotions, continuing without promotions", "error", err)
 	}
 
-	server := &Server{
-		config: config,
-		db:     dbPool,
+	if config.TLS.Enabled() {
+		server.tls, err = newCertReloader(config.TLS)
+		if err != nil {
+			fatal("failed to configure TLS", "error", err)
+		}
+		if config.TLS.ClientCAFile != "" && config.AdminPort == "" {
+			slog.Warn("mutual TLS without ADMIN_PORT: /health, /ready, and /metrics need a client certificate too, which probes and scrapes don't send")
+		}
+	}
+	if config.RateLimit.Rate > 0 {
+		server.limiter = newRateLimiter(config.RateLimit.Rate, config.RateLimit.Burst)
+	}
+	if config.RateLimit.IPRate > 0 {
+		server.ipLimiter = newRateLimiter(config.RateLimit.IPRate, config.RateLimit.IPBurst)
 	}
 
+	server.initMetrics()
+	if config.MetricExporters.OTLP {
+		mp, err := initMetricsExport(server.registry)
+		if err != nil {
+			slog.Warn("failed to configure OTLP metrics export, continuing without it", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := mp.Shutdown(ctx); err != nil {
+					slog.Error("failed to shutdown meter provider", "error", err)
+				}
+			}()
+		}
+	}
+	if config.MetricExporters.StatsD {
+		server.statsd, err = newStatsDSink(config.StatsD.Addr, server.registry, config.ServiceName)
+		if err != nil {
+			slog.Warn("failed to configure StatsD metrics, continuing without them", "error", err)
+		} else {
+			defer server.statsd.Close()
+		}
+	}
+	if config.Auth.JWKSURL != "" {
+		server.auth = newJWTAuth(config.Auth)
+	}
+	if config.Auth.APIKeys {
+		if server.db != nil {
+			server.apiKeys = newAPIKeyAuth(server.db, config.Timeouts.Read)
+		} else {
+			slog.Warn("API keys need Postgres, continuing without them")
+		}
+	}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", server.healthHandler)
-	mux.HandleFunc("/api/v1/process-transaction", server.processTransactionHandler)
-	mux.HandleFunc("/api/v1/stats", server.statsHandler)
-	mux.HandleFunc("/metrics", server.metricsHandler)
+	if config.AdminPort == "" {
+		server.registerOperational(mux)
+	}
+	handle(mux, "GET /version", server.versionHandler)
+	handle(mux, "GET /openapi.json", server.openAPIHandler)
+	handle(mux, "GET /docs", server.docsHandler)
+	for _, version := range server.apiVersions() {
+		version.register(mux)
+	}
 
+	var routes http.Handler = mux
+	if config.ErrorReporting.DSN != "" {
+		routes = reportServerErrors(mux)
+	}
+	if len(config.CORS.AllowedOrigins) > 0 {
+		routes = cors(config.CORS, routes)
+	}
 	// Wrap handler with OpenTelemetry HTTP instrumentation
-	handler := mux
+	handler := correlationHeaders(server.instrumentHTTP(routes))
+	if config.TLS.ClientCAFile != "" {
+		handler = recordClientCertificate(handler)
+	}
 	if tp != nil {
-		handler = otelhttp.NewHandler(mux, "go-service",
+		handler = otelhttp.NewHandler(handler, "go-service",
 			otelhttp.WithMessageEvents(otelhttp.ReadEvents, otelhttp.WriteEvents),
 		)
 	}
@@ -141,26 +479,80 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if server.tls != nil {
+		httpServer.TLSConfig = server.tls.serverConfig()
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	if server.db != nil {
+		server.startWorker(workerCtx, "pool-supervisor", server.runPoolSupervisor)
+		server.startWorker(workerCtx, "revenue-sync", server.runRevenueSync)
+		server.startWorker(workerCtx, "jobs", server.runJobWorker)
+		server.startWorker(workerCtx, "partitions", server.runPartitionMaintainer)
+		server.startWorker(workerCtx, "events", server.runEventListener)
+		server.startWorker(workerCtx, "reports", server.runReportRefresher)
+		if config.Retention.Days > 0 {
+			server.startWorker(workerCtx, "retention", server.runRetentionPurge)
+		}
+		if server.outbox != nil {
+			server.startWorker(workerCtx, "outbox", server.runOutboxPublisher)
+		}
+	}
+	server.startWorker(workerCtx, "promotions", server.runPromotionReloader)
+	if server.statsd != nil {
+		server.startWorker(workerCtx, "statsd", server.runStatsDFlush)
+	}
+	if server.auth != nil {
+		server.startWorker(workerCtx, "jwks", server.runJWKSRefresh)
+	}
+	if server.tls != nil {
+		server.startWorker(workerCtx, "tls-reload", server.runTLSReload)
+	}
+	if server.limiter != nil || server.ipLimiter != nil {
+		server.startWorker(workerCtx, "rate-limit-sweep", server.runRateLimitSweep)
+	}
+	server.startWorker(workerCtx, "log-level", func(ctx context.Context) { watchLogLevel(ctx, config.LogLevel) })
+	if server.replica != nil {
+		server.startWorker(workerCtx, "replica-monitor", server.runReplicaMonitor)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Starting %s on port %s", config.ServiceName, config.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+		slog.Info("starting server", "port", config.Port, "tls", config.TLS.Enabled(), "client_certificates", config.TLS.ClientCAFile != "")
+		if err := serve(httpServer); err != nil && err != http.ErrServerClosed {
+			fatal("server failed", "error", err)
 		}
 	}()
 
+	var adminServer *http.Server
+	if config.AdminPort != "" {
+		adminServer = server.newAdminServer(config.AdminPort)
+		go func() {
+			slog.Info("starting admin server", "port", config.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("admin server failed", "error", err)
+			}
+		}()
+	}
+
 	<-sigChan
-	log.Println("Shutdown signal received, terminating gracefully...")
+	slog.Info("shutdown signal received, terminating gracefully")
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 	defer cancel()
 
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("graceful shutdown failed: %v", err)
+		slog.Error("graceful shutdown failed", "error", err)
+	}
+	if adminServer != nil {
+		// Cut off any profile still running rather than wait for it
+		adminServer.Close()
 	}
+
+	stopWorkers()
+	server.workers.Wait()
 }
 
 func loadConfig() Config {
@@ -209,7 +601,20 @@ func loadConfig() Config {
 		dbSSLMode = "disable"
 	}
 
+	// Like pool_max_conns, a default_query_exec_mode in DATABASE_URL is only
+	// overridden when this is set
+	queryExecMode := os.Getenv("POSTGRES_QUERY_EXEC_MODE")
+	if _, ok := queryExecModes[queryExecMode]; !ok {
+		queryExecMode = ""
+	}
+
+	// DATABASE_URL may carry its own pool_max_conns, which only an explicit
+	// POSTGRES_MAX_CONNS overrides
+	databaseURL := os.Getenv("DATABASE_URL")
 	var dbMaxConns int32 = 4
+	if databaseURL != "" {
+		dbMaxConns = 0
+	}
 	if val := os.Getenv("POSTGRES_MAX_CONNS"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
 			dbMaxConns = int32(parsed)
@@ -230,19 +635,166 @@ func loadConfig() Config {
 		}
 	}
 
+	jobPollInterval := time.Second
+	if val := os.Getenv("JOB_POLL_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			jobPollInterval = parsed
+		}
+	}
+
+	var apiV1Sunset time.Time
+	if val := os.Getenv("API_V1_SUNSET"); val != "" {
+		if parsed, err := parseTimeParam(val, false); err == nil {
+			apiV1Sunset = parsed
+		}
+	}
+
+	catalogPricing := false
+	if val := os.Getenv("CATALOG_PRICING"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			catalogPricing = parsed
+		}
+	}
+
+	migrateOnStart := true
+	if val := os.Getenv("MIGRATE_ON_START"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			migrateOnStart = parsed
+		}
+	}
+
+	itemCopyThreshold := 20
+	if val := os.Getenv("ITEM_COPY_THRESHOLD"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			itemCopyThreshold = parsed
+		}
+	}
+
+	migrationLockWait := 5 * time.Minute
+	if val := os.Getenv("MIGRATION_LOCK_WAIT"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			migrationLockWait = parsed
+		}
+	}
+
+	storage := StoragePostgres
+	if val := os.Getenv("STORAGE"); val == StoragePostgres || val == StorageMemory {
+		storage = val
+	}
+
+	taxRate := 0.08
+	if val := os.Getenv("TAX_RATE"); val != "" {
+		if parsed, err := parseTaxRate(val); err == nil {
+			taxRate = parsed
+		}
+	}
+
+	categoryTaxRates := map[string]float64{}
+	if val := os.Getenv("CATEGORY_TAX_RATES"); val != "" {
+		if parsed, err := parseCategoryTaxRates(val); err == nil {
+			categoryTaxRates = parsed
+		}
+	}
+
+	reportingCurrency := "USD"
+	if val := normalizeCurrency(os.Getenv("REPORTING_CURRENCY")); validCurrencyCode(val) {
+		reportingCurrency = val
+	}
+
+	discountStacking := StackingPolicy{Mode: StackBestOf, CapPercent: 100}
+	if val := os.Getenv("DISCOUNT_STACKING"); val == StackBestOf || val == StackAdditive {
+		discountStacking.Mode = val
+	}
+	if val := os.Getenv("DISCOUNT_STACKING_CAP"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && validPercentOff(parsed) {
+			discountStacking.CapPercent = parsed
+		}
+	}
+
+	promotionsReloadInterval := 30 * time.Second
+	if val := os.Getenv("PROMOTIONS_RELOAD_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			promotionsReloadInterval = parsed
+		}
+	}
+
+	metricsSyncInterval := time.Minute
+	if val := os.Getenv("METRICS_SYNC_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			metricsSyncInterval = parsed
+		}
+	}
+
+	slowQueryThreshold := 500 * time.Millisecond
+	if val := os.Getenv("SLOW_QUERY_THRESHOLD"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed >= 0 {
+			slowQueryThreshold = parsed
+		}
+	}
+
+	rounding, err := parseRounding(os.Getenv("ROUNDING_MODE"), os.Getenv("ROUNDING_SCOPE"))
+	if err != nil {
+		rounding = Rounding{Mode: RoundHalfUp, Scope: RoundPerLine}
+	}
+
 	return Config{
-		Port:             port,
-		ServiceName:      serviceName,
-		Environment:      env,
-		DBHost:           dbHost,
-		DBPort:           dbPort,
-		DBName:           dbName,
-		DBUser:           dbUser,
-		DBPassword:       dbPassword,
-		DBSSLMode:        dbSSLMode,
-		DBMaxConns:       dbMaxConns,
-		DBConnectTimeout: connectTimeout,
-		ShutdownTimeout:  shutdownTimeout,
+		Port:                     port,
+		ServiceName:              serviceName,
+		Environment:              env,
+		DatabaseURL:              databaseURL,
+		DBHost:                   dbHost,
+		DBPort:                   dbPort,
+		DBName:                   dbName,
+		DBUser:                   dbUser,
+		DBPassword:               dbPassword,
+		DBSSLMode:                dbSSLMode,
+		DBMaxConns:               dbMaxConns,
+		DBConnectTimeout:         connectTimeout,
+		DBConnectRetry:           loadConnectRetry(),
+		Replica:                  loadReplicaConfig(),
+		ShutdownTimeout:          shutdownTimeout,
+		JobPollInterval:          jobPollInterval,
+		APIV1Sunset:              apiV1Sunset,
+		CatalogPricing:           catalogPricing,
+		Shipping:                 loadShippingConfig(),
+		TaxRate:                  taxRate,
+		CategoryTaxRates:         categoryTaxRates,
+		ReportingCurrency:        reportingCurrency,
+		Rounding:                 rounding,
+		OrderLimits:              loadOrderLimits(),
+		Loyalty:                  loadLoyaltyConfig(),
+		DiscountStacking:         discountStacking,
+		PromotionsFile:           os.Getenv("PROMOTIONS_FILE"),
+		PromotionsReloadInterval: promotionsReloadInterval,
+		Duplicates:               loadDuplicateConfig(),
+		Fraud:                    loadFraudConfig(),
+		PricingEngine:            os.Getenv("PRICING_ENGINE"),
+		ItemCopyThreshold:        itemCopyThreshold,
+		MigrateOnStart:           migrateOnStart,
+		MigrationLockWait:        migrationLockWait,
+		Storage:                  storage,
+		Partitions:               loadPartitionConfig(),
+		Retention:                loadRetentionConfig(),
+		Outbox:                   loadOutboxConfig(),
+		Reports:                  loadReportsConfig(),
+		Timeouts:                 loadQueryTimeouts(),
+		QueryExecMode:            queryExecMode,
+		SlowQueryThreshold:       slowQueryThreshold,
+		DBCredentialsFile:        os.Getenv("POSTGRES_CREDENTIALS_FILE"),
+		PoolHealth:               loadPoolHealthConfig(),
+		MetricsSyncInterval:      metricsSyncInterval,
+		MetricExporters:          loadMetricExporters(),
+		LogFormat:                loadLogFormat(),
+		LogLevel:                 loadLogLevel(),
+		AccessLog:                loadAccessLogConfig(),
+		ErrorReporting:           loadErrorReportingConfig(env),
+		StatsD:                   loadStatsDConfig(),
+		AdminPort:                os.Getenv("ADMIN_PORT"),
+		PushgatewayURL:           os.Getenv("PUSHGATEWAY_URL"),
+		Auth:                     loadAuthConfig(),
+		TLS:                      loadTLSConfig(),
+		CORS:                     loadCORSConfig(),
+		RateLimit:                loadRateLimitConfig(),
 	}
 }
 
@@ -250,10 +802,10 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Health)
 	defer cancel()
 
-	dbErr := s.db.Ping(ctx)
+	dbErr := s.store.Ping(ctx)
 
 	status := "healthy"
 	if dbErr != nil {
@@ -263,6 +815,7 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    status,
 		Service:   s.config.ServiceName,
+		Replica:   s.replicaStatus(),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
@@ -277,161 +830,80 @@ func (s *Server) processTransactionHandler(w http.ResponseWriter, r *http.Reques
 
 	start := time.Now()
 
-	var req TransactionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	locale, localized, err := requestLocale(r)
+	if err != nil {
+		http.Error(w, "Invalid locale", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Items) == 0 {
-		http.Error(w, "Transaction must contain at least one item", http.StatusBadRequest)
+	var req TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, http.StatusBadRequest, "Invalid request body", decodeViolations(err))
 		return
 	}
 
-	subtotal := calculateSubtotal(req.Items)
-	discount := applyDiscount(subtotal, req.DiscountCode)
-	tax := calculateTax(subtotal-discount, TAX_RATE)
-	total := subtotal - discount + tax
-
-	transactionID := uuid.New()
-
-	var customerUUID pgtype.UUID
-	if req.CustomerID != "" {
-		if parsed, err := uuid.Parse(req.CustomerID); err == nil {
-			customerUUID = pgtype.UUID{
-				Bytes: parsed,
-				Valid: true,
-			}
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		if s.db == nil {
+			http.Error(w, "async processing requires a database", http.StatusServiceUnavailable)
+			return
 		}
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
-	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		s.enqueueTransaction(w, r, req)
 		return
 	}
-	defer tx.Rollback(ctx)
-
-	response := TransactionResponse{
-		TransactionID: transactionID.String(),
-		CustomerID:    req.CustomerID,
-		Items:         req.Items,
-		Subtotal:      subtotal,
-		Tax:           tax,
-		Discount:      discount,
-		Total:         total,
-		Timestamp:     time.Now().UTC().Format(time.RFC3339),
-	}
 
-	rawPayload, _ := json.Marshal(response)
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO transactions (id, customer_id, subtotal, tax, discount, total, raw_payload)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, transactionID, customerUUID, subtotal, tax, discount, total, rawPayload)
+	response, err := s.processTransactionOnce(ctx, w, r, req, start)
 	if err != nil {
-		http.Error(w, "Failed to persist transaction", http.StatusInternalServerError)
-		return
-	}
-
-	for _, item := range req.Items {
-		itemID := uuid.New()
-		metadata, _ := json.Marshal(map[string]any{
-			"source":   "go-service",
-			"category": item.Category,
-		})
-
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transaction_items (
-				id, transaction_id, product_id, name, category, unit_price, quantity, metadata
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`, itemID, transactionID, item.ID, item.Name, item.Category, item.Price, item.Quantity, metadata)
-		if err != nil {
-			http.Error(w, "Failed to persist transaction items", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		writeProcessError(w, r, err)
 		return
 	}
 
 	duration := time.Since(start)
 	response.ProcessingTime = fmt.Sprintf("%.2f", duration.Seconds()*1000)
+	if localized {
+		response.Display = displayAmounts(locale, response)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(response)
 }
 
-// Business Logic: Calculate subtotal from items
-func calculateSubtotal(items []Item) float64 {
-	var subtotal float64
+// Business Logic: Calculate subtotal from items, which OrderLimits has
+// already checked for quantities and prices out of range
+func calculateSubtotal(items []Item) Money {
+	var subtotal Money
 	for _, item := range items {
-		if item.Quantity <= 0 || item.Price < 0 {
-			continue // Skip invalid items
-		}
-		subtotal += item.Price * float64(item.Quantity)
+		subtotal += item.Price.Mul(item.Quantity)
 	}
 	return subtotal
 }
 
-// Business Logic: Apply discount codes
-func applyDiscount(subtotal float64, discountCode string) float64 {
-	if discountCode == "" {
-		return 0
-	}
-
-	// Discount rules
-	discounts := map[string]float64{
-		"SAVE10":  0.10, // 10% off
-		"SAVE20":  0.20, // 20% off
-		"WELCOME": 0.15, // 15% off for new customers
-		"VIP":     0.25, // 25% off for VIP customers
-	}
-
-	if discount, exists := discounts[discountCode]; exists {
-		return subtotal * discount
-	}
-
-	return 0
-}
-
-// Business Logic: Calculate tax
-func calculateTax(subtotal float64, taxRate float64) float64 {
-	return subtotal * taxRate
-}
-
 func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
 	defer cancel()
 
-	var count int64
-	var revenue float64
-	err := s.db.QueryRow(ctx, `SELECT COUNT(*), COALESCE(SUM(total), 0) FROM transactions`).Scan(&count, &revenue)
+	totals, err := s.store.RevenueTotals(ctx)
 	if err != nil {
 		http.Error(w, "Failed to fetch statistics", http.StatusInternalServerError)
 		return
 	}
 
-	avg := 0.0
-	if count > 0 {
-		avg = revenue / float64(count)
-	}
-
 	stats := ServiceStats{
 		Service:           s.config.ServiceName,
-		TotalTransactions: count,
-		TotalRevenue:      revenue,
-		AverageOrderValue: avg,
-		Version:           "1.0.0",
+		TotalTransactions: totals.Transactions,
+		ReportingCurrency: s.config.ReportingCurrency,
+		TotalRevenue:      totals.Revenue,
+		TotalRefunded:     totals.Refunded,
+		TotalTips:         totals.Tips,
+		AverageOrderValue: totals.Revenue.MulFrac(1, totals.Transactions),
+		ByCurrency:        totals.ByCurrency,
+		Version:           version,
 		Environment:       s.config.Environment,
 	}
 
@@ -439,30 +911,3 @@ func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Prometheus metrics endpoint
-func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-
-	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
-	defer cancel()
-
-	var count int64
-	var revenue float64
-	err := s.db.QueryRow(ctx, `SELECT COUNT(*), COALESCE(SUM(total), 0) FROM transactions`).Scan(&count, &revenue)
-	if err != nil {
-		http.Error(w, "Failed to fetch metrics", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Fprintf(w, "# HELP http_requests_total Total number of processed transactions\n")
-	fmt.Fprintf(w, "# TYPE http_requests_total counter\n")
-	fmt.Fprintf(w, "http_requests_total{service=\"%s\",method=\"total\"} %d\n", s.config.ServiceName, count)
-
-	fmt.Fprintf(w, "# HELP service_revenue_total Total revenue processed\n")
-	fmt.Fprintf(w, "# TYPE service_revenue_total counter\n")
-	fmt.Fprintf(w, "service_revenue_total{service=\"%s\"} %.2f\n", s.config.ServiceName, revenue)
-
-	fmt.Fprintf(w, "# HELP service_up Service availability\n")
-	fmt.Fprintf(w, "# TYPE service_up gauge\n")
-	fmt.Fprintf(w, "service_up{service=\"%s\"} 1\n", s.config.ServiceName)
-}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// sizeBuckets are the upper bounds of the batch size and item count
+// histograms
+var sizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100}
+
+// amountBuckets are the upper bounds, in whole units of the reporting
+// currency, of the order value and discount histograms. The 0 bucket counts
+// undiscounted orders.
+var amountBuckets = []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// initMetrics creates the server's instruments and the registry /metrics
+// serves. Every series carries the service name as a constant label, as it
+// did before the registry, so dashboards and alerts keep matching. It runs
+// once the store, pools, and outbox are set up, since what is registered
+// depends on them.
+func (s *Server) initMetrics() {
+	s.registry = prometheus.NewRegistry()
+	if s.db == nil {
+		// The memory store starts empty and all of it passes through here
+		s.revenue.set(revenueTotals{ByCurrency: []CurrencyStats{}})
+	}
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"service": s.config.ServiceName}, s.registry)
+
+	s.persistBatchSizes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "service_persist_batch_size",
+		Help:    "Statements sent in each batch that persists a transaction and its items",
+		Buckets: sizeBuckets,
+	})
+	s.orderValues = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "service_transaction_value",
+		Help:    "Total of each transaction created, in the reporting currency",
+		Buckets: amountBuckets,
+	})
+	s.orderItems = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "service_transaction_items",
+		Help:    "Units ordered in each transaction created",
+		Buckets: sizeBuckets,
+	})
+	s.orderDiscounts = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "service_transaction_discount",
+		Help:    "Discount given on each transaction created, in the reporting currency",
+		Buckets: amountBuckets,
+	})
+	s.httpRequests, s.httpDurations = newHTTPMetrics()
+	reg.MustRegister(s.persistBatchSizes, s.orderValues, s.orderItems, s.orderDiscounts,
+		s.httpRequests, s.httpDurations, revenueCollector{s})
+
+	reg.MustRegister(
+		counterFunc("service_duplicate_transactions_total", "Near-duplicate submissions caught by this instance",
+			prometheus.Labels{"action": DuplicateReject}, &s.duplicatesRejected),
+		counterFunc("service_duplicate_transactions_total", "Near-duplicate submissions caught by this instance",
+			prometheus.Labels{"action": DuplicateFlag}, &s.duplicatesFlagged),
+		counterFunc("service_retention_purged_total", "Transactions deleted or anonymized by the retention purge on this instance",
+			prometheus.Labels{"action": s.config.Retention.Action}, &s.retentionPurged),
+		counterFunc("service_events_dropped_total", "Transaction events not delivered to stream subscribers that fell behind",
+			nil, &s.eventsDropped),
+	)
+	if s.config.Retention.DryRun {
+		reg.MustRegister(gaugeFunc("service_retention_pending", "Transactions the last dry run of the retention purge would have purged",
+			prometheus.Labels{"action": s.config.Retention.Action}, &s.retentionPending))
+	}
+	if s.config.Outbox.Sink != "" {
+		sink := prometheus.Labels{"sink": s.config.Outbox.Sink}
+		reg.MustRegister(
+			counterFunc("service_outbox_published_total", "Outbox events delivered to the sink by this instance", sink, &s.outboxPublished),
+			counterFunc("service_outbox_failures_total", "Failed outbox deliveries on this instance", sink, &s.outboxFailures),
+			gaugeFunc("service_outbox_pending", "Outbox events not yet delivered, as of the publisher's last pass", sink, &s.outboxPending),
+		)
+	}
+
+	if s.db != nil {
+		reg.MustRegister(
+			poolCollector{s},
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "service_db_ready",
+				Help: "Whether the pool supervisor can reach the primary database",
+			}, func() float64 {
+				if s.dbReady.Load() {
+					return 1
+				}
+				return 0
+			}),
+			counterFunc("service_db_pool_resets_total", "Times the pool supervisor dropped the pools' connections to reconnect", nil, &s.poolResets),
+		)
+	}
+	if s.slowQueries != nil {
+		reg.MustRegister(s.slowQueries.counts)
+	}
+	if s.limiter != nil || s.ipLimiter != nil {
+		reg.MustRegister(counterFunc("service_rate_limited_total", "API requests refused with 429 for going over their client's rate limit", nil, &s.rateLimited))
+	}
+	if s.tls != nil {
+		reg.MustRegister(
+			gaugeFunc("service_tls_certificate_expiry_timestamp_seconds", "When the certificate being served expires", nil, &s.tls.expiry),
+			counterFunc("service_tls_reload_failures_total", "Checks that found the certificate files changed but couldn't load them", nil, &s.tls.failures),
+		)
+	}
+
+	// The standard go_* and process_* series: goroutines, GC pauses, heap,
+	// and the process's CPU time, memory, and file descriptors
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	one := func() float64 { return 1 }
+	reg.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "service_build_info",
+			Help:        "Build metadata for the running binary",
+			ConstLabels: prometheus.Labels{"version": version, "git_sha": gitSHA, "build_time": buildTime},
+		}, one),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "service_up",
+			Help:        "Service availability",
+			ConstLabels: prometheus.Labels{"version": version},
+		}, one),
+	)
+}
+
+// recordCommitted observes a newly created transaction in the
+// per-transaction histograms and the revenue counter. Callers run it once
+// the transaction has committed, so work rolled back with a failed atomic
+// batch isn't counted, and never for an idempotent replay.
+func (s *Server) recordCommitted(response TransactionResponse) {
+	units := 0
+	for _, item := range response.Items {
+		units += item.Quantity
+	}
+	s.orderValues.Observe(moneyValue(response.Total.MulRate(response.ExchangeRate)))
+	s.orderItems.Observe(float64(units))
+	s.orderDiscounts.Observe(moneyValue(response.Discount.MulRate(response.ExchangeRate)))
+	s.revenue.add(response)
+	transactionsProcessed.Add(1)
+}
+
+// metricsHandler serves the registry. Exemplars are only written in the
+// OpenMetrics format, which Prometheus asks for when exemplar storage is
+// enabled; other scrapers get the text format as before.
+func (s *Server) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+func counterFunc(name, help string, labels prometheus.Labels, value *atomic.Int64) prometheus.Collector {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels},
+		func() float64 { return float64(value.Load()) })
+}
+
+func gaugeFunc(name, help string, labels prometheus.Labels, value *atomic.Int64) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels},
+		func() float64 { return float64(value.Load()) })
+}
+
+// revenueCollector reports the server's revenueCounter. Until it has synced
+// once, the revenue series are left out rather than reported as zeros.
+type revenueCollector struct {
+	s *Server
+}
+
+var (
+	transactionsDesc = prometheus.NewDesc("service_transactions_total", "Total number of processed transactions", nil, nil)
+	revenueDesc      = prometheus.NewDesc("service_revenue_total", "Total revenue processed, net of refunds, in the reporting currency", []string{"currency"}, nil)
+	nativeDesc       = prometheus.NewDesc("service_revenue_native_total", "Revenue net of refunds in each booking currency", []string{"currency"}, nil)
+	refundsDesc      = prometheus.NewDesc("service_refunds_total", "Total amount refunded", nil, nil)
+	tipsDesc         = prometheus.NewDesc("service_tips_total", "Total tips collected", nil, nil)
+)
+
+func (c revenueCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{transactionsDesc, revenueDesc, nativeDesc, refundsDesc, tipsDesc} {
+		ch <- desc
+	}
+}
+
+func (c revenueCollector) Collect(ch chan<- prometheus.Metric) {
+	totals, synced := c.s.revenue.snapshot()
+	if !synced {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(transactionsDesc, prometheus.CounterValue, float64(totals.Transactions))
+	ch <- prometheus.MustNewConstMetric(revenueDesc, prometheus.CounterValue, moneyValue(totals.Revenue), c.s.config.ReportingCurrency)
+	for _, row := range totals.ByCurrency {
+		ch <- prometheus.MustNewConstMetric(nativeDesc, prometheus.CounterValue, moneyValue(row.Revenue), row.Currency)
+	}
+	ch <- prometheus.MustNewConstMetric(refundsDesc, prometheus.CounterValue, moneyValue(totals.Refunded))
+	ch <- prometheus.MustNewConstMetric(tipsDesc, prometheus.CounterValue, moneyValue(totals.Tips))
+}
+
+// moneyValue is m in whole units, the scale the hand-written metrics used
+func moneyValue(m Money) float64 {
+	return float64(m.Cents()) / 100
+}
+
+// poolSnapshot is one pool's pgxpool.Stat, copied out so the collector can
+// be tested without a database
+type poolSnapshot struct {
+	Pool                 string
+	AcquiredConns        int32
+	IdleConns            int32
+	ConstructingConns    int32
+	TotalConns           int32
+	MaxConns             int32
+	AcquireCount         int64
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
+	AcquireDuration      time.Duration
+	NewConnsCount        int64
+}
+
+func snapshotPool(name string, pool *pgxpool.Pool) poolSnapshot {
+	stat := pool.Stat()
+	return poolSnapshot{
+		Pool:                 name,
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		TotalConns:           stat.TotalConns(),
+		MaxConns:             stat.MaxConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+		NewConnsCount:        stat.NewConnsCount(),
+	}
+}
+
+// poolStats are the connection pool metrics, one sample per pool for each. A
+// pool is exhausted when acquired reaches max; empty acquires and the
+// acquire wait time then climb with every request that queues for a
+// connection.
+var poolStats = []struct {
+	desc  *prometheus.Desc
+	kind  prometheus.ValueType
+	value func(p poolSnapshot) float64
+}{
+	{poolDesc("db_pool_acquired_connections", "Connections currently checked out of the pool"), prometheus.GaugeValue,
+		func(p poolSnapshot) float64 { return float64(p.AcquiredConns) }},
+	{poolDesc("db_pool_idle_connections", "Idle connections in the pool"), prometheus.GaugeValue,
+		func(p poolSnapshot) float64 { return float64(p.IdleConns) }},
+	{poolDesc("db_pool_constructing_connections", "Connections being opened"), prometheus.GaugeValue,
+		func(p poolSnapshot) float64 { return float64(p.ConstructingConns) }},
+	{poolDesc("db_pool_total_connections", "Open connections, whether acquired, idle or being opened"), prometheus.GaugeValue,
+		func(p poolSnapshot) float64 { return float64(p.TotalConns) }},
+	{poolDesc("db_pool_max_connections", "Most connections the pool will open"), prometheus.GaugeValue,
+		func(p poolSnapshot) float64 { return float64(p.MaxConns) }},
+	{poolDesc("db_pool_acquires_total", "Connections acquired from the pool"), prometheus.CounterValue,
+		func(p poolSnapshot) float64 { return float64(p.AcquireCount) }},
+	{poolDesc("db_pool_empty_acquires_total", "Acquires that waited because no idle connection was available"), prometheus.CounterValue,
+		func(p poolSnapshot) float64 { return float64(p.EmptyAcquireCount) }},
+	{poolDesc("db_pool_canceled_acquires_total", "Acquires abandoned because their context ended first"), prometheus.CounterValue,
+		func(p poolSnapshot) float64 { return float64(p.CanceledAcquireCount) }},
+	{poolDesc("db_pool_acquire_wait_seconds_total", "Time spent acquiring connections, including waiting for one to be free"), prometheus.CounterValue,
+		func(p poolSnapshot) float64 { return p.AcquireDuration.Seconds() }},
+	{poolDesc("db_pool_new_connections_total", "Connections opened by the pool"), prometheus.CounterValue,
+		func(p poolSnapshot) float64 { return float64(p.NewConnsCount) }},
+}
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, []string{"pool"}, nil)
+}
+
+// poolCollector reports the primary pool's statistics, and the replica's
+// when there is one
+type poolCollector struct {
+	s *Server
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, stat := range poolStats {
+		ch <- stat.desc
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	pools := []poolSnapshot{snapshotPool("primary", c.s.db)}
+	if c.s.replica != nil {
+		pools = append(pools, snapshotPool("replica", c.s.replica))
+	}
+	collectPoolStats(ch, pools)
+}
+
+func collectPoolStats(ch chan<- prometheus.Metric, pools []poolSnapshot) {
+	for _, stat := range poolStats {
+		for _, p := range pools {
+			ch <- prometheus.MustNewConstMetric(stat.desc, stat.kind, stat.value(p), p.Pool)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrape returns what /metrics serves for s
+func scrape(t *testing.T, s *Server) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.metricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("/metrics answered %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Body.String()
+}
+
+func assertSeries(t *testing.T, out string, want ...string) {
+	t.Helper()
+	for _, line := range want {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics missing %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetricsKeepHandWrittenNames(t *testing.T) {
+	s := newMemoryServer()
+	s.config.Outbox.Sink = OutboxSinkWebhook
+	s.initMetrics()
+	_, err := s.store.ProcessTransaction(context.Background(), TransactionRequest{
+		Items: []Item{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 1}},
+		Tip:   250,
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.duplicatesFlagged.Add(2)
+	s.outboxPending.Store(7)
+
+	assertSeries(t, scrape(t, s),
+		"# TYPE service_transactions_total counter",
+		`service_transactions_total{service="go-service"} 1`,
+		`service_revenue_total{currency="USD",service="go-service"} 13.5`,
+		`service_tips_total{service="go-service"} 2.5`,
+		`service_duplicate_transactions_total{action="flag",service="go-service"} 2`,
+		`service_duplicate_transactions_total{action="reject",service="go-service"} 0`,
+		`service_outbox_pending{service="go-service",sink="webhook"} 7`,
+		`service_up{service="go-service",version="dev"} 1`,
+	)
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	s := newMemoryServer()
+	assertSeries(t, scrape(t, s),
+		"# TYPE go_goroutines gauge",
+		"# TYPE go_gc_duration_seconds summary",
+		"# TYPE go_memstats_heap_alloc_bytes gauge",
+		"# TYPE process_cpu_seconds_total counter",
+		"# TYPE process_resident_memory_bytes gauge",
+	)
+}
+
+func TestPersistBatchSizes(t *testing.T) {
+	s := newMemoryServer()
+	for _, size := range []float64{1, 3, 3, 20, 500} {
+		s.persistBatchSizes.Observe(size)
+	}
+
+	assertSeries(t, scrape(t, s),
+		"# TYPE service_persist_batch_size histogram",
+		`service_persist_batch_size_bucket{service="go-service",le="1"} 1`,
+		`service_persist_batch_size_bucket{service="go-service",le="2"} 1`,
+		`service_persist_batch_size_bucket{service="go-service",le="5"} 3`,
+		`service_persist_batch_size_bucket{service="go-service",le="20"} 4`,
+		`service_persist_batch_size_bucket{service="go-service",le="100"} 4`,
+		`service_persist_batch_size_bucket{service="go-service",le="+Inf"} 5`,
+		`service_persist_batch_size_sum{service="go-service"} 527`,
+		`service_persist_batch_size_count{service="go-service"} 5`,
+	)
+}
+
+type poolStatsSource []poolSnapshot
+
+func (p poolStatsSource) Describe(ch chan<- *prometheus.Desc) { poolCollector{}.Describe(ch) }
+func (p poolStatsSource) Collect(ch chan<- prometheus.Metric) { collectPoolStats(ch, p) }
+
+func TestPoolStats(t *testing.T) {
+	s := newMemoryServer()
+	prometheus.WrapRegistererWith(prometheus.Labels{"service": "go-service"}, s.registry).MustRegister(poolStatsSource{
+		{Pool: "primary", AcquiredConns: 10, MaxConns: 10, EmptyAcquireCount: 7, AcquireDuration: 1500 * time.Millisecond},
+		{Pool: "replica", IdleConns: 2, MaxConns: 4},
+	})
+
+	out := scrape(t, s)
+	assertSeries(t, out,
+		"# TYPE db_pool_acquired_connections gauge",
+		`db_pool_acquired_connections{pool="primary",service="go-service"} 10`,
+		`db_pool_acquired_connections{pool="replica",service="go-service"} 0`,
+		`db_pool_idle_connections{pool="replica",service="go-service"} 2`,
+		`db_pool_max_connections{pool="replica",service="go-service"} 4`,
+		"# TYPE db_pool_empty_acquires_total counter",
+		`db_pool_empty_acquires_total{pool="primary",service="go-service"} 7`,
+		`db_pool_acquire_wait_seconds_total{pool="primary",service="go-service"} 1.5`,
+	)
+}
+
+func TestTransactionHistograms(t *testing.T) {
+	s := newMemoryServer()
+	ctx := context.Background()
+	for _, items := range [][]Item{
+		{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 3}},
+		{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 1}, {ID: "p2", Name: "Gadget", Price: 50000, Quantity: 1}},
+	} {
+		if _, err := s.store.ProcessTransaction(ctx, TransactionRequest{Items: items}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertSeries(t, scrape(t, s),
+		`service_transaction_value_bucket{service="go-service",le="25"} 0`,
+		`service_transaction_value_bucket{service="go-service",le="50"} 1`,
+		`service_transaction_value_bucket{service="go-service",le="1000"} 2`,
+		`service_transaction_value_sum{service="go-service"} 594`,
+		`service_transaction_items_bucket{service="go-service",le="2"} 1`,
+		`service_transaction_items_bucket{service="go-service",le="5"} 2`,
+		`service_transaction_items_sum{service="go-service"} 5`,
+		`service_transaction_discount_bucket{service="go-service",le="0"} 2`,
+		`service_transaction_discount_count{service="go-service"} 2`,
+	)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// requestIDFromContext returns the ID correlationHeaders gave the request,
+// or "" outside one
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts an incoming X-Request-Id of up to 128 letters,
+// digits, and ._:- characters, so a caller's ID can be logged and stored
+// as-is without letting it inject anything
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// correlationHeaders gives every request an ID, the caller's X-Request-Id
+// when it sends a valid one and a new UUID otherwise. The ID goes in the
+// request context, for logs and anything the request writes, on the
+// request's span, and in the X-Request-Id response header. Traced
+// responses also get X-Trace-Id. Both headers are set before next writes
+// anything, so a client reporting a failure can quote an ID that finds
+// the request in Jaeger. It runs inside the otelhttp handler to see the
+// request's span.
+func correlationHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("request.id", id))
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			w.Header().Set("X-Trace-Id", sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestIDTransport forwards the request ID in ctx to the services this
+// one calls, so their logs share it
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := requestIDFromContext(req.Context()); id != "" && req.Header.Get(requestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(requestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
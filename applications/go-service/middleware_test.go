@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCorrelationHeaders(t *testing.T) {
+	handler := correlationHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed to process transaction", http.StatusInternalServerError)
+	}))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	traced := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}))
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantTrace string
+	}{
+		{"traced", traced, traceID.String()},
+		{"untraced", context.Background(), ""},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/process-transaction", nil).WithContext(tt.ctx))
+
+		if got := rec.Header().Get("X-Trace-Id"); got != tt.wantTrace {
+			t.Errorf("%s: X-Trace-Id = %q, want %q", tt.name, got, tt.wantTrace)
+		}
+		requestID := rec.Header().Get("X-Request-Id")
+		if _, err := uuid.Parse(requestID); err != nil || seen[requestID] {
+			t.Errorf("%s: X-Request-Id = %q, want a new UUID", tt.name, requestID)
+		}
+		seen[requestID] = true
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := correlationHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		incoming string
+		keep     bool
+	}{
+		{"lb-7f3a9c:42", true},
+		{"", false},
+		{"bad id\nwith newline", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/health", nil)
+		if tt.incoming != "" {
+			req.Header.Set("X-Request-Id", tt.incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-Id")
+		if seen != got {
+			t.Errorf("%q: context has %q, header %q", tt.incoming, seen, got)
+		}
+		if tt.keep && got != tt.incoming {
+			t.Errorf("%q: replaced with %q", tt.incoming, got)
+		}
+		if _, err := uuid.Parse(got); !tt.keep && err != nil {
+			t.Errorf("%q: got %q, want a new UUID", tt.incoming, got)
+		}
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var got []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Request-Id"))
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: requestIDTransport{http.DefaultTransport}}
+
+	for _, ctx := range []context.Context{
+		context.WithValue(context.Background(), requestIDKey{}, "req-1"),
+		context.Background(),
+	} {
+		req, _ := http.NewRequestWithContext(ctx, "POST", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(got) != 2 || got[0] != "req-1" || got[1] != "" {
+		t.Errorf("forwarded request IDs = %q, want [req-1 \"\"]", got)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MigrationState is one row of `go-service migrate status`
+type MigrationState struct {
+	Name      string
+	State     string
+	AppliedAt time.Time
+}
+
+const (
+	migrationApplied = "applied"
+	migrationPending = "pending"
+	// migrationChanged files were edited after they were applied
+	migrationChanged = "changed"
+	// migrationMissing records name a file this build doesn't embed
+	migrationMissing = "missing"
+)
+
+// migrationStates lines the embedded migrations up against schema_migrations
+func migrationStates(migrations []migration, applied map[string]appliedMigration) []MigrationState {
+	states := make([]MigrationState, 0, len(migrations))
+	embedded := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		embedded[m.Name] = true
+		record, ok := applied[m.Name]
+		switch {
+		case !ok:
+			states = append(states, MigrationState{Name: m.Name, State: migrationPending})
+		case record.Checksum != m.Checksum:
+			states = append(states, MigrationState{Name: m.Name, State: migrationChanged, AppliedAt: record.AppliedAt})
+		default:
+			states = append(states, MigrationState{Name: m.Name, State: migrationApplied, AppliedAt: record.AppliedAt})
+		}
+	}
+
+	var missing []MigrationState
+	for name, record := range applied {
+		if !embedded[name] {
+			missing = append(missing, MigrationState{Name: name, State: migrationMissing, AppliedAt: record.AppliedAt})
+		}
+	}
+	states = append(states, missing...)
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+const migrateUsage = `usage: go-service migrate <command>
+
+Commands:
+  up                 apply pending migrations
+  down [-steps N]    roll back the last N applied migrations (default 1)
+  status             list migrations and whether each is applied
+`
+
+// runMigrateCommand implements `go-service migrate`, connecting with the
+// same POSTGRES_* settings as the server. It returns the process exit code.
+func runMigrateCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, migrateUsage)
+		return 2
+	}
+
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	steps := 1
+	if command == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to roll back")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || steps < 1 {
+		fmt.Fprint(stderr, migrateUsage)
+		return 2
+	}
+
+	switch command {
+	case "up", "down", "status":
+	default:
+		fmt.Fprintf(stderr, "unknown migrate command %q\n\n%s", command, migrateUsage)
+		return 2
+	}
+
+	config := loadConfig()
+	ctx := context.Background()
+	start := time.Now()
+	pool, err := initDatabase(ctx, config, nil)
+	if err != nil {
+		if command != "status" {
+			reportJobRun(stderr, config, jobRun{Job: "migrate-" + command, Start: start, Err: err})
+		}
+		fmt.Fprintf(stderr, "failed to connect to Postgres: %v\n", err)
+		return 1
+	}
+	defer pool.Close()
+
+	switch command {
+	case "up":
+		applied, err := migrateUp(ctx, pool, config.migrationLimits())
+		reportJobRun(stderr, config, jobRun{Job: "migrate-up", Start: start, Items: int64(len(applied)), Err: err})
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "applied %s\n", m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "migrate up: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+	case "down":
+		rolledBack, err := migrateDown(ctx, pool, steps, config.migrationLimits())
+		reportJobRun(stderr, config, jobRun{Job: "migrate-down", Start: start, Items: int64(len(rolledBack)), Err: err})
+		for _, m := range rolledBack {
+			fmt.Fprintf(stdout, "rolled back %s\n", m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "migrate down: %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(stdout, "no applied migrations")
+		}
+	case "status":
+		states, err := loadMigrationStates(ctx, pool)
+		if err != nil {
+			fmt.Fprintf(stderr, "migrate status: %v\n", err)
+			return 1
+		}
+		writeMigrationStates(stdout, states)
+	}
+	return 0
+}
+
+func loadMigrationStates(ctx context.Context, pool *pgxpool.Pool) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(ctx, pool); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(migrations, applied), nil
+}
+
+func writeMigrationStates(w io.Writer, states []MigrationState) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tSTATE\tAPPLIED AT")
+	for _, state := range states {
+		appliedAt := "-"
+		if !state.AppliedAt.IsZero() {
+			appliedAt = state.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", state.Name, state.State, appliedAt)
+	}
+	tw.Flush()
+}
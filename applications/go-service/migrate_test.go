@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrationStates(t *testing.T) {
+	appliedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	migrations := []migration{
+		{Name: "001_init.sql", Checksum: "aaa"},
+		{Name: "002_items.sql", Checksum: "bbb"},
+		{Name: "004_tips.sql", Checksum: "ddd"},
+	}
+	applied := map[string]appliedMigration{
+		"001_init.sql":    {Checksum: "aaa", AppliedAt: appliedAt},
+		"002_items.sql":   {Checksum: "old", AppliedAt: appliedAt},
+		"003_refunds.sql": {Checksum: "ccc", AppliedAt: appliedAt},
+	}
+
+	var got []string
+	for _, state := range migrationStates(migrations, applied) {
+		got = append(got, state.Name+"="+state.State)
+	}
+	want := "001_init.sql=applied,002_items.sql=changed,003_refunds.sql=missing,004_tips.sql=pending"
+	if strings.Join(got, ",") != want {
+		t.Errorf("migrationStates = %v, want %s", got, want)
+	}
+}
+
+func TestRunMigrateCommandUsage(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"sideways"},
+		{"up", "extra"},
+		{"down", "-steps", "0"},
+		{"status", "-steps", "2"},
+	}
+
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := runMigrateCommand(args, &stdout, &stderr); code != 2 {
+			t.Errorf("runMigrateCommand(%v) = %d, want 2", args, code)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("runMigrateCommand(%v) printed no usage", args)
+		}
+	}
+}
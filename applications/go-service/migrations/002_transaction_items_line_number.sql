@@ -0,0 +1,4 @@
+-- Preserve the submitted order of line items so transactions can be read back as they were sent
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS line_number INT;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_items_line_number ON transaction_items(transaction_id, line_number);
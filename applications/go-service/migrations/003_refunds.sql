@@ -0,0 +1,12 @@
+-- Refund records and the running refunded amount per transaction
+CREATE TABLE IF NOT EXISTS refunds (
+    id UUID PRIMARY KEY,
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    amount NUMERIC(14,2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_transaction_id ON refunds(transaction_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded_amount NUMERIC(14,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Explicit transaction lifecycle: pending -> completed -> (partially_)refunded, or pending -> voided
+UPDATE transactions SET status = 'completed' WHERE status IS NULL OR status = 'processed';
+
+ALTER TABLE transactions ALTER COLUMN status SET DEFAULT 'completed';
+ALTER TABLE transactions ALTER COLUMN status SET NOT NULL;
+ALTER TABLE transactions ALTER COLUMN processed_at DROP DEFAULT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status_updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
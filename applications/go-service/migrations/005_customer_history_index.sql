@@ -0,0 +1,2 @@
+-- Serve per-customer history pages, newest first, straight from the index
+CREATE INDEX IF NOT EXISTS idx_transactions_customer_created_at ON transactions(customer_id, created_at DESC, id DESC);
@@ -0,0 +1,17 @@
+-- Discount codes managed at runtime through the admin API
+CREATE TABLE IF NOT EXISTS discount_codes (
+    code TEXT PRIMARY KEY,
+    percent_off NUMERIC(5,2) NOT NULL CHECK (percent_off > 0 AND percent_off <= 100),
+    description TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Seed the codes that used to be hardcoded in the service
+INSERT INTO discount_codes (code, percent_off, description) VALUES
+    ('SAVE10', 10, '10% off'),
+    ('SAVE20', 20, '20% off'),
+    ('WELCOME', 15, '15% off for new customers'),
+    ('VIP', 25, '25% off for VIP customers')
+ON CONFLICT (code) DO NOTHING;
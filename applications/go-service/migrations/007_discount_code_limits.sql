@@ -0,0 +1,16 @@
+-- Validity windows and redemption limits for discount codes
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE;
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS max_redemptions INT CHECK (max_redemptions > 0);
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS redemption_count INT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'discount_codes_valid_window') THEN
+        ALTER TABLE discount_codes ADD CONSTRAINT discount_codes_valid_window
+            CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_from < valid_until);
+    END IF;
+END $$;
+
+-- Remember which code a transaction redeemed so voids can release it
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS discount_code TEXT;
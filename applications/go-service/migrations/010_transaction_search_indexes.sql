@@ -0,0 +1,3 @@
+-- Support the transaction search filters
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_code ON transactions(discount_code) WHERE discount_code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_total ON transactions(total);
@@ -0,0 +1,8 @@
+-- Idempotency-Key -> transaction mapping so retried submissions never double-charge
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    transaction_id UUID REFERENCES transactions(id) ON DELETE CASCADE,
+    response JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
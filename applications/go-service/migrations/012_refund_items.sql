@@ -0,0 +1,13 @@
+-- Per-line refund records so individual items and quantities can be returned
+CREATE TABLE IF NOT EXISTS refund_items (
+    id UUID PRIMARY KEY,
+    refund_id UUID NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    transaction_item_id UUID NOT NULL REFERENCES transaction_items(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    discount NUMERIC(14,2) NOT NULL DEFAULT 0,
+    tax NUMERIC(14,2) NOT NULL DEFAULT 0,
+    amount NUMERIC(14,2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refund_items_refund_id ON refund_items(refund_id);
+CREATE INDEX IF NOT EXISTS idx_refund_items_transaction_item_id ON refund_items(transaction_item_id);
@@ -0,0 +1,2 @@
+-- Gratuity is kept apart from the taxable subtotal so it can be reported on its own
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tip NUMERIC(14,2) NOT NULL DEFAULT 0;
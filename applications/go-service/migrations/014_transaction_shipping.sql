@@ -0,0 +1,2 @@
+-- Shipping charge recorded as its own line next to tax and tip
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS shipping NUMERIC(14,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Runtime overrides for configuration such as the tax rate, and the rate each transaction was taxed at
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(7,6);
+
+-- Transactions before this change were all taxed at the former hard-coded 8%
+UPDATE transactions SET tax_rate = 0.08 WHERE tax_rate IS NULL;
@@ -0,0 +1,40 @@
+-- Per-region tax rules: each jurisdiction has one or more component rates
+-- applied in sequence, optionally compounding on earlier components, and may
+-- quote prices tax-inclusive
+CREATE TABLE IF NOT EXISTS tax_jurisdictions (
+    region TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS tax_rates (
+    region TEXT NOT NULL REFERENCES tax_jurisdictions(region) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    rate NUMERIC(7,6) NOT NULL CHECK (rate >= 0 AND rate < 1),
+    compound BOOLEAN NOT NULL DEFAULT FALSE,
+    sequence INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (region, name)
+);
+
+INSERT INTO tax_jurisdictions (region, name, tax_inclusive) VALUES
+    ('US-CA', 'California', FALSE),
+    ('US-NY', 'New York City', FALSE),
+    ('US-OR', 'Oregon', FALSE),
+    ('CA-QC', 'Quebec', FALSE),
+    ('GB', 'United Kingdom', TRUE),
+    ('DE', 'Germany', TRUE)
+ON CONFLICT (region) DO NOTHING;
+
+INSERT INTO tax_rates (region, name, rate, compound, sequence) VALUES
+    ('US-CA', 'State sales tax', 0.0725, FALSE, 1),
+    ('US-NY', 'State sales tax', 0.04, FALSE, 1),
+    ('US-NY', 'City sales tax', 0.045, FALSE, 2),
+    ('US-NY', 'MCTD surcharge', 0.00375, FALSE, 3),
+    ('CA-QC', 'GST', 0.05, FALSE, 1),
+    ('CA-QC', 'QST', 0.09975, FALSE, 2),
+    ('GB', 'VAT', 0.20, FALSE, 1),
+    ('DE', 'USt', 0.19, FALSE, 1)
+ON CONFLICT (region, name) DO NOTHING;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS region TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+-- Category-specific tax rates applied per line; region '' applies everywhere
+CREATE TABLE IF NOT EXISTS category_tax_rates (
+    region TEXT NOT NULL DEFAULT '',
+    category TEXT NOT NULL,
+    rate NUMERIC(7,6) NOT NULL CHECK (rate >= 0 AND rate < 1),
+    PRIMARY KEY (region, category)
+);
+
+-- Tax and discount as allocated to each line, so refunds return exactly what a line was charged
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS discount NUMERIC(14,2);
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS tax NUMERIC(14,2);
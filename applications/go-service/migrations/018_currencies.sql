@@ -0,0 +1,16 @@
+-- Exchange rates into the reporting currency, and the rate each transaction was booked at
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) PRIMARY KEY,
+    rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Seed rates are relative to USD, the default reporting currency
+INSERT INTO exchange_rates (currency, rate) VALUES
+    ('EUR', 1.08),
+    ('GBP', 1.27),
+    ('CAD', 0.73)
+ON CONFLICT (currency) DO NOTHING;
+
+-- Every transaction before this change was booked in USD
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18,8) NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- Rounding strategy (mode/scope) used to compute each transaction's tax and
+-- discount; NULL for transactions booked before it was recorded
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS rounding TEXT;
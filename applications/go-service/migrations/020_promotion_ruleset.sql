@@ -0,0 +1,6 @@
+-- The promotion rules engine's ruleset, stored as a single JSON document
+CREATE TABLE IF NOT EXISTS promotion_ruleset (
+    id SMALLINT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    ruleset JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+-- Exclusive codes are never combined with other codes
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS exclusive BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Every code applied to a transaction; discount_code keeps the first
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS discount_codes TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE transactions SET discount_codes = ARRAY[discount_code]
+WHERE discount_code IS NOT NULL AND discount_codes = '{}';
+
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_codes ON transactions USING GIN (discount_codes);
@@ -0,0 +1,15 @@
+-- Pricing tiers and the discount each one gets without a code
+CREATE TABLE IF NOT EXISTS customer_tiers (
+    tier TEXT PRIMARY KEY,
+    percent_off NUMERIC(5,2) NOT NULL DEFAULT 0 CHECK (percent_off >= 0 AND percent_off <= 100),
+    description TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+INSERT INTO customer_tiers (tier, percent_off, description) VALUES
+    ('standard', 0, 'List prices'),
+    ('vip', 10, 'VIP customers'),
+    ('wholesale', 20, 'Wholesale accounts')
+ON CONFLICT (tier) DO NOTHING;
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'standard' REFERENCES customer_tiers(tier);
@@ -0,0 +1,17 @@
+-- Loyalty points balance per customer, and every change to it
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS loyalty_points BIGINT NOT NULL DEFAULT 0 CHECK (loyalty_points >= 0);
+
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    transaction_id UUID REFERENCES transactions(id),
+    points BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_customer ON loyalty_ledger(customer_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_transaction ON loyalty_ledger(transaction_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS points_earned BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS points_redeemed BIGINT NOT NULL DEFAULT 0;
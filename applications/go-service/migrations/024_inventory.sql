@@ -0,0 +1,19 @@
+-- Stock on hand per catalog product, and every change to it. Products
+-- without a row are not tracked.
+CREATE TABLE IF NOT EXISTS inventory (
+    product_id TEXT PRIMARY KEY REFERENCES products(id),
+    quantity BIGINT NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id BIGSERIAL PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES inventory(product_id),
+    transaction_id UUID REFERENCES transactions(id),
+    quantity BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_product ON inventory_movements(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_transaction ON inventory_movements(transaction_id);
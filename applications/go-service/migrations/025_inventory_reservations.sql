@@ -0,0 +1,11 @@
+-- Units held by pending transactions until they are captured or voided
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS reserved BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE inventory_movements ADD COLUMN IF NOT EXISTS reserved BIGINT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_reserved_check') THEN
+        ALTER TABLE inventory ADD CONSTRAINT inventory_reserved_check
+            CHECK (reserved >= 0 AND reserved <= quantity);
+    END IF;
+END $$;
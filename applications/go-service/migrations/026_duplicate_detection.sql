@@ -0,0 +1,5 @@
+-- Fingerprint of customer and items, used to catch repeated submissions
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fingerprint TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS duplicate_of UUID REFERENCES transactions(id);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_fingerprint ON transactions(fingerprint, created_at DESC) WHERE fingerprint IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Fraud score given to each transaction before it was committed
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fraud_score NUMERIC(5,2);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fraud_reasons TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fraud_scorer TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_fraud_score ON transactions(fraud_score DESC) WHERE fraud_score > 0;
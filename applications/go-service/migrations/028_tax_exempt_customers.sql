@@ -0,0 +1,13 @@
+-- Tax-exempt customers and the exemption each transaction was granted
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tax_exempt BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS exemption_certificate TEXT;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'customers_exemption_certificate') THEN
+        ALTER TABLE customers ADD CONSTRAINT customers_exemption_certificate
+            CHECK (NOT tax_exempt OR exemption_certificate IS NOT NULL);
+    END IF;
+END $$;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tax_exemption TEXT;
@@ -0,0 +1,6 @@
+-- Human-readable invoice numbers, assigned when a transaction completes
+CREATE SEQUENCE IF NOT EXISTS invoice_number_seq;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS invoice_number BIGINT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_invoice_number ON transactions(invoice_number);
@@ -0,0 +1,5 @@
+-- Free-form metadata and notes supplied with a transaction
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS notes TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_metadata ON transactions USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,3 @@
+-- Discount codes can be limited to item categories or specific products
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS categories TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE discount_codes ADD COLUMN IF NOT EXISTS product_ids TEXT[] NOT NULL DEFAULT '{}';
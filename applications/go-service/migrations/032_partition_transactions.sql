@@ -0,0 +1,59 @@
+-- Partition transactions by month of created_at (UTC), so time-bounded stats
+-- and listings scan only the months they cover. Postgres can't partition a
+-- table in place, so the rows are copied into a new partitioned table that
+-- replaces the old one. Unique keys on a partitioned table must include the
+-- partition key: the primary key becomes (id, created_at), and the foreign
+-- keys pointing at transactions(id) are dropped. The service creates the
+-- partitions for upcoming months; rows outside them land in
+-- transactions_default.
+DO $$
+DECLARE
+    fk RECORD;
+    month TIMESTAMP;
+    last_month TIMESTAMP;
+BEGIN
+    IF (SELECT relkind FROM pg_class WHERE oid = 'transactions'::regclass) = 'p' THEN
+        RETURN;
+    END IF;
+
+    FOR fk IN
+        SELECT conrelid::regclass AS tbl, conname FROM pg_constraint
+        WHERE contype = 'f' AND confrelid = 'transactions'::regclass
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', fk.tbl, fk.conname);
+    END LOOP;
+
+    UPDATE transactions SET created_at = COALESCE(processed_at, NOW()) WHERE created_at IS NULL;
+
+    ALTER TABLE transactions RENAME TO transactions_unpartitioned;
+    CREATE TABLE transactions (LIKE transactions_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING GENERATED)
+        PARTITION BY RANGE (created_at);
+    ALTER TABLE transactions ALTER COLUMN created_at SET NOT NULL;
+
+    SELECT date_trunc('month', COALESCE(MIN(created_at), NOW()) AT TIME ZONE 'UTC') INTO month FROM transactions_unpartitioned;
+    last_month := date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '3 months';
+    WHILE month <= last_month LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF transactions FOR VALUES FROM (%L) TO (%L)',
+            'transactions_' || to_char(month, 'YYYY_MM'),
+            month AT TIME ZONE 'UTC', (month + INTERVAL '1 month') AT TIME ZONE 'UTC');
+        month := month + INTERVAL '1 month';
+    END LOOP;
+    CREATE TABLE transactions_default PARTITION OF transactions DEFAULT;
+
+    INSERT INTO transactions SELECT * FROM transactions_unpartitioned;
+    DROP TABLE transactions_unpartitioned;
+    ALTER TABLE transactions ADD CONSTRAINT transactions_pkey PRIMARY KEY (id, created_at);
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_customer_id ON transactions(customer_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+CREATE INDEX IF NOT EXISTS idx_transactions_customer_created_at ON transactions(customer_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_code ON transactions(discount_code) WHERE discount_code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_total ON transactions(total);
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_codes ON transactions USING GIN (discount_codes);
+CREATE INDEX IF NOT EXISTS idx_transactions_fingerprint ON transactions(fingerprint, created_at DESC) WHERE fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_fraud_score ON transactions(fraud_score DESC) WHERE fraud_score > 0;
+-- invoice_number_seq keeps numbers unique; the index can only be unique per month
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_invoice_number ON transactions(invoice_number, created_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_metadata ON transactions USING GIN (metadata jsonb_path_ops);
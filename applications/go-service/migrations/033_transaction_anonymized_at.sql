@@ -0,0 +1,2 @@
+-- When the retention job stripped a transaction of customer data
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP WITH TIME ZONE;
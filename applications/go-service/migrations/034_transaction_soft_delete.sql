@@ -0,0 +1,2 @@
+-- Soft-deleted transactions are hidden from the API and stats but can be restored
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
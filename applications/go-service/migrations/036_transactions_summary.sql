@@ -0,0 +1,84 @@
+-- Running revenue totals per currency, kept by trigger so stats and metrics
+-- don't aggregate the whole transactions table. Each currency's totals are
+-- spread over 16 slots, picked at random per change, so concurrent commits
+-- rarely wait on the same row; readers sum the slots.
+CREATE TABLE IF NOT EXISTS transactions_summary (
+    currency TEXT NOT NULL,
+    slot SMALLINT NOT NULL,
+    transactions BIGINT NOT NULL DEFAULT 0,
+    revenue NUMERIC NOT NULL DEFAULT 0,
+    refunded NUMERIC NOT NULL DEFAULT 0,
+    tips NUMERIC NOT NULL DEFAULT 0,
+    reporting_revenue NUMERIC NOT NULL DEFAULT 0,
+    reporting_refunded NUMERIC NOT NULL DEFAULT 0,
+    reporting_tips NUMERIC NOT NULL DEFAULT 0,
+    PRIMARY KEY (currency, slot)
+);
+
+-- Which transactions count towards revenue; matches revenueStatusFilter
+CREATE OR REPLACE FUNCTION transaction_counts_as_revenue(status TEXT, deleted_at TIMESTAMP WITH TIME ZONE)
+RETURNS BOOLEAN LANGUAGE sql IMMUTABLE AS $$
+    SELECT status IN ('completed', 'partially_refunded', 'refunded') AND deleted_at IS NULL
+$$;
+
+-- Adds sign (1 or -1) times a transaction's contribution to the totals. It
+-- takes columns rather than the row, since a trigger on a partition sees the
+-- partition's row type.
+CREATE OR REPLACE FUNCTION transactions_summary_add(
+    currency TEXT, total NUMERIC, refunded_amount NUMERIC, tip NUMERIC, exchange_rate NUMERIC, sign INTEGER
+) RETURNS VOID LANGUAGE sql AS $$
+    INSERT INTO transactions_summary AS s (
+        currency, slot, transactions, revenue, refunded, tips,
+        reporting_revenue, reporting_refunded, reporting_tips
+    ) VALUES (
+        COALESCE(currency, ''), floor(random() * 16), sign,
+        sign * (total - refunded_amount), sign * refunded_amount, sign * tip,
+        sign * (total - refunded_amount) * exchange_rate, sign * refunded_amount * exchange_rate,
+        sign * tip * exchange_rate
+    )
+    ON CONFLICT (currency, slot) DO UPDATE SET
+        transactions = s.transactions + EXCLUDED.transactions,
+        revenue = s.revenue + EXCLUDED.revenue,
+        refunded = s.refunded + EXCLUDED.refunded,
+        tips = s.tips + EXCLUDED.tips,
+        reporting_revenue = s.reporting_revenue + EXCLUDED.reporting_revenue,
+        reporting_refunded = s.reporting_refunded + EXCLUDED.reporting_refunded,
+        reporting_tips = s.reporting_tips + EXCLUDED.reporting_tips
+$$;
+
+CREATE OR REPLACE FUNCTION transactions_summary_apply() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND transaction_counts_as_revenue(OLD.status, OLD.deleted_at) THEN
+        PERFORM transactions_summary_add(OLD.currency, OLD.total, OLD.refunded_amount, OLD.tip, OLD.exchange_rate, -1);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND transaction_counts_as_revenue(NEW.status, NEW.deleted_at) THEN
+        PERFORM transactions_summary_add(NEW.currency, NEW.total, NEW.refunded_amount, NEW.tip, NEW.exchange_rate, 1);
+    END IF;
+    RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS transactions_summary_insert_delete ON transactions;
+CREATE TRIGGER transactions_summary_insert_delete
+    AFTER INSERT OR DELETE ON transactions
+    FOR EACH ROW EXECUTE FUNCTION transactions_summary_apply();
+
+-- Updates that can't move the totals, such as anonymization, skip the trigger
+DROP TRIGGER IF EXISTS transactions_summary_update ON transactions;
+CREATE TRIGGER transactions_summary_update
+    AFTER UPDATE OF status, deleted_at, currency, total, refunded_amount, tip, exchange_rate ON transactions
+    FOR EACH ROW EXECUTE FUNCTION transactions_summary_apply();
+
+-- Creating the triggers locked out writes, so this backfill can't miss or
+-- double-count a transaction
+DELETE FROM transactions_summary;
+INSERT INTO transactions_summary (
+    currency, slot, transactions, revenue, refunded, tips,
+    reporting_revenue, reporting_refunded, reporting_tips
+)
+SELECT COALESCE(currency, ''), 0, COUNT(*),
+       SUM(total - refunded_amount), SUM(refunded_amount), SUM(tip),
+       SUM((total - refunded_amount) * exchange_rate), SUM(refunded_amount * exchange_rate), SUM(tip * exchange_rate)
+FROM transactions
+WHERE transaction_counts_as_revenue(status, deleted_at)
+GROUP BY 1;
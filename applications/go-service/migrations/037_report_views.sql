@@ -0,0 +1,34 @@
+-- Daily rollups behind the time series and category report. They are created
+-- empty and filled by the service's refresher; until then, and for any part
+-- of a range they don't cover, reports read transactions directly.
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_revenue AS
+SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day,
+       COUNT(*) AS transactions,
+       SUM((total - refunded_amount) * exchange_rate) AS revenue
+FROM transactions
+WHERE transaction_counts_as_revenue(status, deleted_at)
+GROUP BY 1
+WITH NO DATA;
+
+-- CONCURRENTLY refreshes need a unique index
+CREATE UNIQUE INDEX IF NOT EXISTS daily_revenue_day_idx ON daily_revenue (day);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_category_revenue AS
+SELECT date_trunc('day', t.created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS day,
+       COALESCE(NULLIF(ti.category, ''), 'uncategorized') AS category,
+       COUNT(DISTINCT t.id) AS transactions,
+       COALESCE(SUM(ti.quantity), 0) AS units_sold,
+       COALESCE(SUM(ti.total * t.exchange_rate), 0) AS revenue
+FROM transaction_items ti
+JOIN transactions t ON t.id = ti.transaction_id
+WHERE transaction_counts_as_revenue(t.status, t.deleted_at)
+GROUP BY 1, 2
+WITH NO DATA;
+
+CREATE UNIQUE INDEX IF NOT EXISTS daily_category_revenue_day_category_idx ON daily_category_revenue (day, category);
+
+-- When each view was last refreshed; the days before that one are complete
+CREATE TABLE IF NOT EXISTS report_refreshes (
+    view_name TEXT PRIMARY KEY,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Keys clients send in X-API-Key. Only the SHA-256 of a key is stored; the
+-- key itself is returned once, when it is minted.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    -- The key's first characters, to tell keys apart in listings
+    prefix TEXT NOT NULL,
+    -- Hex SHA-256 of the key
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
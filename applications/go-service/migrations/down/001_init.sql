@@ -0,0 +1,4 @@
+-- Drop the base schema, and with it every transaction and customer
+DROP TABLE IF EXISTS transaction_items;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS customers;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transaction_items_line_number;
+ALTER TABLE transaction_items DROP COLUMN IF EXISTS line_number;
@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS refunded_amount;
+DROP TABLE IF EXISTS refunds;
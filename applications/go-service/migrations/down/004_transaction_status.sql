@@ -0,0 +1,6 @@
+-- Statuses are left as they are; 'completed' rows are not renamed back to 'processed'
+DROP INDEX IF EXISTS idx_transactions_status;
+ALTER TABLE transactions DROP COLUMN IF EXISTS status_updated_at;
+ALTER TABLE transactions ALTER COLUMN processed_at SET DEFAULT NOW();
+ALTER TABLE transactions ALTER COLUMN status DROP NOT NULL;
+ALTER TABLE transactions ALTER COLUMN status SET DEFAULT 'processed';
@@ -0,0 +1,6 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS discount_code;
+ALTER TABLE discount_codes DROP CONSTRAINT IF EXISTS discount_codes_valid_window;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS redemption_count;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS max_redemptions;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS valid_until;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS valid_from;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_total;
+DROP INDEX IF EXISTS idx_transactions_discount_code;
@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS tax_inclusive;
+ALTER TABLE transactions DROP COLUMN IF EXISTS region;
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS tax_jurisdictions;
@@ -0,0 +1,3 @@
+ALTER TABLE transaction_items DROP COLUMN IF EXISTS tax;
+ALTER TABLE transaction_items DROP COLUMN IF EXISTS discount;
+DROP TABLE IF EXISTS category_tax_rates;
@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS exchange_rate;
+DROP TABLE IF EXISTS exchange_rates;
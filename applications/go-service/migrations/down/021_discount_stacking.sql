@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_discount_codes;
+ALTER TABLE transactions DROP COLUMN IF EXISTS discount_codes;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS exclusive;
@@ -0,0 +1,2 @@
+ALTER TABLE customers DROP COLUMN IF EXISTS tier;
+DROP TABLE IF EXISTS customer_tiers;
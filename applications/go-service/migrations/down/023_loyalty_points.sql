@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS points_redeemed;
+ALTER TABLE transactions DROP COLUMN IF EXISTS points_earned;
+DROP TABLE IF EXISTS loyalty_ledger;
+ALTER TABLE customers DROP COLUMN IF EXISTS loyalty_points;
@@ -0,0 +1,3 @@
+ALTER TABLE inventory DROP CONSTRAINT IF EXISTS inventory_reserved_check;
+ALTER TABLE inventory_movements DROP COLUMN IF EXISTS reserved;
+ALTER TABLE inventory DROP COLUMN IF EXISTS reserved;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_fingerprint;
+ALTER TABLE transactions DROP COLUMN IF EXISTS duplicate_of;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fingerprint;
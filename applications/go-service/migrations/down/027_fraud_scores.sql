@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_transactions_fraud_score;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fraud_scorer;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fraud_reasons;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fraud_score;
@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS tax_exemption;
+ALTER TABLE customers DROP CONSTRAINT IF EXISTS customers_exemption_certificate;
+ALTER TABLE customers DROP COLUMN IF EXISTS exemption_certificate;
+ALTER TABLE customers DROP COLUMN IF EXISTS tax_exempt;
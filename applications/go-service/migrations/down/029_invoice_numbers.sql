@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_invoice_number;
+ALTER TABLE transactions DROP COLUMN IF EXISTS invoice_number;
+DROP SEQUENCE IF EXISTS invoice_number_seq;
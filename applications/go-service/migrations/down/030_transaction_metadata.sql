@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_metadata;
+ALTER TABLE transactions DROP COLUMN IF EXISTS notes;
+ALTER TABLE transactions DROP COLUMN IF EXISTS metadata;
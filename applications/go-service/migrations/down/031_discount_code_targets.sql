@@ -0,0 +1,2 @@
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS product_ids;
+ALTER TABLE discount_codes DROP COLUMN IF EXISTS categories;
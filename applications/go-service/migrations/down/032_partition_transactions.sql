@@ -0,0 +1,41 @@
+-- Copy the partitions back into one table and restore the single-column
+-- primary key and the foreign keys that reference it
+DO $$
+BEGIN
+    IF (SELECT relkind FROM pg_class WHERE oid = 'transactions'::regclass) <> 'p' THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE transactions RENAME TO transactions_partitioned;
+    CREATE TABLE transactions (LIKE transactions_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING GENERATED);
+    INSERT INTO transactions SELECT * FROM transactions_partitioned;
+    DROP TABLE transactions_partitioned;
+
+    ALTER TABLE transactions ALTER COLUMN created_at DROP NOT NULL;
+    ALTER TABLE transactions ADD CONSTRAINT transactions_pkey PRIMARY KEY (id);
+    ALTER TABLE transactions ADD CONSTRAINT transactions_duplicate_of_fkey FOREIGN KEY (duplicate_of) REFERENCES transactions(id);
+    ALTER TABLE transaction_items ADD CONSTRAINT transaction_items_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE;
+    ALTER TABLE refunds ADD CONSTRAINT refunds_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE;
+    ALTER TABLE jobs ADD CONSTRAINT jobs_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL;
+    ALTER TABLE idempotency_keys ADD CONSTRAINT idempotency_keys_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE;
+    ALTER TABLE loyalty_ledger ADD CONSTRAINT loyalty_ledger_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id);
+    ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_transaction_id_fkey
+        FOREIGN KEY (transaction_id) REFERENCES transactions(id);
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_customer_id ON transactions(customer_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+CREATE INDEX IF NOT EXISTS idx_transactions_customer_created_at ON transactions(customer_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_code ON transactions(discount_code) WHERE discount_code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_total ON transactions(total);
+CREATE INDEX IF NOT EXISTS idx_transactions_discount_codes ON transactions USING GIN (discount_codes);
+CREATE INDEX IF NOT EXISTS idx_transactions_fingerprint ON transactions(fingerprint, created_at DESC) WHERE fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_fraud_score ON transactions(fraud_score DESC) WHERE fraud_score > 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_invoice_number ON transactions(invoice_number);
+CREATE INDEX IF NOT EXISTS idx_transactions_metadata ON transactions USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS transactions_summary_update ON transactions;
+DROP TRIGGER IF EXISTS transactions_summary_insert_delete ON transactions;
+DROP FUNCTION IF EXISTS transactions_summary_apply();
+DROP FUNCTION IF EXISTS transactions_summary_add(TEXT, NUMERIC, NUMERIC, NUMERIC, NUMERIC, INTEGER);
+DROP FUNCTION IF EXISTS transaction_counts_as_revenue(TEXT, TIMESTAMP WITH TIME ZONE);
+DROP TABLE IF EXISTS transactions_summary;
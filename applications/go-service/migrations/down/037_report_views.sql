@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS report_refreshes;
+DROP MATERIALIZED VIEW IF EXISTS daily_category_revenue;
+DROP MATERIALIZED VIEW IF EXISTS daily_revenue;
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// Money is an amount in integer cents. It is written to JSON as a decimal
+// number with two places (12.30), read from JSON numbers or strings without
+// passing through float64, and scanned from and bound to NUMERIC columns
+// exactly. Arithmetic that can produce fractions of a cent goes through
+// MulRate and MulFrac, which round half away from zero.
+type Money int64
+
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Mul multiplies a unit price by a quantity. Line totals that could overflow
+// are rejected by validation first; see MulChecked.
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// MulChecked is Mul, reporting false when the product doesn't fit in Money
+func (m Money) MulChecked(quantity int) (Money, bool) {
+	product := m * Money(quantity)
+	if quantity != 0 && (product/Money(quantity) != m || (quantity == -1 && m == math.MinInt64)) {
+		return 0, false
+	}
+	return product, true
+}
+
+// MulRate applies a fractional rate such as a tax rate or a percentage
+// discount expressed as 0.10.
+func (m Money) MulRate(rate float64) Money {
+	return fromDecimal(m.exactRate(rate))
+}
+
+// exactRate is m*rate in cents before rounding
+func (m Money) exactRate(rate float64) decimal.Decimal {
+	return m.decimal().Mul(decimal.NewFromFloat(rate))
+}
+
+// MulFrac returns m*num/den, used to prorate an amount by a share of a total.
+// A zero denominator yields zero.
+func (m Money) MulFrac(num, den int64) Money {
+	if den == 0 {
+		return 0
+	}
+	return fromDecimal(m.decimal().Mul(decimal.NewFromInt(num)).Div(decimal.NewFromInt(den)))
+}
+
+func (m Money) String() string {
+	return decimal.New(int64(m), -2).StringFixed(2)
+}
+
+func (m Money) decimal() decimal.Decimal {
+	return decimal.NewFromInt(int64(m))
+}
+
+// fromDecimal rounds a value already expressed in cents
+func fromDecimal(cents decimal.Decimal) Money {
+	return Money(cents.Round(0).IntPart())
+}
+
+// parseMoney reads a decimal amount such as "12.3" or "0.125", rounding to
+// the nearest cent.
+func parseMoney(s string) (Money, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return fromDecimal(d.Shift(2)), nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	parsed, err := parseMoney(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*m = 0
+		return nil
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("cannot scan non-finite numeric into Money")
+	}
+	*m = fromDecimal(decimal.NewFromBigInt(v.Int, v.Exp).Shift(2))
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: m.decimal().BigInt(), Exp: -2, Valid: true}, nil
+}
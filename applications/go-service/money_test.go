@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestMoneyJSON(t *testing.T) {
+	var item Item
+	if err := json.Unmarshal([]byte(`{"price": 0.1, "quantity": 3}`), &item); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got := item.Price.Mul(item.Quantity); got != 30 {
+		t.Errorf("0.1 x 3 = %d cents, want 30", got)
+	}
+
+	for input, want := range map[string]Money{`19.99`: 1999, `"5"`: 500, `0.125`: 13, `-0.125`: -13, `null`: 0} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err != nil {
+			t.Errorf("unmarshal %s: %v", input, err)
+			continue
+		}
+		if m != want {
+			t.Errorf("unmarshal %s = %d cents, want %d", input, m, want)
+		}
+	}
+
+	out, _ := json.Marshal(struct {
+		Total Money `json:"total"`
+		Owed  Money `json:"owed"`
+	}{Total: 1230, Owed: -5})
+	if string(out) != `{"total":12.30,"owed":-0.05}` {
+		t.Errorf("marshal = %s", out)
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"abc"`), &m); err == nil {
+		t.Error("expected error for non-numeric amount")
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"tax rounds half up", Money(1250).MulRate(0.08), 100},
+		{"tax rounds down", Money(1005).MulRate(0.08), 80},
+		{"percent off", Money(3333).MulRate(0.15), 500},
+		{"prorate", Money(1000).MulFrac(1, 3), 333},
+		{"prorate rounds half away from zero", Money(5).MulFrac(1, 2), 3},
+		{"zero denominator", Money(1000).MulFrac(1, 0), 0},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %d cents, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulChecked(t *testing.T) {
+	tests := []struct {
+		price    Money
+		quantity int
+		want     Money
+		ok       bool
+	}{
+		{1999, 3, 5997, true},
+		{1999, 0, 0, true},
+		{math.MaxInt64 / 2, 2, math.MaxInt64 - 1, true},
+		{math.MaxInt64/2 + 1, 2, 0, false},
+		{100, math.MaxInt64/100 + 1, 0, false},
+		{math.MaxInt64, math.MaxInt64, 0, false},
+		{math.MinInt64, -1, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.price.MulChecked(tt.quantity)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%d x %d = %d, %v; want %d, %v", tt.price, tt.quantity, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMoneyNumeric(t *testing.T) {
+	var m Money
+	// 12.345 as NUMERIC(…,3), e.g. from AVG()
+	if err := m.ScanNumeric(pgtype.Numeric{Int: big.NewInt(12345), Exp: -3, Valid: true}); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if m != 1235 {
+		t.Errorf("scanned %d cents, want 1235", m)
+	}
+
+	if err := m.ScanNumeric(pgtype.Numeric{Int: big.NewInt(4), Exp: 2, Valid: true}); err != nil || m != 40000 {
+		t.Errorf("scan 400 = %d cents, %v", m, err)
+	}
+
+	n, err := Money(1999).NumericValue()
+	if err != nil || n.Int.Int64() != 1999 || n.Exp != -2 {
+		t.Errorf("NumericValue = %+v, %v", n, err)
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	for _, tt := range []struct {
+		amount   Money
+		currency string
+		want     string
+	}{
+		{1230, "USD", "$12.30"},
+		{-500, "EUR", "€-5.00"},
+		{99, "CHF", "CHF 0.99"},
+	} {
+		if got := formatMoney(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("formatMoney(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed docs/index.html
+var swaggerUIPage []byte
+
+// apiParam documents a path or query parameter
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+	Required    bool
+}
+
+// apiOperation documents one route. Request and Responses hold zero values of
+// the Go types that are encoded on the wire; schemas are derived from them by
+// reflection so the spec can't drift from the structs. A nil response value
+// documents a plain-text body.
+type apiOperation struct {
+	Method    string
+	Path      string
+	Tag       string
+	Summary   string
+	Params    []apiParam
+	Request   any
+	Responses map[int]any
+	// Deprecated flags v1 routes that have a v2 successor
+	Deprecated bool
+}
+
+func idParam(what string) apiParam {
+	return apiParam{Name: "id", In: "path", Type: "string", Description: what + " ID", Required: true}
+}
+
+var (
+	idempotencyKeyParam = apiParam{Name: idempotencyKeyHeader, In: "header", Type: "string",
+		Description: "Client-chosen key; retries with the same key and body replay the original response"}
+	settingKeyParam = apiParam{Name: "key", In: "path", Type: "string", Description: "Setting key", Required: true}
+	codeParam       = apiParam{Name: "code", In: "path", Type: "string", Description: "Discount code", Required: true}
+	limitParam      = apiParam{Name: "limit", In: "query", Type: "integer", Description: "Page size (1-200, default 50)"}
+	cursorParam     = apiParam{Name: "cursor", In: "query", Type: "string", Description: "Opaque cursor from next_cursor"}
+	fromParam       = apiParam{Name: "from", In: "query", Type: "string", Description: "Inclusive start, RFC3339 or YYYY-MM-DD"}
+	toParam         = apiParam{Name: "to", In: "query", Type: "string", Description: "Exclusive end, RFC3339 or YYYY-MM-DD (a bare date includes that day)"}
+	localeParam     = apiParam{Name: "locale", In: "query", Type: "string", Description: "BCP 47 locale, e.g. en-US, to add display-formatted amounts; Accept-Language is used when omitted"}
+)
+
+func apiOperations() []apiOperation {
+	return []apiOperation{
+		{Method: "GET", Path: "/health", Tag: "operations", Summary: "Health check including database connectivity",
+			Responses: map[int]any{200: HealthResponse{}}},
+		{Method: "GET", Path: "/ready", Tag: "operations", Summary: "Readiness probe; 503 while the database has been unreachable for several checks",
+			Responses: map[int]any{200: HealthResponse{}, 503: HealthResponse{}}},
+		{Method: "GET", Path: "/version", Tag: "operations", Summary: "Build metadata of the running binary",
+			Responses: map[int]any{200: VersionResponse{}}},
+		{Method: "GET", Path: "/metrics", Tag: "operations", Summary: "Prometheus metrics in text exposition format",
+			Responses: map[int]any{200: nil}},
+
+		{Method: "POST", Path: "/api/v1/process-transaction", Tag: "transactions", Summary: "Price and persist a transaction",
+			Deprecated: true,
+			Params: []apiParam{
+				{Name: "async", In: "query", Type: "boolean", Description: "Queue the transaction and return a job to poll"},
+				idempotencyKeyParam,
+				localeParam,
+			},
+			Request:   TransactionRequest{},
+			Responses: map[int]any{200: TransactionResponse{}, 202: JobResponse{}, 400: nil, 409: ValidationErrorResponse{}, 422: ValidationErrorResponse{}}},
+		{Method: "POST", Path: "/api/v1/process-transactions", Tag: "transactions", Summary: "Submit up to 100 transactions at once",
+			Params:    []apiParam{{Name: "mode", In: "query", Type: "string", Description: "independent (default) or atomic"}},
+			Request:   []TransactionRequest{},
+			Responses: map[int]any{200: BatchResponse{}, 400: nil, 413: nil}},
+		{Method: "GET", Path: "/api/v1/transactions", Tag: "transactions", Summary: "List transactions, newest first",
+			Params:    []apiParam{limitParam, cursorParam, fromParam, toParam},
+			Responses: map[int]any{200: TransactionListResponse{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/transactions/search", Tag: "transactions", Summary: "Search transactions",
+			Params: []apiParam{
+				{Name: "customer_id", In: "query", Type: "string"},
+				{Name: "min_total", In: "query", Type: "number"},
+				{Name: "max_total", In: "query", Type: "number"},
+				{Name: "discount_code", In: "query", Type: "string"},
+				{Name: "status", In: "query", Type: "string"},
+				{Name: "notes", In: "query", Type: "string", Description: "Case-insensitive substring of the notes"},
+				{Name: "metadata.{key}", In: "query", Type: "string", Description: "Metadata key to match, e.g. metadata.store=berlin"},
+				fromParam, toParam,
+				{Name: "sort", In: "query", Type: "string", Description: "created_at (default) or total"},
+				{Name: "order", In: "query", Type: "string", Description: "asc or desc (default)"},
+				limitParam,
+				{Name: "offset", In: "query", Type: "integer"},
+			},
+			Responses: map[int]any{200: TransactionSearchResponse{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/transactions/{id}", Tag: "transactions", Summary: "Fetch a transaction with its line items",
+			Deprecated: true,
+			Params:     []apiParam{idParam("Transaction"), localeParam},
+			Responses:  map[int]any{200: TransactionResponse{}, 400: nil, 404: nil}},
+		{Method: "DELETE", Path: "/api/v1/transactions/{id}", Tag: "transactions", Summary: "Soft-delete a transaction",
+			Params:    []apiParam{idParam("Transaction")},
+			Responses: map[int]any{204: nil, 400: nil, 404: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/transactions/{id}/receipt", Tag: "transactions", Summary: "Render a printable receipt as HTML or PDF",
+			Params: []apiParam{
+				idParam("Transaction"),
+				{Name: "format", In: "query", Type: "string", Description: "html (default) or pdf; Accept: application/pdf also selects PDF"},
+			},
+			Responses: map[int]any{200: nil, 400: nil, 404: nil}},
+		{Method: "POST", Path: "/api/v1/transactions/{id}/refund", Tag: "transactions", Summary: "Refund a transaction in full, by amount, or by line item",
+			Params:    []apiParam{idParam("Transaction")},
+			Request:   RefundRequest{},
+			Responses: map[int]any{200: RefundResponse{}, 400: nil, 404: nil, 409: nil, 422: nil}},
+		{Method: "POST", Path: "/api/v1/transactions/{id}/capture", Tag: "transactions", Summary: "Complete a pending transaction",
+			Params:    []apiParam{idParam("Transaction")},
+			Responses: map[int]any{200: TransactionResponse{}, 404: nil, 409: nil}},
+		{Method: "POST", Path: "/api/v1/transactions/{id}/void", Tag: "transactions", Summary: "Void a pending transaction",
+			Params:    []apiParam{idParam("Transaction")},
+			Responses: map[int]any{200: TransactionResponse{}, 404: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/jobs/{id}", Tag: "transactions", Summary: "Poll an async transaction job",
+			Params:    []apiParam{idParam("Job")},
+			Responses: map[int]any{200: JobResponse{}, 404: nil}},
+		{Method: "GET", Path: "/api/v1/events/transactions", Tag: "transactions", Summary: "Stream transaction events as server-sent events",
+			Responses: map[int]any{200: TransactionEvent{}}},
+
+		{Method: "POST", Path: "/api/v1/customers", Tag: "customers", Summary: "Create a customer",
+			Request:   CreateCustomerRequest{},
+			Responses: map[int]any{201: Customer{}, 400: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/customers", Tag: "customers", Summary: "List customers",
+			Params:    []apiParam{limitParam, cursorParam},
+			Responses: map[int]any{200: CustomerListResponse{}}},
+		{Method: "GET", Path: "/api/v1/customers/{id}", Tag: "customers", Summary: "Fetch a customer",
+			Params:    []apiParam{idParam("Customer")},
+			Responses: map[int]any{200: Customer{}, 404: nil}},
+		{Method: "PATCH", Path: "/api/v1/customers/{id}", Tag: "customers", Summary: "Update a customer",
+			Params:    []apiParam{idParam("Customer")},
+			Request:   UpdateCustomerRequest{},
+			Responses: map[int]any{200: Customer{}, 404: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/customers/{id}/transactions", Tag: "customers", Summary: "A customer's purchase history",
+			Params:    []apiParam{idParam("Customer"), limitParam, cursorParam, fromParam, toParam},
+			Responses: map[int]any{200: TransactionListResponse{}, 404: nil}},
+		{Method: "GET", Path: "/api/v1/customers/{id}/loyalty", Tag: "customers", Summary: "Loyalty points balance and recent history",
+			Params:    []apiParam{idParam("Customer")},
+			Responses: map[int]any{200: LoyaltyAccount{}, 404: nil}},
+
+		{Method: "GET", Path: "/api/v1/products", Tag: "catalog", Summary: "List products",
+			Params:    []apiParam{{Name: "category", In: "query", Type: "string"}},
+			Responses: map[int]any{200: ProductListResponse{}}},
+		{Method: "GET", Path: "/api/v1/products/{id}", Tag: "catalog", Summary: "Fetch a product",
+			Params:    []apiParam{idParam("Product")},
+			Responses: map[int]any{200: Product{}, 404: nil}},
+		{Method: "POST", Path: "/api/v1/admin/transactions/{id}/restore", Tag: "admin", Summary: "Restore a soft-deleted transaction",
+			Params:    []apiParam{idParam("Transaction")},
+			Responses: map[int]any{200: TransactionResponse{}, 400: nil, 404: nil}},
+		{Method: "POST", Path: "/api/v1/admin/products", Tag: "admin", Summary: "Add a product to the catalog",
+			Request:   CreateProductRequest{},
+			Responses: map[int]any{201: Product{}, 400: nil, 409: nil}},
+		{Method: "PATCH", Path: "/api/v1/admin/products/{id}", Tag: "admin", Summary: "Update a product",
+			Params:    []apiParam{idParam("Product")},
+			Request:   UpdateProductRequest{},
+			Responses: map[int]any{200: Product{}, 404: nil}},
+		{Method: "GET", Path: "/api/v1/inventory", Tag: "catalog", Summary: "Stock on hand for tracked products",
+			Responses: map[int]any{200: InventoryListResponse{}}},
+		{Method: "PUT", Path: "/api/v1/admin/inventory/{product_id}", Tag: "admin", Summary: "Set a product's stock on hand",
+			Params:    []apiParam{{Name: "product_id", In: "path", Type: "string", Required: true}},
+			Request:   UpdateInventoryRequest{},
+			Responses: map[int]any{200: InventoryLevel{}, 400: nil, 404: nil, 409: nil}},
+		{Method: "POST", Path: "/api/v1/admin/discount-codes", Tag: "admin", Summary: "Create a discount code",
+			Request:   CreateDiscountCodeRequest{},
+			Responses: map[int]any{201: DiscountCode{}, 400: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/admin/discount-codes", Tag: "admin", Summary: "List discount codes",
+			Responses: map[int]any{200: DiscountCodeListResponse{}}},
+		{Method: "GET", Path: "/api/v1/admin/discount-codes/{code}", Tag: "admin", Summary: "Fetch a discount code",
+			Params:    []apiParam{codeParam},
+			Responses: map[int]any{200: DiscountCode{}, 404: nil}},
+		{Method: "PATCH", Path: "/api/v1/admin/discount-codes/{code}", Tag: "admin", Summary: "Update or disable a discount code",
+			Params:    []apiParam{codeParam},
+			Request:   UpdateDiscountCodeRequest{},
+			Responses: map[int]any{200: DiscountCode{}, 400: nil, 404: nil}},
+		{Method: "GET", Path: "/api/v1/customer-tiers", Tag: "customers", Summary: "List pricing tiers and their discounts",
+			Responses: map[int]any{200: CustomerTierListResponse{}}},
+		{Method: "PUT", Path: "/api/v1/admin/customer-tiers/{tier}", Tag: "admin", Summary: "Create a tier or change its discount",
+			Params:    []apiParam{{Name: "tier", In: "path", Type: "string", Required: true}},
+			Request:   UpdateCustomerTierRequest{},
+			Responses: map[int]any{200: CustomerTier{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/promotions", Tag: "catalog", Summary: "Promotion rules currently in effect",
+			Responses: map[int]any{200: PromotionRuleset{}}},
+		{Method: "PUT", Path: "/api/v1/admin/promotions", Tag: "admin", Summary: "Replace the promotion ruleset",
+			Request:   PromotionRuleset{},
+			Responses: map[int]any{200: PromotionRuleset{}, 400: nil}},
+		{Method: "POST", Path: "/api/v1/admin/promotions/reload", Tag: "admin", Summary: "Re-read the promotion ruleset now",
+			Responses: map[int]any{200: PromotionRuleset{}, 422: nil}},
+		{Method: "GET", Path: "/api/v1/exchange-rates", Tag: "catalog", Summary: "Exchange rates into the reporting currency",
+			Responses: map[int]any{200: ExchangeRateListResponse{}}},
+		{Method: "PUT", Path: "/api/v1/admin/exchange-rates/{currency}", Tag: "admin", Summary: "Set the exchange rate for a currency",
+			Params:    []apiParam{{Name: "currency", In: "path", Type: "string", Description: "ISO 4217 currency code", Required: true}},
+			Request:   UpdateExchangeRateRequest{},
+			Responses: map[int]any{200: ExchangeRate{}, 400: nil, 409: nil}},
+		{Method: "GET", Path: "/api/v1/tax/jurisdictions", Tag: "catalog", Summary: "List tax regions and their component rates",
+			Responses: map[int]any{200: TaxJurisdictionListResponse{}}},
+		{Method: "GET", Path: "/api/v1/admin/settings", Tag: "admin", Summary: "List runtime setting overrides",
+			Responses: map[int]any{200: SettingListResponse{}}},
+		{Method: "PUT", Path: "/api/v1/admin/settings/{key}", Tag: "admin", Summary: "Override a setting such as tax_rate",
+			Params:    []apiParam{settingKeyParam},
+			Request:   UpdateSettingRequest{},
+			Responses: map[int]any{200: Setting{}, 400: nil, 404: nil}},
+		{Method: "DELETE", Path: "/api/v1/admin/settings/{key}", Tag: "admin", Summary: "Remove an override and fall back to the environment",
+			Params:    []apiParam{settingKeyParam},
+			Responses: map[int]any{204: nil, 404: nil}},
+		{Method: "POST", Path: "/api/v1/admin/api-keys", Tag: "admin", Summary: "Mint an API key; the key is only returned here",
+			Request:   CreateAPIKeyRequest{},
+			Responses: map[int]any{201: CreateAPIKeyResponse{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/admin/api-keys", Tag: "admin", Summary: "List API keys, including revoked ones",
+			Responses: map[int]any{200: APIKeyListResponse{}}},
+		{Method: "DELETE", Path: "/api/v1/admin/api-keys/{id}", Tag: "admin", Summary: "Revoke an API key",
+			Params:    []apiParam{idParam("API key")},
+			Responses: map[int]any{200: APIKey{}, 400: nil, 404: nil}},
+
+		{Method: "GET", Path: "/api/v1/stats", Tag: "reporting", Summary: "Aggregate transaction statistics",
+			Responses: map[int]any{200: ServiceStats{}}},
+		{Method: "GET", Path: "/api/v1/stats/timeseries", Tag: "reporting", Summary: "Transaction counts and revenue per time bucket",
+			Params: []apiParam{
+				{Name: "granularity", In: "query", Type: "string", Description: "hour (default) or day"},
+				fromParam, toParam,
+			},
+			Responses: map[int]any{200: TimeseriesResponse{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/reports/revenue-by-category", Tag: "reporting", Summary: "Gross revenue per category",
+			Params:    []apiParam{fromParam, toParam},
+			Responses: map[int]any{200: RevenueByCategoryResponse{}, 400: nil}},
+		{Method: "GET", Path: "/api/v1/reports/top-products", Tag: "reporting", Summary: "Best-selling products",
+			Params: []apiParam{
+				{Name: "limit", In: "query", Type: "integer", Description: "1-100, default 10"},
+				{Name: "sort_by", In: "query", Type: "string", Description: "quantity (default) or revenue"},
+				{Name: "window", In: "query", Type: "string", Description: "Trailing window such as 24h or 7d (default 30d)"},
+				fromParam, toParam,
+			},
+			Responses: map[int]any{200: TopProductsResponse{}, 400: nil}},
+
+		{Method: "POST", Path: "/api/v2/transactions", Tag: "v2", Summary: "Price and persist a transaction using integer cents",
+			Params:    []apiParam{idempotencyKeyParam, localeParam},
+			Request:   V2TransactionRequest{},
+			Responses: map[int]any{201: V2TransactionResponse{}, 400: V2ErrorResponse{}, 422: V2ErrorResponse{}}},
+		{Method: "GET", Path: "/api/v2/transactions/{id}", Tag: "v2", Summary: "Fetch a transaction using integer cents",
+			Params:    []apiParam{idParam("Transaction"), localeParam},
+			Responses: map[int]any{200: V2TransactionResponse{}, 400: V2ErrorResponse{}, 404: V2ErrorResponse{}}},
+	}
+}
+
+// schemaBuilder turns Go types into OpenAPI schemas, registering named
+// structs under components/schemas and referencing them by $ref.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	moneyType = reflect.TypeOf(Money(0))
+)
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == moneyType:
+		return map[string]any{"type": "number", "multipleOf": 0.01}
+	case t.Kind() == reflect.Pointer:
+		schema := b.schemaFor(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		return b.structRef(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+func (b *schemaBuilder) structRef(t reflect.Type) map[string]any {
+	ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	if _, done := b.components[t.Name()]; done {
+		return ref
+	}
+	// Reserve the name first so self-referencing types terminate
+	b.components[t.Name()] = map[string]any{}
+
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = b.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	b.components[t.Name()] = schema
+	return ref
+}
+
+func buildOpenAPISpec(serviceName string) map[string]any {
+	builder := &schemaBuilder{components: map[string]any{}}
+	paths := map[string]map[string]any{}
+
+	for _, op := range apiOperations() {
+		operation := map[string]any{
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"operationId": strings.ToLower(op.Method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_").Replace(op.Path),
+		}
+
+		if op.Deprecated {
+			operation["deprecated"] = true
+		}
+
+		if len(op.Params) > 0 {
+			params := make([]any, 0, len(op.Params))
+			for _, p := range op.Params {
+				param := map[string]any{
+					"name":     p.Name,
+					"in":       p.In,
+					"required": p.Required,
+					"schema":   map[string]any{"type": p.Type},
+				}
+				if p.Description != "" {
+					param["description"] = p.Description
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": builder.schemaFor(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+
+		responses := map[string]any{}
+		for status, body := range op.Responses {
+			response := map[string]any{"description": http.StatusText(status)}
+			if body == nil {
+				response["content"] = map[string]any{
+					"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+				}
+			} else {
+				response["content"] = map[string]any{
+					"application/json": map[string]any{"schema": builder.schemaFor(reflect.TypeOf(body))},
+				}
+			}
+			responses[strconv.Itoa(status)] = response
+		}
+		operation["responses"] = responses
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	tags := map[string]struct{}{}
+	for _, op := range apiOperations() {
+		tags[op.Tag] = struct{}{}
+	}
+	tagNames := make([]string, 0, len(tags))
+	for tag := range tags {
+		tagNames = append(tagNames, tag)
+	}
+	sort.Strings(tagNames)
+	tagList := make([]any, 0, len(tagNames))
+	for _, tag := range tagNames {
+		tagList = append(tagList, map[string]any{"name": tag})
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   serviceName + " API",
+			"version": version,
+		},
+		"tags":       tagList,
+		"paths":      paths,
+		"components": map[string]any{"schemas": builder.components},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.Marshal(buildOpenAPISpec(s.config.ServiceName))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPIJSON)
+}
+
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(swaggerUIPage)
+}
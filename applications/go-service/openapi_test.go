@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpecCoversOperations(t *testing.T) {
+	spec := buildOpenAPISpec("go-service")
+
+	paths := spec["paths"].(map[string]map[string]any)
+	for _, op := range apiOperations() {
+		if _, ok := paths[op.Path][strings.ToLower(op.Method)]; !ok {
+			t.Errorf("spec missing %s %s", op.Method, op.Path)
+		}
+	}
+
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+	request, ok := schemas["TransactionRequest"].(map[string]any)
+	if !ok {
+		t.Fatal("spec missing TransactionRequest schema")
+	}
+
+	properties := request["properties"].(map[string]any)
+	for _, field := range []string{"items", "customer_id", "discount_code"} {
+		if _, ok := properties[field]; !ok {
+			t.Errorf("TransactionRequest schema missing %q", field)
+		}
+	}
+
+	required := request["required"].([]string)
+	for _, field := range required {
+		if field == "discount_code" {
+			t.Error("omitempty field discount_code should not be required")
+		}
+	}
+	if _, ok := schemas["Item"]; !ok {
+		t.Error("nested Item schema was not registered")
+	}
+}
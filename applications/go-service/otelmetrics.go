@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// MetricExporters selects where the metrics go, from OTEL_METRICS_EXPORTER:
+// a comma-separated list of "prometheus", serving /metrics for scraping,
+// and "otlp", pushing the same series to the collector traces go to.
+// "none" turns both off. METRICS_BACKEND=statsd also sends them to a StatsD
+// agent, and unless OTEL_METRICS_EXPORTER says otherwise stops serving
+// /metrics, for environments run on Datadog rather than Prometheus.
+type MetricExporters struct {
+	Prometheus bool
+	OTLP       bool
+	StatsD     bool
+}
+
+func loadMetricExporters() MetricExporters {
+	cfg := loadOTelMetricExporters()
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("METRICS_BACKEND")), "statsd") {
+		cfg.StatsD = true
+		if os.Getenv("OTEL_METRICS_EXPORTER") == "" {
+			cfg.Prometheus = false
+		}
+	}
+	return cfg
+}
+
+func loadOTelMetricExporters() MetricExporters {
+	val := os.Getenv("OTEL_METRICS_EXPORTER")
+	if val == "" {
+		return MetricExporters{Prometheus: true}
+	}
+	var cfg MetricExporters
+	valid := false
+	for _, name := range strings.Split(val, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "prometheus":
+			cfg.Prometheus, valid = true, true
+		case "otlp":
+			cfg.OTLP, valid = true, true
+		case "none":
+			valid = true
+		}
+	}
+	if !valid {
+		return MetricExporters{Prometheus: true}
+	}
+	return cfg
+}
+
+// initMetricsExport starts a meter provider that reads the registry every
+// OTEL_METRIC_EXPORT_INTERVAL (default 60s) and pushes it over OTLP HTTP.
+// It isn't made the global provider: everything worth exporting is already
+// in the registry, and the instrumentation libraries' own meters would
+// duplicate http_requests_total under other names.
+func initMetricsExport(gatherer prometheus.Gatherer) (*sdkmetric.MeterProvider, error) {
+	ctx := context.Background()
+	exporter, err := otlpmetrichttp.New(ctx,
+		otlpmetrichttp.WithEndpoint(collectorHost()+":4318"),
+		otlpmetrichttp.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	res, err := serviceResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithProducer(registryProducer{gatherer: gatherer, start: time.Now()}))
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res)), nil
+}
+
+// registryProducer converts what the registry gathers into OpenTelemetry
+// metrics. Counters become cumulative monotonic sums, gauges and untyped
+// metrics become gauges, and histograms keep their buckets. Summaries,
+// which the OTLP exporter can't send, are left out; go_gc_duration_seconds
+// is the only one.
+type registryProducer struct {
+	gatherer prometheus.Gatherer
+	// start is reported as every series' start time
+	start time.Time
+}
+
+func (p registryProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+	now := time.Now()
+	scope := metricdata.ScopeMetrics{
+		Scope: instrumentation.Scope{Name: "github.com/prometheus/client_golang"},
+	}
+	for _, family := range families {
+		if m, ok := convertFamily(family, p.start, now); ok {
+			scope.Metrics = append(scope.Metrics, m)
+		}
+	}
+	// A partial gather is still exported; the error is reported alongside
+	return []metricdata.ScopeMetrics{scope}, err
+}
+
+func convertFamily(family *dto.MetricFamily, start, now time.Time) (metricdata.Metrics, bool) {
+	m := metricdata.Metrics{Name: family.GetName(), Description: family.GetHelp()}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		for _, metric := range family.GetMetric() {
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: labelSet(metric), StartTime: start, Time: now, Value: metric.GetCounter().GetValue(),
+			})
+		}
+		m.Data = sum
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		var gauge metricdata.Gauge[float64]
+		for _, metric := range family.GetMetric() {
+			value := metric.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = metric.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: labelSet(metric), Time: now, Value: value,
+			})
+		}
+		m.Data = gauge
+	case dto.MetricType_HISTOGRAM:
+		hist := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+		for _, metric := range family.GetMetric() {
+			hist.DataPoints = append(hist.DataPoints, histogramPoint(metric, start, now))
+		}
+		m.Data = hist
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// histogramPoint turns Prometheus's cumulative bucket counts into
+// OpenTelemetry's per-bucket ones, with the +Inf bucket implied by the
+// last count
+func histogramPoint(metric *dto.Metric, start, now time.Time) metricdata.HistogramDataPoint[float64] {
+	h := metric.GetHistogram()
+	point := metricdata.HistogramDataPoint[float64]{
+		Attributes: labelSet(metric),
+		StartTime:  start,
+		Time:       now,
+		Count:      h.GetSampleCount(),
+		Sum:        h.GetSampleSum(),
+	}
+	var below uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		point.Bounds = append(point.Bounds, bucket.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-below)
+		below = bucket.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, point.Count-below)
+	return point
+}
+
+func labelSet(metric *dto.Metric) attribute.Set {
+	attrs := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		attrs = append(attrs, attribute.String(label.GetName(), label.GetValue()))
+	}
+	return attribute.NewSet(attrs...)
+}
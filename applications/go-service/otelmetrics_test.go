@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLoadMetricExporters(t *testing.T) {
+	tests := []struct {
+		env  string
+		want MetricExporters
+	}{
+		{"", MetricExporters{Prometheus: true}},
+		{"prometheus", MetricExporters{Prometheus: true}},
+		{"otlp", MetricExporters{OTLP: true}},
+		{"otlp, Prometheus", MetricExporters{Prometheus: true, OTLP: true}},
+		{"none", MetricExporters{}},
+		{"statsd", MetricExporters{Prometheus: true}},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_METRICS_EXPORTER", tt.env)
+		if got := loadMetricExporters(); got != tt.want {
+			t.Errorf("OTEL_METRICS_EXPORTER=%q: got %+v, want %+v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryProducer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"service": "go-service"}, registry)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total", Help: "Jobs run"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_depth", Help: "Jobs waiting"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "batch_size", Help: "Batch sizes", Buckets: []float64{1, 5}})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "pause_seconds", Help: "Pauses"})
+	reg.MustRegister(counter, gauge, hist, summary)
+
+	counter.Add(3)
+	gauge.Set(7)
+	for _, v := range []float64{1, 2, 3, 9} {
+		hist.Observe(v)
+	}
+	summary.Observe(1)
+
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(registryProducer{gatherer: registry, start: time.Now()}))
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]metricdata.Aggregation{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	if _, ok := got["pause_seconds"]; ok || len(got) != 3 {
+		t.Fatalf("metrics = %v, want jobs_total, queue_depth, and batch_size", got)
+	}
+
+	sum, ok := got["jobs_total"].(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality || sum.DataPoints[0].Value != 3 {
+		t.Errorf("jobs_total = %+v, want a cumulative monotonic sum of 3", got["jobs_total"])
+	}
+	if service, _ := sum.DataPoints[0].Attributes.Value("service"); service.AsString() != "go-service" {
+		t.Errorf("jobs_total service = %q, want go-service", service.AsString())
+	}
+	if g, ok := got["queue_depth"].(metricdata.Gauge[float64]); !ok || g.DataPoints[0].Value != 7 {
+		t.Errorf("queue_depth = %+v, want a gauge of 7", got["queue_depth"])
+	}
+
+	h, ok := got["batch_size"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("batch_size = %T, want a histogram", got["batch_size"])
+	}
+	point := h.DataPoints[0]
+	if point.Count != 4 || point.Sum != 15 {
+		t.Errorf("batch_size count, sum = %d, %v, want 4, 15", point.Count, point.Sum)
+	}
+	if !reflect.DeepEqual(point.Bounds, []float64{1, 5}) || !reflect.DeepEqual(point.BucketCounts, []uint64{1, 2, 1}) {
+		t.Errorf("batch_size bounds %v counts %v, want [1 5] [1 2 1]", point.Bounds, point.BucketCounts)
+	}
+}
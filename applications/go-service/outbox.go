@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	OutboxSinkWebhook = "webhook"
+	OutboxSinkKafka   = "kafka"
+)
+
+// OutboxConfig chooses where outbox events are delivered. With no Sink the
+// outbox isn't written at all.
+type OutboxConfig struct {
+	Sink           string
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	KafkaBrokers   []string
+	KafkaTopic     string
+	// Interval is how often the publisher looks for undelivered events
+	Interval  time.Duration
+	BatchSize int
+	// Retain is how long delivered events are kept before being deleted
+	Retain time.Duration
+}
+
+func loadOutboxConfig() OutboxConfig {
+	cfg := OutboxConfig{
+		WebhookURL:     os.Getenv("OUTBOX_WEBHOOK_URL"),
+		WebhookTimeout: 5 * time.Second,
+		KafkaTopic:     "transactions",
+		Interval:       time.Second,
+		BatchSize:      100,
+		Retain:         7 * 24 * time.Hour,
+	}
+	if val := os.Getenv("OUTBOX_SINK"); val == OutboxSinkWebhook || val == OutboxSinkKafka {
+		cfg.Sink = val
+	}
+	if val := os.Getenv("OUTBOX_WEBHOOK_TIMEOUT"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.WebhookTimeout = parsed
+		}
+	}
+	for _, broker := range strings.Split(os.Getenv("OUTBOX_KAFKA_BROKERS"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			cfg.KafkaBrokers = append(cfg.KafkaBrokers, broker)
+		}
+	}
+	if val := os.Getenv("OUTBOX_KAFKA_TOPIC"); val != "" {
+		cfg.KafkaTopic = val
+	}
+	if val := os.Getenv("OUTBOX_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Interval = parsed
+		}
+	}
+	if val := os.Getenv("OUTBOX_BATCH_SIZE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			cfg.BatchSize = parsed
+		}
+	}
+	if val := os.Getenv("OUTBOX_RETAIN"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Retain = parsed
+		}
+	}
+	return cfg
+}
+
+// outboxMessage is one undelivered outbox row. ID is the same on every
+// delivery attempt, so consumers can drop the duplicates at-least-once
+// delivery produces.
+type outboxMessage struct {
+	ID          int64
+	EventType   string
+	AggregateID uuid.UUID
+	Payload     []byte
+	Attempts    int
+}
+
+// outboxSink delivers messages in order and returns how many it delivered
+// before the first failure
+type outboxSink interface {
+	Publish(ctx context.Context, messages []outboxMessage) (int, error)
+	Close() error
+}
+
+func newOutboxSink(cfg OutboxConfig) (outboxSink, error) {
+	switch cfg.Sink {
+	case OutboxSinkWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("OUTBOX_SINK=webhook requires OUTBOX_WEBHOOK_URL")
+		}
+		return &webhookSink{
+			url:    cfg.WebhookURL,
+			client: &http.Client{Timeout: cfg.WebhookTimeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		}, nil
+	case OutboxSinkKafka:
+		if len(cfg.KafkaBrokers) == 0 {
+			return nil, fmt.Errorf("OUTBOX_SINK=kafka requires OUTBOX_KAFKA_BROKERS")
+		}
+		return &kafkaSink{writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.KafkaBrokers...),
+			Topic:        cfg.KafkaTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    cfg.BatchSize,
+			BatchTimeout: 10 * time.Millisecond,
+		}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// webhookSink POSTs each event's payload, taking any 2xx as delivered
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (w *webhookSink) Publish(ctx context.Context, messages []outboxMessage) (int, error) {
+	for i, msg := range messages {
+		if err := w.post(ctx, msg); err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+func (w *webhookSink) post(ctx context.Context, msg outboxMessage) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(msg.ID, 10))
+	req.Header.Set("X-Event-Type", msg.EventType)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *webhookSink) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// kafkaSink produces each event keyed by its aggregate, so every event for
+// one transaction lands on the same partition
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func (k *kafkaSink) Publish(ctx context.Context, messages []outboxMessage) (int, error) {
+	records := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		records[i] = kafka.Message{
+			Key:   []byte(msg.AggregateID.String()),
+			Value: msg.Payload,
+			Headers: []kafka.Header{
+				{Key: "event-id", Value: []byte(strconv.FormatInt(msg.ID, 10))},
+				{Key: "event-type", Value: []byte(msg.EventType)},
+			},
+		}
+	}
+
+	err := k.writer.WriteMessages(ctx, records...)
+	if err == nil {
+		return len(messages), nil
+	}
+	var writeErrs kafka.WriteErrors
+	if !errors.As(err, &writeErrs) {
+		return 0, err
+	}
+	for i, writeErr := range writeErrs {
+		if writeErr != nil {
+			return i, writeErr
+		}
+	}
+	return len(messages), nil
+}
+
+func (k *kafkaSink) Close() error {
+	return k.writer.Close()
+}
+
+// enqueueOutbox records event on tx, so it is delivered if and only if tx
+// commits. It does nothing when no sink is configured.
+func (s *Server) enqueueOutbox(ctx context.Context, tx pgx.Tx, event TransactionEvent) error {
+	if s.config.Outbox.Sink == "" {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)
+	`, event.Type, event.TransactionID, payload)
+	return err
+}
+
+// outboxBackoff is how long an event waits before its next delivery
+// attempt, doubling from a second up to five minutes
+func outboxBackoff(attempts int) time.Duration {
+	const maxBackoff = 5 * time.Minute
+	if attempts >= 9 {
+		return maxBackoff
+	}
+	return min(time.Second<<attempts, maxBackoff)
+}
+
+// runOutboxPublisher delivers outbox events every Interval and deletes
+// delivered ones past Retain
+func (s *Server) runOutboxPublisher(ctx context.Context) {
+	runEvery(ctx, s.config.Outbox.Interval, func(ctx context.Context) {
+		if err := s.publishOutbox(ctx); err != nil {
+			slog.ErrorContext(ctx, "outbox publisher failed", "error", err)
+		}
+		if _, err := s.db.Exec(ctx, `DELETE FROM outbox WHERE processed_at < $1`, time.Now().Add(-s.config.Outbox.Retain)); err != nil {
+			slog.ErrorContext(ctx, "outbox publisher failed to delete delivered events", "error", err)
+		}
+
+		var pending int64
+		if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM outbox WHERE processed_at IS NULL`).Scan(&pending); err != nil {
+			slog.ErrorContext(ctx, "outbox publisher failed to count pending events", "error", err)
+			return
+		}
+		s.outboxPending.Store(pending)
+	})
+}
+
+// publishOutbox delivers due events a batch at a time until none are left
+// or a delivery fails
+func (s *Server) publishOutbox(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := s.publishOutboxBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n < s.config.Outbox.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// publishOutboxBatch delivers up to BatchSize due events in id order and
+// marks the delivered ones processed. The rows stay locked while they are
+// delivered, so other instances skip past them rather than sending them
+// too; an instance that dies mid-batch leaves them to be sent again. The
+// first event that fails is retried after a backoff, and those after it on
+// the next pass.
+func (s *Server) publishOutboxBatch(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, event_type, aggregate_id, payload, attempts FROM outbox
+		WHERE processed_at IS NULL AND next_attempt_at <= NOW()
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+	`, s.config.Outbox.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("select events: %w", err)
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (outboxMessage, error) {
+		var msg outboxMessage
+		err := row.Scan(&msg.ID, &msg.EventType, &msg.AggregateID, &msg.Payload, &msg.Attempts)
+		return msg, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("select events: %w", err)
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	delivered, publishErr := s.outbox.Publish(ctx, messages)
+	ids := make([]int64, delivered)
+	for i, msg := range messages[:delivered] {
+		ids[i] = msg.ID
+	}
+	if _, err := tx.Exec(ctx, `UPDATE outbox SET processed_at = NOW() WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("mark events processed: %w", err)
+	}
+	if publishErr != nil {
+		failed := messages[delivered]
+		_, err := tx.Exec(ctx, `
+			UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1
+		`, failed.ID, publishErr.Error(), time.Now().Add(outboxBackoff(failed.Attempts)))
+		if err != nil {
+			return 0, fmt.Errorf("record failed delivery: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	s.outboxPublished.Add(int64(delivered))
+	if publishErr != nil {
+		s.outboxFailures.Add(1)
+		return delivered, fmt.Errorf("deliver event %d: %w", messages[delivered].ID, publishErr)
+	}
+	return delivered, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{8, 256 * time.Second},
+		{9, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestNewOutboxSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     OutboxConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{"none", OutboxConfig{}, true, false},
+		{"webhook", OutboxConfig{Sink: OutboxSinkWebhook, WebhookURL: "http://example.com/hook"}, false, false},
+		{"webhook without url", OutboxConfig{Sink: OutboxSinkWebhook}, true, true},
+		{"kafka", OutboxConfig{Sink: OutboxSinkKafka, KafkaBrokers: []string{"localhost:9092"}, KafkaTopic: "transactions"}, false, false},
+		{"kafka without brokers", OutboxConfig{Sink: OutboxSinkKafka}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := newOutboxSink(tt.cfg)
+			if (err != nil) != tt.wantErr || (sink == nil) != tt.wantNil {
+				t.Errorf("sink = %v, err = %v", sink, err)
+			}
+		})
+	}
+}
+
+func TestWebhookSinkStopsAtFirstFailure(t *testing.T) {
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Event-ID"))
+		if r.Header.Get("X-Event-Type") != EventTransactionCreated || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if r.Header.Get("X-Event-ID") == "2" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	sink, err := newOutboxSink(OutboxConfig{Sink: OutboxSinkWebhook, WebhookURL: srv.URL, WebhookTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	var messages []outboxMessage
+	for id := int64(1); id <= 3; id++ {
+		messages = append(messages, outboxMessage{ID: id, EventType: EventTransactionCreated, AggregateID: uuid.New(), Payload: []byte(`{}`)})
+	}
+	delivered, err := sink.Publish(context.Background(), messages)
+	if delivered != 1 || err == nil {
+		t.Errorf("delivered %d, err %v; want 1 and the 502", delivered, err)
+	}
+	if len(received) != 2 {
+		t.Errorf("received %v, want events 1 and 2 only", received)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PartitionConfig sets how far ahead monthly transactions partitions are
+// created. A row written before its month's partition exists lands in
+// transactions_default, and that month's partition can't be created until
+// the row is moved out, so MonthsAhead should stay at one or more.
+type PartitionConfig struct {
+	MonthsAhead   int
+	CheckInterval time.Duration
+}
+
+func loadPartitionConfig() PartitionConfig {
+	cfg := PartitionConfig{MonthsAhead: 3, CheckInterval: 6 * time.Hour}
+	if val := os.Getenv("PARTITION_MONTHS_AHEAD"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			cfg.MonthsAhead = parsed
+		}
+	}
+	if val := os.Getenv("PARTITION_CHECK_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.CheckInterval = parsed
+		}
+	}
+	return cfg
+}
+
+// monthPartition is the transactions partition for one UTC calendar month
+type monthPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// upcomingPartitions lists the partitions for the month containing now and
+// the ahead months after it, named like migration 032 names them
+func upcomingPartitions(now time.Time, ahead int) []monthPartition {
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	partitions := make([]monthPartition, 0, ahead+1)
+	for i := 0; i <= ahead; i++ {
+		next := month.AddDate(0, 1, 0)
+		partitions = append(partitions, monthPartition{
+			Name: "transactions_" + month.Format("2006_01"),
+			From: month,
+			To:   next,
+		})
+		month = next
+	}
+	return partitions
+}
+
+func (p monthPartition) createSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF transactions FOR VALUES FROM ('%s') TO ('%s')`,
+		pgx.Identifier{p.Name}.Sanitize(), p.From.Format(time.RFC3339), p.To.Format(time.RFC3339))
+}
+
+// ensurePartitions creates whichever of partitions don't exist yet and
+// returns their names. It does nothing until migration 032 has partitioned
+// the table. Replicas starting together serialize on an advisory lock.
+func ensurePartitions(ctx context.Context, pool *pgxpool.Pool, partitions []monthPartition) ([]string, error) {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var partitioned bool
+	if err := tx.QueryRow(ctx, `SELECT relkind = 'p' FROM pg_class WHERE oid = 'transactions'::regclass`).Scan(&partitioned); err != nil {
+		return nil, fmt.Errorf("check transactions table: %w", err)
+	}
+	if !partitioned {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('transactions_partitions'))`); err != nil {
+		return nil, fmt.Errorf("lock partitions: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'transactions'::regclass
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	var created []string
+	for _, p := range partitions {
+		if existing[p.Name] {
+			continue
+		}
+		if _, err := tx.Exec(ctx, p.createSQL()); err != nil {
+			return nil, fmt.Errorf("create partition %s: %w", p.Name, err)
+		}
+		created = append(created, p.Name)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return created, nil
+}
+
+// runPartitionMaintainer keeps the upcoming months' partitions in place
+func (s *Server) runPartitionMaintainer(ctx context.Context) {
+	runEvery(ctx, s.config.Partitions.CheckInterval, func(ctx context.Context) {
+		created, err := ensurePartitions(ctx, s.db, upcomingPartitions(time.Now(), s.config.Partitions.MonthsAhead))
+		if err != nil {
+			slog.ErrorContext(ctx, "partition maintainer failed", "error", err)
+			return
+		}
+		for _, name := range created {
+			slog.InfoContext(ctx, "partition maintainer created partition", "partition", name)
+		}
+	})
+}
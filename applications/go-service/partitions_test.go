@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpcomingPartitions(t *testing.T) {
+	// Late on New Year's Eve in New York is already January in UTC
+	ny := time.FixedZone("EST", -5*60*60)
+	got := upcomingPartitions(time.Date(2024, 12, 31, 22, 0, 0, 0, ny), 2)
+
+	want := []monthPartition{
+		{Name: "transactions_2025_01", From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "transactions_2025_02", From: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "transactions_2025_03", From: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d partitions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("partition %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := upcomingPartitions(time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), 0); len(got) != 1 || got[0].Name != "transactions_2024_06" {
+		t.Errorf("no months ahead = %+v, want only the current month", got)
+	}
+}
+
+func TestPartitionCreateSQL(t *testing.T) {
+	p := upcomingPartitions(time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), 0)[0]
+	want := `CREATE TABLE IF NOT EXISTS "transactions_2024_02" PARTITION OF transactions FOR VALUES FROM ('2024-02-01T00:00:00Z') TO ('2024-03-01T00:00:00Z')`
+	if got := p.createSQL(); got != want {
+		t.Errorf("createSQL() = %s\nwant %s", got, want)
+	}
+}
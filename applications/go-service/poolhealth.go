@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PoolHealthConfig sets how the primary pool is supervised. After
+// FailureThreshold pings in a row fail, the service reports not ready and
+// the pool's connections are dropped, so they are reopened with a fresh DNS
+// lookup and, when POSTGRES_CREDENTIALS_FILE is set, current credentials.
+type PoolHealthConfig struct {
+	Interval         time.Duration
+	FailureThreshold int
+}
+
+func loadPoolHealthConfig() PoolHealthConfig {
+	cfg := PoolHealthConfig{Interval: 5 * time.Second, FailureThreshold: 3}
+	if val := os.Getenv("POOL_HEALTH_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Interval = parsed
+		}
+	}
+	if val := os.Getenv("POOL_HEALTH_FAILURE_THRESHOLD"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			cfg.FailureThreshold = parsed
+		}
+	}
+	return cfg
+}
+
+// poolHealth counts consecutive failed pings
+type poolHealth struct {
+	threshold int
+	failures  int
+}
+
+// observe records a ping result, reporting whether the database should now
+// count as reachable and whether to drop the pool's connections. While the
+// database stays down they are dropped again every threshold failures.
+func (h *poolHealth) observe(err error) (ready, reset bool) {
+	if err == nil {
+		h.failures = 0
+		return true, false
+	}
+	h.failures++
+	return h.failures < h.threshold, h.failures%h.threshold == 0
+}
+
+// runPoolSupervisor pings the primary every Interval, keeping dbReady
+// current, and drops the pools' connections when the database stays
+// unreachable or the credentials file changes
+func (s *Server) runPoolSupervisor(ctx context.Context) {
+	health := poolHealth{threshold: s.config.PoolHealth.FailureThreshold}
+	credentialsChanged := credentialsWatcher(s.config.DBCredentialsFile)
+
+	runEvery(ctx, s.config.PoolHealth.Interval, func(ctx context.Context) {
+		if credentialsChanged() {
+			slog.InfoContext(ctx, "pool supervisor reconnecting with new credentials", "file", s.config.DBCredentialsFile)
+			s.resetPools()
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, s.config.Timeouts.Health)
+		err := s.db.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		ready, reset := health.observe(err)
+		if s.dbReady.Swap(ready) != ready {
+			if ready {
+				slog.InfoContext(ctx, "pool supervisor: database reachable again, reporting ready")
+			} else {
+				slog.ErrorContext(ctx, "pool supervisor: database unreachable, reporting not ready", "failures", health.failures, "error", err)
+			}
+		}
+		if reset {
+			slog.WarnContext(ctx, "pool supervisor reconnecting after failed pings", "failures", health.failures)
+			s.resetPools()
+		}
+	})
+}
+
+// resetPools closes every idle connection and each checked-out one as it is
+// released. Queries in flight finish on their connection.
+func (s *Server) resetPools() {
+	s.db.Reset()
+	if s.replica != nil {
+		s.replica.Reset()
+	}
+	s.poolResets.Add(1)
+}
+
+// credentialsWatcher returns a func reporting whether path has been modified
+// since it last looked, for a secret rendered by an agent such as Vault's.
+// With no path it never reports a change.
+func credentialsWatcher(path string) func() bool {
+	if path == "" {
+		return func() bool { return false }
+	}
+	var last time.Time
+	if info, err := os.Stat(path); err == nil {
+		last = info.ModTime()
+	}
+	return func() bool {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(last) {
+			return false
+		}
+		last = info.ModTime()
+		return true
+	}
+}
+
+// applyCredentialsFile sets conn's user and password from path, an env
+// file with POSTGRES_USER and POSTGRES_PASSWORD lines. Either may be
+// missing, leaving conn's own.
+func applyCredentialsFile(conn *pgx.ConnConfig, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		switch strings.TrimSpace(key) {
+		case "POSTGRES_USER":
+			conn.User = value
+		case "POSTGRES_PASSWORD":
+			conn.Password = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+	return nil
+}
+
+// readyHandler is the readiness probe. It fails only once the supervisor has
+// seen the database unreachable for FailureThreshold pings, so a single
+// slow ping doesn't take the instance out of rotation.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status, code := "ready", http.StatusOK
+	if s.db != nil && !s.dbReady.Load() {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(HealthResponse{
+		Status:    status,
+		Service:   s.config.ServiceName,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
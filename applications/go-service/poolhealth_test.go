@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPoolHealthObserve(t *testing.T) {
+	down := errors.New("connection refused")
+	h := poolHealth{threshold: 3}
+	steps := []struct {
+		err   error
+		ready bool
+		reset bool
+	}{
+		{down, true, false},
+		{down, true, false},
+		{down, false, true},
+		{down, false, false},
+		{down, false, false},
+		{down, false, true},
+		{nil, true, false},
+		{down, true, false},
+	}
+	for i, step := range steps {
+		ready, reset := h.observe(step.err)
+		if ready != step.ready || reset != step.reset {
+			t.Errorf("step %d: ready %v reset %v, want %v %v", i, ready, reset, step.ready, step.reset)
+		}
+	}
+}
+
+func TestApplyCredentialsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.env")
+	contents := "POSTGRES_DB=portfolio\n# rotated\nPOSTGRES_USER=app_user_v2\nexport POSTGRES_PASSWORD=\"s3cret=\"\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &pgx.ConnConfig{}
+	conn.User, conn.Password, conn.Database = "app_user", "old", "portfolio"
+	if err := applyCredentialsFile(conn, path); err != nil {
+		t.Fatal(err)
+	}
+	if conn.User != "app_user_v2" || conn.Password != "s3cret=" || conn.Database != "portfolio" {
+		t.Errorf("conn = %s/%s/%s", conn.User, conn.Password, conn.Database)
+	}
+	if err := applyCredentialsFile(conn, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file should fail the connection")
+	}
+}
+
+func TestCredentialsWatcher(t *testing.T) {
+	if credentialsWatcher("")() {
+		t.Error("no file reported a change")
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.env")
+	if err := os.WriteFile(path, []byte("POSTGRES_PASSWORD=a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed := credentialsWatcher(path)
+	if changed() {
+		t.Error("unchanged file reported a change")
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !changed() || changed() {
+		t.Error("want one change reported after the file is rewritten")
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	s := newMemoryServer()
+	rec := httptest.NewRecorder()
+	s.readyHandler(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("memory storage: status %d, want 200", rec.Code)
+	}
+}
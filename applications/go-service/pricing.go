@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PricingEngine computes what a transaction costs. persistTransaction calls
+// CalculateSubtotal, then ApplyDiscount on that subtotal, then CalculateTax on
+// what the discounts left. An alternative strategy (dynamic or regional
+// pricing, say) can embed standardPricing and replace only the steps it
+// changes. Loading the inputs
+// (catalog prices, codes, rulesets, tax rules) and persisting the result stay
+// with the caller, which keeps engines free of I/O and testable on their own.
+type PricingEngine interface {
+	// Name is how the engine is selected with PRICING_ENGINE
+	Name() string
+	// CalculateSubtotal is called with items that passed validation
+	CalculateSubtotal(items []Item) Money
+	ApplyDiscount(ruleset PromotionRuleset, codes []DiscountCode, in promotionInput, rounding Rounding) PromotionResult
+	CalculateTax(rules TaxRules, items []Item, subtotal, discount Money, lineDiscounts []Money) (TaxResult, []LineTax)
+}
+
+// pricingEngines are the engines PRICING_ENGINE can name
+var pricingEngines = map[string]PricingEngine{
+	"standard": standardPricing{},
+}
+
+// newPricingEngine returns the engine registered under name, or the standard
+// engine when name is empty
+func newPricingEngine(name string) (PricingEngine, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return standardPricing{}, nil
+	}
+	engine, ok := pricingEngines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pricing engine %q", name)
+	}
+	return engine, nil
+}
+
+// standardPricing sums list prices, applies codes then promotions, and taxes
+// each line under the region's rules
+type standardPricing struct{}
+
+func (standardPricing) Name() string {
+	return "standard"
+}
+
+func (standardPricing) CalculateSubtotal(items []Item) Money {
+	return calculateSubtotal(items)
+}
+
+func (standardPricing) ApplyDiscount(ruleset PromotionRuleset, codes []DiscountCode, in promotionInput, rounding Rounding) PromotionResult {
+	return applyPromotions(ruleset, codes, in, rounding)
+}
+
+func (standardPricing) CalculateTax(rules TaxRules, items []Item, subtotal, discount Money, lineDiscounts []Money) (TaxResult, []LineTax) {
+	return rules.calculateItems(items, subtotal, discount, lineDiscounts)
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestNewPricingEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: "standard"},
+		{name: "standard", want: "standard"},
+		{name: " Standard ", want: "standard"},
+		{name: "dynamic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		engine, err := newPricingEngine(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("newPricingEngine(%q) succeeded, want error", tt.name)
+			}
+			continue
+		}
+		if err != nil || engine.Name() != tt.want {
+			t.Errorf("newPricingEngine(%q) = %v, %v; want %s", tt.name, engine, err, tt.want)
+		}
+	}
+}
+
+func TestStandardPricing(t *testing.T) {
+	engine := standardPricing{}
+	items := []Item{
+		{Name: "Book", Price: 2000, Quantity: 1, Category: "books"},
+		{Name: "Pen", Price: 500, Quantity: 2},
+	}
+
+	subtotal := engine.CalculateSubtotal(items)
+	if subtotal != 3000 {
+		t.Fatalf("subtotal = %s, want 30.00", subtotal)
+	}
+
+	rule := PromotionRule{
+		Name:       "books",
+		Conditions: PromotionConditions{Categories: []string{"books"}},
+		Action:     PromotionAction{Type: PromotionPercentOff, PercentOff: 10},
+	}
+	promotions := engine.ApplyDiscount(PromotionRuleset{Rules: []PromotionRule{rule}}, nil, promotionInput{Items: items, Subtotal: subtotal}, Rounding{})
+	if promotions.Discount != 200 {
+		t.Fatalf("discount = %s, want 2.00", promotions.Discount)
+	}
+
+	taxed, lines := engine.CalculateTax(TaxRules{Jurisdiction: flatJurisdiction(0.10)}, items, subtotal, promotions.Discount, promotions.LineDiscounts)
+	if taxed.Tax != 280 {
+		t.Errorf("tax = %s, want 2.80", taxed.Tax)
+	}
+	if lines[0].Discount != 200 || lines[1].Discount != 0 {
+		t.Errorf("line discounts = %s, %s; want 2.00, 0.00", lines[0].Discount, lines[1].Discount)
+	}
+}
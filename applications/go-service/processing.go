@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// processError carries the HTTP status and client-facing message for a
+// transaction that could not be processed. Err keeps the underlying cause and
+// Violations lists each failed rule for validation errors.
+type processError struct {
+	Status     int
+	Message    string
+	Err        error
+	Violations []Violation
+}
+
+func (e *processError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *processError) Unwrap() error {
+	return e.Err
+}
+
+func clientError(status int, message string) error {
+	return &processError{Status: status, Message: message}
+}
+
+func serverError(message string, err error) error {
+	return &processError{Status: http.StatusInternalServerError, Message: message, Err: err}
+}
+
+// errorStatus maps an error from processTransaction to its HTTP status and
+// client-facing message.
+func errorStatus(err error) (int, string) {
+	var perr *processError
+	if errors.As(err, &perr) {
+		return perr.Status, perr.Message
+	}
+	return http.StatusInternalServerError, "Failed to process transaction"
+}
+
+// writeProcessError answers r with err's status and message, reporting
+// server errors with their full cause
+func writeProcessError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		reportError(r.Context(), err)
+	}
+	if violations := errorViolations(err); len(violations) > 0 {
+		writeValidationError(w, status, message, violations)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// processTransaction prices and persists req in its own database transaction
+func (s *Server) processTransaction(ctx context.Context, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return TransactionResponse{}, serverError("Failed to start transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	response, err := s.persistTransaction(ctx, tx, req, now)
+	if err != nil {
+		return TransactionResponse{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return TransactionResponse{}, serverError("Failed to commit transaction", err)
+	}
+	s.recordCommitted(response)
+
+	return response, nil
+}
+
+// persistTransaction validates and prices req, then writes the transaction and
+// its line items using tx. The caller owns commit and rollback. Each call
+// gets a span carrying the transaction's ID, so a trace can be found from
+// the order.
+func (s *Server) persistTransaction(ctx context.Context, tx pgx.Tx, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	ctx, span := tracer.Start(ctx, "persist transaction", trace.WithAttributes(requestAttributes(req)...))
+	defer span.End()
+
+	response, err := s.priceAndPersist(ctx, tx, req, now)
+	endTransactionSpan(span, response, err)
+	return response, err
+}
+
+func (s *Server) priceAndPersist(ctx context.Context, tx pgx.Tx, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	if violations := s.config.OrderLimits.validateTransactionRequest(req, s.config.CatalogPricing); len(violations) > 0 {
+		return TransactionResponse{}, validationError("Transaction failed validation", violations)
+	}
+	tip := req.Tip
+
+	transactionID := uuid.New()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("transaction.id", transactionID.String()))
+
+	var customerUUID pgtype.UUID
+	if req.CustomerID != "" {
+		customerUUID = pgtype.UUID{
+			Bytes: uuid.MustParse(req.CustomerID),
+			Valid: true,
+		}
+	}
+
+	var (
+		customerTier string
+		taxExemption string
+	)
+	if customerUUID.Valid {
+		customer, err := loadCustomer(ctx, tx, customerUUID.Bytes)
+		if errors.Is(err, errCustomerNotFound) {
+			return TransactionResponse{}, clientError(http.StatusBadRequest, "Unknown customer_id")
+		}
+		if err != nil {
+			return TransactionResponse{}, serverError("Failed to validate customer", err)
+		}
+		customerTier = customer.Tier
+		if customer.TaxExempt {
+			taxExemption = "exemption certificate " + customer.ExemptionCertificate
+		}
+	}
+
+	currency := normalizeCurrency(req.Currency)
+	if currency == "" {
+		currency = s.config.ReportingCurrency
+	}
+	exchangeRate, err := loadExchangeRate(ctx, tx, currency, s.config.ReportingCurrency)
+	if errors.Is(err, errUnsupportedCurrency) {
+		return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, "Unsupported currency "+currency)
+	}
+	if err != nil {
+		return TransactionResponse{}, serverError("Failed to look up exchange rate", err)
+	}
+	spanEvent(ctx, "customer and currency loaded")
+
+	if s.config.CatalogPricing {
+		priced, err := priceItemsFromCatalog(ctx, tx, req.Items)
+		var unknown *UnknownProductsError
+		if errors.As(err, &unknown) {
+			return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, unknown.Error())
+		}
+		if err != nil {
+			return TransactionResponse{}, serverError("Failed to look up product prices", err)
+		}
+		// Catalog prices are kept in the reporting currency
+		for i := range priced {
+			priced[i].Price = fromReporting(priced[i].Price, exchangeRate)
+		}
+		if violations := checkAmounts(priced); len(violations) > 0 {
+			return TransactionResponse{}, validationError("Transaction failed validation", violations)
+		}
+		req.Items = priced
+	}
+
+	subtotal := s.pricing.CalculateSubtotal(req.Items)
+	spanEvent(ctx, "subtotal calculated", attribute.Float64("transaction.subtotal", moneyValue(subtotal)))
+	if violations := s.config.OrderLimits.checkMinimum(toReporting(subtotal, exchangeRate)); len(violations) > 0 {
+		return TransactionResponse{}, validationError("Transaction failed validation", violations)
+	}
+
+	submittedCodes := submittedDiscountCodes(req.DiscountCode, req.DiscountCodes)
+	discountCodes, codeResults, err := redeemDiscounts(ctx, tx, submittedCodes, s.config.DiscountStacking, now)
+	switch {
+	case errors.Is(err, errDiscountNotYetValid), errors.Is(err, errDiscountExpired), errors.Is(err, errDiscountExhausted):
+		return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		return TransactionResponse{}, serverError("Failed to look up discount code", err)
+	}
+
+	// discount_code keeps the first applied code for filtering and summaries
+	var appliedCode *string
+	appliedCodes := []string{}
+	for _, code := range discountCodes {
+		appliedCodes = append(appliedCodes, code.Code)
+	}
+	if len(appliedCodes) > 0 {
+		appliedCode = &appliedCodes[0]
+	}
+
+	ruleset := s.promotionRuleset()
+	if customerTier != "" {
+		tier, err := loadCustomerTier(ctx, tx, customerTier)
+		if err != nil {
+			return TransactionResponse{}, serverError("Failed to look up customer tier", err)
+		}
+		// Tier pricing applies after codes and before ruleset promotions
+		if rule, ok := tierRule(tier); ok {
+			ruleset.Rules = append([]PromotionRule{rule}, ruleset.Rules...)
+		}
+	}
+
+	promotions := s.pricing.ApplyDiscount(ruleset, discountCodes, promotionInput{
+		Items:        req.Items,
+		Subtotal:     subtotal,
+		Codes:        submittedCodes,
+		CustomerTier: customerTier,
+	}, s.config.Rounding)
+	discount := promotions.Discount
+	spanEvent(ctx, "discounts evaluated",
+		attribute.Int("transaction.promotions", len(promotions.Applied)),
+		attribute.Float64("transaction.discount", moneyValue(discount)))
+
+	// Points are redeemed against whatever the promotions left to pay
+	var pointsRedeemed int64
+	if req.RedeemPoints > 0 {
+		if !customerUUID.Valid {
+			return TransactionResponse{}, clientError(http.StatusBadRequest, "redeem_points requires a customer_id")
+		}
+		balance, err := lockLoyaltyBalance(ctx, tx, customerUUID.Bytes)
+		if err != nil {
+			return TransactionResponse{}, serverError("Failed to look up loyalty balance", err)
+		}
+		if balance < req.RedeemPoints {
+			return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, "Insufficient loyalty points")
+		}
+		used, value := s.config.Loyalty.redemption(req.RedeemPoints, toReporting(subtotal-discount, exchangeRate))
+		if value = min(fromReporting(value, exchangeRate), subtotal-discount); value > 0 {
+			pointsRedeemed = used
+			discount += value
+			promotions.Applied = append(promotions.Applied, AppliedPromotion{Name: "loyalty points", Amount: value})
+		}
+	}
+
+	region := normalizeRegion(req.Region)
+	rules, err := s.resolveTaxRules(ctx, tx, region)
+	if errors.Is(err, errUnknownRegion) {
+		return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, "Unknown region "+region)
+	}
+	if err != nil {
+		return TransactionResponse{}, serverError("Failed to look up tax rates", err)
+	}
+	if taxExemption != "" {
+		rules = rules.exempt()
+	}
+
+	taxed, lineTaxes := s.pricing.CalculateTax(rules, req.Items, subtotal, discount, promotions.LineDiscounts)
+	lines := make([]TransactionLine, len(req.Items))
+	for i, item := range req.Items {
+		lines[i] = TransactionLine{
+			Line:     i + 1,
+			ID:       item.ID,
+			Name:     item.Name,
+			Amount:   item.Price.Mul(item.Quantity),
+			Discount: lineTaxes[i].Discount,
+			Tax:      lineTaxes[i].Tax,
+		}
+	}
+	tax := taxed.Tax
+	// Shipping rates and thresholds are configured in the reporting currency
+	shipping := fromReporting(calculateShipping(s.config.Shipping, toReporting(subtotal-discount, exchangeRate), req.Items), exchangeRate)
+	total := subtotal - discount + shipping + tip
+	if !taxed.Inclusive {
+		total += tax
+	}
+
+	spanEvent(ctx, "tax and shipping calculated")
+
+	var pointsEarned int64
+	if customerUUID.Valid {
+		pointsEarned = s.config.Loyalty.pointsEarned(toReporting(total-tip, exchangeRate))
+	}
+
+	status := StatusCompleted
+	if req.AuthorizeOnly {
+		status = StatusPending
+	}
+
+	fingerprint := transactionFingerprint(req.CustomerID, currency, req.Items)
+	var duplicateOf pgtype.UUID
+	if s.config.Duplicates.Window > 0 && customerUUID.Valid {
+		original, found, err := findDuplicate(ctx, tx, fingerprint, total, now.Add(-s.config.Duplicates.Window))
+		if err != nil {
+			return TransactionResponse{}, serverError("Failed to check for duplicates", err)
+		}
+		if found {
+			if s.config.Duplicates.Action == DuplicateReject {
+				s.duplicatesRejected.Add(1)
+				return TransactionResponse{}, clientError(http.StatusConflict, "Possible duplicate of transaction "+original.String())
+			}
+			s.duplicatesFlagged.Add(1)
+			duplicateOf = pgtype.UUID{Bytes: original, Valid: true}
+		}
+	}
+
+	// Scoring runs last, on the final amounts; a scorer that fails leaves the
+	// transaction unscored rather than blocking sales
+	var (
+		fraudScore   *float64
+		fraudReasons = []string{}
+		fraudScorer  *string
+	)
+	if s.fraud != nil {
+		input := FraudInput{
+			TransactionID: transactionID.String(),
+			CustomerID:    req.CustomerID,
+			Currency:      currency,
+			Total:         toReporting(total, exchangeRate),
+			Items:         req.Items,
+			Region:        region,
+		}
+		if customerUUID.Valid {
+			input.RecentTransactions, err = countRecentTransactions(ctx, tx, customerUUID.Bytes, now.Add(-s.config.Fraud.VelocityWindow))
+			if err != nil {
+				return TransactionResponse{}, serverError("Failed to score transaction", err)
+			}
+		}
+		score, err := s.fraud.Score(ctx, input)
+		if err != nil {
+			slog.WarnContext(ctx, "fraud scoring failed, continuing unscored", "transaction_id", transactionID, "error", err)
+		} else {
+			if s.config.Fraud.BlockScore > 0 && score.Score >= s.config.Fraud.BlockScore {
+				return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, "Transaction declined by fraud screening")
+			}
+			name := s.fraud.Name()
+			fraudScore, fraudReasons, fraudScorer = &score.Score, score.Reasons, &name
+		}
+	}
+
+	spanEvent(ctx, "screening done")
+
+	// Invoice numbers are only spent on completed sales. A transaction that
+	// rolls back after this leaves a gap, as sequences never reuse values.
+	var invoiceNumber int64
+	if status == StatusCompleted {
+		if err := tx.QueryRow(ctx, `SELECT nextval('invoice_number_seq')`).Scan(&invoiceNumber); err != nil {
+			return TransactionResponse{}, serverError("Failed to assign invoice number", err)
+		}
+	}
+
+	response := TransactionResponse{
+		TransactionID:  transactionID.String(),
+		CustomerID:     req.CustomerID,
+		Status:         string(status),
+		Currency:       currency,
+		ExchangeRate:   exchangeRate,
+		Items:          req.Items,
+		Lines:          lines,
+		Subtotal:       subtotal,
+		Tax:            tax,
+		Discount:       discount,
+		Promotions:     promotions.Applied,
+		DiscountCodes:  codeResults,
+		PointsEarned:   pointsEarned,
+		PointsRedeemed: pointsRedeemed,
+		Tip:            tip,
+		Shipping:       shipping,
+		Total:          total,
+		TaxRate:        taxed.EffectiveRate,
+		TaxLines:       taxed.Lines,
+		TaxInclusive:   taxed.Inclusive,
+		Region:         region,
+		Rounding:       rules.Rounding.String(),
+		TaxExemption:   taxExemption,
+		InvoiceNumber:  invoiceNumber,
+		Metadata:       req.Metadata,
+		Notes:          strings.TrimSpace(req.Notes),
+		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if duplicateOf.Valid {
+		response.DuplicateOf = uuid.UUID(duplicateOf.Bytes).String()
+	}
+
+	rawPayload, _ := json.Marshal(response)
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadataJSON, _ := json.Marshal(metadata)
+
+	transactionArgs := []any{
+		transactionID, customerUUID, subtotal, tax, discount, tip, shipping, total, rawPayload, status, appliedCode,
+		taxed.EffectiveRate, region, taxed.Inclusive, currency, exchangeRate,
+		rules.Rounding.String(), appliedCodes, pointsEarned, pointsRedeemed, fingerprint, duplicateOf,
+		fraudScore, fraudReasons, fraudScorer, taxExemption, invoiceNumber,
+		metadataJSON, response.Notes,
+	}
+
+	itemRows := make([][]any, len(req.Items))
+	for i, item := range req.Items {
+		lineMetadata := map[string]any{
+			"source":   "go-service",
+			"category": item.Category,
+		}
+		if tier := promotions.LineTiers[i]; tier != nil {
+			lineMetadata["volume_tier"] = tier
+		}
+		if id := requestIDFromContext(ctx); id != "" {
+			lineMetadata["request_id"] = id
+		}
+		metadata, _ := json.Marshal(lineMetadata)
+
+		itemRows[i] = []any{
+			pgtype.UUID{Bytes: uuid.New(), Valid: true}, pgtype.UUID{Bytes: transactionID, Valid: true},
+			item.ID, item.Name, item.Category, item.Price, item.Quantity, metadata, i + 1,
+			lineTaxes[i].Discount, lineTaxes[i].Tax,
+		}
+	}
+	if err := s.insertTransactionRows(ctx, tx, transactionArgs, itemRows); err != nil {
+		return TransactionResponse{}, serverError("Failed to persist transaction", err)
+	}
+	spanEvent(ctx, "transaction rows inserted", attribute.Int("transaction.rows", 1+len(itemRows)))
+
+	if customerUUID.Valid {
+		if err := recordLoyalty(ctx, tx, customerUUID.Bytes, transactionID, pointsEarned, pointsRedeemed); err != nil {
+			return TransactionResponse{}, serverError("Failed to update loyalty points", err)
+		}
+		spanEvent(ctx, "loyalty recorded")
+	}
+
+	// Pending transactions only reserve their stock until they are captured
+	err = holdStock(ctx, tx, transactionID, req.Items, status == StatusPending)
+	var outOfStock *OutOfStockError
+	if errors.As(err, &outOfStock) {
+		return TransactionResponse{}, &processError{
+			Status:     http.StatusConflict,
+			Message:    outOfStock.Error(),
+			Violations: outOfStock.violations(),
+		}
+	}
+	if err != nil {
+		return TransactionResponse{}, serverError("Failed to update inventory", err)
+	}
+	spanEvent(ctx, "stock held")
+
+	if err := notifyTransaction(ctx, tx, transactionCreatedEvent(response)); err != nil {
+		return TransactionResponse{}, serverError("Failed to publish transaction event", err)
+	}
+	if err := s.enqueueOutbox(ctx, tx, transactionCreatedEvent(response)); err != nil {
+		return TransactionResponse{}, serverError("Failed to write outbox event", err)
+	}
+	spanEvent(ctx, "events queued")
+
+	return response, nil
+}
+
+const insertTransactionSQL = `
+	INSERT INTO transactions (
+		id, customer_id, subtotal, tax, discount, tip, shipping, total, raw_payload, status, processed_at,
+		discount_code, tax_rate, region, tax_inclusive, currency, exchange_rate,
+		rounding, discount_codes, points_earned, points_redeemed, fingerprint, duplicate_of,
+		fraud_score, fraud_reasons, fraud_scorer, tax_exemption, invoice_number,
+		metadata, notes
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CASE WHEN $10 = 'completed' THEN NOW() END,
+		$11, $12, NULLIF($13, ''), $14, $15, $16,
+		$17, $18, $19, $20, $21, $22,
+		$23, $24, $25, NULLIF($26, ''), NULLIF($27, 0),
+		$28, NULLIF($29, '')
+	)
+`
+
+const insertTransactionItemSQL = `
+	INSERT INTO transaction_items (
+		id, transaction_id, product_id, name, category, unit_price, quantity, metadata, line_number, discount, tax
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+`
+
+// transactionItemColumns are the columns of each item row, in order
+var transactionItemColumns = []string{
+	"id", "transaction_id", "product_id", "name", "category", "unit_price", "quantity", "metadata", "line_number", "discount", "tax",
+}
+
+// insertTransactionRows writes the transaction row and its lines. They are
+// normally queued as one pgx.Batch, so the whole write is a single round
+// trip. Orders with at least ItemCopyThreshold lines send the transaction row
+// and then stream the lines with COPY, which is cheaper for many rows.
+func (s *Server) insertTransactionRows(ctx context.Context, tx pgx.Tx, transaction []any, items [][]any) error {
+	if threshold := s.config.ItemCopyThreshold; threshold > 0 && len(items) >= threshold {
+		if _, err := tx.Exec(ctx, insertTransactionSQL, transaction...); err != nil {
+			return fmt.Errorf("insert transaction: %w", err)
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"transaction_items"}, transactionItemColumns, pgx.CopyFromRows(items)); err != nil {
+			return fmt.Errorf("copy transaction items: %w", err)
+		}
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(insertTransactionSQL, transaction...)
+	for _, row := range items {
+		batch.Queue(insertTransactionItemSQL, row...)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			_ = results.Close()
+			if i == 0 {
+				return fmt.Errorf("insert transaction: %w", err)
+			}
+			return fmt.Errorf("insert transaction item %d: %w", i, err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return fmt.Errorf("send transaction batch: %w", err)
+	}
+	s.persistBatchSizes.Observe(float64(batch.Len()))
+	return nil
+}
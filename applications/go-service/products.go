@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Product struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Category  string `json:"category,omitempty"`
+	Price     Money  `json:"price"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type ProductListResponse struct {
+	Products []Product `json:"products"`
+}
+
+type CreateProductRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Price    Money  `json:"price"`
+	Active   *bool  `json:"active,omitempty"`
+}
+
+// UpdateProductRequest only touches fields that are present in the body
+type UpdateProductRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Category *string `json:"category,omitempty"`
+	Price    *Money  `json:"price,omitempty"`
+	Active   *bool   `json:"active,omitempty"`
+}
+
+// UnknownProductsError lists item IDs that could not be priced from the catalog
+type UnknownProductsError struct {
+	ProductIDs []string
+}
+
+func (e *UnknownProductsError) Error() string {
+	return "unknown or inactive products: " + strings.Join(e.ProductIDs, ", ")
+}
+
+const productColumns = `id, name, COALESCE(category, ''), price, active, created_at, updated_at`
+
+func scanProduct(row pgx.Row) (Product, error) {
+	var (
+		product              Product
+		createdAt, updatedAt time.Time
+	)
+	if err := row.Scan(&product.ID, &product.Name, &product.Category, &product.Price, &product.Active, &createdAt, &updatedAt); err != nil {
+		return Product{}, err
+	}
+	product.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	product.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return product, nil
+}
+
+// priceItemsFromCatalog replaces client-supplied name, category, and price on
+// each item with the catalog values so clients can't tamper with pricing.
+func priceItemsFromCatalog(ctx context.Context, q querier, items []Item) ([]Item, error) {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	rows, err := q.Query(ctx, `SELECT `+productColumns+` FROM products WHERE id = ANY($1) AND active`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("query products: %w", err)
+	}
+	defer rows.Close()
+
+	catalog := make(map[string]Product, len(ids))
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		catalog[product.ID] = product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read products: %w", err)
+	}
+
+	priced := make([]Item, len(items))
+	unknown := map[string]struct{}{}
+	for i, item := range items {
+		product, ok := catalog[item.ID]
+		if !ok {
+			unknown[item.ID] = struct{}{}
+			continue
+		}
+		item.Name = product.Name
+		item.Category = product.Category
+		item.Price = product.Price
+		priced[i] = item
+	}
+
+	if len(unknown) > 0 {
+		missing := make([]string, 0, len(unknown))
+		for id := range unknown {
+			missing = append(missing, id)
+		}
+		sort.Strings(missing)
+		return nil, &UnknownProductsError{ProductIDs: missing}
+	}
+
+	return priced, nil
+}
+
+func (s *Server) createProductHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.ID = strings.TrimSpace(req.ID)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.ID == "" || req.Name == "" {
+		http.Error(w, "id and name are required", http.StatusBadRequest)
+		return
+	}
+	if req.Price < 0 {
+		http.Error(w, "price must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	product, err := scanProduct(s.db.QueryRow(ctx, `
+		INSERT INTO products (id, name, category, price, active)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		RETURNING `+productColumns,
+		req.ID, req.Name, req.Category, req.Price, active,
+	))
+	if isUniqueViolation(err) {
+		http.Error(w, "Product already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create product", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(product)
+}
+
+func (s *Server) listProductsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	category := r.URL.Query().Get("category")
+	rows, err := s.db.Query(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		WHERE $1 = '' OR category = $1
+		ORDER BY id
+	`, category)
+	if err != nil {
+		http.Error(w, "Failed to list products", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			http.Error(w, "Failed to list products", http.StatusInternalServerError)
+			return
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to list products", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ProductListResponse{Products: products})
+}
+
+func (s *Server) getProductHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	product, err := scanProduct(s.db.QueryRow(ctx, `SELECT `+productColumns+` FROM products WHERE id = $1`, r.PathValue("id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(product)
+}
+
+func (s *Server) updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	var req UpdateProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "name must not be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Price != nil && *req.Price < 0 {
+		http.Error(w, "price must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	product, err := scanProduct(s.db.QueryRow(ctx, `
+		UPDATE products
+		SET name = COALESCE($2, name),
+			category = CASE WHEN $3::text IS NULL THEN category ELSE NULLIF($3, '') END,
+			price = COALESCE($4, price),
+			active = COALESCE($5, active),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+productColumns,
+		r.PathValue("id"), req.Name, req.Category, req.Price, req.Active,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(product)
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	PromotionPercentOff = "percent_off"
+	PromotionFixedOff   = "fixed_off"
+	PromotionVolume     = "volume_tier"
+	PromotionBOGO       = "bogo"
+)
+
+// PromotionRuleset is the ordered list of promotions evaluated against every
+// transaction. It is read from the promotion_ruleset table, falling back to
+// PROMOTIONS_FILE, and reloaded while the service runs.
+type PromotionRuleset struct {
+	Rules     []PromotionRule `json:"rules"`
+	Source    string          `json:"source,omitempty"`
+	UpdatedAt string          `json:"updated_at,omitempty"`
+}
+
+// PromotionRule applies its action when every condition holds. A rule with a
+// code only applies when that discount_code is submitted.
+type PromotionRule struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Code        string              `json:"code,omitempty"`
+	Conditions  PromotionConditions `json:"conditions"`
+	Action      PromotionAction     `json:"action"`
+}
+
+// PromotionConditions are ANDed; empty fields always match. With categories
+// or product_ids set the action only applies to the lines they cover, and
+// the discount is granted to those lines rather than the whole order.
+type PromotionConditions struct {
+	MinSubtotal   Money    `json:"min_subtotal,omitempty"`
+	Categories    []string `json:"categories,omitempty"`
+	ProductIDs    []string `json:"product_ids,omitempty"`
+	CustomerTiers []string `json:"customer_tiers,omitempty"`
+}
+
+// PromotionAction is what a matching rule grants. volume_tier actions are
+// evaluated per line: each line gets the highest tier its quantity reaches.
+// bogo actions grant GetQuantity units of GetProductID (BuyProductID when
+// empty) at PercentOff (free when zero) for every BuyQuantity units bought.
+type PromotionAction struct {
+	Type         string       `json:"type"`
+	PercentOff   float64      `json:"percent_off,omitempty"`
+	AmountOff    Money        `json:"amount_off,omitempty"`
+	Tiers        []VolumeTier `json:"tiers,omitempty"`
+	BuyProductID string       `json:"buy_product_id,omitempty"`
+	BuyQuantity  int          `json:"buy_quantity,omitempty"`
+	GetProductID string       `json:"get_product_id,omitempty"`
+	GetQuantity  int          `json:"get_quantity,omitempty"`
+}
+
+// VolumeTier takes PercentOff off a line of at least MinQuantity units
+type VolumeTier struct {
+	MinQuantity int     `json:"min_quantity"`
+	PercentOff  float64 `json:"percent_off"`
+}
+
+// AppliedVolumeTier records which tier a line was priced at
+type AppliedVolumeTier struct {
+	Rule        string  `json:"rule"`
+	MinQuantity int     `json:"min_quantity"`
+	PercentOff  float64 `json:"percent_off"`
+}
+
+// AppliedPromotion is one discount that contributed to a transaction. For
+// bogo promotions it names the product and how many units were discounted.
+type AppliedPromotion struct {
+	Name      string `json:"name"`
+	Amount    Money  `json:"amount"`
+	ProductID string `json:"product_id,omitempty"`
+	Quantity  int    `json:"quantity,omitempty"`
+}
+
+// PromotionResult is the outcome of evaluating a ruleset. LineDiscounts and
+// LineTiers are parallel to the evaluated items and cover only discounts
+// granted to specific lines; the rest of Discount applies to the order.
+type PromotionResult struct {
+	Discount      Money
+	Applied       []AppliedPromotion
+	LineDiscounts []Money
+	LineTiers     []*AppliedVolumeTier
+}
+
+// promotionInput is what rules are evaluated against
+type promotionInput struct {
+	Items        []Item
+	Subtotal     Money
+	Codes        []string
+	CustomerTier string
+}
+
+func (r PromotionRule) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.Conditions.MinSubtotal < 0 {
+		return errors.New("min_subtotal cannot be negative")
+	}
+	switch r.Action.Type {
+	case PromotionPercentOff:
+		if !validPercentOff(r.Action.PercentOff) {
+			return errors.New("percent_off must be greater than 0 and at most 100")
+		}
+	case PromotionFixedOff:
+		if r.Action.AmountOff <= 0 {
+			return errors.New("amount_off must be positive")
+		}
+	case PromotionVolume:
+		if len(r.Action.Tiers) == 0 {
+			return errors.New("tiers are required")
+		}
+		for _, tier := range r.Action.Tiers {
+			if tier.MinQuantity <= 0 {
+				return errors.New("min_quantity must be positive")
+			}
+			if !validPercentOff(tier.PercentOff) {
+				return errors.New("percent_off must be greater than 0 and at most 100")
+			}
+		}
+	case PromotionBOGO:
+		if strings.TrimSpace(r.Action.BuyProductID) == "" {
+			return errors.New("buy_product_id is required")
+		}
+		if r.Action.BuyQuantity <= 0 || r.Action.GetQuantity <= 0 {
+			return errors.New("buy_quantity and get_quantity must be positive")
+		}
+		if r.Action.PercentOff != 0 && !validPercentOff(r.Action.PercentOff) {
+			return errors.New("percent_off must be greater than 0 and at most 100")
+		}
+	default:
+		return fmt.Errorf("unknown action type %q", r.Action.Type)
+	}
+	return nil
+}
+
+// parsePromotionRuleset decodes and validates a ruleset document
+func parsePromotionRuleset(data []byte) (PromotionRuleset, error) {
+	var ruleset PromotionRuleset
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ruleset); err != nil {
+		return PromotionRuleset{}, fmt.Errorf("invalid ruleset: %w", err)
+	}
+	if ruleset.Rules == nil {
+		ruleset.Rules = []PromotionRule{}
+	}
+
+	seen := map[string]bool{}
+	for i, rule := range ruleset.Rules {
+		if err := rule.validate(); err != nil {
+			return PromotionRuleset{}, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if seen[rule.Name] {
+			return PromotionRuleset{}, fmt.Errorf("rule %d: duplicate name %q", i, rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return ruleset, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies reports whether the order-level conditions hold
+func (r PromotionRule) applies(in promotionInput) bool {
+	if r.Code != "" && !containsFold(in.Codes, normalizeDiscountCode(r.Code)) {
+		return false
+	}
+	if in.Subtotal < r.Conditions.MinSubtotal {
+		return false
+	}
+	if len(r.Conditions.CustomerTiers) > 0 && !containsFold(r.Conditions.CustomerTiers, in.CustomerTier) {
+		return false
+	}
+	return true
+}
+
+// coversLine reports whether a valid line falls under the category and
+// product filters
+func (c PromotionConditions) coversLine(item Item) bool {
+	if item.Quantity <= 0 || item.Price < 0 {
+		return false
+	}
+	if len(c.Categories) > 0 && !containsFold(c.Categories, normalizeCategory(item.Category)) {
+		return false
+	}
+	return len(c.ProductIDs) == 0 || containsFold(c.ProductIDs, strings.TrimSpace(item.ID))
+}
+
+// targetsLines reports whether the conditions pick out specific lines
+func (c PromotionConditions) targetsLines() bool {
+	return len(c.Categories) > 0 || len(c.ProductIDs) > 0
+}
+
+// lineDiscount grants a percent_off or fixed_off action to the covered lines,
+// never more than limit in total. percent_off is charged on each line's
+// remaining amount; fixed_off is shared by those amounts with any rounding
+// remainder on the last covered line.
+func (r PromotionRule) lineDiscount(in promotionInput, result *PromotionResult, limit Money, rounding Rounding) Money {
+	var (
+		covered  []int
+		eligible Money
+	)
+	for i, item := range in.Items {
+		if r.Conditions.coversLine(item) {
+			covered = append(covered, i)
+			eligible += item.Price.Mul(item.Quantity) - result.LineDiscounts[i]
+		}
+	}
+
+	fixed := min(r.Action.AmountOff, eligible)
+	var total Money
+	for n, i := range covered {
+		net := in.Items[i].Price.Mul(in.Items[i].Quantity) - result.LineDiscounts[i]
+		var discount Money
+		switch r.Action.Type {
+		case PromotionPercentOff:
+			discount = rounding.applyRate(net, r.Action.PercentOff/100)
+		case PromotionFixedOff:
+			discount = fixed.MulFrac(net.Cents(), eligible.Cents())
+			if n == len(covered)-1 {
+				discount = fixed - total
+			}
+		}
+		discount = min(discount, net, limit-total)
+		if discount <= 0 {
+			continue
+		}
+		total += discount
+		result.LineDiscounts[i] += discount
+	}
+	return total
+}
+
+// tierFor returns the highest tier quantity reaches, if any
+func (a PromotionAction) tierFor(quantity int) *VolumeTier {
+	var best *VolumeTier
+	for i, tier := range a.Tiers {
+		if quantity >= tier.MinQuantity && (best == nil || tier.MinQuantity > best.MinQuantity) {
+			best = &a.Tiers[i]
+		}
+	}
+	return best
+}
+
+// volumeDiscount prices each covered line at its tier, never granting more
+// than limit in total, and records the line discounts and tiers on result
+func (r PromotionRule) volumeDiscount(in promotionInput, result *PromotionResult, limit Money, rounding Rounding) Money {
+	var total Money
+	for i, item := range in.Items {
+		if !r.Conditions.coversLine(item) {
+			continue
+		}
+		tier := r.Action.tierFor(item.Quantity)
+		if tier == nil {
+			continue
+		}
+		net := item.Price.Mul(item.Quantity) - result.LineDiscounts[i]
+		discount := min(rounding.applyRate(net, tier.PercentOff/100), limit-total)
+		if discount <= 0 {
+			continue
+		}
+		total += discount
+		result.LineDiscounts[i] += discount
+		result.LineTiers[i] = &AppliedVolumeTier{Rule: r.Name, MinQuantity: tier.MinQuantity, PercentOff: tier.PercentOff}
+	}
+	return total
+}
+
+func (a PromotionAction) discount(amount Money, rounding Rounding) Money {
+	switch a.Type {
+	case PromotionPercentOff:
+		return rounding.applyRate(amount, a.PercentOff/100)
+	case PromotionFixedOff:
+		return min(a.AmountOff, amount)
+	}
+	return 0
+}
+
+// bogoDiscount counts how many reward units the bought units earn and
+// discounts them on the reward product's lines in order. When the reward is
+// the bought product, each set is BuyQuantity+GetQuantity units.
+func (r PromotionRule) bogoDiscount(in promotionInput, result *PromotionResult, limit Money, rounding Rounding) (Money, int) {
+	a := r.Action
+	getProduct := a.GetProductID
+	if getProduct == "" {
+		getProduct = a.BuyProductID
+	}
+	percent := a.PercentOff
+	if percent == 0 {
+		percent = 100
+	}
+
+	var bought, available int
+	for _, item := range in.Items {
+		if !r.Conditions.coversLine(item) {
+			continue
+		}
+		if item.ID == a.BuyProductID {
+			bought += item.Quantity
+		}
+		if item.ID == getProduct {
+			available += item.Quantity
+		}
+	}
+
+	var rewarded int
+	if getProduct == a.BuyProductID {
+		rewarded = bought / (a.BuyQuantity + a.GetQuantity) * a.GetQuantity
+	} else {
+		rewarded = min(bought/a.BuyQuantity*a.GetQuantity, available)
+	}
+
+	var total Money
+	units := 0
+	for i, item := range in.Items {
+		if units == rewarded {
+			break
+		}
+		if item.ID != getProduct || !r.Conditions.coversLine(item) {
+			continue
+		}
+		lineUnits := min(item.Quantity, rewarded-units)
+		net := item.Price.Mul(item.Quantity) - result.LineDiscounts[i]
+		discount := min(rounding.applyRate(item.Price.Mul(lineUnits), percent/100), net, limit-total)
+		if discount <= 0 {
+			continue
+		}
+		units += lineUnits
+		total += discount
+		result.LineDiscounts[i] += discount
+	}
+	return total, units
+}
+
+// evaluate applies each matching rule in order. Discounts never take the
+// order below zero: once the subtotal is used up later rules are skipped.
+func (rs PromotionRuleset) evaluate(in promotionInput, rounding Rounding) PromotionResult {
+	result := PromotionResult{
+		Applied:       []AppliedPromotion{},
+		LineDiscounts: make([]Money, len(in.Items)),
+		LineTiers:     make([]*AppliedVolumeTier, len(in.Items)),
+	}
+	for _, rule := range rs.Rules {
+		if !rule.applies(in) {
+			continue
+		}
+		remaining := in.Subtotal - result.Discount
+
+		applied := AppliedPromotion{Name: rule.Name}
+		switch rule.Action.Type {
+		case PromotionVolume:
+			applied.Amount = rule.volumeDiscount(in, &result, remaining, rounding)
+		case PromotionBOGO:
+			applied.Amount, applied.Quantity = rule.bogoDiscount(in, &result, remaining, rounding)
+			applied.ProductID = rule.Action.GetProductID
+			if applied.ProductID == "" {
+				applied.ProductID = rule.Action.BuyProductID
+			}
+		default:
+			if rule.Conditions.targetsLines() {
+				applied.Amount = rule.lineDiscount(in, &result, remaining, rounding)
+			} else {
+				applied.Amount = min(rule.Action.discount(in.Subtotal, rounding), remaining)
+			}
+		}
+		if applied.Amount <= 0 {
+			continue
+		}
+		result.Discount += applied.Amount
+		result.Applied = append(result.Applied, applied)
+	}
+	return result
+}
+
+// codeRule expresses a redeemed discount code as a promotion so codes and
+// automatic promotions go through the same engine
+func codeRule(code DiscountCode) PromotionRule {
+	return PromotionRule{
+		Name:       code.Code,
+		Conditions: PromotionConditions{Categories: code.Categories, ProductIDs: code.ProductIDs},
+		Action:     PromotionAction{Type: PromotionPercentOff, PercentOff: code.PercentOff},
+	}
+}
+
+// applyPromotions evaluates the redeemed codes followed by the ruleset
+func applyPromotions(ruleset PromotionRuleset, codes []DiscountCode, in promotionInput, rounding Rounding) PromotionResult {
+	var rules []PromotionRule
+	for _, code := range codes {
+		if code.Active {
+			rules = append(rules, codeRule(code))
+		}
+	}
+	ruleset.Rules = append(rules, ruleset.Rules...)
+	return ruleset.evaluate(in, rounding)
+}
+
+// promotionRuleset returns the ruleset currently in effect
+func (s *Server) promotionRuleset() PromotionRuleset {
+	if ruleset := s.promotions.Load(); ruleset != nil {
+		return *ruleset
+	}
+	return PromotionRuleset{Rules: []PromotionRule{}}
+}
+
+// loadPromotionRuleset reads the stored ruleset, or PROMOTIONS_FILE when
+// none has been stored, or an empty ruleset when neither is set.
+func (s *Server) loadPromotionRuleset(ctx context.Context) (PromotionRuleset, error) {
+	var (
+		data      []byte
+		updatedAt time.Time
+	)
+	if s.db != nil {
+		err := s.db.QueryRow(ctx, `SELECT ruleset, updated_at FROM promotion_ruleset WHERE id = 1`).Scan(&data, &updatedAt)
+		if err == nil {
+			ruleset, err := parsePromotionRuleset(data)
+			if err != nil {
+				return PromotionRuleset{}, err
+			}
+			ruleset.Source = "database"
+			ruleset.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+			return ruleset, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return PromotionRuleset{}, fmt.Errorf("query promotion ruleset: %w", err)
+		}
+	}
+
+	if s.config.PromotionsFile == "" {
+		return PromotionRuleset{Rules: []PromotionRule{}}, nil
+	}
+	data, err := os.ReadFile(s.config.PromotionsFile)
+	if err != nil {
+		return PromotionRuleset{}, fmt.Errorf("read promotions file: %w", err)
+	}
+	ruleset, err := parsePromotionRuleset(data)
+	if err != nil {
+		return PromotionRuleset{}, err
+	}
+	ruleset.Source = s.config.PromotionsFile
+	return ruleset, nil
+}
+
+// reloadPromotions swaps in the latest ruleset. On error the previous one
+// stays in effect.
+func (s *Server) reloadPromotions(ctx context.Context) (PromotionRuleset, error) {
+	ruleset, err := s.loadPromotionRuleset(ctx)
+	if err != nil {
+		return PromotionRuleset{}, err
+	}
+	s.promotions.Store(&ruleset)
+	return ruleset, nil
+}
+
+// runPromotionReloader picks up ruleset changes made on other replicas or
+// in PROMOTIONS_FILE
+func (s *Server) runPromotionReloader(ctx context.Context) {
+	runEvery(ctx, s.config.PromotionsReloadInterval, func(ctx context.Context) {
+		if _, err := s.reloadPromotions(ctx); err != nil {
+			slog.ErrorContext(ctx, "promotion reloader failed", "error", err)
+		}
+	})
+}
+
+func (s *Server) getPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(s.promotionRuleset())
+}
+
+// putPromotionsHandler replaces the stored ruleset; it takes effect on this
+// replica immediately and on others at their next reload
+func (s *Server) putPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ruleset, err := parsePromotionRuleset(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stored, _ := json.Marshal(PromotionRuleset{Rules: ruleset.Rules})
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO promotion_ruleset (id, ruleset) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET ruleset = EXCLUDED.ruleset, updated_at = NOW()
+	`, stored)
+	if err != nil {
+		http.Error(w, "Failed to save promotions", http.StatusInternalServerError)
+		return
+	}
+
+	ruleset, err = s.reloadPromotions(ctx)
+	if err != nil {
+		http.Error(w, "Failed to reload promotions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ruleset)
+}
+
+// reloadPromotionsHandler re-reads the ruleset without waiting for the
+// reload interval, e.g. after editing PROMOTIONS_FILE
+func (s *Server) reloadPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	ruleset, err := s.reloadPromotions(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ruleset)
+}
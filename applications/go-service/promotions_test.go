@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePromotionRuleset(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"empty", `{"rules": []}`, ""},
+		{"percent", `{"rules": [{"name": "a", "action": {"type": "percent_off", "percent_off": 10}}]}`, ""},
+		{"fixed", `{"rules": [{"name": "a", "action": {"type": "fixed_off", "amount_off": 5.00}}]}`, ""},
+		{"missing name", `{"rules": [{"action": {"type": "percent_off", "percent_off": 10}}]}`, "name is required"},
+		{"bad percent", `{"rules": [{"name": "a", "action": {"type": "percent_off", "percent_off": 120}}]}`, "percent_off"},
+		{"unknown action", `{"rules": [{"name": "a", "action": {"type": "free_shipping"}}]}`, "unknown action"},
+		{"unknown field", `{"rules": [{"name": "a", "when": {}}]}`, "invalid ruleset"},
+		{"duplicate", `{"rules": [
+			{"name": "a", "action": {"type": "fixed_off", "amount_off": 1}},
+			{"name": "a", "action": {"type": "fixed_off", "amount_off": 2}}]}`, "duplicate"},
+	}
+
+	for _, tt := range tests {
+		_, err := parsePromotionRuleset([]byte(tt.body))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEvaluatePromotions(t *testing.T) {
+	items := []Item{
+		{Price: 2000, Quantity: 2, Category: "books"},
+		{Price: 6000, Quantity: 1, Category: "electronics"},
+	}
+	percent := func(p float64) PromotionAction { return PromotionAction{Type: PromotionPercentOff, PercentOff: p} }
+	fixed := func(m Money) PromotionAction { return PromotionAction{Type: PromotionFixedOff, AmountOff: m} }
+
+	tests := []struct {
+		name  string
+		rules []PromotionRule
+		in    promotionInput
+		want  Money
+	}{
+		{"no rules", nil, promotionInput{}, 0},
+		{"whole order", []PromotionRule{{Name: "a", Action: percent(10)}}, promotionInput{}, 1000},
+		{"category only", []PromotionRule{{Name: "a", Conditions: PromotionConditions{Categories: []string{"Books"}}, Action: percent(50)}}, promotionInput{}, 2000},
+		{"category absent", []PromotionRule{{Name: "a", Conditions: PromotionConditions{Categories: []string{"toys"}}, Action: percent(50)}}, promotionInput{}, 0},
+		{"below minimum", []PromotionRule{{Name: "a", Conditions: PromotionConditions{MinSubtotal: 20000}, Action: fixed(500)}}, promotionInput{}, 0},
+		{"at minimum", []PromotionRule{{Name: "a", Conditions: PromotionConditions{MinSubtotal: 10000}, Action: fixed(500)}}, promotionInput{}, 500},
+		{"tier matches", []PromotionRule{{Name: "a", Conditions: PromotionConditions{CustomerTiers: []string{"vip"}}, Action: fixed(500)}}, promotionInput{CustomerTier: "VIP"}, 500},
+		{"tier missing", []PromotionRule{{Name: "a", Conditions: PromotionConditions{CustomerTiers: []string{"vip"}}, Action: fixed(500)}}, promotionInput{}, 0},
+		{"code required", []PromotionRule{{Name: "a", Code: "SPRING", Action: fixed(500)}}, promotionInput{}, 0},
+		{"code submitted", []PromotionRule{{Name: "a", Code: "spring", Action: fixed(500)}}, promotionInput{Codes: []string{"SPRING"}}, 500},
+		{"fixed capped at eligible", []PromotionRule{{Name: "a", Conditions: PromotionConditions{Categories: []string{"books"}}, Action: fixed(9000)}}, promotionInput{}, 4000},
+		{"stacked rules capped at subtotal", []PromotionRule{{Name: "a", Action: percent(80)}, {Name: "b", Action: fixed(5000)}}, promotionInput{}, 10000},
+	}
+
+	for _, tt := range tests {
+		tt.in.Items = items
+		tt.in.Subtotal = calculateSubtotal(items)
+		result := applyPromotions(PromotionRuleset{Rules: tt.rules}, nil, tt.in, Rounding{})
+		got := result.Discount
+		if got != tt.want {
+			t.Errorf("%s: discount = %v, want %v", tt.name, got, tt.want)
+		}
+		var sum Money
+		for _, promotion := range result.Applied {
+			sum += promotion.Amount
+		}
+		if sum != got {
+			t.Errorf("%s: applied promotions sum to %v, want %v", tt.name, sum, got)
+		}
+	}
+}
+
+func TestTargetedLineDiscounts(t *testing.T) {
+	items := []Item{
+		{ID: "novel", Price: 2000, Quantity: 2, Category: "books"},
+		{ID: "tv", Price: 6000, Quantity: 1, Category: "electronics"},
+		{ID: "atlas", Price: 1000, Quantity: 1, Category: "Books"},
+	}
+	in := promotionInput{Items: items, Subtotal: calculateSubtotal(items)}
+
+	tests := []struct {
+		name  string
+		rules []PromotionRule
+		codes []DiscountCode
+		want  []Money
+	}{
+		{"percent on category", []PromotionRule{{Name: "a", Conditions: PromotionConditions{Categories: []string{"books"}}, Action: PromotionAction{Type: PromotionPercentOff, PercentOff: 10}}}, nil,
+			[]Money{400, 0, 100}},
+		{"fixed shared by product", []PromotionRule{{Name: "a", Conditions: PromotionConditions{ProductIDs: []string{"novel", "atlas"}}, Action: PromotionAction{Type: PromotionFixedOff, AmountOff: 1000}}}, nil,
+			[]Money{800, 0, 200}},
+		{"fixed capped at covered lines", []PromotionRule{{Name: "a", Conditions: PromotionConditions{ProductIDs: []string{"atlas"}}, Action: PromotionAction{Type: PromotionFixedOff, AmountOff: 5000}}}, nil,
+			[]Money{0, 0, 1000}},
+		{"category and product both apply", []PromotionRule{{Name: "a", Conditions: PromotionConditions{Categories: []string{"books"}, ProductIDs: []string{"tv", "atlas"}}, Action: PromotionAction{Type: PromotionPercentOff, PercentOff: 50}}}, nil,
+			[]Money{0, 0, 500}},
+		{"targeted code", nil, []DiscountCode{{Code: "TV20", PercentOff: 20, Active: true, ProductIDs: []string{"tv"}}},
+			[]Money{0, 1200, 0}},
+		{"whole-order code stays off the lines", nil, []DiscountCode{{Code: "SAVE10", PercentOff: 10, Active: true}},
+			[]Money{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		result := applyPromotions(PromotionRuleset{Rules: tt.rules}, tt.codes, in, Rounding{})
+		var sum Money
+		for i, want := range tt.want {
+			if result.LineDiscounts[i] != want {
+				t.Errorf("%s: line %d discount = %v, want %v", tt.name, i, result.LineDiscounts[i], want)
+			}
+			sum += want
+		}
+		if sum > 0 && result.Discount != sum {
+			t.Errorf("%s: discount = %v, want the line total %v", tt.name, result.Discount, sum)
+		}
+	}
+}
+
+func TestDiscountCodeAppliesBeforeRules(t *testing.T) {
+	code := []DiscountCode{{Code: "SAVE20", PercentOff: 20, Active: true}}
+	rules := PromotionRuleset{Rules: []PromotionRule{{Name: "five-off", Action: PromotionAction{Type: PromotionFixedOff, AmountOff: 500}}}}
+
+	result := applyPromotions(rules, code, promotionInput{Subtotal: 10000}, Rounding{})
+	total, applied := result.Discount, result.Applied
+	if total != 2500 || len(applied) != 2 || applied[0].Name != "SAVE20" {
+		t.Errorf("applyPromotions = %v, %+v", total, applied)
+	}
+}
+
+func TestVolumeTiers(t *testing.T) {
+	rule := PromotionRule{
+		Name:       "bulk",
+		Conditions: PromotionConditions{Categories: []string{"office"}},
+		Action: PromotionAction{Type: PromotionVolume, Tiers: []VolumeTier{
+			{MinQuantity: 10, PercentOff: 15},
+			{MinQuantity: 5, PercentOff: 5},
+		}},
+	}
+	items := []Item{
+		{Price: 100, Quantity: 12, Category: "office"},
+		{Price: 100, Quantity: 6, Category: "office"},
+		{Price: 100, Quantity: 3, Category: "office"},
+		{Price: 100, Quantity: 20, Category: "books"},
+	}
+	in := promotionInput{Items: items, Subtotal: calculateSubtotal(items)}
+
+	result := applyPromotions(PromotionRuleset{Rules: []PromotionRule{rule}}, nil, in, Rounding{})
+	wantLines := []Money{180, 30, 0, 0}
+	for i, want := range wantLines {
+		if result.LineDiscounts[i] != want {
+			t.Errorf("line %d discount = %v, want %v", i, result.LineDiscounts[i], want)
+		}
+	}
+	if result.Discount != 210 || len(result.Applied) != 1 {
+		t.Errorf("discount = %v (%+v), want 2.10 from one rule", result.Discount, result.Applied)
+	}
+	if tier := result.LineTiers[0]; tier == nil || tier.MinQuantity != 10 || tier.Rule != "bulk" {
+		t.Errorf("line 0 tier = %+v", tier)
+	}
+	if result.LineTiers[2] != nil {
+		t.Errorf("line below every tier got %+v", result.LineTiers[2])
+	}
+}
+
+func TestBOGO(t *testing.T) {
+	items := []Item{
+		{ID: "SKU-TEE", Price: 1500, Quantity: 5},
+		{ID: "SKU-MUG", Price: 800, Quantity: 1},
+		{ID: "SKU-CAP", Price: 1000, Quantity: 3},
+	}
+	in := promotionInput{Items: items, Subtotal: calculateSubtotal(items)}
+	bogo := func(buy string, buyQty int, get string, getQty int, percent float64) PromotionRule {
+		return PromotionRule{Name: "bogo", Action: PromotionAction{
+			Type: PromotionBOGO, BuyProductID: buy, BuyQuantity: buyQty,
+			GetProductID: get, GetQuantity: getQty, PercentOff: percent,
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		rule      PromotionRule
+		wantUnits int
+		want      Money
+	}{
+		// 5 tees make two buy-one-get-one sets
+		{"same product free", bogo("SKU-TEE", 1, "", 1, 0), 2, 3000},
+		{"same product half off", bogo("SKU-TEE", 1, "", 1, 50), 2, 1500},
+		{"buy two get one", bogo("SKU-CAP", 2, "", 1, 0), 1, 1000},
+		// 5 tees would earn 5 mugs, but only one is in the cart
+		{"different product", bogo("SKU-TEE", 1, "SKU-MUG", 1, 0), 1, 800},
+		{"product not in cart", bogo("SKU-HAT", 1, "", 1, 0), 0, 0},
+	}
+
+	for _, tt := range tests {
+		result := applyPromotions(PromotionRuleset{Rules: []PromotionRule{tt.rule}}, nil, in, Rounding{})
+		if result.Discount != tt.want {
+			t.Errorf("%s: discount = %v, want %v", tt.name, result.Discount, tt.want)
+		}
+		if tt.want > 0 && (len(result.Applied) != 1 || result.Applied[0].Quantity != tt.wantUnits) {
+			t.Errorf("%s: applied = %+v, want %d units", tt.name, result.Applied, tt.wantUnits)
+		}
+	}
+}
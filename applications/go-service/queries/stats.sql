@@ -0,0 +1,13 @@
+-- name: RevenueTotalsByCurrency :many
+-- Sums the transactions_summary slots the migration 036 triggers maintain
+SELECT currency, SUM(transactions)::bigint AS transactions,
+       SUM(revenue)::numeric AS revenue,
+       SUM(refunded)::numeric AS refunded,
+       SUM(tips)::numeric AS tips,
+       SUM(reporting_revenue)::numeric AS reporting_revenue,
+       SUM(reporting_refunded)::numeric AS reporting_refunded,
+       SUM(reporting_tips)::numeric AS reporting_tips
+FROM transactions_summary
+GROUP BY currency
+HAVING SUM(transactions) > 0
+ORDER BY currency;
@@ -0,0 +1,14 @@
+-- name: GetTransaction :one
+SELECT customer_id, status, currency, exchange_rate::float8 AS exchange_rate, subtotal, tax, discount, tip, shipping, total,
+       COALESCE(tax_rate, 0)::float8 AS tax_rate, COALESCE(region, '')::text AS region, tax_inclusive,
+       COALESCE(rounding, '')::text AS rounding, duplicate_of, COALESCE(tax_exemption, '')::text AS tax_exemption,
+       COALESCE(invoice_number, 0)::bigint AS invoice_number, metadata, COALESCE(notes, '')::text AS notes, created_at
+FROM transactions
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: ListTransactionItems :many
+SELECT product_id, COALESCE(name, '')::text AS name, COALESCE(category, '')::text AS category, unit_price, quantity,
+       COALESCE(discount, 0)::numeric AS discount, COALESCE(tax, 0)::numeric AS tax
+FROM transaction_items
+WHERE transaction_id = $1
+ORDER BY line_number NULLS LAST, id;
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig caps each client of the API routes at Rate requests a
+// second, with bursts of up to Burst. A client is the API key or token
+// subject it authenticated as, or its IP address when authentication is
+// off. A Rate of 0, the default, turns limiting off.
+type RateLimitConfig struct {
+	Rate  float64
+	Burst int
+	// IPRate and IPBurst limit each IP address before authentication, so a
+	// flood is refused before its API key is looked up. They default to Rate
+	// and Burst.
+	IPRate  float64
+	IPBurst int
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, for
+	// running behind a proxy that sets it; otherwise every client behind the
+	// proxy would share its address
+	TrustForwardedFor bool
+}
+
+func loadRateLimitConfig() RateLimitConfig {
+	var cfg RateLimitConfig
+	if val := os.Getenv("RATE_LIMIT_RPS"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed > 0 {
+			cfg.Rate = parsed
+		}
+	}
+	// A second's worth of requests by default
+	cfg.Burst = max(1, int(math.Ceil(cfg.Rate)))
+	if val := os.Getenv("RATE_LIMIT_BURST"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			cfg.Burst = parsed
+		}
+	}
+	cfg.IPRate, cfg.IPBurst = cfg.Rate, cfg.Burst
+	if val := os.Getenv("RATE_LIMIT_IP_RPS"); val != "" {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed > 0 {
+			cfg.IPRate = parsed
+			cfg.IPBurst = max(1, int(math.Ceil(parsed)))
+		}
+	}
+	if val := os.Getenv("RATE_LIMIT_IP_BURST"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			cfg.IPBurst = parsed
+		}
+	}
+	if val := os.Getenv("RATE_LIMIT_TRUST_FORWARDED_FOR"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			cfg.TrustForwardedFor = parsed
+		}
+	}
+	return cfg
+}
+
+// tokenBucket holds tokens as of last; it refills at the limiter's rate
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client. Each request takes a token,
+// and a client whose bucket is empty is refused until it refills.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+// allow takes a token from key's bucket at now. When there is none it says
+// how long until there will be.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refilled(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) refilled(b *tokenBucket, now time.Time) float64 {
+	return min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// sweep forgets the buckets that have refilled, which a new request would
+// recreate as they are, so clients that went away don't pile up
+func (l *rateLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if l.refilled(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// runRateLimitSweep sweeps the limiters' buckets every minute
+func (s *Server) runRateLimitSweep(ctx context.Context) {
+	runEvery(ctx, time.Minute, func(context.Context) {
+		for _, l := range []*rateLimiter{s.limiter, s.ipLimiter} {
+			if l != nil {
+				l.sweep(time.Now())
+			}
+		}
+	})
+}
+
+// rateLimit answers 429 with Retry-After to a client over its limit in l,
+// counting each request against the client key names.
+func (s *Server) rateLimit(l *rateLimiter, key func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(key(r), time.Now()); !ok {
+			s.rateLimited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitRoutes puts every route behind rateLimit
+func (s *Server) rateLimitRoutes(routes []apiRoute, l *rateLimiter, key func(*http.Request) string) {
+	for i := range routes {
+		routes[i].Handler = s.rateLimit(l, key, routes[i].Handler)
+	}
+}
+
+// rateLimitKey is the client an authenticated request counts against
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if claims := claimsFromContext(r.Context()); claims != nil && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+	return s.ipRateLimitKey(r)
+}
+
+// ipRateLimitKey is the address a request counts against before it has
+// authenticated
+func (s *Server) ipRateLimitKey(r *http.Request) string {
+	return "ip:" + clientIP(r, s.config.RateLimit.TrustForwardedFor)
+}
+
+// clientIP is the address r came from: the first in X-Forwarded-For when
+// trustForwardedFor is set and it has one, the peer's otherwise
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		first, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	start := time.Now()
+
+	tests := []struct {
+		key   string
+		after time.Duration
+		ok    bool
+		wait  time.Duration
+	}{
+		// The burst, then nothing until a token refills every 500ms
+		{"a", 0, true, 0},
+		{"a", 0, true, 0},
+		{"a", 0, true, 0},
+		{"a", 0, false, 500 * time.Millisecond},
+		{"a", 250 * time.Millisecond, false, 250 * time.Millisecond},
+		// Other clients have their own bucket
+		{"b", 250 * time.Millisecond, true, 0},
+		{"a", 500 * time.Millisecond, true, 0},
+		{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		// Refills stop at the burst
+		{"a", time.Hour, true, 0},
+		{"a", time.Hour, true, 0},
+		{"a", time.Hour, true, 0},
+		{"a", time.Hour, false, 500 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		ok, wait := limiter.allow(tt.key, start.Add(tt.after))
+		if ok != tt.ok || wait.Round(time.Millisecond) != tt.wait {
+			t.Errorf("%d: allow(%s, +%v) = %v, %v, want %v, %v", i, tt.key, tt.after, ok, wait, tt.ok, tt.wait)
+		}
+	}
+
+	limiter.sweep(start.Add(time.Hour))
+	if len(limiter.buckets) != 1 {
+		t.Errorf("sweep kept %d buckets, want only the one still refilling", len(limiter.buckets))
+	}
+	limiter.sweep(start.Add(2 * time.Hour))
+	if len(limiter.buckets) != 0 {
+		t.Errorf("sweep kept %d full buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newMemoryServer()
+	s.limiter = newRateLimiter(1, 1)
+	handler := s.rateLimit(s.limiter, s.rateLimitKey, func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(remoteAddr, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		req.RemoteAddr = remoteAddr
+		if subject != "" {
+			claims := &Claims{}
+			claims.Subject = subject
+			req = req.WithContext(context.WithValue(req.Context(), claimsKey{}, claims))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := request("10.0.0.1:5000", ""); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	rec := request("10.0.0.1:5001", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request from the IP: status %d, Retry-After %q, want 429 after 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// An authenticated client counts against its identity, not its address
+	if rec := request("10.0.0.1:5002", "load-test"); rec.Code != http.StatusOK {
+		t.Errorf("client from the same IP: status %d", rec.Code)
+	}
+	if rec := request("10.0.0.2:5000", "load-test"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("same client from another IP: status %d, want 429", rec.Code)
+	}
+	if got := s.rateLimited.Load(); got != 2 {
+		t.Errorf("rateLimited = %d, want 2", got)
+	}
+}
+
+func TestRateLimitBeforeAPIKeyLookup(t *testing.T) {
+	s := newMemoryServer()
+	lookups := 0
+	s.apiKeys = &apiKeyAuth{find: func(ctx context.Context, hash string) (APIKey, error) {
+		lookups++
+		return APIKey{}, errAPIKeyNotFound
+	}}
+	s.limiter = newRateLimiter(10, 10)
+	s.ipLimiter = newRateLimiter(1, 2)
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+
+	statuses := make([]int, 5)
+	for i := range statuses {
+		req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set(apiKeyHeader, "gsk_guessed")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		statuses[i] = rec.Code
+	}
+	// The burst is looked up and refused; the rest are throttled without
+	// touching the api_keys table
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if lookups != 2 {
+		t.Errorf("%d API key lookups, want 2", lookups)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr, forwarded string
+		trust                 bool
+		want                  string
+	}{
+		{"10.0.0.1:5000", "", false, "10.0.0.1"},
+		{"[::1]:5000", "", false, "::1"},
+		{"10.0.0.1:5000", "203.0.113.7, 10.0.0.9", false, "10.0.0.1"},
+		{"10.0.0.1:5000", "203.0.113.7, 10.0.0.9", true, "203.0.113.7"},
+		{"10.0.0.1:5000", "", true, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientIP(req, tt.trust); got != tt.want {
+			t.Errorf("clientIP(%s, X-Forwarded-For %q, trust %v) = %q, want %q", tt.remoteAddr, tt.forwarded, tt.trust, got, tt.want)
+		}
+	}
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "2.5")
+	if cfg := loadRateLimitConfig(); cfg.Rate != 2.5 || cfg.Burst != 3 {
+		t.Errorf("RATE_LIMIT_RPS=2.5: %+v, want a burst of 3", cfg)
+	}
+	t.Setenv("RATE_LIMIT_BURST", "50")
+	if cfg := loadRateLimitConfig(); cfg.Burst != 50 || cfg.IPRate != 2.5 || cfg.IPBurst != 50 {
+		t.Errorf("RATE_LIMIT_BURST=50: %+v, want the same limit by IP", cfg)
+	}
+	t.Setenv("RATE_LIMIT_IP_RPS", "20")
+	if cfg := loadRateLimitConfig(); cfg.IPRate != 20 || cfg.IPBurst != 20 || cfg.Rate != 2.5 {
+		t.Errorf("RATE_LIMIT_IP_RPS=20: %+v", cfg)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed templates/receipt.html
+var receiptTemplateSource string
+
+var receiptTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"money":     formatMoney,
+	"lineTotal": func(item Item) Money { return item.Price.Mul(item.Quantity) },
+}).Parse(receiptTemplateSource))
+
+// receiptLine is one row of the totals block under the line items
+type receiptLine struct {
+	Label  string
+	Amount Money
+	Total  bool
+}
+
+// receipt is what both the HTML and PDF renderers draw: the transaction as
+// it was priced, plus its current status and any refunds since.
+type receipt struct {
+	TransactionResponse
+	Service string
+	Summary []receiptLine
+}
+
+var currencySymbols = map[string]string{"USD": "$", "EUR": "€", "GBP": "£", "CAD": "CA$"}
+
+func formatMoney(amount Money, currency string) string {
+	if symbol, ok := currencySymbols[currency]; ok {
+		return symbol + amount.String()
+	}
+	return currency + " " + amount.String()
+}
+
+func newReceipt(service string, txn TransactionResponse, status TransactionStatus, refunded Money) receipt {
+	txn.Status = string(status)
+
+	summary := []receiptLine{{Label: "Subtotal", Amount: txn.Subtotal}}
+	if len(txn.Promotions) > 1 {
+		for _, promotion := range txn.Promotions {
+			summary = append(summary, receiptLine{Label: "Discount (" + promotion.Name + ")", Amount: -promotion.Amount})
+		}
+	} else if txn.Discount > 0 {
+		summary = append(summary, receiptLine{Label: "Discount", Amount: -txn.Discount})
+	}
+	taxLabel := "Tax"
+	if txn.TaxInclusive {
+		taxLabel = "Tax (included)"
+	}
+	if len(txn.TaxLines) > 1 {
+		for _, line := range txn.TaxLines {
+			summary = append(summary, receiptLine{Label: fmt.Sprintf("%s (%s)", line.Name, taxLabel), Amount: line.Amount})
+		}
+	} else {
+		summary = append(summary, receiptLine{Label: taxLabel, Amount: txn.Tax})
+	}
+	if txn.Shipping > 0 {
+		summary = append(summary, receiptLine{Label: "Shipping", Amount: txn.Shipping})
+	}
+	if txn.Tip > 0 {
+		summary = append(summary, receiptLine{Label: "Tip", Amount: txn.Tip})
+	}
+	summary = append(summary, receiptLine{Label: "Total", Amount: txn.Total, Total: true})
+	if refunded > 0 {
+		summary = append(summary,
+			receiptLine{Label: "Refunded", Amount: -refunded},
+			receiptLine{Label: "Net paid", Amount: txn.Total - refunded, Total: true},
+		)
+	}
+
+	return receipt{TransactionResponse: txn, Service: service, Summary: summary}
+}
+
+func (s *Server) receiptHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/pdf") {
+		format = "pdf"
+	}
+	if format != "" && format != "html" && format != "pdf" {
+		http.Error(w, "format must be html or pdf", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	var (
+		payload       []byte
+		status        TransactionStatus
+		currency      string
+		refunded      Money
+		invoiceNumber int64
+	)
+	err = s.db.QueryRow(ctx, `
+		SELECT raw_payload, status, currency, refunded_amount, COALESCE(invoice_number, 0) FROM transactions
+		WHERE id = $1 AND deleted_at IS NULL
+	`, transactionID).Scan(&payload, &status, &currency, &refunded, &invoiceNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+
+	var txn TransactionResponse
+	if err := json.Unmarshal(payload, &txn); err != nil {
+		http.Error(w, "Failed to decode stored transaction", http.StatusInternalServerError)
+		return
+	}
+	// Payloads stored before multi-currency support carry no currency
+	txn.Currency = currency
+	// Captured transactions get their invoice number after the payload is stored
+	txn.InvoiceNumber = invoiceNumber
+
+	rec := newReceipt(s.config.ServiceName, txn, status, refunded)
+
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = renderReceiptPDF(&buf, rec)
+	} else {
+		err = receiptTemplate.Execute(&buf, rec)
+	}
+	if err != nil {
+		http.Error(w, "Failed to render receipt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == "pdf" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%s.pdf"`, rec.TransactionID))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func renderReceiptPDF(buf *bytes.Buffer, rec receipt) error {
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.SetTitle("Receipt "+rec.TransactionID, true)
+	pdf.AddPage()
+	// The core fonts are cp1252; convert so names with accents survive
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 8, tr(rec.Service), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.CellFormat(0, 4, "Receipt "+rec.TransactionID, "", 1, "L", false, 0, "")
+	if rec.InvoiceNumber > 0 {
+		pdf.CellFormat(0, 4, fmt.Sprintf("Invoice #%d", rec.InvoiceNumber), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 4, rec.Timestamp+" - "+strings.ToUpper(rec.Status), "", 1, "L", false, 0, "")
+	if rec.CustomerID != "" {
+		pdf.CellFormat(0, 4, "Customer "+rec.CustomerID, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{68, 14, 20, 26}
+	pdf.SetFont("Helvetica", "B", 9)
+	for i, heading := range []string{"Item", "Qty", "Price", "Amount"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 6, heading, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 9)
+	for _, item := range rec.Items {
+		pdf.CellFormat(widths[0], 6, tr(item.Name), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, fmt.Sprint(item.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 6, tr(formatMoney(item.Price, rec.Currency)), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, tr(formatMoney(item.Price.Mul(item.Quantity), rec.Currency)), "", 1, "R", false, 0, "")
+	}
+
+	labelWidth := widths[0] + widths[1] + widths[2]
+	for _, line := range rec.Summary {
+		border := ""
+		pdf.SetFont("Helvetica", "", 9)
+		if line.Total {
+			border = "T"
+			pdf.SetFont("Helvetica", "B", 9)
+		}
+		pdf.CellFormat(labelWidth, 6, line.Label, border, 0, "L", false, 0, "")
+		pdf.CellFormat(widths[3], 6, tr(formatMoney(line.Amount, rec.Currency)), border, 1, "R", false, 0, "")
+	}
+
+	return pdf.Output(buf)
+}
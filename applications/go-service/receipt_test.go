@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewReceiptSummary(t *testing.T) {
+	txn := TransactionResponse{Subtotal: 10000, Discount: 1000, Tax: 720, Tip: 500, Total: 10220}
+
+	rec := newReceipt("go-service", txn, StatusPartiallyRefunded, 2000)
+
+	var labels []string
+	for _, line := range rec.Summary {
+		labels = append(labels, line.Label)
+	}
+	want := "Subtotal,Discount,Tax,Tip,Total,Refunded,Net paid"
+	if got := strings.Join(labels, ","); got != want {
+		t.Errorf("summary lines = %s, want %s", got, want)
+	}
+	if net := rec.Summary[len(rec.Summary)-1].Amount; net != 8220 {
+		t.Errorf("net paid = %v, want 82.20", net)
+	}
+	if rec.Status != string(StatusPartiallyRefunded) {
+		t.Errorf("status = %s, want current status", rec.Status)
+	}
+}
+
+func TestRenderReceipt(t *testing.T) {
+	rec := newReceipt("go-service", TransactionResponse{
+		TransactionID: "abc",
+		Currency:      "USD",
+		Items:         []Item{{Name: "<Widget>", Price: 250, Quantity: 2}},
+		Subtotal:      500,
+		Tax:           40,
+		Total:         540,
+		InvoiceNumber: 1042,
+	}, StatusCompleted, 0)
+
+	var html bytes.Buffer
+	if err := receiptTemplate.Execute(&html, rec); err != nil {
+		t.Fatalf("render html: %v", err)
+	}
+	if !strings.Contains(html.String(), "&lt;Widget&gt;") || !strings.Contains(html.String(), "$5.40") ||
+		!strings.Contains(html.String(), "Invoice #1042") {
+		t.Errorf("html receipt missing escaped item, total, or invoice number:\n%s", html.String())
+	}
+
+	var pdf bytes.Buffer
+	if err := renderReceiptPDF(&pdf, rec); err != nil {
+		t.Fatalf("render pdf: %v", err)
+	}
+	if !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("pdf output does not start with a PDF header")
+	}
+}
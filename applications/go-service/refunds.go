@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// RefundRequest optionally narrows a refund to a specific amount or to
+// specific line items. An empty body refunds whatever remains of the
+// transaction total.
+type RefundRequest struct {
+	Amount Money               `json:"amount,omitempty"`
+	Items  []RefundItemRequest `json:"items,omitempty"`
+	Reason string              `json:"reason,omitempty"`
+}
+
+// RefundItemRequest returns quantity units of the line at line_number.
+type RefundItemRequest struct {
+	LineNumber int `json:"line_number"`
+	Quantity   int `json:"quantity"`
+}
+
+// RefundItem is one refunded line with its prorated discount and tax.
+type RefundItem struct {
+	LineNumber int    `json:"line_number"`
+	ProductID  string `json:"product_id"`
+	Quantity   int    `json:"quantity"`
+	Discount   Money  `json:"discount"`
+	Tax        Money  `json:"tax"`
+	Amount     Money  `json:"amount"`
+
+	transactionItemID uuid.UUID
+}
+
+type RefundResponse struct {
+	RefundID       string       `json:"refund_id"`
+	TransactionID  string       `json:"transaction_id"`
+	Amount         Money        `json:"amount"`
+	RefundedAmount Money        `json:"refunded_amount"`
+	Status         string       `json:"status"`
+	Reason         string       `json:"reason,omitempty"`
+	Items          []RefundItem `json:"items,omitempty"`
+	Timestamp      string       `json:"timestamp"`
+}
+
+func (s *Server) refundTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount < 0 {
+		http.Error(w, "Refund amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount > 0 && len(req.Items) > 0 {
+		http.Error(w, "Specify either amount or items, not both", http.StatusBadRequest)
+		return
+	}
+
+	for _, item := range req.Items {
+		if item.LineNumber <= 0 || item.Quantity <= 0 {
+			http.Error(w, "Refund items need a positive line_number and quantity", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the original row so concurrent refunds can't exceed the total
+	var (
+		current                 TransactionStatus
+		subtotal, discount, tax Money
+		total, refunded         Money
+		taxInclusive            bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT status, subtotal, discount, tax, total, refunded_amount, tax_inclusive FROM transactions WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, transactionID).Scan(&current, &subtotal, &discount, &tax, &total, &refunded, &taxInclusive)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+
+	if !current.canTransitionTo(StatusRefunded) {
+		http.Error(w, "Transaction in status "+string(current)+" cannot be refunded", http.StatusConflict)
+		return
+	}
+
+	remaining := total - refunded
+
+	amount := remaining
+	if req.Amount > 0 {
+		amount = req.Amount
+	}
+
+	var items []RefundItem
+	if len(req.Items) > 0 {
+		items, err = loadRefundItems(ctx, tx, transactionID, req.Items, subtotal, discount, tax, taxInclusive)
+		if err != nil {
+			writeProcessError(w, r, err)
+			return
+		}
+		amount = 0
+		for _, item := range items {
+			amount += item.Amount
+		}
+		// Per-line rounding can drift a cent past what's left on the final return
+		amount = min(amount, remaining)
+	}
+	if amount > remaining {
+		http.Error(w, "Refund amount exceeds remaining refundable total", http.StatusConflict)
+		return
+	}
+
+	refunded += amount
+	status := StatusPartiallyRefunded
+	if refunded >= total {
+		status = StatusRefunded
+	}
+
+	refundID := uuid.New()
+	var createdAt time.Time
+	err = tx.QueryRow(ctx, `
+		INSERT INTO refunds (id, transaction_id, amount, reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING created_at
+	`, refundID, transactionID, amount, req.Reason).Scan(&createdAt)
+	if err != nil {
+		http.Error(w, "Failed to persist refund", http.StatusInternalServerError)
+		return
+	}
+
+	for _, item := range items {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO refund_items (id, refund_id, transaction_item_id, quantity, discount, tax, amount)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, uuid.New(), refundID, item.transactionItemID, item.Quantity, item.Discount, item.Tax, item.Amount)
+		if err != nil {
+			http.Error(w, "Failed to persist refund items", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE transactions SET refunded_amount = $2, status = $3, status_updated_at = NOW() WHERE id = $1
+	`, transactionID, refunded, status)
+	if err != nil {
+		http.Error(w, "Failed to update transaction", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Failed to commit refund", http.StatusInternalServerError)
+		return
+	}
+
+	response := RefundResponse{
+		RefundID:       refundID.String(),
+		TransactionID:  transactionID.String(),
+		Amount:         amount,
+		RefundedAmount: refunded,
+		Status:         string(status),
+		Reason:         req.Reason,
+		Items:          items,
+		Timestamp:      createdAt.UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// loadRefundItems resolves the requested lines against the locked
+// transaction, rejecting unknown lines and quantities beyond what is still
+// unrefunded, and prorates the transaction's discount and tax onto each.
+func loadRefundItems(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID, requested []RefundItemRequest, subtotal, discount, tax Money, taxInclusive bool) ([]RefundItem, error) {
+	items := make([]RefundItem, 0, len(requested))
+	seen := make(map[int]bool, len(requested))
+
+	for _, req := range requested {
+		if seen[req.LineNumber] {
+			return nil, clientError(http.StatusBadRequest, fmt.Sprintf("Line %d listed more than once", req.LineNumber))
+		}
+		seen[req.LineNumber] = true
+
+		var (
+			item                  RefundItem
+			unitPrice             Money
+			lineDiscount, lineTax *Money
+			quantity, already     int
+		)
+		err := tx.QueryRow(ctx, `
+			SELECT ti.id, ti.product_id, ti.unit_price, ti.quantity, ti.discount, ti.tax,
+			       COALESCE((SELECT SUM(ri.quantity) FROM refund_items ri WHERE ri.transaction_item_id = ti.id), 0)
+			FROM transaction_items ti
+			WHERE ti.transaction_id = $1 AND ti.line_number = $2
+		`, transactionID, req.LineNumber).Scan(&item.transactionItemID, &item.ProductID, &unitPrice, &quantity, &lineDiscount, &lineTax, &already)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, clientError(http.StatusUnprocessableEntity, fmt.Sprintf("Transaction has no line %d", req.LineNumber))
+		}
+		if err != nil {
+			return nil, serverError("Failed to fetch transaction items", err)
+		}
+
+		if req.Quantity > quantity-already {
+			return nil, clientError(http.StatusConflict, fmt.Sprintf("Line %d has only %d unrefunded units", req.LineNumber, quantity-already))
+		}
+
+		item.LineNumber = req.LineNumber
+		item.Quantity = req.Quantity
+		gross := unitPrice.Mul(req.Quantity)
+		if lineDiscount != nil && lineTax != nil {
+			// The line's own allocation, scaled to the units being returned
+			item.Discount = lineDiscount.MulFrac(int64(req.Quantity), int64(quantity))
+			item.Tax = lineTax.MulFrac(int64(req.Quantity), int64(quantity))
+			item.Amount = gross - item.Discount
+			if !taxInclusive {
+				item.Amount += item.Tax
+			}
+		} else {
+			// Lines written before per-line tax was recorded
+			item.Discount, item.Tax, item.Amount = prorateLine(gross, subtotal, discount, tax, taxInclusive)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// prorateLine splits the transaction's discount and tax onto a line worth
+// gross before discount, in proportion to its share of the subtotal, and
+// returns what the customer paid for it. With tax-inclusive pricing the tax
+// share is already part of gross.
+func prorateLine(gross, subtotal, discount, tax Money, taxInclusive bool) (lineDiscount, lineTax, amount Money) {
+	if subtotal <= 0 {
+		return 0, 0, 0
+	}
+	lineDiscount = gross.MulFrac(discount.Cents(), subtotal.Cents())
+	if taxable := subtotal - discount; taxable > 0 {
+		lineTax = (gross - lineDiscount).MulFrac(tax.Cents(), taxable.Cents())
+	}
+	if taxInclusive {
+		return lineDiscount, lineTax, gross - lineDiscount
+	}
+	return lineDiscount, lineTax, gross - lineDiscount + lineTax
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestProrateLine(t *testing.T) {
+	tests := []struct {
+		name                    string
+		gross                   Money
+		subtotal, discount, tax Money
+		wantDiscount, wantTax   Money
+		wantAmount              Money
+		inclusive               bool
+	}{
+		{"quarter of order", 2500, 10000, 1000, 720, 250, 180, 2430, false},
+		{"whole order", 10000, 10000, 1000, 720, 1000, 720, 9720, false},
+		{"no discount", 3000, 6000, 0, 480, 0, 240, 3240, false},
+		{"fully discounted", 5000, 10000, 10000, 0, 5000, 0, 0, false},
+		{"a third rounds to the cent", 1000, 3000, 100, 232, 33, 77, 1044, false},
+		{"empty subtotal", 1000, 0, 0, 0, 0, 0, 0, false},
+		{"tax inclusive", 2400, 12000, 0, 2000, 0, 400, 2400, true},
+	}
+
+	for _, tt := range tests {
+		discount, tax, amount := prorateLine(tt.gross, tt.subtotal, tt.discount, tt.tax, tt.inclusive)
+		if discount != tt.wantDiscount || tax != tt.wantTax || amount != tt.wantAmount {
+			t.Errorf("%s: prorateLine = (%v, %v, %v), want (%v, %v, %v)",
+				tt.name, discount, tax, amount, tt.wantDiscount, tt.wantTax, tt.wantAmount)
+		}
+	}
+}
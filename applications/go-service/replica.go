@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ReplicaConfig points read-only queries at a streaming replica. Only views
+// that tolerate replication lag use it: stats, reports, lists, and search.
+// Reads that follow a write, such as fetching a transaction just created,
+// stay on the primary.
+type ReplicaConfig struct {
+	Host string
+	// Port defaults to the primary's
+	Port string
+	// CheckInterval is how often an unavailable replica is retried and an
+	// available one re-checked
+	CheckInterval time.Duration
+}
+
+func loadReplicaConfig() ReplicaConfig {
+	cfg := ReplicaConfig{
+		Host:          os.Getenv("POSTGRES_REPLICA_HOST"),
+		Port:          os.Getenv("POSTGRES_REPLICA_PORT"),
+		CheckInterval: 5 * time.Second,
+	}
+	if val := os.Getenv("POSTGRES_REPLICA_CHECK_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.CheckInterval = parsed
+		}
+	}
+	return cfg
+}
+
+// initReplica creates the replica pool without waiting for it: the primary
+// serves reads until the first successful check. There is no replica without
+// a primary, so memory storage ignores it.
+func (s *Server) initReplica(ctx context.Context) error {
+	if s.config.Replica.Host == "" || s.db == nil {
+		return nil
+	}
+	pool, err := newPool(ctx, s.config, s.config.Replica.Host, s.config.Replica.Port, s.slowQueries)
+	if err != nil {
+		return err
+	}
+	s.replica = pool
+	s.checkReplica(ctx)
+	return nil
+}
+
+// runReplicaMonitor keeps replicaHealthy current until ctx is done
+func (s *Server) runReplicaMonitor(ctx context.Context) {
+	runEvery(ctx, s.config.Replica.CheckInterval, s.checkReplica)
+}
+
+func (s *Server) checkReplica(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, s.config.Timeouts.Health)
+	defer cancel()
+
+	err := s.replica.Ping(pingCtx)
+	s.setReplicaHealthy(err == nil, err)
+}
+
+func (s *Server) setReplicaHealthy(healthy bool, err error) {
+	if s.replicaHealthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		slog.Info("read replica available, routing reads to it", "host", s.config.Replica.Host)
+	} else {
+		slog.Warn("read replica unavailable, reading from primary", "host", s.config.Replica.Host, "error", err)
+	}
+}
+
+// reader is where lag-tolerant reads go: the replica while it is healthy,
+// otherwise the primary
+func (s *Server) reader() querier {
+	if s.replica != nil && s.replicaHealthy.Load() {
+		return s.replica
+	}
+	return s.db
+}
+
+// readQuery runs a lag-tolerant query on reader. A replica that fails to
+// answer for reasons other than the query itself is marked unavailable and
+// the query is retried on the primary, so callers never see the outage.
+func (s *Server) readQuery(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q := s.reader()
+	rows, err := q.Query(ctx, sql, args...)
+	if err == nil || q == querier(s.db) || isQueryError(err) || ctx.Err() != nil {
+		return rows, err
+	}
+	s.setReplicaHealthy(false, err)
+	return s.db.Query(ctx, sql, args...)
+}
+
+// isQueryError reports whether Postgres itself rejected the statement, as
+// opposed to the connection failing
+func isQueryError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr)
+}
+
+// replicaStatus is reported by the health check when a replica is set
+func (s *Server) replicaStatus() string {
+	switch {
+	case s.replica == nil:
+		return ""
+	case s.replicaHealthy.Load():
+		return "healthy"
+	default:
+		return "unavailable"
+	}
+}
+
+// replicaDB gives sqlc-generated queries the same routing as readQuery:
+// lag-tolerant reads on the replica with fallback, anything else on the
+// primary
+type replicaDB struct {
+	s *Server
+}
+
+func (r replicaDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return r.s.db.Exec(ctx, sql, args...)
+}
+
+func (r replicaDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return r.s.readQuery(ctx, sql, args...)
+}
+
+func (r replicaDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return r.s.reader().QueryRow(ctx, sql, args...)
+}
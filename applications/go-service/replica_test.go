@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	primary, replica := &pgxpool.Pool{}, &pgxpool.Pool{}
+
+	s := &Server{db: primary}
+	if s.reader() != querier(primary) || s.replicaStatus() != "" {
+		t.Errorf("without a replica: reader = %p, status = %q; want primary, none", s.reader(), s.replicaStatus())
+	}
+
+	s.replica = replica
+	if s.reader() != querier(primary) || s.replicaStatus() != "unavailable" {
+		t.Errorf("before the first check: reader = %p, status = %q; want primary, unavailable", s.reader(), s.replicaStatus())
+	}
+
+	s.setReplicaHealthy(true, nil)
+	if s.reader() != querier(replica) || s.replicaStatus() != "healthy" {
+		t.Errorf("healthy: reader = %p, status = %q; want replica, healthy", s.reader(), s.replicaStatus())
+	}
+
+	s.setReplicaHealthy(false, errors.New("connection refused"))
+	if s.reader() != querier(primary) {
+		t.Errorf("after failing: reader = %p, want primary", s.reader())
+	}
+}
+
+func TestIsQueryError(t *testing.T) {
+	if !isQueryError(fmt.Errorf("list: %w", &pgconn.PgError{Code: "42P01"})) {
+		t.Error("Postgres error was not treated as a query error")
+	}
+	if isQueryError(errors.New("dial tcp: connection refused")) {
+		t.Error("connection error was treated as a query error")
+	}
+}
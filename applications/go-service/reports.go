@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTopProducts       = 10
+	maxTopProducts           = 100
+	defaultTopProductsWindow = 30 * 24 * time.Hour
+)
+
+type CategoryRevenue struct {
+	Category     string `json:"category"`
+	Transactions int64  `json:"transactions"`
+	UnitsSold    int64  `json:"units_sold"`
+	Revenue      Money  `json:"revenue"`
+}
+
+type RevenueByCategoryResponse struct {
+	From       string            `json:"from,omitempty"`
+	To         string            `json:"to,omitempty"`
+	Categories []CategoryRevenue `json:"categories"`
+}
+
+type ProductSales struct {
+	ProductID    string `json:"product_id"`
+	Name         string `json:"name,omitempty"`
+	Category     string `json:"category,omitempty"`
+	UnitsSold    int64  `json:"units_sold"`
+	Revenue      Money  `json:"revenue"`
+	Transactions int64  `json:"transactions"`
+}
+
+type TopProductsResponse struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	SortBy   string         `json:"sort_by"`
+	Products []ProductSales `json:"products"`
+}
+
+// parseWindow accepts Go durations (e.g. "36h") plus whole days ("7d")
+func parseWindow(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New("window must be a positive duration such as 24h or 7d")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, errors.New("window must be a positive duration such as 24h or 7d")
+	}
+	return window, nil
+}
+
+func formatOptionalTime(ts *time.Time) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.UTC().Format(time.RFC3339)
+}
+
+// revenueByCategoryHandler breaks gross line-item revenue down by category.
+// Revenue is before order-level discounts and tax, matching the line totals.
+// Whole days the daily_category_revenue view covers are read from it; a
+// transaction falls on one day, so its per-day distinct counts add up.
+func (s *Server) revenueByCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Report)
+	defer cancel()
+
+	coveredUntil, err := s.reportCoverage(ctx, viewDailyCategoryRevenue)
+	if err != nil {
+		http.Error(w, "Failed to fetch revenue report", http.StatusInternalServerError)
+		return
+	}
+	split := splitReportRange(from, to, coveredUntil)
+	var args []any
+	rows, err := s.readQuery(ctx, `
+		WITH categories AS (
+			SELECT category, transactions, units_sold, revenue
+			FROM `+viewDailyCategoryRevenue+`
+			WHERE `+split.viewCondition(&args)+`
+			UNION ALL
+			SELECT COALESCE(NULLIF(ti.category, ''), 'uncategorized'),
+				COUNT(DISTINCT t.id),
+				COALESCE(SUM(ti.quantity), 0),
+				COALESCE(SUM(ti.total * t.exchange_rate), 0)
+			FROM transaction_items ti
+			JOIN transactions t ON t.id = ti.transaction_id
+			WHERE t.`+revenueStatusFilter+`
+				AND t.deleted_at IS NULL
+				AND `+split.liveCondition("t.created_at", &args)+`
+			GROUP BY 1
+		)
+		SELECT category, SUM(transactions)::bigint, SUM(units_sold)::bigint, SUM(revenue)
+		FROM categories
+		GROUP BY 1
+		ORDER BY 4 DESC, 1
+	`, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch revenue report", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := RevenueByCategoryResponse{
+		From:       formatOptionalTime(from),
+		To:         formatOptionalTime(to),
+		Categories: []CategoryRevenue{},
+	}
+	for rows.Next() {
+		var row CategoryRevenue
+		if err := rows.Scan(&row.Category, &row.Transactions, &row.UnitsSold, &row.Revenue); err != nil {
+			http.Error(w, "Failed to fetch revenue report", http.StatusInternalServerError)
+			return
+		}
+		response.Categories = append(response.Categories, row)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch revenue report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// topProductsHandler ranks products by units sold or revenue over a trailing
+// window (default 30 days), or an explicit from/to range when given.
+func (s *Server) topProductsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultTopProducts
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTopProducts {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	sortBy := query.Get("sort_by")
+	if sortBy == "" {
+		sortBy = "quantity"
+	}
+	orderBy := map[string]string{
+		"quantity": "units_sold DESC, revenue DESC",
+		"revenue":  "revenue DESC, units_sold DESC",
+	}[sortBy]
+	if orderBy == "" {
+		http.Error(w, "sort_by must be quantity or revenue", http.StatusBadRequest)
+		return
+	}
+
+	window := defaultTopProductsWindow
+	if value := query.Get("window"); value != "" {
+		parsed, err := parseWindow(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end := time.Now().UTC()
+	if to != nil {
+		end = to.UTC()
+	}
+	start := end.Add(-window)
+	if from != nil {
+		start = from.UTC()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Report)
+	defer cancel()
+
+	rows, err := s.readQuery(ctx, `
+		SELECT ti.product_id,
+			COALESCE(MAX(ti.name), ''),
+			COALESCE(MAX(ti.category), ''),
+			SUM(ti.quantity) AS units_sold,
+			SUM(ti.total * t.exchange_rate) AS revenue,
+			COUNT(DISTINCT t.id)
+		FROM transaction_items ti
+		JOIN transactions t ON t.id = ti.transaction_id
+		WHERE t.`+revenueStatusFilter+`
+			AND t.deleted_at IS NULL
+			AND t.created_at >= $1 AND t.created_at < $2
+		GROUP BY ti.product_id
+		ORDER BY `+orderBy+`, ti.product_id
+		LIMIT $3
+	`, start, end, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch top products", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := TopProductsResponse{
+		From:     start.Format(time.RFC3339),
+		To:       end.Format(time.RFC3339),
+		SortBy:   sortBy,
+		Products: []ProductSales{},
+	}
+	for rows.Next() {
+		var row ProductSales
+		if err := rows.Scan(&row.ProductID, &row.Name, &row.Category, &row.UnitsSold, &row.Revenue, &row.Transactions); err != nil {
+			http.Error(w, "Failed to fetch top products", http.StatusInternalServerError)
+			return
+		}
+		response.Products = append(response.Products, row)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch top products", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Materialized views from migration 037
+const (
+	viewDailyRevenue         = "daily_revenue"
+	viewDailyCategoryRevenue = "daily_category_revenue"
+)
+
+var reportViews = []string{viewDailyRevenue, viewDailyCategoryRevenue}
+
+// ReportsConfig sets how often the report views are refreshed, and so how far
+// behind earlier days' figures can be
+type ReportsConfig struct {
+	RefreshInterval time.Duration
+}
+
+func loadReportsConfig() ReportsConfig {
+	cfg := ReportsConfig{RefreshInterval: 5 * time.Minute}
+	if val := os.Getenv("REPORTS_REFRESH_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.RefreshInterval = parsed
+		}
+	}
+	return cfg
+}
+
+// reportRange is a half-open time range; a nil bound leaves that side open
+type reportRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// condition restricts column to r, appending the bounds to args
+func (r reportRange) condition(column string, args *[]any) string {
+	var conditions []string
+	if r.From != nil {
+		*args = append(*args, *r.From)
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", column, len(*args)))
+	}
+	if r.To != nil {
+		*args = append(*args, *r.To)
+		conditions = append(conditions, fmt.Sprintf("%s < $%d", column, len(*args)))
+	}
+	if len(conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// reportSplit divides a report's range between the whole UTC days a view
+// covers and the rest, which is read live
+type reportSplit struct {
+	// View is nil when the view covers none of the range
+	View *reportRange
+	Live []reportRange
+}
+
+// splitReportRange splits [from, to) given the view is complete for the days
+// before coveredUntil, a UTC midnight. A zero coveredUntil, for a view never
+// refreshed, leaves everything live.
+func splitReportRange(from, to *time.Time, coveredUntil time.Time) reportSplit {
+	live := reportSplit{Live: []reportRange{{From: from, To: to}}}
+	if coveredUntil.IsZero() {
+		return live
+	}
+
+	var viewFrom *time.Time
+	if from != nil {
+		day := from.UTC().Truncate(24 * time.Hour)
+		if day.Before(*from) {
+			day = day.AddDate(0, 0, 1)
+		}
+		viewFrom = &day
+	}
+	viewTo := coveredUntil
+	if to != nil {
+		if day := to.UTC().Truncate(24 * time.Hour); day.Before(viewTo) {
+			viewTo = day
+		}
+	}
+	if viewFrom != nil && !viewFrom.Before(viewTo) {
+		return live
+	}
+
+	split := reportSplit{View: &reportRange{From: viewFrom, To: &viewTo}}
+	if from != nil && from.Before(*viewFrom) {
+		split.Live = append(split.Live, reportRange{From: from, To: viewFrom})
+	}
+	if to == nil || viewTo.Before(*to) {
+		split.Live = append(split.Live, reportRange{From: &viewTo, To: to})
+	}
+	return split
+}
+
+// viewCondition selects the view rows for s, by their day column
+func (s reportSplit) viewCondition(args *[]any) string {
+	if s.View == nil {
+		return "FALSE"
+	}
+	return s.View.condition("day", args)
+}
+
+// liveCondition selects the rows of column's table outside the view's days
+func (s reportSplit) liveCondition(column string, args *[]any) string {
+	if len(s.Live) == 0 {
+		return "FALSE"
+	}
+	conditions := make([]string, len(s.Live))
+	for i, r := range s.Live {
+		conditions[i] = "(" + r.condition(column, args) + ")"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// reportCoverage returns the UTC midnight before which view is complete, or
+// the zero time if it has never been refreshed
+func (s *Server) reportCoverage(ctx context.Context, view string) (time.Time, error) {
+	var refreshedAt time.Time
+	err := s.reader().QueryRow(ctx, `SELECT refreshed_at FROM report_refreshes WHERE view_name = $1`, view).Scan(&refreshedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read %s coverage: %w", view, err)
+	}
+	return refreshedAt.UTC().Truncate(24 * time.Hour), nil
+}
+
+// runReportRefresher refreshes the report views every RefreshInterval
+func (s *Server) runReportRefresher(ctx context.Context) {
+	runEvery(ctx, s.config.Reports.RefreshInterval, func(ctx context.Context) {
+		for _, view := range reportViews {
+			if err := s.refreshReportView(ctx, view); err != nil {
+				slog.ErrorContext(ctx, "report refresher failed", "error", err)
+			}
+		}
+	})
+}
+
+// refreshReportView rebuilds view and records when. Reads carry on against
+// the old contents meanwhile, except on the first refresh, which has nothing
+// to keep. It does nothing while another instance is refreshing.
+func (s *Server) refreshReportView(ctx context.Context, view string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('report_refresh_' || $1))`, view).Scan(&locked); err != nil {
+		return fmt.Errorf("lock %s: %w", view, err)
+	}
+	if !locked {
+		return nil
+	}
+
+	var populated bool
+	if err := tx.QueryRow(ctx, `SELECT ispopulated FROM pg_matviews WHERE matviewname = $1`, view).Scan(&populated); err != nil {
+		return fmt.Errorf("check %s: %w", view, err)
+	}
+	// A rebuild scans all of history, so it gets until the next one is due
+	// rather than the pool's statement_timeout
+	timeout := strconv.FormatInt(s.config.Reports.RefreshInterval.Milliseconds(), 10)
+	if _, err := tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`, timeout); err != nil {
+		return fmt.Errorf("set %s refresh timeout: %w", view, err)
+	}
+	refresh := "REFRESH MATERIALIZED VIEW "
+	if populated {
+		refresh += "CONCURRENTLY "
+	}
+	if _, err := tx.Exec(ctx, refresh+pgx.Identifier{view}.Sanitize()); err != nil {
+		return fmt.Errorf("refresh %s: %w", view, err)
+	}
+
+	// NOW() is when this transaction began, so nothing committed before it
+	// is missing from the refreshed view
+	_, err = tx.Exec(ctx, `
+		INSERT INTO report_refreshes (view_name, refreshed_at) VALUES ($1, NOW())
+		ON CONFLICT (view_name) DO UPDATE SET refreshed_at = EXCLUDED.refreshed_at
+	`, view)
+	if err != nil {
+		return fmt.Errorf("record %s refresh: %w", view, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
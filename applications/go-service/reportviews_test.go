@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitReportRange(t *testing.T) {
+	at := func(day, hour int) *time.Time {
+		ts := time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC)
+		return &ts
+	}
+	covered := *at(10, 0)
+	format := func(r reportRange) string {
+		bound := func(ts *time.Time) string {
+			if ts == nil {
+				return "open"
+			}
+			return ts.Format("02T15")
+		}
+		return bound(r.From) + ".." + bound(r.To)
+	}
+
+	tests := []struct {
+		name     string
+		from, to *time.Time
+		covered  time.Time
+		view     string
+		live     []string
+	}{
+		{"never refreshed", at(1, 0), at(5, 0), time.Time{}, "", []string{"01T00..05T00"}},
+		{"whole days inside coverage", at(1, 0), at(5, 0), covered, "01T00..05T00", nil},
+		{"partial days at both ends", at(1, 6), at(5, 12), covered, "02T00..05T00", []string{"01T06..02T00", "05T00..05T12"}},
+		{"past coverage", at(8, 0), at(12, 6), covered, "08T00..10T00", []string{"10T00..12T06"}},
+		{"open ended", nil, nil, covered, "open..10T00", []string{"10T00..open"}},
+		{"within one day", at(3, 1), at(3, 5), covered, "", []string{"03T01..03T05"}},
+		{"after coverage", at(11, 0), at(12, 0), covered, "", []string{"11T00..12T00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := splitReportRange(tt.from, tt.to, tt.covered)
+			view := ""
+			if split.View != nil {
+				view = format(*split.View)
+			}
+			var live []string
+			for _, r := range split.Live {
+				live = append(live, format(r))
+			}
+			if view != tt.view || len(live) != len(tt.live) {
+				t.Fatalf("view %q live %v, want %q %v", view, live, tt.view, tt.live)
+			}
+			for i := range live {
+				if live[i] != tt.live[i] {
+					t.Errorf("live %v, want %v", live, tt.live)
+				}
+			}
+		})
+	}
+}
+
+func TestReportSplitConditions(t *testing.T) {
+	from := time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)
+	split := splitReportRange(&from, nil, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC))
+
+	args := []any{"day"}
+	if got, want := split.viewCondition(&args), "day >= $2 AND day < $3"; got != want {
+		t.Errorf("view condition = %q, want %q", got, want)
+	}
+	if got, want := split.liveCondition("created_at", &args), "((created_at >= $4 AND created_at < $5) OR (created_at >= $6))"; got != want {
+		t.Errorf("live condition = %q, want %q", got, want)
+	}
+	if len(args) != 6 {
+		t.Errorf("args = %v, want 6", args)
+	}
+
+	if got := (reportSplit{}).viewCondition(&args); got != "FALSE" {
+		t.Errorf("no view: condition = %q, want FALSE", got)
+	}
+}
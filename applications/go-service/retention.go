@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// RetentionDelete removes expired transactions and everything recorded
+	// against them
+	RetentionDelete = "delete"
+	// RetentionAnonymize keeps expired transactions' amounts for reporting but
+	// drops the customer, metadata, and notes
+	RetentionAnonymize = "anonymize"
+)
+
+// RetentionConfig controls the purge of transactions older than Days. Zero
+// Days turns the purge off.
+type RetentionConfig struct {
+	Days   int
+	Action string
+	// DryRun counts what would be purged without changing anything
+	DryRun    bool
+	Interval  time.Duration
+	BatchSize int
+}
+
+func loadRetentionConfig() RetentionConfig {
+	cfg := RetentionConfig{Action: RetentionAnonymize, Interval: 24 * time.Hour, BatchSize: 1000}
+	if val := os.Getenv("RETENTION_DAYS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			cfg.Days = parsed
+		}
+	}
+	if val := os.Getenv("RETENTION_ACTION"); val == RetentionDelete || val == RetentionAnonymize {
+		cfg.Action = val
+	}
+	if val := os.Getenv("RETENTION_DRY_RUN"); val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			cfg.DryRun = parsed
+		}
+	}
+	if val := os.Getenv("RETENTION_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Interval = parsed
+		}
+	}
+	if val := os.Getenv("RETENTION_BATCH_SIZE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			cfg.BatchSize = parsed
+		}
+	}
+	return cfg
+}
+
+// cutoff is the creation time before which transactions have expired
+func (c RetentionConfig) cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -c.Days)
+}
+
+// expiredCondition selects the transactions action still has to purge
+func expiredCondition(action string) string {
+	if action == RetentionAnonymize {
+		return `created_at < $1 AND anonymized_at IS NULL`
+	}
+	return `created_at < $1`
+}
+
+// purgeStatements run against $1, the ids in one batch. Nothing enforces
+// references to a partitioned transactions table, so deleting clears them
+// first: rows that only make sense with their transaction go with it, and
+// history kept for other reasons (jobs, loyalty, stock) is unlinked.
+func purgeStatements(action string) []string {
+	if action == RetentionAnonymize {
+		return []string{
+			`DELETE FROM idempotency_keys WHERE transaction_id = ANY($1)`,
+			`UPDATE loyalty_ledger SET transaction_id = NULL WHERE transaction_id = ANY($1)`,
+			`UPDATE transactions
+			 SET customer_id = NULL, metadata = '{}', notes = NULL, fingerprint = NULL,
+			     raw_payload = raw_payload - 'customer_id' - 'metadata' - 'notes', anonymized_at = NOW()
+			 WHERE id = ANY($1)`,
+		}
+	}
+	return []string{
+		`DELETE FROM idempotency_keys WHERE transaction_id = ANY($1)`,
+		`UPDATE jobs SET transaction_id = NULL WHERE transaction_id = ANY($1)`,
+		`UPDATE loyalty_ledger SET transaction_id = NULL WHERE transaction_id = ANY($1)`,
+		`UPDATE inventory_movements SET transaction_id = NULL WHERE transaction_id = ANY($1)`,
+		`UPDATE transactions SET duplicate_of = NULL WHERE duplicate_of = ANY($1)`,
+		// refund_items go with their refunds
+		`DELETE FROM refunds WHERE transaction_id = ANY($1)`,
+		`DELETE FROM transaction_items WHERE transaction_id = ANY($1)`,
+		`DELETE FROM transactions WHERE id = ANY($1)`,
+	}
+}
+
+// runRetentionPurge purges expired transactions once per Interval
+func (s *Server) runRetentionPurge(ctx context.Context) {
+	runEvery(ctx, s.config.Retention.Interval, func(ctx context.Context) {
+		if _, err := s.purgeExpired(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "retention purge failed", "error", err)
+		}
+	})
+}
+
+const purgeUsage = `usage: go-service purge
+
+Applies the RETENTION_* settings once and exits, for running the purge from
+a Kubernetes CronJob instead of in the server.
+`
+
+// runPurgeCommand implements `go-service purge`. It returns the process exit
+// code.
+func runPurgeCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprint(stderr, purgeUsage)
+		return 2
+	}
+	config := loadConfig()
+	if config.Retention.Days == 0 {
+		fmt.Fprintf(stderr, "RETENTION_DAYS is not set\n\n%s", purgeUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	pool, err := initDatabase(ctx, config, nil)
+	if err != nil {
+		reportJobRun(stderr, config, jobRun{Job: "retention-purge", Start: start, Err: err})
+		fmt.Fprintf(stderr, "failed to connect to Postgres: %v\n", err)
+		return 1
+	}
+	defer pool.Close()
+
+	s := &Server{config: config, db: pool}
+	purged, err := s.purgeExpired(ctx, start)
+	reportJobRun(stderr, config, jobRun{Job: "retention-purge", Start: start, Items: purged, Err: err})
+	if err != nil {
+		fmt.Fprintf(stderr, "purge: %v\n", err)
+		return 1
+	}
+	if config.Retention.DryRun {
+		fmt.Fprintf(stdout, "dry run: %d transactions to %s\n", s.retentionPending.Load(), config.Retention.Action)
+	} else {
+		fmt.Fprintf(stdout, "%s: %d transactions\n", config.Retention.Action, purged)
+	}
+	return 0
+}
+
+// purgeExpired applies the retention action to every expired transaction,
+// a batch per database transaction, and returns how many it changed. In dry
+// run mode it only counts them.
+func (s *Server) purgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	cfg := s.config.Retention
+	cutoff := cfg.cutoff(now)
+
+	if cfg.DryRun {
+		var count int64
+		err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM transactions WHERE `+expiredCondition(cfg.Action), cutoff).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("count expired transactions: %w", err)
+		}
+		s.retentionPending.Store(count)
+		slog.InfoContext(ctx, "retention purge dry run", "action", cfg.Action, "count", count, "cutoff", cutoff.UTC())
+		return 0, nil
+	}
+
+	var total int64
+	for ctx.Err() == nil {
+		n, err := s.purgeBatch(ctx, cutoff)
+		total += n
+		s.retentionPurged.Add(n)
+		if err != nil {
+			return total, err
+		}
+		if n < int64(cfg.BatchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		slog.InfoContext(ctx, "retention purge", "action", cfg.Action, "count", total, "cutoff", cutoff.UTC())
+	}
+	return total, nil
+}
+
+// purgeBatch purges up to BatchSize expired transactions. It does nothing
+// while another instance holds the purge lock.
+func (s *Server) purgeBatch(ctx context.Context, cutoff time.Time) (int64, error) {
+	cfg := s.config.Retention
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('retention_purge'))`).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id FROM transactions WHERE `+expiredCondition(cfg.Action)+`
+		ORDER BY created_at LIMIT $2 FOR UPDATE SKIP LOCKED
+	`, cutoff, cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("select expired transactions: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("select expired transactions: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	for _, statement := range purgeStatements(cfg.Action) {
+		if _, err := tx.Exec(ctx, statement, ids); err != nil {
+			return 0, fmt.Errorf("%s expired transactions: %w", cfg.Action, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	cfg := RetentionConfig{Days: 30}
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	if got, want := cfg.cutoff(now), time.Date(2024, 2, 14, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("cutoff = %v, want %v", got, want)
+	}
+}
+
+func TestRunPurgeCommandUsage(t *testing.T) {
+	tests := []struct {
+		days string
+		args []string
+	}{
+		{"30", []string{"now"}},
+		{"", nil},
+		{"0", nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("RETENTION_DAYS", tt.days)
+		var stdout, stderr bytes.Buffer
+		if code := runPurgeCommand(tt.args, &stdout, &stderr); code != 2 {
+			t.Errorf("RETENTION_DAYS=%q runPurgeCommand(%v) = %d, want 2", tt.days, tt.args, code)
+		}
+		if !strings.Contains(stderr.String(), "usage: go-service purge") {
+			t.Errorf("RETENTION_DAYS=%q runPurgeCommand(%v) printed no usage", tt.days, tt.args)
+		}
+	}
+}
+
+func TestPurgeStatements(t *testing.T) {
+	tests := []struct {
+		action string
+		// last must be the statement that changes the transactions themselves
+		last string
+	}{
+		{RetentionDelete, "DELETE FROM transactions"},
+		{RetentionAnonymize, "UPDATE transactions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			statements := purgeStatements(tt.action)
+			if last := statements[len(statements)-1]; !strings.HasPrefix(last, tt.last) {
+				t.Errorf("last statement = %q, want it to start with %q", last, tt.last)
+			}
+			for _, statement := range statements {
+				if !strings.Contains(statement, "ANY($1)") {
+					t.Errorf("statement %q isn't limited to the batch", statement)
+				}
+			}
+		})
+	}
+
+	if !strings.Contains(expiredCondition(RetentionAnonymize), "anonymized_at IS NULL") {
+		t.Error("anonymize would revisit transactions it already anonymized")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// revenueCounter holds the revenue totals /metrics reports, so a scrape
+// never queries Postgres. It is seeded from the database at startup and
+// re-read every MetricsSyncInterval; in between, transactions this instance
+// creates are added as they commit. Refunds, captures, voids, deletions, and
+// other instances' transactions show up at the next sync.
+type revenueCounter struct {
+	mu     sync.Mutex
+	totals revenueTotals
+	// synced is false until the first successful load
+	synced bool
+}
+
+func (c *revenueCounter) set(totals revenueTotals) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totals = totals
+	c.synced = true
+}
+
+// add counts a transaction that has just been committed. Only completed
+// ones count as revenue; an authorization is counted once a sync sees it
+// captured.
+func (c *revenueCounter) add(response TransactionResponse) {
+	if response.Status != string(StatusCompleted) {
+		return
+	}
+	reportingTotal := response.Total.MulRate(response.ExchangeRate)
+	reportingTip := response.Tip.MulRate(response.ExchangeRate)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totals.Transactions++
+	c.totals.Revenue += reportingTotal
+	c.totals.Tips += reportingTip
+
+	i := sort.Search(len(c.totals.ByCurrency), func(i int) bool {
+		return c.totals.ByCurrency[i].Currency >= response.Currency
+	})
+	if i == len(c.totals.ByCurrency) || c.totals.ByCurrency[i].Currency != response.Currency {
+		c.totals.ByCurrency = append(c.totals.ByCurrency, CurrencyStats{})
+		copy(c.totals.ByCurrency[i+1:], c.totals.ByCurrency[i:])
+		c.totals.ByCurrency[i] = CurrencyStats{Currency: response.Currency}
+	}
+	row := &c.totals.ByCurrency[i]
+	row.Transactions++
+	row.Revenue += response.Total
+	row.Tips += response.Tip
+	row.ReportingRevenue += reportingTotal
+}
+
+// snapshot returns a copy of the totals, and false before the first sync
+func (c *revenueCounter) snapshot() (revenueTotals, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	totals := c.totals
+	totals.ByCurrency = append([]CurrencyStats(nil), c.totals.ByCurrency...)
+	return totals, c.synced
+}
+
+// runRevenueSync reloads the revenue totals every MetricsSyncInterval,
+// starting straight away to seed them
+func (s *Server) runRevenueSync(ctx context.Context) {
+	runEvery(ctx, s.config.MetricsSyncInterval, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, s.config.Timeouts.Read)
+		defer cancel()
+
+		totals, err := s.store.RevenueTotals(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "revenue sync failed", "error", err)
+			return
+		}
+		s.revenue.set(totals)
+	})
+}
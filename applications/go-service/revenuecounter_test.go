@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRevenueCounter(t *testing.T) {
+	var c revenueCounter
+	if _, synced := c.snapshot(); synced {
+		t.Fatal("synced before the first load")
+	}
+	c.set(revenueTotals{
+		Transactions: 1, Revenue: 1000,
+		ByCurrency: []CurrencyStats{{Currency: "USD", Transactions: 1, Revenue: 1000, ReportingRevenue: 1000}},
+	})
+
+	c.add(TransactionResponse{Status: string(StatusCompleted), Currency: "EUR", ExchangeRate: 1.5, Total: 2000, Tip: 100})
+	c.add(TransactionResponse{Status: string(StatusCompleted), Currency: "USD", ExchangeRate: 1, Total: 500})
+	c.add(TransactionResponse{Status: string(StatusPending), Currency: "USD", ExchangeRate: 1, Total: 9900})
+
+	totals, synced := c.snapshot()
+	if !synced {
+		t.Fatal("not synced after set")
+	}
+	if totals.Transactions != 3 || totals.Revenue != 4500 || totals.Tips != 150 {
+		t.Errorf("totals = %+v, want 3 transactions, 45.00 revenue, 1.50 tips", totals)
+	}
+	want := []CurrencyStats{
+		{Currency: "EUR", Transactions: 1, Revenue: 2000, Tips: 100, ReportingRevenue: 3000},
+		{Currency: "USD", Transactions: 2, Revenue: 1500, ReportingRevenue: 1500},
+	}
+	if len(totals.ByCurrency) != len(want) {
+		t.Fatalf("by currency = %+v, want %+v", totals.ByCurrency, want)
+	}
+	for i := range want {
+		if totals.ByCurrency[i] != want[i] {
+			t.Errorf("by currency[%d] = %+v, want %+v", i, totals.ByCurrency[i], want[i])
+		}
+	}
+
+	totals.ByCurrency[0].Revenue = 0
+	if again, _ := c.snapshot(); again.ByCurrency[0].Revenue != 2000 {
+		t.Error("snapshot shares its slice with the counter")
+	}
+}
+
+func TestRevenueSeriesWaitForSync(t *testing.T) {
+	s := newMemoryServer()
+	s.db = nil
+	s.revenue = revenueCounter{}
+	if out := scrape(t, s); strings.Contains(out, "service_revenue_total") {
+		t.Errorf("revenue reported before the first sync:\n%s", out)
+	}
+}
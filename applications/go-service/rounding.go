@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// RoundingMode decides which way an exact half cent goes
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds halves away from zero (0.5 -> 1, -0.5 -> -1)
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundHalfEven is banker's rounding: halves go to the even cent
+	RoundHalfEven RoundingMode = "half_even"
+)
+
+// RoundingScope decides where tax is rounded to the cent
+type RoundingScope string
+
+const (
+	// RoundPerLine rounds each line's tax and sums the rounded amounts
+	RoundPerLine RoundingScope = "line"
+	// RoundPerTotal sums exact line taxes and rounds once for the
+	// transaction, then spreads the result back over the lines
+	RoundPerTotal RoundingScope = "total"
+)
+
+// Rounding is the strategy applied to computed tax and discount amounts. The
+// zero value is half-up, per line.
+type Rounding struct {
+	Mode  RoundingMode
+	Scope RoundingScope
+}
+
+func parseRounding(mode, scope string) (Rounding, error) {
+	r := Rounding{Mode: RoundHalfUp, Scope: RoundPerLine}
+	switch RoundingMode(mode) {
+	case "":
+	case RoundHalfUp, RoundHalfEven:
+		r.Mode = RoundingMode(mode)
+	default:
+		return Rounding{}, fmt.Errorf("unknown rounding mode %q", mode)
+	}
+	switch RoundingScope(scope) {
+	case "":
+	case RoundPerLine, RoundPerTotal:
+		r.Scope = RoundingScope(scope)
+	default:
+		return Rounding{}, fmt.Errorf("unknown rounding scope %q", scope)
+	}
+	return r, nil
+}
+
+func (r Rounding) perTotal() bool {
+	return r.Scope == RoundPerTotal
+}
+
+// String is the form recorded on transactions, e.g. "half_even/total"
+func (r Rounding) String() string {
+	mode, scope := r.Mode, r.Scope
+	if mode == "" {
+		mode = RoundHalfUp
+	}
+	if scope == "" {
+		scope = RoundPerLine
+	}
+	return string(mode) + "/" + string(scope)
+}
+
+// round converts an exact amount in cents to whole cents
+func (r Rounding) round(cents decimal.Decimal) Money {
+	if r.Mode == RoundHalfEven {
+		return Money(cents.RoundBank(0).IntPart())
+	}
+	return fromDecimal(cents)
+}
+
+// applyRate multiplies amount by rate and rounds the result
+func (r Rounding) applyRate(amount Money, rate float64) Money {
+	return r.round(amount.exactRate(rate))
+}
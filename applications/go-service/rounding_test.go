@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestRoundingModes(t *testing.T) {
+	halfUp := Rounding{Mode: RoundHalfUp}
+	halfEven := Rounding{Mode: RoundHalfEven}
+
+	tests := []struct {
+		name     string
+		amount   Money
+		rate     float64
+		up, even Money
+	}{
+		{"half rounds to even", 625, 0.1, 63, 62},
+		{"half already even", 635, 0.1, 64, 64},
+		{"below half", 1005, 0.08, 80, 80},
+		{"negative half", -625, 0.1, -63, -62},
+	}
+
+	for _, tt := range tests {
+		if got := halfUp.applyRate(tt.amount, tt.rate); got != tt.up {
+			t.Errorf("%s: half_up = %d, want %d", tt.name, got, tt.up)
+		}
+		if got := halfEven.applyRate(tt.amount, tt.rate); got != tt.even {
+			t.Errorf("%s: half_even = %d, want %d", tt.name, got, tt.even)
+		}
+	}
+}
+
+func TestParseRounding(t *testing.T) {
+	r, err := parseRounding("", "")
+	if err != nil || r.String() != "half_up/line" {
+		t.Errorf("default rounding = %v, %v", r, err)
+	}
+	r, err = parseRounding("half_even", "total")
+	if err != nil || r.String() != "half_even/total" {
+		t.Errorf("parseRounding = %v, %v", r, err)
+	}
+	if _, err := parseRounding("ceiling", ""); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if _, err := parseRounding("", "invoice"); err == nil {
+		t.Error("expected error for unknown scope")
+	}
+}
+
+func TestPerTotalRounding(t *testing.T) {
+	// Three lines each taxed 0.4 cents: per line rounds every one down to
+	// zero, per total rounds the 1.2 cent sum once
+	items := []Item{{Price: 5, Quantity: 1}, {Price: 5, Quantity: 1}, {Price: 5, Quantity: 1}}
+
+	perLine := TaxRules{Jurisdiction: flatJurisdiction(0.08)}
+	if result, _ := perLine.calculateItems(items, 15, 0, nil); result.Tax != 0 {
+		t.Errorf("per-line tax = %d, want 0", result.Tax)
+	}
+
+	perTotal := TaxRules{Jurisdiction: flatJurisdiction(0.08), Rounding: Rounding{Scope: RoundPerTotal}}
+	result, lines := perTotal.calculateItems(items, 15, 0, nil)
+	if result.Tax != 1 || result.Lines[0].Amount != 1 {
+		t.Errorf("per-total tax = %d (line %d), want 1", result.Tax, result.Lines[0].Amount)
+	}
+	var sum Money
+	for _, line := range lines {
+		sum += line.Tax
+	}
+	if sum != result.Tax {
+		t.Errorf("line taxes sum to %d, want %d", sum, result.Tax)
+	}
+}
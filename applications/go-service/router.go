@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiRoute is one endpoint within a versioned API
+type apiRoute struct {
+	// Method restricts the route to one HTTP method; empty matches any
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// Successor is the path of the replacement route in a newer API version,
+	// relative to the API root (e.g. "/v2/transactions/{id}"). Routes with a
+	// successor are answered with deprecation headers pointing at it.
+	Successor string
+	// Store routes keep working with memory storage, as they only touch the
+	// TransactionStore and the event stream it feeds; the rest need Postgres
+	Store bool
+	// Scope is what a caller must be granted when authentication is on.
+	// When empty, /admin routes need admin, GET routes reader, and the rest
+	// writer.
+	Scope string
+}
+
+func (r apiRoute) scope() string {
+	switch {
+	case r.Scope != "":
+		return r.Scope
+	case strings.HasPrefix(r.Path, "/admin/"):
+		return scopeAdmin
+	case r.Method == http.MethodGet:
+		return scopeReader
+	}
+	return scopeWriter
+}
+
+type apiVersion struct {
+	Prefix string
+	Routes []apiRoute
+	// Sunset is when deprecated routes in this version will be removed; zero
+	// when no date has been announced
+	Sunset time.Time
+}
+
+func (s *Server) apiVersions() []apiVersion {
+	versions := []apiVersion{
+		{
+			Prefix: "/api/v1",
+			Sunset: s.config.APIV1Sunset,
+			Routes: []apiRoute{
+				{Path: "/process-transaction", Handler: s.processTransactionHandler, Successor: "/v2/transactions", Store: true},
+				{Method: "POST", Path: "/process-transactions", Handler: s.processTransactionsHandler},
+				{Method: "GET", Path: "/transactions", Handler: s.listTransactionsHandler, Store: true},
+				{Method: "GET", Path: "/transactions/search", Handler: s.searchTransactionsHandler},
+				{Method: "GET", Path: "/transactions/{id}", Handler: s.getTransactionHandler, Successor: "/v2/transactions/{id}", Store: true},
+				{Method: "DELETE", Path: "/transactions/{id}", Handler: s.deleteTransactionHandler},
+				{Method: "GET", Path: "/transactions/{id}/receipt", Handler: s.receiptHandler},
+				{Method: "POST", Path: "/transactions/{id}/refund", Handler: s.refundTransactionHandler},
+				{Method: "POST", Path: "/transactions/{id}/capture", Handler: s.captureTransactionHandler},
+				{Method: "POST", Path: "/transactions/{id}/void", Handler: s.voidTransactionHandler},
+				{Method: "POST", Path: "/customers", Handler: s.createCustomerHandler},
+				{Method: "GET", Path: "/customers", Handler: s.listCustomersHandler},
+				{Method: "GET", Path: "/customers/{id}", Handler: s.getCustomerHandler},
+				{Method: "PATCH", Path: "/customers/{id}", Handler: s.updateCustomerHandler},
+				{Method: "GET", Path: "/customers/{id}/transactions", Handler: s.customerTransactionsHandler},
+				{Method: "GET", Path: "/customers/{id}/loyalty", Handler: s.customerLoyaltyHandler},
+				{Method: "POST", Path: "/admin/discount-codes", Handler: s.createDiscountCodeHandler},
+				{Method: "GET", Path: "/admin/discount-codes", Handler: s.listDiscountCodesHandler},
+				{Method: "GET", Path: "/admin/discount-codes/{code}", Handler: s.getDiscountCodeHandler},
+				{Method: "PATCH", Path: "/admin/discount-codes/{code}", Handler: s.updateDiscountCodeHandler},
+				{Method: "POST", Path: "/admin/transactions/{id}/restore", Handler: s.restoreTransactionHandler},
+				{Method: "GET", Path: "/admin/settings", Handler: s.listSettingsHandler},
+				{Method: "PUT", Path: "/admin/settings/{key}", Handler: s.putSettingHandler},
+				{Method: "DELETE", Path: "/admin/settings/{key}", Handler: s.deleteSettingHandler},
+				{Method: "POST", Path: "/admin/api-keys", Handler: s.createAPIKeyHandler},
+				{Method: "GET", Path: "/admin/api-keys", Handler: s.listAPIKeysHandler},
+				{Method: "DELETE", Path: "/admin/api-keys/{id}", Handler: s.revokeAPIKeyHandler},
+				{Method: "GET", Path: "/customer-tiers", Handler: s.listCustomerTiersHandler},
+				{Method: "PUT", Path: "/admin/customer-tiers/{tier}", Handler: s.putCustomerTierHandler},
+				{Method: "GET", Path: "/promotions", Handler: s.getPromotionsHandler},
+				{Method: "PUT", Path: "/admin/promotions", Handler: s.putPromotionsHandler},
+				{Method: "POST", Path: "/admin/promotions/reload", Handler: s.reloadPromotionsHandler},
+				{Method: "GET", Path: "/exchange-rates", Handler: s.listExchangeRatesHandler},
+				{Method: "PUT", Path: "/admin/exchange-rates/{currency}", Handler: s.putExchangeRateHandler},
+				{Method: "GET", Path: "/tax/jurisdictions", Handler: s.listTaxJurisdictionsHandler},
+				{Method: "GET", Path: "/products", Handler: s.listProductsHandler},
+				{Method: "GET", Path: "/products/{id}", Handler: s.getProductHandler},
+				{Method: "POST", Path: "/admin/products", Handler: s.createProductHandler},
+				{Method: "PATCH", Path: "/admin/products/{id}", Handler: s.updateProductHandler},
+				{Method: "GET", Path: "/inventory", Handler: s.listInventoryHandler},
+				{Method: "PUT", Path: "/admin/inventory/{product_id}", Handler: s.putInventoryHandler},
+				{Method: "GET", Path: "/jobs/{id}", Handler: s.getJobHandler},
+				{Method: "GET", Path: "/events/transactions", Handler: s.transactionEventsHandler, Store: true},
+				{Method: "GET", Path: "/reports/revenue-by-category", Handler: s.revenueByCategoryHandler},
+				{Method: "GET", Path: "/reports/top-products", Handler: s.topProductsHandler},
+				{Path: "/stats", Handler: s.statsHandler, Store: true, Scope: scopeReader},
+				{Method: "GET", Path: "/stats/timeseries", Handler: s.statsTimeseriesHandler},
+			},
+		},
+		{
+			Prefix: "/api/v2",
+			Routes: []apiRoute{
+				{Method: "POST", Path: "/transactions", Handler: s.v2CreateTransactionHandler, Store: true},
+				{Method: "GET", Path: "/transactions/{id}", Handler: s.v2GetTransactionHandler, Store: true},
+			},
+		},
+	}
+	if s.db == nil {
+		for _, version := range versions {
+			requireDatabase(version.Routes)
+		}
+	}
+	authenticated := s.auth != nil || s.apiKeys != nil
+	// Inside authentication, so the limiter sees who the caller authenticated
+	// as. Without authentication every caller is only an address, which the
+	// limit by IP below covers.
+	if s.limiter != nil && authenticated {
+		for _, version := range versions {
+			s.rateLimitRoutes(version.Routes, s.limiter, s.rateLimitKey)
+		}
+	}
+	if authenticated {
+		for _, version := range versions {
+			requireAuth(version.Routes, s.authenticate)
+		}
+	}
+	// Outside authentication, so a flood is refused before its API key is
+	// looked up in Postgres
+	if s.ipLimiter != nil {
+		for _, version := range versions {
+			s.rateLimitRoutes(version.Routes, s.ipLimiter, s.ipRateLimitKey)
+		}
+	}
+	return versions
+}
+
+// requireDatabase answers every route that isn't a Store route with 503, for
+// running on memory storage
+func requireDatabase(routes []apiRoute) {
+	for i := range routes {
+		if !routes[i].Store {
+			routes[i].Handler = databaseUnavailable
+		}
+	}
+}
+
+func databaseUnavailable(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "This endpoint requires a database", http.StatusServiceUnavailable)
+}
+
+// register mounts every route of the version on mux
+func (v apiVersion) register(mux *http.ServeMux) {
+	for _, route := range v.Routes {
+		pattern := v.Prefix + route.Path
+		if route.Method != "" {
+			pattern = route.Method + " " + pattern
+		}
+
+		handler := route.Handler
+		if route.Successor != "" {
+			handler = deprecated(route.Successor, v.Sunset, handler)
+		}
+		handle(mux, pattern, handler)
+	}
+}
+
+// deprecated marks responses with the Deprecation, Sunset, and successor Link
+// headers so clients can discover the replacement route.
+func deprecated(successor string, sunset time.Time, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Link", "</api"+expandPathValues(successor, r)+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// expandPathValues substitutes {name} segments in path with the values
+// matched for the current request.
+func expandPathValues(path string, r *http.Request) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			segments[i] = r.PathValue(name)
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecatedRouteHeaders(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	version := apiVersion{
+		Prefix: "/api/v1",
+		Sunset: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Routes: []apiRoute{
+			{Method: "GET", Path: "/transactions/{id}", Handler: ok, Successor: "/v2/transactions/{id}"},
+			{Method: "GET", Path: "/stats", Handler: ok},
+		},
+	}
+
+	mux := http.NewServeMux()
+	version.register(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/transactions/abc-123", nil))
+
+	if got := rr.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, want true", got)
+	}
+	if got, want := rr.Header().Get("Link"), `</api/v2/transactions/abc-123>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+	if got, want := rr.Header().Get("Sunset"), "Wed, 01 Jan 2025 00:00:00 GMT"; got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	if got := rr.Header().Get("Deprecation"); got != "" {
+		t.Errorf("route without successor got Deprecation = %q", got)
+	}
+}
+
+func TestV2CentsConversion(t *testing.T) {
+	req := V2TransactionRequest{Items: []V2Item{{ID: "sku-1", UnitPriceCents: 1999, Quantity: 3}}}
+	v1 := req.toV1()
+	if v1.Items[0].Price != 1999 {
+		t.Errorf("price = %v, want 19.99", v1.Items[0].Price)
+	}
+
+	response := v2TransactionFromV1(TransactionResponse{Items: v1.Items, Subtotal: 30, Total: 5997})
+	if response.SubtotalCents != 30 || response.TotalCents != 5997 || response.Items[0].UnitPriceCents != 1999 {
+		t.Errorf("unexpected cents conversion: %+v", response)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const maxSearchOffset = 10000
+
+// searchSortColumns whitelists the columns results can be ordered by
+var searchSortColumns = map[string]string{
+	"created_at": "created_at",
+	"total":      "total",
+}
+
+type TransactionSearchResponse struct {
+	Transactions []TransactionSummary `json:"transactions"`
+	Limit        int                  `json:"limit"`
+	Offset       int                  `json:"offset"`
+	NextOffset   *int                 `json:"next_offset,omitempty"`
+}
+
+type searchParams struct {
+	filter transactionFilter
+	sort   string
+	order  string
+	limit  int
+	offset int
+}
+
+func parseOptionalAmount(query url.Values, key string) (*Money, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := parseMoney(value)
+	if err != nil || amount < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number", key)
+	}
+	return &amount, nil
+}
+
+func parseSearchParams(query url.Values) (searchParams, error) {
+	params := searchParams{sort: "created_at", order: "desc"}
+
+	var err error
+	if params.limit, err = parseListLimit(query.Get("limit")); err != nil {
+		return searchParams{}, err
+	}
+
+	if value := query.Get("offset"); value != "" {
+		params.offset, err = strconv.Atoi(value)
+		if err != nil || params.offset < 0 || params.offset > maxSearchOffset {
+			return searchParams{}, fmt.Errorf("offset must be between 0 and %d", maxSearchOffset)
+		}
+	}
+
+	if value := query.Get("customer_id"); value != "" {
+		customerID, err := uuid.Parse(value)
+		if err != nil {
+			return searchParams{}, errors.New("customer_id must be a valid UUID")
+		}
+		params.filter.CustomerID = &customerID
+	}
+
+	if params.filter.From, params.filter.To, err = parseTimeRange(query); err != nil {
+		return searchParams{}, err
+	}
+	if params.filter.MinTotal, err = parseOptionalAmount(query, "min_total"); err != nil {
+		return searchParams{}, err
+	}
+	if params.filter.MaxTotal, err = parseOptionalAmount(query, "max_total"); err != nil {
+		return searchParams{}, err
+	}
+	if params.filter.MinTotal != nil && params.filter.MaxTotal != nil && *params.filter.MinTotal > *params.filter.MaxTotal {
+		return searchParams{}, errors.New("min_total must not exceed max_total")
+	}
+
+	params.filter.DiscountCode = query.Get("discount_code")
+	params.filter.Notes = query.Get("notes")
+
+	// metadata.<key>=<value> filters on string values in the metadata
+	for key, values := range query {
+		name, ok := strings.CutPrefix(key, "metadata.")
+		if !ok {
+			continue
+		}
+		if name == "" {
+			return searchParams{}, errors.New("metadata filters must name a key, e.g. metadata.store=berlin")
+		}
+		if params.filter.Metadata == nil {
+			params.filter.Metadata = map[string]string{}
+		}
+		params.filter.Metadata[name] = values[0]
+	}
+
+	if value := query.Get("status"); value != "" {
+		if !TransactionStatus(value).valid() {
+			return searchParams{}, fmt.Errorf("unknown status %q", value)
+		}
+		params.filter.Status = value
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if _, ok := searchSortColumns[value]; !ok {
+			return searchParams{}, errors.New("sort must be created_at or total")
+		}
+		params.sort = value
+	}
+	if value := query.Get("order"); value != "" {
+		if value != "asc" && value != "desc" {
+			return searchParams{}, errors.New("order must be asc or desc")
+		}
+		params.order = value
+	}
+
+	return params, nil
+}
+
+// searchTransactionsHandler lets operators find orders by customer, total
+// range, discount code, status, and date range without database access.
+func (s *Server) searchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Report)
+	defer cancel()
+
+	var qb queryBuilder
+	params.filter.apply(&qb)
+
+	// id breaks ties so pages stay stable when sort values repeat
+	orderBy := fmt.Sprintf("%s %s, id %s", searchSortColumns[params.sort], params.order, params.order)
+	sql := `SELECT ` + transactionSummaryColumns + ` FROM transactions` + qb.whereClause() +
+		` ORDER BY ` + orderBy + ` LIMIT ` + qb.arg(params.limit+1) + ` OFFSET ` + qb.arg(params.offset)
+
+	rows, err := s.readQuery(ctx, sql, qb.args...)
+	if err != nil {
+		http.Error(w, "Failed to search transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := TransactionSearchResponse{
+		Transactions: []TransactionSummary{},
+		Limit:        params.limit,
+		Offset:       params.offset,
+	}
+	for rows.Next() {
+		summary, _, err := scanTransactionSummary(rows)
+		if err != nil {
+			http.Error(w, "Failed to search transactions", http.StatusInternalServerError)
+			return
+		}
+		if len(response.Transactions) == params.limit {
+			next := params.offset + params.limit
+			response.NextOffset = &next
+			break
+		}
+		response.Transactions = append(response.Transactions, summary)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to search transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSearchParams(t *testing.T) {
+	params, err := parseSearchParams(url.Values{
+		"min_total":     {"10"},
+		"max_total":     {"250.50"},
+		"discount_code": {"save10"},
+		"status":        {"refunded"},
+		"sort":          {"total"},
+		"order":         {"asc"},
+		"offset":        {"50"},
+	})
+	if err != nil {
+		t.Fatalf("parseSearchParams returned error: %v", err)
+	}
+
+	if *params.filter.MinTotal != 1000 || *params.filter.MaxTotal != 25050 {
+		t.Errorf("unexpected total range: %v..%v", *params.filter.MinTotal, *params.filter.MaxTotal)
+	}
+	if params.sort != "total" || params.order != "asc" || params.offset != 50 || params.limit != defaultListLimit {
+		t.Errorf("unexpected paging/sort: %+v", params)
+	}
+
+	var qb queryBuilder
+	params.filter.apply(&qb)
+	want := " WHERE deleted_at IS NULL AND total >= $1 AND total <= $2 AND discount_codes @> ARRAY[$3]::text[] AND status = $4"
+	if got := qb.whereClause(); got != want {
+		t.Errorf("whereClause = %q, want %q", got, want)
+	}
+	if qb.args[2] != "SAVE10" {
+		t.Errorf("discount code arg = %v, want SAVE10", qb.args[2])
+	}
+}
+
+func TestParseSearchParamsRejectsInvalid(t *testing.T) {
+	invalid := []url.Values{
+		{"customer_id": {"not-a-uuid"}},
+		{"min_total": {"-1"}},
+		{"min_total": {"20"}, "max_total": {"10"}},
+		{"sort": {"customer_id"}},
+		{"order": {"sideways"}},
+		{"status": {"shipped"}},
+		{"offset": {"-5"}},
+	}
+
+	for _, query := range invalid {
+		if _, err := parseSearchParams(query); err == nil {
+			t.Errorf("parseSearchParams(%v) expected error", query)
+		}
+	}
+}
+
+func TestParseSearchParamsMetadataAndNotes(t *testing.T) {
+	params, err := parseSearchParams(url.Values{
+		"metadata.store": {"berlin"},
+		"notes":          {"50% off_gift"},
+	})
+	if err != nil {
+		t.Fatalf("parseSearchParams returned error: %v", err)
+	}
+
+	var qb queryBuilder
+	params.filter.apply(&qb)
+	want := " WHERE deleted_at IS NULL AND metadata @> $1::jsonb AND notes ILIKE $2"
+	if got := qb.whereClause(); got != want {
+		t.Errorf("whereClause = %q, want %q", got, want)
+	}
+	if qb.args[0] != `{"store":"berlin"}` {
+		t.Errorf("metadata arg = %v", qb.args[0])
+	}
+	if qb.args[1] != `%50\% off\_gift%` {
+		t.Errorf("notes arg = %v, want wildcards escaped", qb.args[1])
+	}
+
+	if _, err := parseSearchParams(url.Values{"metadata.": {"x"}}); err == nil {
+		t.Error("metadata filter without a key should be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const settingTaxRate = "tax_rate"
+
+// settingValidators lists the keys that may be overridden at runtime and
+// checks each value before it is stored.
+var settingValidators = map[string]func(string) error{
+	settingTaxRate: func(value string) error {
+		_, err := parseTaxRate(value)
+		return err
+	},
+}
+
+type Setting struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type SettingListResponse struct {
+	Settings []Setting `json:"settings"`
+}
+
+type UpdateSettingRequest struct {
+	Value string `json:"value"`
+}
+
+// parseTaxRate accepts a fraction such as 0.0725 for 7.25%
+func parseTaxRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate >= 1 {
+		return 0, fmt.Errorf("tax rate must be a fraction between 0 and 1, got %q", value)
+	}
+	return rate, nil
+}
+
+// effectiveTaxRate returns the tax_rate override from the settings table,
+// or fallback (TAX_RATE) when none is set.
+func effectiveTaxRate(ctx context.Context, q querier, fallback float64) (float64, error) {
+	var value string
+	err := q.QueryRow(ctx, `SELECT value FROM settings WHERE key = $1`, settingTaxRate).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fallback, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query tax rate setting: %w", err)
+	}
+	return parseTaxRate(value)
+}
+
+func scanSetting(row pgx.Row) (Setting, error) {
+	var (
+		setting   Setting
+		updatedAt time.Time
+	)
+	if err := row.Scan(&setting.Key, &setting.Value, &updatedAt); err != nil {
+		return Setting{}, err
+	}
+	setting.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return setting, nil
+}
+
+func (s *Server) listSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT key, value, updated_at FROM settings ORDER BY key`)
+	if err != nil {
+		http.Error(w, "Failed to fetch settings", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := SettingListResponse{Settings: []Setting{}}
+	for rows.Next() {
+		setting, err := scanSetting(rows)
+		if err != nil {
+			http.Error(w, "Failed to read settings", http.StatusInternalServerError)
+			return
+		}
+		response.Settings = append(response.Settings, setting)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) putSettingHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	validate, ok := settingValidators[key]
+	if !ok {
+		http.Error(w, "Unknown setting", http.StatusNotFound)
+		return
+	}
+
+	var req UpdateSettingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate(req.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	setting, err := scanSetting(s.db.QueryRow(ctx, `
+		INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+		RETURNING key, value, updated_at
+	`, key, req.Value))
+	if err != nil {
+		http.Error(w, "Failed to save setting", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(setting)
+}
+
+// deleteSettingHandler drops an override so the environment default applies again
+func (s *Server) deleteSettingHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if _, ok := settingValidators[key]; !ok {
+		http.Error(w, "Unknown setting", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM settings WHERE key = $1`, key); err != nil {
+		http.Error(w, "Failed to delete setting", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
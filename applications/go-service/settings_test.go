@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestParseTaxRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"0.08", 0.08, false},
+		{"0", 0, false},
+		{"0.0725", 0.0725, false},
+		{"8", 0, true},
+		{"-0.01", 0, true},
+		{"eight", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTaxRate(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTaxRate(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "os"
+
+// Shipping strategies selectable with SHIPPING_STRATEGY
+const (
+	ShippingNone        = "none"
+	ShippingFlat        = "flat"
+	ShippingWeight      = "weight"
+	ShippingFreeOverMin = "free_over_threshold"
+)
+
+// ShippingConfig selects how the shipping line of a transaction is priced.
+// FlatRate is the whole charge for flat and free_over_threshold, and the base
+// charge for weight, which adds PerKg for every kilogram of item weight.
+type ShippingConfig struct {
+	Strategy      string
+	FlatRate      Money
+	PerKg         Money
+	FreeThreshold Money
+}
+
+func loadShippingConfig() ShippingConfig {
+	cfg := ShippingConfig{
+		Strategy:      ShippingNone,
+		FlatRate:      500,
+		PerKg:         100,
+		FreeThreshold: 5000,
+	}
+
+	switch val := os.Getenv("SHIPPING_STRATEGY"); val {
+	case ShippingFlat, ShippingWeight, ShippingFreeOverMin:
+		cfg.Strategy = val
+	}
+
+	for env, field := range map[string]*Money{
+		"SHIPPING_FLAT_RATE":      &cfg.FlatRate,
+		"SHIPPING_PER_KG":         &cfg.PerKg,
+		"SHIPPING_FREE_THRESHOLD": &cfg.FreeThreshold,
+	} {
+		if val := os.Getenv(env); val != "" {
+			if parsed, err := parseMoney(val); err == nil && parsed >= 0 {
+				*field = parsed
+			}
+		}
+	}
+
+	return cfg
+}
+
+// calculateShipping prices the shipping line for items. subtotal is the
+// discounted merchandise total, which is what free_over_threshold compares
+// against.
+func calculateShipping(cfg ShippingConfig, subtotal Money, items []Item) Money {
+	switch cfg.Strategy {
+	case ShippingFlat:
+		return cfg.FlatRate
+	case ShippingWeight:
+		var weight float64
+		for _, item := range items {
+			if item.Quantity > 0 && item.Weight > 0 {
+				weight += item.Weight * float64(item.Quantity)
+			}
+		}
+		return cfg.FlatRate + cfg.PerKg.MulRate(weight)
+	case ShippingFreeOverMin:
+		if subtotal >= cfg.FreeThreshold {
+			return 0
+		}
+		return cfg.FlatRate
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestCalculateShipping(t *testing.T) {
+	items := []Item{
+		{ID: "a", Price: 1000, Quantity: 2, Weight: 1.5},
+		{ID: "b", Price: 500, Quantity: 1},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      ShippingConfig
+		subtotal Money
+		want     Money
+	}{
+		{"none", ShippingConfig{Strategy: ShippingNone, FlatRate: 500}, 2500, 0},
+		{"flat", ShippingConfig{Strategy: ShippingFlat, FlatRate: 500}, 2500, 500},
+		{"weight", ShippingConfig{Strategy: ShippingWeight, FlatRate: 200, PerKg: 125}, 2500, 575},
+		{"below threshold", ShippingConfig{Strategy: ShippingFreeOverMin, FlatRate: 500, FreeThreshold: 5000}, 2500, 500},
+		{"at threshold", ShippingConfig{Strategy: ShippingFreeOverMin, FlatRate: 500, FreeThreshold: 5000}, 5000, 0},
+	}
+
+	for _, tt := range tests {
+		if got := calculateShipping(tt.cfg, tt.subtotal, items); got != tt.want {
+			t.Errorf("%s: calculateShipping = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
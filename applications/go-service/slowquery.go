@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowQueryLog is a pgx tracer that logs queries taking longer than
+// threshold and counts them by queryName
+type slowQueryLog struct {
+	threshold time.Duration
+	counts    *prometheus.CounterVec
+}
+
+// newSlowQueryLog returns nil, for no tracing at all, when threshold is 0
+func newSlowQueryLog(threshold time.Duration) *slowQueryLog {
+	if threshold <= 0 {
+		return nil
+	}
+	return &slowQueryLog{threshold: threshold, counts: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slow_queries_total",
+		Help: "Queries slower than SLOW_QUERY_THRESHOLD, by query",
+	}, []string{"query"})}
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	at    time.Time
+	sql   string
+	nargs int
+}
+
+func (l *slowQueryLog) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{at: time.Now(), sql: data.SQL, nargs: len(data.Args)})
+}
+
+// TraceQueryEnd logs the argument count rather than the arguments, which can
+// hold customer details
+func (l *slowQueryLog) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start.at)
+	if elapsed < l.threshold {
+		// Every query is logged at debug, for following a request's
+		// queries during an incident
+		if slog.Default().Enabled(ctx, slog.LevelDebug) {
+			slog.DebugContext(ctx, "query", "query", queryName(start.sql), "duration", elapsed, "args", start.nargs)
+		}
+		return
+	}
+	name := queryName(start.sql)
+
+	l.counts.WithLabelValues(name).Inc()
+
+	outcome := "ok"
+	if data.Err != nil {
+		outcome = data.Err.Error()
+	}
+	slog.WarnContext(ctx, "slow query", "query", name, "duration", elapsed, "args", start.nargs, "outcome", outcome, "sql", normalizeSQL(start.sql))
+}
+
+var (
+	sqlcName    = regexp.MustCompile(`^\s*-- name: (\w+)`)
+	sqlComment  = regexp.MustCompile(`--[^\n]*`)
+	sqlSpace    = regexp.MustCompile(`\s+`)
+	sqlRelation = regexp.MustCompile(`(?i)\b(?:from|into|update|join)\s+([a-z_][a-z0-9_.]*)`)
+)
+
+// queryName labels a query for slow_queries_total: the sqlc name when it
+// has one, and otherwise its statement and first table, like
+// "select transactions". Both come from the source rather than the
+// arguments, so the label set is bounded by the code.
+func queryName(sql string) string {
+	if m := sqlcName.FindStringSubmatch(sql); m != nil {
+		return m[1]
+	}
+	normalized := normalizeSQL(sql)
+	fields := strings.Fields(normalized)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	name := strings.ToLower(fields[0])
+	if m := sqlRelation.FindStringSubmatch(normalized); m != nil {
+		name += " " + strings.ToLower(m[1])
+	}
+	return name
+}
+
+// normalizeSQL strips comments and collapses whitespace so a query logs on
+// one line
+func normalizeSQL(sql string) string {
+	return strings.TrimSpace(sqlSpace.ReplaceAllString(sqlComment.ReplaceAllString(sql, " "), " "))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{revenueTotalsByCurrency, "RevenueTotalsByCurrency"},
+		{"\n\t\tSELECT id, payload FROM outbox WHERE processed_at IS NULL", "select outbox"},
+		{"INSERT INTO outbox (event_type) VALUES ($1)", "insert outbox"},
+		{"UPDATE public.transactions SET status = $2 WHERE id = $1", "update public.transactions"},
+		{"-- from the cache\nSELECT 1", "select"},
+		{"begin", "begin"},
+		{"  ", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := queryName(tt.sql); got != tt.want {
+			t.Errorf("queryName(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	got := normalizeSQL("-- name: X :one\nSELECT a,\n\t\tb  FROM t -- trailing\nWHERE id = $1\n")
+	if want := "SELECT a, b FROM t WHERE id = $1"; got != want {
+		t.Errorf("normalizeSQL = %q, want %q", got, want)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	if newSlowQueryLog(0) != nil {
+		t.Error("a zero threshold should turn tracing off")
+	}
+
+	l := newSlowQueryLog(time.Nanosecond)
+	for _, sql := range []string{"SELECT 1 FROM outbox", "SELECT 2 FROM outbox", "DELETE FROM outbox"} {
+		ctx := l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{1}})
+		time.Sleep(time.Millisecond)
+		l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	}
+	fast := newSlowQueryLog(time.Hour)
+	fast.TraceQueryEnd(fast.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"}), nil, pgx.TraceQueryEndData{})
+	if n := testutil.CollectAndCount(fast.counts); n != 0 {
+		t.Errorf("fast query counted: %d series", n)
+	}
+
+	for name, want := range map[string]float64{"delete outbox": 1, "select outbox": 2} {
+		if got := testutil.ToFloat64(l.counts.WithLabelValues(name)); got != want {
+			t.Errorf("slow_queries_total{query=%q} = %v, want %v", name, got, want)
+		}
+	}
+}
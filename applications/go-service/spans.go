@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the service's own spans. It goes through the global
+// provider, so until initTracing succeeds its spans are no-ops.
+var tracer = otel.Tracer("github.com/david-vizena/sre-devops_github/applications/go-service")
+
+// requestAttributes describes a transaction request before it is priced.
+// The customer ID is hashed, so traces can be grouped by customer without
+// the collector storing who they are.
+func requestAttributes(req TransactionRequest) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int("transaction.item_count", len(req.Items)),
+	}
+	if req.CustomerID != "" {
+		attrs = append(attrs, attribute.String("customer.id_hash", hashCustomerID(req.CustomerID)))
+	}
+	if codes := submittedDiscountCodes(req.DiscountCode, req.DiscountCodes); len(codes) > 0 {
+		attrs = append(attrs, attribute.StringSlice("transaction.discount_codes", codes))
+	}
+	return attrs
+}
+
+// spanEvent marks the end of a processing step on ctx's span. The gaps
+// between the events on a slow transaction's span show which step took
+// the time; queries within a step also get their own child spans.
+func spanEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+// hashCustomerID is the first 16 hex digits of the ID's SHA-256, enough to
+// tell customers apart in a trace search
+func hashCustomerID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// endTransactionSpan records the outcome of persisting a transaction on
+// span: its status and total when it was created, or the client-facing
+// reason, with the full cause as an exception event, when it wasn't. The
+// ID is set as soon as it is assigned, so failures late in processing
+// carry it too.
+func endTransactionSpan(span trace.Span, response TransactionResponse, err error) {
+	if err != nil {
+		status, message := errorStatus(err)
+		span.SetAttributes(attribute.Int("transaction.failure_status", status))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, message)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("transaction.status", response.Status),
+		attribute.String("transaction.currency", response.Currency),
+		attribute.Float64("transaction.total", moneyValue(response.Total)),
+	)
+}
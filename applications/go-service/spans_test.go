@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestRequestAttributes(t *testing.T) {
+	req := TransactionRequest{
+		CustomerID:    "6f1c2a4e-8b0d-4c3e-9f7a-1b2c3d4e5f60",
+		Items:         []Item{{ID: "p1", Quantity: 2}, {ID: "p2", Quantity: 1}},
+		DiscountCode:  "save10",
+		DiscountCodes: []string{"SAVE10", "VIP"},
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range requestAttributes(req) {
+		attrs[kv.Key] = kv.Value
+	}
+
+	if got := attrs["transaction.item_count"].AsInt64(); got != 2 {
+		t.Errorf("item_count = %d, want 2", got)
+	}
+	hash := attrs["customer.id_hash"].AsString()
+	if len(hash) != 16 || hash == req.CustomerID || hash != hashCustomerID(req.CustomerID) {
+		t.Errorf("customer.id_hash = %q, want 16 hex digits of the hash", hash)
+	}
+	if got := attrs["transaction.discount_codes"].AsStringSlice(); len(got) != 2 || got[0] != "SAVE10" || got[1] != "VIP" {
+		t.Errorf("discount_codes = %v, want [SAVE10 VIP]", got)
+	}
+
+	anonymous := requestAttributes(TransactionRequest{Items: []Item{{ID: "p1"}}})
+	if len(anonymous) != 1 {
+		t.Errorf("attributes without customer or codes = %v, want only the item count", anonymous)
+	}
+}
+
+func TestEndTransactionSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, created := tp.Tracer("test").Start(context.Background(), "persist transaction")
+	endTransactionSpan(created, TransactionResponse{Status: string(StatusCompleted), Currency: "EUR", Total: 1250}, nil)
+	created.End()
+
+	_, failed := tp.Tracer("test").Start(context.Background(), "persist transaction")
+	endTransactionSpan(failed, TransactionResponse{}, clientError(http.StatusUnprocessableEntity, "Unknown region XX"))
+	failed.End()
+
+	_, crashed := tp.Tracer("test").Start(context.Background(), "persist transaction")
+	endTransactionSpan(crashed, TransactionResponse{}, serverError("Failed to persist transaction", errors.New("connection reset")))
+	crashed.End()
+
+	spans := recorder.Ended()
+	ok := spanAttributes(spans[0])
+	if spans[0].Status().Code == codes.Error || ok["transaction.total"].AsFloat64() != 12.5 || ok["transaction.currency"].AsString() != "EUR" {
+		t.Errorf("created span: status %v, attributes %v", spans[0].Status(), ok)
+	}
+
+	tests := []struct {
+		span    sdktrace.ReadOnlySpan
+		message string
+		status  int64
+	}{
+		{spans[1], "Unknown region XX", http.StatusUnprocessableEntity},
+		{spans[2], "Failed to persist transaction", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if tt.span.Status().Code != codes.Error || tt.span.Status().Description != tt.message {
+			t.Errorf("status = %+v, want error %q", tt.span.Status(), tt.message)
+		}
+		if got := spanAttributes(tt.span)["transaction.failure_status"].AsInt64(); got != tt.status {
+			t.Errorf("failure_status = %d, want %d", got, tt.status)
+		}
+		if events := tt.span.Events(); len(events) != 1 || events[0].Name != "exception" {
+			t.Errorf("events = %v, want the recorded error", events)
+		}
+	}
+}
+
+func TestSpanEvent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "persist transaction")
+	spanEvent(ctx, "subtotal calculated", attribute.Float64("transaction.subtotal", 12.5))
+	spanEvent(ctx, "stock held")
+	span.End()
+	// Without a span, as in a test or untraced worker, it does nothing
+	spanEvent(context.Background(), "stock held")
+
+	events := recorder.Ended()[0].Events()
+	if len(events) != 2 || events[0].Name != "subtotal calculated" || events[1].Name != "stock held" {
+		t.Fatalf("events = %v, want subtotal calculated then stock held", events)
+	}
+	if len(events[0].Attributes) != 1 || events[0].Attributes[0].Value.AsFloat64() != 12.5 {
+		t.Errorf("subtotal event attributes = %v", events[0].Attributes)
+	}
+}
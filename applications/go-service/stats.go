@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const maxTimeseriesBuckets = 1000
+
+// timeseriesGranularities maps the accepted granularity values to their bucket
+// width and the window used when the caller gives no explicit range.
+var timeseriesGranularities = map[string]struct {
+	step          time.Duration
+	defaultWindow time.Duration
+}{
+	"hour": {step: time.Hour, defaultWindow: 24 * time.Hour},
+	"day":  {step: 24 * time.Hour, defaultWindow: 30 * 24 * time.Hour},
+}
+
+type TimeseriesPoint struct {
+	Timestamp    string `json:"timestamp"`
+	Transactions int64  `json:"transactions"`
+	Revenue      Money  `json:"revenue"`
+}
+
+type TimeseriesResponse struct {
+	Granularity string            `json:"granularity"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Points      []TimeseriesPoint `json:"points"`
+}
+
+// statsTimeseriesHandler buckets transaction counts and net revenue by hour or
+// day. Empty buckets are returned as zeros so charts don't interpolate gaps.
+// Daily buckets the daily_revenue view covers are read from it.
+func (s *Server) statsTimeseriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "hour"
+	}
+	spec, ok := timeseriesGranularities[granularity]
+	if !ok {
+		http.Error(w, "granularity must be hour or day", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now().UTC()
+	if to != nil {
+		end = to.UTC()
+	}
+	start := end.Add(-spec.defaultWindow)
+	if from != nil {
+		start = from.UTC()
+	}
+	start = start.Truncate(spec.step)
+
+	if buckets := end.Sub(start) / spec.step; buckets > maxTimeseriesBuckets {
+		http.Error(w, fmt.Sprintf("range covers %d buckets, maximum is %d", buckets, maxTimeseriesBuckets), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Report)
+	defer cancel()
+
+	var coveredUntil time.Time
+	if granularity == "day" {
+		coveredUntil, err = s.reportCoverage(ctx, viewDailyRevenue)
+		if err != nil {
+			http.Error(w, "Failed to fetch timeseries", http.StatusInternalServerError)
+			return
+		}
+	}
+	split := splitReportRange(&start, &end, coveredUntil)
+	args := []any{granularity, start, end}
+	rows, err := s.readQuery(ctx, `
+		WITH buckets AS (
+			SELECT generate_series(
+				date_trunc($1, $2::timestamptz AT TIME ZONE 'UTC'),
+				date_trunc($1, $3::timestamptz AT TIME ZONE 'UTC'),
+				('1 ' || $1)::interval
+			) AS bucket
+		),
+		totals AS (
+			SELECT day AT TIME ZONE 'UTC' AS bucket, transactions, revenue
+			FROM `+viewDailyRevenue+`
+			WHERE `+split.viewCondition(&args)+`
+			UNION ALL
+			SELECT date_trunc($1, created_at AT TIME ZONE 'UTC'),
+				COUNT(*),
+				SUM((total - refunded_amount) * exchange_rate)
+			FROM transactions
+			WHERE `+revenueStatusFilter+`
+				AND deleted_at IS NULL
+				AND `+split.liveCondition("created_at", &args)+`
+			GROUP BY 1
+		)
+		SELECT b.bucket, COALESCE(SUM(t.transactions), 0)::bigint, COALESCE(SUM(t.revenue), 0)
+		FROM buckets b
+		LEFT JOIN totals t ON t.bucket = b.bucket
+		WHERE b.bucket < $3::timestamptz AT TIME ZONE 'UTC'
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch timeseries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := TimeseriesResponse{
+		Granularity: granularity,
+		From:        start.Format(time.RFC3339),
+		To:          end.Format(time.RFC3339),
+		Points:      []TimeseriesPoint{},
+	}
+	for rows.Next() {
+		var (
+			bucket time.Time
+			point  TimeseriesPoint
+		)
+		if err := rows.Scan(&bucket, &point.Transactions, &point.Revenue); err != nil {
+			http.Error(w, "Failed to fetch timeseries", http.StatusInternalServerError)
+			return
+		}
+		point.Timestamp = bucket.Format(time.RFC3339)
+		response.Points = append(response.Points, point)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch timeseries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// CurrencyStats totals one booking currency: Revenue, Refunded, and Tips in
+// that currency, and ReportingRevenue converted at each transaction's rate.
+type CurrencyStats struct {
+	Currency         string `json:"currency"`
+	Transactions     int64  `json:"transactions"`
+	Revenue          Money  `json:"revenue"`
+	Refunded         Money  `json:"refunded"`
+	Tips             Money  `json:"tips"`
+	ReportingRevenue Money  `json:"reporting_revenue"`
+}
+
+// revenueTotals aggregates revenue-counting transactions per currency, and
+// across all currencies in the reporting currency.
+type revenueTotals struct {
+	Transactions int64
+	Revenue      Money
+	Refunded     Money
+	Tips         Money
+	ByCurrency   []CurrencyStats
+}
+
+func (s *Server) loadRevenueTotals(ctx context.Context) (revenueTotals, error) {
+	rows, err := New(replicaDB{s}).RevenueTotalsByCurrency(ctx)
+	if err != nil {
+		return revenueTotals{}, fmt.Errorf("query revenue totals: %w", err)
+	}
+
+	totals := revenueTotals{ByCurrency: []CurrencyStats{}}
+	for _, row := range rows {
+		totals.Transactions += row.Transactions
+		totals.Revenue += row.ReportingRevenue
+		totals.Refunded += row.ReportingRefunded
+		totals.Tips += row.ReportingTips
+		totals.ByCurrency = append(totals.ByCurrency, CurrencyStats{
+			Currency:         row.Currency,
+			Transactions:     row.Transactions,
+			Revenue:          row.Revenue,
+			Refunded:         row.Refunded,
+			Tips:             row.Tips,
+			ReportingRevenue: row.ReportingRevenue,
+		})
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// The summary triggers can't reference revenueStatusFilter, so keep the two
+// in step
+func TestRevenueSummaryStatuses(t *testing.T) {
+	sql, err := migrationFiles.ReadFile("migrations/036_transactions_summary.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(sql), "SELECT "+revenueStatusFilter+" AND deleted_at IS NULL\n") {
+		t.Errorf("transaction_counts_as_revenue in migration 036 does not match %s", revenueStatusFilter)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDConfig is where METRICS_BACKEND=statsd sends metrics: STATSD_ADDR,
+// or port 8125 on DD_AGENT_HOST, the node's Datadog agent, when that is set
+// instead. Interval is STATSD_FLUSH_INTERVAL.
+type StatsDConfig struct {
+	Addr     string
+	Interval time.Duration
+}
+
+func loadStatsDConfig() StatsDConfig {
+	cfg := StatsDConfig{Addr: "127.0.0.1:8125", Interval: 10 * time.Second}
+	if host := os.Getenv("DD_AGENT_HOST"); host != "" {
+		cfg.Addr = net.JoinHostPort(host, "8125")
+	}
+	if val := os.Getenv("STATSD_ADDR"); val != "" {
+		cfg.Addr = val
+	}
+	if val := os.Getenv("STATSD_FLUSH_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.Interval = parsed
+		}
+	}
+	return cfg
+}
+
+// statsdMaxPacket keeps each datagram within one Ethernet frame, as the
+// Datadog agent recommends
+const statsdMaxPacket = 1432
+
+// statsdSink writes the registry in the DogStatsD format, labels becoming
+// tags, and times each request as it finishes. Counters are sent as the
+// increase since the last flush, gauges as their value, and histograms and
+// summaries as the increase in their _count and _sum; request durations go
+// as timers instead, so the agent computes the percentiles. UDP sends
+// don't wait for the agent, and are lost while it is down.
+type statsdSink struct {
+	conn     net.Conn
+	gatherer prometheus.Gatherer
+	// tags go on the timers, which don't pass through the registry's
+	// constant labels
+	tags []string
+
+	mu sync.Mutex
+	// sent is each counter series' value at the last flush
+	sent map[string]float64
+}
+
+func newStatsDSink(addr string, gatherer prometheus.Gatherer, serviceName string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{
+		conn:     conn,
+		gatherer: gatherer,
+		tags:     []string{statsdTag("service", serviceName)},
+		sent:     map[string]float64{},
+	}, nil
+}
+
+// timing sends one timer sample
+func (s *statsdSink) timing(name string, d time.Duration, tags ...string) {
+	line := name + ":" + strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64) + "|ms" +
+		statsdTags(append(append([]string{}, tags...), s.tags...))
+	s.write([]string{line})
+}
+
+// flush sends every series the registry gathers
+func (s *statsdSink) flush() {
+	families, err := s.gatherer.Gather()
+	if err != nil {
+		slog.Warn("failed to gather metrics for StatsD", "error", err)
+	}
+	s.mu.Lock()
+	var lines []string
+	for _, family := range families {
+		lines = append(lines, s.familyLines(family)...)
+	}
+	s.mu.Unlock()
+	s.write(lines)
+}
+
+func (s *statsdSink) familyLines(family *dto.MetricFamily) []string {
+	var lines []string
+	name := family.GetName()
+	for _, metric := range family.GetMetric() {
+		tags := metricTags(metric)
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			lines = append(lines, s.counterLine(name, metric.GetCounter().GetValue(), tags)...)
+		case dto.MetricType_GAUGE:
+			lines = append(lines, gaugeLine(name, metric.GetGauge().GetValue(), tags))
+		case dto.MetricType_UNTYPED:
+			lines = append(lines, gaugeLine(name, metric.GetUntyped().GetValue(), tags))
+		case dto.MetricType_HISTOGRAM:
+			h := metric.GetHistogram()
+			lines = append(lines, s.counterLine(name+"_count", float64(h.GetSampleCount()), tags)...)
+			lines = append(lines, s.counterLine(name+"_sum", h.GetSampleSum(), tags)...)
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			lines = append(lines, s.counterLine(name+"_count", float64(summary.GetSampleCount()), tags)...)
+			lines = append(lines, s.counterLine(name+"_sum", summary.GetSampleSum(), tags)...)
+		}
+	}
+	return lines
+}
+
+// counterLine sends the increase in a cumulative value since the last
+// flush, nothing when it hasn't moved
+func (s *statsdSink) counterLine(name string, value float64, tags string) []string {
+	key := name + tags
+	delta := value - s.sent[key]
+	s.sent[key] = value
+	if delta == 0 {
+		return nil
+	}
+	if delta < 0 {
+		// The series went back down, so it was reset; send all of it
+		delta = value
+	}
+	return []string{name + ":" + strconv.FormatFloat(delta, 'f', -1, 64) + "|c" + tags}
+}
+
+func gaugeLine(name string, value float64, tags string) string {
+	return name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g" + tags
+}
+
+// write packs lines into as few datagrams as fit
+func (s *statsdSink) write(lines []string) {
+	var packet strings.Builder
+	send := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+			slog.Debug("failed to send StatsD packet", "error", err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			send()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	send()
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+func metricTags(metric *dto.Metric) string {
+	tags := make([]string, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		tags = append(tags, statsdTag(label.GetName(), label.GetValue()))
+	}
+	return statsdTags(tags)
+}
+
+// statsdTags is the |#tag,... suffix, sorted so a series always has the
+// same key
+func statsdTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsdTag replaces the characters that would end a tag or the line
+func statsdTag(name, value string) string {
+	return name + ":" + strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// runStatsDFlush sends the registry every StatsD.Interval, and once more
+// on shutdown so the last interval's counts aren't lost
+func (s *Server) runStatsDFlush(ctx context.Context) {
+	runEvery(ctx, s.config.StatsD.Interval, func(context.Context) { s.statsd.flush() })
+	s.statsd.flush()
+}
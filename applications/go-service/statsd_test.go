@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadMetricsBackend(t *testing.T) {
+	tests := []struct {
+		backend, exporters string
+		want               MetricExporters
+	}{
+		{"", "", MetricExporters{Prometheus: true}},
+		{"prometheus", "", MetricExporters{Prometheus: true}},
+		{"statsd", "", MetricExporters{StatsD: true}},
+		{"StatsD", "prometheus,otlp", MetricExporters{Prometheus: true, OTLP: true, StatsD: true}},
+		{"graphite", "", MetricExporters{Prometheus: true}},
+	}
+	for _, tt := range tests {
+		t.Setenv("METRICS_BACKEND", tt.backend)
+		t.Setenv("OTEL_METRICS_EXPORTER", tt.exporters)
+		if got := loadMetricExporters(); got != tt.want {
+			t.Errorf("METRICS_BACKEND=%q OTEL_METRICS_EXPORTER=%q: got %+v, want %+v", tt.backend, tt.exporters, got, tt.want)
+		}
+	}
+}
+
+func TestLoadStatsDConfig(t *testing.T) {
+	tests := []struct {
+		agent, addr, interval string
+		want                  StatsDConfig
+	}{
+		{"", "", "", StatsDConfig{Addr: "127.0.0.1:8125", Interval: 10 * time.Second}},
+		{"10.0.0.7", "", "30s", StatsDConfig{Addr: "10.0.0.7:8125", Interval: 30 * time.Second}},
+		{"10.0.0.7", "statsd.monitoring:9125", "-1s", StatsDConfig{Addr: "statsd.monitoring:9125", Interval: 10 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Setenv("DD_AGENT_HOST", tt.agent)
+		t.Setenv("STATSD_ADDR", tt.addr)
+		t.Setenv("STATSD_FLUSH_INTERVAL", tt.interval)
+		if got := loadStatsDConfig(); got != tt.want {
+			t.Errorf("DD_AGENT_HOST=%q STATSD_ADDR=%q STATSD_FLUSH_INTERVAL=%q: got %+v, want %+v", tt.agent, tt.addr, tt.interval, got, tt.want)
+		}
+	}
+}
+
+// listenStatsD returns a UDP listener and a function reading the lines of
+// the next datagram sent to it
+func listenStatsD(t *testing.T) (net.PacketConn, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, func() []string {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no StatsD packet: %v", err)
+		}
+		lines := strings.Split(string(buf[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+}
+
+func TestStatsDSink(t *testing.T) {
+	conn, read := listenStatsD(t)
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"service": "go-service"}, registry)
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "jobs_total", Help: "Jobs run"}, []string{"outcome"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_depth", Help: "Jobs waiting"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "batch_size", Help: "Batch sizes", Buckets: []float64{1, 5}})
+	reg.MustRegister(counter, gauge, hist)
+
+	sink, err := newStatsDSink(conn.LocalAddr().String(), registry, "go-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	counter.WithLabelValues("ok").Add(3)
+	gauge.Set(7)
+	hist.Observe(2)
+	hist.Observe(4)
+	sink.flush()
+	want := []string{
+		"batch_size_count:2|c|#service:go-service",
+		"batch_size_sum:6|c|#service:go-service",
+		"jobs_total:3|c|#outcome:ok,service:go-service",
+		"queue_depth:7|g|#service:go-service",
+	}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("first flush = %q, want %q", got, want)
+	}
+
+	// Counters send only what they rose by, and nothing once they stop
+	counter.WithLabelValues("ok").Add(2)
+	sink.flush()
+	want = []string{
+		"jobs_total:2|c|#outcome:ok,service:go-service",
+		"queue_depth:7|g|#service:go-service",
+	}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("second flush = %q, want %q", got, want)
+	}
+
+	sink.timing("http_request_duration", 1500*time.Microsecond,
+		statsdTag("route", "/api/v1/transactions/{id}"), statsdTag("method", "GET"), statsdTag("status", "2xx"))
+	want = []string{"http_request_duration:1.5|ms|#method:GET,route:/api/v1/transactions/{id},service:go-service,status:2xx"}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("timer = %q, want %q", got, want)
+	}
+}
+
+func TestStatsDPackets(t *testing.T) {
+	conn, read := listenStatsD(t)
+	sink, err := newStatsDSink(conn.LocalAddr().String(), prometheus.NewRegistry(), "go-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = "queue_depth:1|g|#" + strings.Repeat("x", 40)
+	}
+	sink.write(lines)
+	total := 0
+	for total < len(lines) {
+		packet := read()
+		if size := len(strings.Join(packet, "\n")); size > statsdMaxPacket {
+			t.Fatalf("packet of %d bytes, want at most %d", size, statsdMaxPacket)
+		}
+		total += len(packet)
+	}
+	if total != len(lines) {
+		t.Errorf("received %d lines, want %d", total, len(lines))
+	}
+
+	if got := statsdTag("route", "a,b|c#d"); got != "route:a_b_c_d" {
+		t.Errorf("statsdTag = %q", got)
+	}
+}
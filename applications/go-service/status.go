@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type TransactionStatus string
+
+const (
+	StatusPending           TransactionStatus = "pending"
+	StatusCompleted         TransactionStatus = "completed"
+	StatusVoided            TransactionStatus = "voided"
+	StatusPartiallyRefunded TransactionStatus = "partially_refunded"
+	StatusRefunded          TransactionStatus = "refunded"
+)
+
+// revenueStatusFilter restricts aggregate queries to transactions where money
+// has actually changed hands.
+const revenueStatusFilter = `status IN ('completed', 'partially_refunded', 'refunded')`
+
+var errIllegalTransition = errors.New("illegal status transition")
+
+// statusTransitions lists every state a transaction may move to from its
+// current state. Anything not listed here is rejected.
+var statusTransitions = map[TransactionStatus][]TransactionStatus{
+	StatusPending:           {StatusCompleted, StatusVoided},
+	StatusCompleted:         {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+func (status TransactionStatus) valid() bool {
+	switch status {
+	case StatusPending, StatusCompleted, StatusVoided, StatusPartiallyRefunded, StatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (from TransactionStatus) canTransitionTo(to TransactionStatus) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) captureTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	s.transitionHandler(w, r, StatusCompleted)
+}
+
+func (s *Server) voidTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	s.transitionHandler(w, r, StatusVoided)
+}
+
+func (s *Server) transitionHandler(w http.ResponseWriter, r *http.Request, to TransactionStatus) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	err = s.transitionTransaction(ctx, transactionID, to)
+	switch {
+	case errors.Is(err, errTransactionNotFound):
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errIllegalTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update transaction status", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := s.loadTransaction(ctx, transactionID)
+	if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) transitionTransaction(ctx context.Context, transactionID uuid.UUID, to TransactionStatus) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current TransactionStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM transactions WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, transactionID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errTransactionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("query transaction status: %w", err)
+	}
+
+	if !current.canTransitionTo(to) {
+		return fmt.Errorf("%w: cannot move from %s to %s", errIllegalTransition, current, to)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE transactions
+		SET status = $2,
+			status_updated_at = NOW(),
+			processed_at = CASE WHEN $2 = 'completed' THEN NOW() ELSE processed_at END,
+			invoice_number = CASE WHEN $2 = 'completed' THEN COALESCE(invoice_number, nextval('invoice_number_seq')) ELSE invoice_number END
+		WHERE id = $1
+	`, transactionID, to)
+	if err != nil {
+		return fmt.Errorf("update transaction status: %w", err)
+	}
+
+	if current == StatusPending && to == StatusCompleted {
+		if err := captureStock(ctx, tx, transactionID); err != nil {
+			return err
+		}
+	}
+
+	if to == StatusVoided {
+		if err := releaseDiscount(ctx, tx, transactionID); err != nil {
+			return err
+		}
+		if err := reverseLoyalty(ctx, tx, transactionID); err != nil {
+			return err
+		}
+		if err := restockTransaction(ctx, tx, transactionID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
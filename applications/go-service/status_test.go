@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from TransactionStatus
+		to   TransactionStatus
+		want bool
+	}{
+		{StatusPending, StatusCompleted, true},
+		{StatusPending, StatusVoided, true},
+		{StatusPending, StatusRefunded, false},
+		{StatusCompleted, StatusVoided, false},
+		{StatusCompleted, StatusRefunded, true},
+		{StatusCompleted, StatusPartiallyRefunded, true},
+		{StatusPartiallyRefunded, StatusRefunded, true},
+		{StatusRefunded, StatusPartiallyRefunded, false},
+		{StatusVoided, StatusCompleted, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.canTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s -> %s allowed = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
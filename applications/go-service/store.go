@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionStore creates and reads back transactions. The Postgres store is
+// the real one; the memory store lets handlers be unit-tested and the service
+// run as a demo with STORAGE=memory, at the cost of everything that needs
+// the other tables (customers, discount codes, inventory, reports, jobs).
+type TransactionStore interface {
+	// ProcessTransaction prices and records req, returning a *processError
+	// for anything the client should see
+	ProcessTransaction(ctx context.Context, req TransactionRequest, now time.Time) (TransactionResponse, error)
+	// LoadTransaction returns errTransactionNotFound for unknown ids
+	LoadTransaction(ctx context.Context, id uuid.UUID) (TransactionResponse, error)
+	ListTransactions(ctx context.Context, filter transactionFilter, cursor *listCursor, limit int) (TransactionListResponse, error)
+	RevenueTotals(ctx context.Context) (revenueTotals, error)
+	Ping(ctx context.Context) error
+}
+
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+// postgresStore is the store backed by the server's pool
+type postgresStore struct {
+	s *Server
+}
+
+func (p postgresStore) ProcessTransaction(ctx context.Context, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	return p.s.processTransaction(ctx, req, now)
+}
+
+func (p postgresStore) LoadTransaction(ctx context.Context, id uuid.UUID) (TransactionResponse, error) {
+	return p.s.loadTransaction(ctx, id)
+}
+
+func (p postgresStore) ListTransactions(ctx context.Context, filter transactionFilter, cursor *listCursor, limit int) (TransactionListResponse, error) {
+	return p.s.listTransactionSummaries(ctx, filter, cursor, limit)
+}
+
+func (p postgresStore) RevenueTotals(ctx context.Context) (revenueTotals, error) {
+	return p.s.loadRevenueTotals(ctx)
+}
+
+func (p postgresStore) Ping(ctx context.Context) error {
+	return p.s.db.Ping(ctx)
+}
+
+// memoryStore keeps transactions in process memory. Pricing uses the same
+// engine, promotions, and flat tax configuration as Postgres; requests that
+// need data only the database holds are rejected with 422.
+type memoryStore struct {
+	s *Server
+
+	mu      sync.Mutex
+	byID    map[uuid.UUID]*memoryTransaction
+	ordered []*memoryTransaction
+	invoice int64
+}
+
+type memoryTransaction struct {
+	createdAt time.Time
+	id        uuid.UUID
+	response  TransactionResponse
+}
+
+func newMemoryStore(s *Server) *memoryStore {
+	return &memoryStore{s: s, byID: map[uuid.UUID]*memoryTransaction{}}
+}
+
+func (m *memoryStore) ProcessTransaction(ctx context.Context, req TransactionRequest, now time.Time) (TransactionResponse, error) {
+	cfg := m.s.config
+	if violations := cfg.OrderLimits.validateTransactionRequest(req, cfg.CatalogPricing); len(violations) > 0 {
+		return TransactionResponse{}, validationError("Transaction failed validation", violations)
+	}
+	if field := databaseOnlyField(req, cfg); field != "" {
+		return TransactionResponse{}, clientError(http.StatusUnprocessableEntity, field+" requires a database")
+	}
+
+	subtotal := m.s.pricing.CalculateSubtotal(req.Items)
+	if violations := cfg.OrderLimits.checkMinimum(subtotal); len(violations) > 0 {
+		return TransactionResponse{}, validationError("Transaction failed validation", violations)
+	}
+
+	promotions := m.s.pricing.ApplyDiscount(m.s.promotionRuleset(), nil, promotionInput{
+		Items:    req.Items,
+		Subtotal: subtotal,
+	}, cfg.Rounding)
+	discount := promotions.Discount
+
+	rules := TaxRules{Jurisdiction: flatJurisdiction(cfg.TaxRate), CategoryRates: cfg.CategoryTaxRates, Rounding: cfg.Rounding}
+	taxed, lineTaxes := m.s.pricing.CalculateTax(rules, req.Items, subtotal, discount, promotions.LineDiscounts)
+	lines := make([]TransactionLine, len(req.Items))
+	for i, item := range req.Items {
+		lines[i] = TransactionLine{
+			Line:     i + 1,
+			ID:       item.ID,
+			Name:     item.Name,
+			Amount:   item.Price.Mul(item.Quantity),
+			Discount: lineTaxes[i].Discount,
+			Tax:      lineTaxes[i].Tax,
+		}
+	}
+	shipping := calculateShipping(cfg.Shipping, subtotal-discount, req.Items)
+	total := subtotal - discount + shipping + req.Tip
+	if !taxed.Inclusive {
+		total += taxed.Tax
+	}
+
+	status := StatusCompleted
+	if req.AuthorizeOnly {
+		status = StatusPending
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var invoiceNumber int64
+	if status == StatusCompleted {
+		m.invoice++
+		invoiceNumber = m.invoice
+	}
+
+	id := uuid.New()
+	response := TransactionResponse{
+		TransactionID: id.String(),
+		Status:        string(status),
+		Currency:      cfg.ReportingCurrency,
+		ExchangeRate:  1,
+		Items:         req.Items,
+		Lines:         lines,
+		Subtotal:      subtotal,
+		Tax:           taxed.Tax,
+		Discount:      discount,
+		Promotions:    promotions.Applied,
+		Tip:           req.Tip,
+		Shipping:      shipping,
+		Total:         total,
+		TaxRate:       taxed.EffectiveRate,
+		TaxLines:      taxed.Lines,
+		TaxInclusive:  taxed.Inclusive,
+		Rounding:      rules.Rounding.String(),
+		InvoiceNumber: invoiceNumber,
+		Metadata:      req.Metadata,
+		Notes:         strings.TrimSpace(req.Notes),
+		Timestamp:     now.UTC().Format(time.RFC3339),
+	}
+
+	stored := &memoryTransaction{createdAt: now, id: id, response: response}
+	m.byID[id] = stored
+	m.ordered = append(m.ordered, stored)
+	m.s.recordCommitted(response)
+	// There is no Postgres to NOTIFY, and no other instance to tell
+	m.s.eventsDropped.Add(int64(m.s.events.publish(transactionCreatedEvent(response))))
+	return response, nil
+}
+
+// databaseOnlyField names the first part of req that the memory store can't
+// honour, or returns "" when it can price req
+func databaseOnlyField(req TransactionRequest, cfg Config) string {
+	switch {
+	case cfg.CatalogPricing:
+		return "CATALOG_PRICING"
+	case req.CustomerID != "":
+		return "customer_id"
+	case req.DiscountCode != "" || len(req.DiscountCodes) > 0:
+		return "discount_code"
+	case req.RedeemPoints > 0:
+		return "redeem_points"
+	case req.Region != "":
+		return "region"
+	case req.Currency != "" && normalizeCurrency(req.Currency) != cfg.ReportingCurrency:
+		return "currency"
+	}
+	return ""
+}
+
+func (m *memoryStore) LoadTransaction(ctx context.Context, id uuid.UUID) (TransactionResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.byID[id]
+	if !ok {
+		return TransactionResponse{}, errTransactionNotFound
+	}
+	return stored.response, nil
+}
+
+// ListTransactions pages newest first by (createdAt, id), like Postgres
+func (m *memoryStore) ListTransactions(ctx context.Context, filter transactionFilter, cursor *listCursor, limit int) (TransactionListResponse, error) {
+	m.mu.Lock()
+	matches := make([]*memoryTransaction, 0, len(m.ordered))
+	for _, stored := range m.ordered {
+		if filter.matches(stored) && (cursor == nil || stored.before(*cursor)) {
+			matches = append(matches, stored)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[j].before(listCursor{CreatedAt: matches[i].createdAt, ID: matches[i].id})
+	})
+
+	response := TransactionListResponse{Transactions: []TransactionSummary{}}
+	for i, stored := range matches {
+		if i == limit {
+			last := matches[i-1]
+			response.NextCursor = listCursor{CreatedAt: last.createdAt, ID: last.id}.encode()
+			break
+		}
+		response.Transactions = append(response.Transactions, stored.summary())
+	}
+	return response, nil
+}
+
+// before reports whether t sorts after c in a newest-first listing
+func (t *memoryTransaction) before(c listCursor) bool {
+	if !t.createdAt.Equal(c.CreatedAt) {
+		return t.createdAt.Before(c.CreatedAt)
+	}
+	return strings.Compare(t.id.String(), c.ID.String()) < 0
+}
+
+func (t *memoryTransaction) summary() TransactionSummary {
+	return TransactionSummary{
+		TransactionID: t.response.TransactionID,
+		CustomerID:    t.response.CustomerID,
+		Status:        t.response.Status,
+		Currency:      t.response.Currency,
+		Total:         t.response.Total,
+		Timestamp:     t.response.Timestamp,
+	}
+}
+
+// matches applies the filter fields the memory store can hold values for.
+// Customers and discount codes never reach it, so those filters match nothing.
+func (f transactionFilter) matches(t *memoryTransaction) bool {
+	r := t.response
+	switch {
+	case f.CustomerID != nil && r.CustomerID != f.CustomerID.String():
+		return false
+	case f.DiscountCode != "":
+		return false
+	case f.From != nil && t.createdAt.Before(*f.From):
+		return false
+	case f.To != nil && !t.createdAt.Before(*f.To):
+		return false
+	case f.MinTotal != nil && r.Total < *f.MinTotal:
+		return false
+	case f.MaxTotal != nil && r.Total > *f.MaxTotal:
+		return false
+	case f.Status != "" && r.Status != f.Status:
+		return false
+	case f.Notes != "" && !strings.Contains(strings.ToLower(r.Notes), strings.ToLower(f.Notes)):
+		return false
+	}
+	for key, want := range f.Metadata {
+		if got, ok := r.Metadata[key].(string); !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// RevenueTotals counts completed transactions; nothing in memory is ever
+// refunded, and everything is in the reporting currency
+func (m *memoryStore) RevenueTotals(ctx context.Context) (revenueTotals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	totals := revenueTotals{ByCurrency: []CurrencyStats{}}
+	for _, stored := range m.ordered {
+		if stored.response.Status != string(StatusCompleted) {
+			continue
+		}
+		totals.Transactions++
+		totals.Revenue += stored.response.Total
+		totals.Tips += stored.response.Tip
+	}
+	if totals.Transactions > 0 {
+		totals.ByCurrency = append(totals.ByCurrency, CurrencyStats{
+			Currency:         m.s.config.ReportingCurrency,
+			Transactions:     totals.Transactions,
+			Revenue:          totals.Revenue,
+			Tips:             totals.Tips,
+			ReportingRevenue: totals.Revenue,
+		})
+	}
+	return totals, nil
+}
+
+func (m *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newMemoryServer() *Server {
+	s := &Server{
+		config: Config{
+			ServiceName:       "go-service",
+			TaxRate:           0.1,
+			ReportingCurrency: "USD",
+			Rounding:          Rounding{Mode: RoundHalfUp, Scope: RoundPerLine},
+			Storage:           StorageMemory,
+			Timeouts:          loadQueryTimeouts(),
+		},
+		pricing: standardPricing{},
+	}
+	s.store = newMemoryStore(s)
+	s.initMetrics()
+	return s
+}
+
+func TestMemoryStoreProcessTransaction(t *testing.T) {
+	s := newMemoryServer()
+	ctx := context.Background()
+
+	req := TransactionRequest{
+		Items: []Item{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 2}},
+		Tip:   100,
+	}
+	response, err := s.store.ProcessTransaction(ctx, req, time.Now())
+	if err != nil {
+		t.Fatalf("ProcessTransaction: %v", err)
+	}
+	if response.Subtotal != 2000 || response.Tax != 200 || response.Total != 2300 {
+		t.Errorf("subtotal/tax/total = %s/%s/%s, want 20.00/2.00/23.00", response.Subtotal, response.Tax, response.Total)
+	}
+	if response.Status != string(StatusCompleted) || response.InvoiceNumber != 1 {
+		t.Errorf("status %q invoice %d, want completed invoice 1", response.Status, response.InvoiceNumber)
+	}
+
+	loaded, err := s.store.LoadTransaction(ctx, uuid.MustParse(response.TransactionID))
+	if err != nil {
+		t.Fatalf("LoadTransaction: %v", err)
+	}
+	if loaded.Total != response.Total {
+		t.Errorf("loaded total = %s, want %s", loaded.Total, response.Total)
+	}
+
+	if _, err := s.store.LoadTransaction(ctx, uuid.New()); !errors.Is(err, errTransactionNotFound) {
+		t.Errorf("unknown id: err = %v, want errTransactionNotFound", err)
+	}
+
+	totals, err := s.store.RevenueTotals(ctx)
+	if err != nil {
+		t.Fatalf("RevenueTotals: %v", err)
+	}
+	if totals.Transactions != 1 || totals.Revenue != 2300 || totals.Tips != 100 {
+		t.Errorf("totals = %+v", totals)
+	}
+}
+
+func TestMemoryStoreRejectsDatabaseFields(t *testing.T) {
+	s := newMemoryServer()
+	items := []Item{{ID: "p1", Name: "Widget", Price: 1000, Quantity: 1}}
+
+	tests := []struct {
+		name string
+		req  TransactionRequest
+	}{
+		{"customer", TransactionRequest{Items: items, CustomerID: uuid.NewString()}},
+		{"discount code", TransactionRequest{Items: items, DiscountCode: "SAVE10"}},
+		{"region", TransactionRequest{Items: items, Region: "US-CA"}},
+		{"foreign currency", TransactionRequest{Items: items, Currency: "EUR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.store.ProcessTransaction(context.Background(), tt.req, time.Now())
+			if status, _ := errorStatus(err); status != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d (%v), want 422", status, err)
+			}
+		})
+	}
+
+	if _, err := s.store.ProcessTransaction(context.Background(), TransactionRequest{Items: items, Currency: "usd"}, time.Now()); err != nil {
+		t.Errorf("reporting currency: %v", err)
+	}
+}
+
+func TestMemoryStoreListTransactions(t *testing.T) {
+	s := newMemoryServer()
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		req := TransactionRequest{Items: []Item{{ID: "p1", Name: "Widget", Price: Money(100 * (i + 1)), Quantity: 1}}}
+		response, err := s.store.ProcessTransaction(ctx, req, start.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, response.TransactionID)
+	}
+
+	var got []string
+	var cursor *listCursor
+	for {
+		page, err := s.store.ListTransactions(ctx, transactionFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, summary := range page.Transactions {
+			got = append(got, summary.TransactionID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		next, err := decodeListCursor(page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor = &next
+	}
+
+	want := []string{ids[4], ids[3], ids[2], ids[1], ids[0]}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("pages = %v, want newest first %v", got, want)
+	}
+
+	from, to := start.Add(time.Minute), start.Add(3*time.Minute)
+	page, err := s.store.ListTransactions(ctx, transactionFilter{From: &from, To: &to}, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 2 || page.Transactions[0].TransactionID != ids[2] {
+		t.Errorf("time range = %+v, want %s then %s", page.Transactions, ids[2], ids[1])
+	}
+}
+
+func TestMemoryStorageRoutes(t *testing.T) {
+	s := newMemoryServer()
+	mux := http.NewServeMux()
+	for _, version := range s.apiVersions() {
+		version.register(mux)
+	}
+
+	body := `{"items":[{"id":"p1","name":"Widget","price":"10.00","quantity":1}]}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v2/transactions", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rr.Code, rr.Body)
+	}
+	location := rr.Header().Get("Location")
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", location, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get %s: status %d: %s", location, rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/transactions", nil))
+	var list TransactionListResponse
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list.Transactions) != 1 {
+		t.Errorf("list: status %d, %d transactions (%v)", rr.Code, len(list.Transactions), err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/customers", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("customers: status %d, want 503", rr.Code)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+var errUnknownRegion = errors.New("unknown tax region")
+
+// TaxComponent is one rate levied in a jurisdiction. Compound components are
+// charged on the base plus every component before them in sequence.
+type TaxComponent struct {
+	Name     string  `json:"name"`
+	Rate     float64 `json:"rate"`
+	Compound bool    `json:"compound,omitempty"`
+}
+
+// TaxJurisdiction is the set of rates for a region. Inclusive jurisdictions
+// quote item prices with tax already included, so tax is extracted from the
+// price rather than added on top.
+type TaxJurisdiction struct {
+	Region     string         `json:"region"`
+	Name       string         `json:"name"`
+	Inclusive  bool           `json:"tax_inclusive"`
+	Components []TaxComponent `json:"components"`
+}
+
+type TaxJurisdictionListResponse struct {
+	Jurisdictions []TaxJurisdiction `json:"jurisdictions"`
+}
+
+// TaxLine is the amount charged for one component on a transaction
+type TaxLine struct {
+	Name   string  `json:"name"`
+	Rate   float64 `json:"rate"`
+	Amount Money   `json:"amount"`
+
+	// exact is Amount in cents before rounding
+	exact decimal.Decimal
+}
+
+// TaxResult is the outcome of taxing an amount. Net is the pre-tax base:
+// the amount itself for exclusive pricing, or what remains after extracting
+// tax for inclusive pricing.
+type TaxResult struct {
+	Net   Money
+	Tax   Money
+	Lines []TaxLine
+	// EffectiveRate is the combined rate on Net, compounding included
+	EffectiveRate float64
+	Inclusive     bool
+}
+
+// flatJurisdiction wraps the single configured rate used when a request
+// carries no region.
+func flatJurisdiction(rate float64) TaxJurisdiction {
+	return TaxJurisdiction{Components: []TaxComponent{{Name: "Sales tax", Rate: rate}}}
+}
+
+func normalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+// effectiveRate folds the components into a single rate on the net base
+func (j TaxJurisdiction) effectiveRate() float64 {
+	var accumulated float64
+	for _, c := range j.Components {
+		if c.Compound {
+			accumulated += (1 + accumulated) * c.Rate
+		} else {
+			accumulated += c.Rate
+		}
+	}
+	return accumulated
+}
+
+// calculate taxes amount under the jurisdiction's rules, rounding each
+// component to the cent
+func (j TaxJurisdiction) calculate(amount Money, rounding Rounding) TaxResult {
+	result := TaxResult{Net: amount, Inclusive: j.Inclusive, EffectiveRate: j.effectiveRate()}
+	net := amount.decimal()
+	if j.Inclusive {
+		net = net.Div(decimal.NewFromFloat(1 + result.EffectiveRate))
+		result.Net = rounding.round(net)
+	}
+
+	var accumulated decimal.Decimal
+	for _, c := range j.Components {
+		base := net
+		if c.Compound {
+			base = base.Add(accumulated)
+		}
+		exact := base.Mul(decimal.NewFromFloat(c.Rate))
+		accumulated = accumulated.Add(exact)
+
+		line := TaxLine{Name: c.Name, Rate: c.Rate, Amount: rounding.round(exact), exact: exact}
+		result.Tax += line.Amount
+		result.Lines = append(result.Lines, line)
+	}
+
+	// Rounding each line can leave inclusive prices a cent off; settle it on
+	// the last component so net and tax add back up to the quoted price
+	if j.Inclusive && len(result.Lines) > 0 {
+		drift := amount - result.Net - result.Tax
+		result.Lines[len(result.Lines)-1].Amount += drift
+		result.Tax += drift
+	}
+
+	return result
+}
+
+// loadJurisdiction reads a region's components in sequence order
+func loadJurisdiction(ctx context.Context, q querier, region string) (TaxJurisdiction, error) {
+	jurisdiction := TaxJurisdiction{Region: region}
+	err := q.QueryRow(ctx, `
+		SELECT name, tax_inclusive FROM tax_jurisdictions WHERE region = $1
+	`, region).Scan(&jurisdiction.Name, &jurisdiction.Inclusive)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TaxJurisdiction{}, errUnknownRegion
+	}
+	if err != nil {
+		return TaxJurisdiction{}, fmt.Errorf("query tax jurisdiction: %w", err)
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT name, rate::float8, compound FROM tax_rates WHERE region = $1 ORDER BY sequence, name
+	`, region)
+	if err != nil {
+		return TaxJurisdiction{}, fmt.Errorf("query tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	jurisdiction.Components = []TaxComponent{}
+	for rows.Next() {
+		var c TaxComponent
+		if err := rows.Scan(&c.Name, &c.Rate, &c.Compound); err != nil {
+			return TaxJurisdiction{}, fmt.Errorf("scan tax rate: %w", err)
+		}
+		jurisdiction.Components = append(jurisdiction.Components, c)
+	}
+	if err := rows.Err(); err != nil {
+		return TaxJurisdiction{}, fmt.Errorf("read tax rates: %w", err)
+	}
+
+	return jurisdiction, nil
+}
+
+// resolveJurisdiction picks the rules for a transaction: the region's rates
+// when one is given, otherwise the configured flat rate.
+func (s *Server) resolveJurisdiction(ctx context.Context, q querier, region string) (TaxJurisdiction, error) {
+	if region == "" {
+		rate, err := effectiveTaxRate(ctx, q, s.config.TaxRate)
+		if err != nil {
+			return TaxJurisdiction{}, err
+		}
+		return flatJurisdiction(rate), nil
+	}
+	return loadJurisdiction(ctx, q, region)
+}
+
+func (s *Server) listTaxJurisdictionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT region FROM tax_jurisdictions ORDER BY region`)
+	if err != nil {
+		http.Error(w, "Failed to fetch tax jurisdictions", http.StatusInternalServerError)
+		return
+	}
+	regions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		http.Error(w, "Failed to read tax jurisdictions", http.StatusInternalServerError)
+		return
+	}
+
+	response := TaxJurisdictionListResponse{Jurisdictions: make([]TaxJurisdiction, 0, len(regions))}
+	for _, region := range regions {
+		jurisdiction, err := loadJurisdiction(ctx, s.db, region)
+		if err != nil {
+			http.Error(w, "Failed to fetch tax jurisdictions", http.StatusInternalServerError)
+			return
+		}
+		response.Jurisdictions = append(response.Jurisdictions, jurisdiction)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// TaxRules combines a jurisdiction with per-category overrides. A category
+// with an override is taxed at that single rate instead of the
+// jurisdiction's components; zero makes the category exempt.
+type TaxRules struct {
+	Jurisdiction  TaxJurisdiction
+	CategoryRates map[string]float64
+	Rounding      Rounding
+}
+
+// LineTax is the discount share and tax computed for one item line
+type LineTax struct {
+	Discount Money
+	Tax      Money
+	Rate     float64
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// parseCategoryTaxRates reads CATEGORY_TAX_RATES, e.g. "groceries=0,books=0.05"
+func parseCategoryTaxRates(value string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		category, rawRate, ok := strings.Cut(pair, "=")
+		if !ok || normalizeCategory(category) == "" {
+			return nil, fmt.Errorf("invalid category tax rate %q", pair)
+		}
+		rate, err := parseTaxRate(strings.TrimSpace(rawRate))
+		if err != nil {
+			return nil, err
+		}
+		rates[normalizeCategory(category)] = rate
+	}
+	return rates, nil
+}
+
+func (t TaxRules) forCategory(category string) TaxJurisdiction {
+	rate, ok := t.CategoryRates[normalizeCategory(category)]
+	if !ok {
+		return t.Jurisdiction
+	}
+	override := t.Jurisdiction
+	override.Components = []TaxComponent{{Name: "Sales tax (" + normalizeCategory(category) + ")", Rate: rate}}
+	return override
+}
+
+// calculateItems taxes each line under its category's rules. discount is
+// the transaction's total discount, of which lineDiscounts (parallel to items,
+// may be nil) were granted to specific lines. The rest is spread over the
+// lines by their share of what remains, with any rounding remainder on the
+// last line, so exempt lines never absorb tax.
+// With per-total rounding each tax component is rounded once from the exact
+// sum over all lines, and the difference from the per-line amounts is
+// settled on the last line. The returned slice is parallel to items.
+func (t TaxRules) calculateItems(items []Item, subtotal, discount Money, lineDiscounts []Money) (TaxResult, []LineTax) {
+	result := TaxResult{Inclusive: t.Jurisdiction.Inclusive}
+	lines := make([]LineTax, len(items))
+	lineIndex := map[string]int{}
+
+	last := -1
+	for i, item := range items {
+		if item.Quantity > 0 && item.Price >= 0 {
+			last = i
+		}
+	}
+
+	lineDiscount := func(i int) Money {
+		if i < len(lineDiscounts) {
+			return lineDiscounts[i]
+		}
+		return 0
+	}
+	orderDiscount, base := discount, subtotal
+	for i := range items {
+		orderDiscount -= lineDiscount(i)
+		base -= lineDiscount(i)
+	}
+
+	var allocated Money
+	for i, item := range items {
+		if item.Quantity <= 0 || item.Price < 0 {
+			continue
+		}
+		net := item.Price.Mul(item.Quantity) - lineDiscount(i)
+		share := net.MulFrac(orderDiscount.Cents(), base.Cents())
+		if i == last {
+			share = orderDiscount - allocated
+		}
+		allocated += share
+
+		jurisdiction := t.forCategory(item.Category)
+		taxed := jurisdiction.calculate(net-share, t.Rounding)
+		lines[i] = LineTax{Discount: lineDiscount(i) + share, Tax: taxed.Tax, Rate: taxed.EffectiveRate}
+
+		result.Net += taxed.Net
+		result.Tax += taxed.Tax
+		for _, line := range taxed.Lines {
+			key := fmt.Sprintf("%s@%v", line.Name, line.Rate)
+			if idx, ok := lineIndex[key]; ok {
+				result.Lines[idx].Amount += line.Amount
+				result.Lines[idx].exact = result.Lines[idx].exact.Add(line.exact)
+				continue
+			}
+			lineIndex[key] = len(result.Lines)
+			result.Lines = append(result.Lines, line)
+		}
+	}
+
+	if t.Rounding.perTotal() && last >= 0 {
+		var tax Money
+		for i := range result.Lines {
+			result.Lines[i].Amount = t.Rounding.round(result.Lines[i].exact)
+			tax += result.Lines[i].Amount
+		}
+		lines[last].Tax += tax - result.Tax
+		if result.Inclusive {
+			result.Net -= tax - result.Tax
+		}
+		result.Tax = tax
+	}
+
+	if result.Net > 0 {
+		result.EffectiveRate = float64(result.Tax) / float64(result.Net)
+	}
+	return result, lines
+}
+
+// loadCategoryTaxRates layers DB overrides on top of the configured ones:
+// rows without a region apply everywhere, and rows for region win over both.
+func loadCategoryTaxRates(ctx context.Context, q querier, region string, configured map[string]float64) (map[string]float64, error) {
+	rates := make(map[string]float64, len(configured))
+	for category, rate := range configured {
+		rates[category] = rate
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT category, rate::float8 FROM category_tax_rates
+		WHERE region = '' OR region = $1
+		ORDER BY region
+	`, region)
+	if err != nil {
+		return nil, fmt.Errorf("query category tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			category string
+			rate     float64
+		)
+		if err := rows.Scan(&category, &rate); err != nil {
+			return nil, fmt.Errorf("scan category tax rate: %w", err)
+		}
+		rates[normalizeCategory(category)] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read category tax rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+// exempt drops every tax component so nothing is charged. Prices in
+// tax-inclusive regions are charged as listed.
+func (t TaxRules) exempt() TaxRules {
+	return TaxRules{
+		Jurisdiction: TaxJurisdiction{Region: t.Jurisdiction.Region, Name: t.Jurisdiction.Name, Components: []TaxComponent{}},
+		Rounding:     t.Rounding,
+	}
+}
+
+// resolveTaxRules loads the jurisdiction and category overrides for region
+func (s *Server) resolveTaxRules(ctx context.Context, q querier, region string) (TaxRules, error) {
+	jurisdiction, err := s.resolveJurisdiction(ctx, q, region)
+	if err != nil {
+		return TaxRules{}, err
+	}
+	rates, err := loadCategoryTaxRates(ctx, q, region, s.config.CategoryTaxRates)
+	if err != nil {
+		return TaxRules{}, err
+	}
+	return TaxRules{Jurisdiction: jurisdiction, CategoryRates: rates, Rounding: s.config.Rounding}, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import "testing"
+
+func TestTaxJurisdictionCalculate(t *testing.T) {
+	tests := []struct {
+		name         string
+		jurisdiction TaxJurisdiction
+		amount       Money
+		wantNet      Money
+		wantTax      Money
+		wantLines    []Money
+	}{
+		{
+			name:         "flat rate",
+			jurisdiction: flatJurisdiction(0.08),
+			amount:       10000,
+			wantNet:      10000, wantTax: 800, wantLines: []Money{800},
+		},
+		{
+			name: "stacked components",
+			jurisdiction: TaxJurisdiction{Components: []TaxComponent{
+				{Name: "GST", Rate: 0.05}, {Name: "QST", Rate: 0.09975},
+			}},
+			amount:  10000,
+			wantNet: 10000, wantTax: 1498, wantLines: []Money{500, 998},
+		},
+		{
+			name: "compound component taxes earlier tax",
+			jurisdiction: TaxJurisdiction{Components: []TaxComponent{
+				{Name: "Federal", Rate: 0.05}, {Name: "Provincial", Rate: 0.10, Compound: true},
+			}},
+			amount:  10000,
+			wantNet: 10000, wantTax: 1550, wantLines: []Money{500, 1050},
+		},
+		{
+			name:         "inclusive price",
+			jurisdiction: TaxJurisdiction{Inclusive: true, Components: []TaxComponent{{Name: "VAT", Rate: 0.20}}},
+			amount:       1200,
+			wantNet:      1000, wantTax: 200, wantLines: []Money{200},
+		},
+		{
+			name:         "inclusive rounding settles on the last line",
+			jurisdiction: TaxJurisdiction{Inclusive: true, Components: []TaxComponent{{Name: "VAT", Rate: 0.19}}},
+			amount:       999,
+			wantNet:      839, wantTax: 160, wantLines: []Money{160},
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.jurisdiction.calculate(tt.amount, Rounding{})
+		if got.Net != tt.wantNet || got.Tax != tt.wantTax {
+			t.Errorf("%s: net/tax = %v/%v, want %v/%v", tt.name, got.Net, got.Tax, tt.wantNet, tt.wantTax)
+		}
+		if tt.jurisdiction.Inclusive && got.Net+got.Tax != tt.amount {
+			t.Errorf("%s: inclusive net + tax = %v, want %v", tt.name, got.Net+got.Tax, tt.amount)
+		}
+		if len(got.Lines) != len(tt.wantLines) {
+			t.Errorf("%s: %d tax lines, want %d", tt.name, len(got.Lines), len(tt.wantLines))
+			continue
+		}
+		for i, want := range tt.wantLines {
+			if got.Lines[i].Amount != want {
+				t.Errorf("%s: line %d = %v, want %v", tt.name, i, got.Lines[i].Amount, want)
+			}
+		}
+	}
+}
+
+func TestEffectiveRateCompounds(t *testing.T) {
+	j := TaxJurisdiction{Components: []TaxComponent{{Rate: 0.05}, {Rate: 0.10, Compound: true}}}
+	if got := j.effectiveRate(); got < 0.1549 || got > 0.1551 {
+		t.Errorf("effectiveRate = %v, want 0.155", got)
+	}
+}
+
+func TestTaxRulesCalculateItems(t *testing.T) {
+	rules := TaxRules{
+		Jurisdiction:  flatJurisdiction(0.10),
+		CategoryRates: map[string]float64{"groceries": 0},
+	}
+	items := []Item{
+		{ID: "bread", Category: "Groceries", Price: 500, Quantity: 2},
+		{ID: "tv", Category: "electronics", Price: 2000, Quantity: 1},
+		{ID: "cable", Category: "electronics", Price: 1000, Quantity: 1},
+	}
+
+	// 10% off a 40.00 order: 1.00 / 2.00 / 1.00 of discount per line
+	result, lines := rules.calculateItems(items, 4000, 400, nil)
+
+	wantTax := []Money{0, 180, 90}
+	var discount Money
+	for i, want := range wantTax {
+		if lines[i].Tax != want {
+			t.Errorf("line %d tax = %v, want %v", i, lines[i].Tax, want)
+		}
+		discount += lines[i].Discount
+	}
+	if discount != 400 {
+		t.Errorf("allocated discount = %v, want 4.00", discount)
+	}
+	if result.Tax != 270 || result.Net != 3600 {
+		t.Errorf("tax/net = %v/%v, want 2.70/36.00", result.Tax, result.Net)
+	}
+	if len(result.Lines) != 2 {
+		t.Errorf("tax lines = %+v, want one per distinct rate", result.Lines)
+	}
+}
+
+func TestTaxRulesDiscountRemainderOnLastLine(t *testing.T) {
+	rules := TaxRules{Jurisdiction: flatJurisdiction(0)}
+	items := []Item{{Price: 100, Quantity: 1}, {Price: 100, Quantity: 1}, {Price: 100, Quantity: 1}}
+
+	_, lines := rules.calculateItems(items, 300, 100, nil)
+	if lines[0].Discount != 33 || lines[1].Discount != 33 || lines[2].Discount != 34 {
+		t.Errorf("discount shares = %v/%v/%v, want 0.33/0.33/0.34", lines[0].Discount, lines[1].Discount, lines[2].Discount)
+	}
+}
+
+func TestTaxRulesExempt(t *testing.T) {
+	rules := TaxRules{
+		Jurisdiction:  TaxJurisdiction{Region: "GB", Inclusive: true, Components: []TaxComponent{{Name: "VAT", Rate: 0.20}}},
+		CategoryRates: map[string]float64{"books": 0.05},
+	}
+	items := []Item{{Category: "books", Price: 1200, Quantity: 1}, {Price: 2400, Quantity: 1}}
+
+	result, lines := rules.exempt().calculateItems(items, 3600, 0, nil)
+	if result.Tax != 0 || result.Inclusive || result.Net != 3600 || len(result.Lines) != 0 {
+		t.Errorf("exempt result = %+v, want no tax on 36.00", result)
+	}
+	for i, line := range lines {
+		if line.Tax != 0 {
+			t.Errorf("line %d tax = %v, want 0", i, line.Tax)
+		}
+	}
+}
+
+func TestParseCategoryTaxRates(t *testing.T) {
+	rates, err := parseCategoryTaxRates(" Groceries=0, books=0.05 ,")
+	if err != nil {
+		t.Fatalf("parseCategoryTaxRates: %v", err)
+	}
+	if len(rates) != 2 || rates["groceries"] != 0 || rates["books"] != 0.05 {
+		t.Errorf("rates = %v", rates)
+	}
+
+	for _, bad := range []string{"books", "=0.1", "books=2"} {
+		if _, err := parseCategoryTaxRates(bad); err == nil {
+			t.Errorf("parseCategoryTaxRates(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestCalculateItemsLineDiscounts(t *testing.T) {
+	// A line discount stays on its line; the order discount is spread over
+	// what remains after it
+	items := []Item{
+		{Price: 1000, Quantity: 1},
+		{Price: 1000, Quantity: 1, Category: "groceries"},
+	}
+	rules := TaxRules{Jurisdiction: flatJurisdiction(0.10), CategoryRates: map[string]float64{"groceries": 0}}
+
+	_, lines := rules.calculateItems(items, 2000, 600, []Money{400, 0})
+	if lines[0].Discount != 475 || lines[1].Discount != 125 {
+		t.Errorf("discounts = %v, %v, want 4.75, 1.25", lines[0].Discount, lines[1].Discount)
+	}
+	if lines[0].Tax != 53 || lines[1].Tax != 0 {
+		t.Errorf("tax = %v, %v, want 0.53, 0", lines[0].Tax, lines[1].Tax)
+	}
+}
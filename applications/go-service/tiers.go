@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const TierStandard = "standard"
+
+var errUnknownTier = errors.New("unknown customer tier")
+
+// CustomerTier is a pricing tier customers are assigned to. Its percent_off
+// is applied automatically to every transaction by a customer in the tier.
+type CustomerTier struct {
+	Tier        string  `json:"tier"`
+	PercentOff  float64 `json:"percent_off"`
+	Description string  `json:"description,omitempty"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+type CustomerTierListResponse struct {
+	Tiers []CustomerTier `json:"tiers"`
+}
+
+type UpdateCustomerTierRequest struct {
+	PercentOff  float64 `json:"percent_off"`
+	Description string  `json:"description,omitempty"`
+}
+
+func normalizeTier(tier string) string {
+	return strings.ToLower(strings.TrimSpace(tier))
+}
+
+func scanCustomerTier(row pgx.Row) (CustomerTier, error) {
+	var (
+		tier      CustomerTier
+		updatedAt time.Time
+	)
+	if err := row.Scan(&tier.Tier, &tier.PercentOff, &tier.Description, &updatedAt); err != nil {
+		return CustomerTier{}, err
+	}
+	tier.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return tier, nil
+}
+
+// loadCustomerTier looks up a tier's terms inside the caller's transaction
+func loadCustomerTier(ctx context.Context, q querier, tier string) (CustomerTier, error) {
+	loaded, err := scanCustomerTier(q.QueryRow(ctx, `
+		SELECT tier, percent_off::float8, COALESCE(description, ''), updated_at FROM customer_tiers WHERE tier = $1
+	`, normalizeTier(tier)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CustomerTier{}, errUnknownTier
+	}
+	if err != nil {
+		return CustomerTier{}, fmt.Errorf("query customer tier: %w", err)
+	}
+	return loaded, nil
+}
+
+// tierRule expresses a tier's discount as a promotion, or false when the
+// tier has none
+func tierRule(tier CustomerTier) (PromotionRule, bool) {
+	if tier.PercentOff <= 0 {
+		return PromotionRule{}, false
+	}
+	return PromotionRule{
+		Name:   tier.Tier + " pricing",
+		Action: PromotionAction{Type: PromotionPercentOff, PercentOff: tier.PercentOff},
+	}, true
+}
+
+func (s *Server) listCustomerTiersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT tier, percent_off::float8, COALESCE(description, ''), updated_at FROM customer_tiers ORDER BY percent_off, tier
+	`)
+	if err != nil {
+		http.Error(w, "Failed to list customer tiers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := CustomerTierListResponse{Tiers: []CustomerTier{}}
+	for rows.Next() {
+		tier, err := scanCustomerTier(rows)
+		if err != nil {
+			http.Error(w, "Failed to list customer tiers", http.StatusInternalServerError)
+			return
+		}
+		response.Tiers = append(response.Tiers, tier)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to list customer tiers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// putCustomerTierHandler creates a tier or changes its discount
+func (s *Server) putCustomerTierHandler(w http.ResponseWriter, r *http.Request) {
+	tier := normalizeTier(r.PathValue("tier"))
+	if tier == "" {
+		http.Error(w, "tier is required", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateCustomerTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.PercentOff < 0 || req.PercentOff > 100 {
+		http.Error(w, "percent_off must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	updated, err := scanCustomerTier(s.db.QueryRow(ctx, `
+		INSERT INTO customer_tiers (tier, percent_off, description) VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (tier) DO UPDATE SET percent_off = EXCLUDED.percent_off,
+			description = EXCLUDED.description, updated_at = NOW()
+		RETURNING tier, percent_off::float8, COALESCE(description, ''), updated_at
+	`, tier, req.PercentOff, req.Description))
+	if err != nil {
+		http.Error(w, "Failed to save customer tier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestTierRule(t *testing.T) {
+	if _, ok := tierRule(CustomerTier{Tier: TierStandard}); ok {
+		t.Error("tier without a discount should not produce a rule")
+	}
+
+	rule, ok := tierRule(CustomerTier{Tier: "vip", PercentOff: 10})
+	if !ok || rule.validate() != nil {
+		t.Fatalf("tierRule = %+v, %v", rule, ok)
+	}
+
+	// Tier pricing stacks after a code, both on the full subtotal
+	codes := []DiscountCode{{Code: "SAVE20", PercentOff: 20, Active: true}}
+	result := applyPromotions(PromotionRuleset{Rules: []PromotionRule{rule}}, codes, promotionInput{Subtotal: 10000}, Rounding{})
+	if result.Discount != 3000 || len(result.Applied) != 2 || result.Applied[1].Name != "vip pricing" {
+		t.Errorf("applyPromotions = %v, %+v", result.Discount, result.Applied)
+	}
+}
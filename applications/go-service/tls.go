@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TLSConfig serves the API over TLS when CertFile and KeyFile are set. With
+// ClientCAFile set as well, every client must present a certificate signed
+// by one of the CAs in it, for mutual TLS between services. The files are
+// checked every ReloadInterval and loaded again when they change.
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ReloadInterval time.Duration
+}
+
+func loadTLSConfig() TLSConfig {
+	cfg := TLSConfig{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		ReloadInterval: 30 * time.Second,
+	}
+	if val := os.Getenv("TLS_RELOAD_INTERVAL"); val != "" {
+		if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+			cfg.ReloadInterval = parsed
+		}
+	}
+	return cfg
+}
+
+// Enabled reports whether the API is served over TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientCAFile != ""
+}
+
+// newServerTLSConfig loads the certificate, and the client CAs for mutual
+// TLS, that cfg names
+func newServerTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("TLS needs both TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// Set here because the config the server was started with, which
+		// http.Server adds them to, is replaced by this one per connection
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA file %s", cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// certReloader hands each new connection the TLS config last loaded from
+// the files cfg names, so a certificate cert-manager renewed in the mounted
+// secret is served without a restart. Connections already open keep the
+// certificate they were made with.
+type certReloader struct {
+	cfg     TLSConfig
+	current atomic.Pointer[tls.Config]
+	// fingerprint is the hash of the files current was loaded from; only
+	// reload touches it
+	fingerprint [sha256.Size]byte
+	// expiry is when the served certificate expires, in Unix seconds
+	expiry   atomic.Int64
+	failures atomic.Int64
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// serverConfig is the config to start the server with
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+		// Unused while GetConfigForClient is set, but older versions of
+		// http.Server look for it before they'll serve without cert files
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current.Load().Certificates[0], nil
+		},
+	}
+}
+
+// reload loads the files again when their contents have changed, reporting
+// whether it did. When they can't be loaded, as when the certificate has
+// been replaced and its key not yet, the current config is kept.
+func (r *certReloader) reload() (bool, error) {
+	hash := sha256.New()
+	for _, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		hash.Write(data)
+	}
+	var fingerprint [sha256.Size]byte
+	hash.Sum(fingerprint[:0])
+	if fingerprint == r.fingerprint && r.current.Load() != nil {
+		return false, nil
+	}
+
+	config, err := newServerTLSConfig(r.cfg)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("parse TLS certificate: %w", err)
+	}
+	r.current.Store(config)
+	r.fingerprint = fingerprint
+	r.expiry.Store(leaf.NotAfter.Unix())
+	return true, nil
+}
+
+// runTLSReload checks the certificate files every TLS.ReloadInterval
+func (s *Server) runTLSReload(ctx context.Context) {
+	runEvery(ctx, s.config.TLS.ReloadInterval, func(ctx context.Context) {
+		reloaded, err := s.tls.reload()
+		if err != nil {
+			s.tls.failures.Add(1)
+			slog.WarnContext(ctx, "failed to reload TLS certificate, continuing with the current one", "error", err)
+			return
+		}
+		if reloaded {
+			slog.InfoContext(ctx, "reloaded TLS certificate", "expires", time.Unix(s.tls.expiry.Load(), 0).UTC())
+		}
+	})
+}
+
+// serve listens on srv's address, over TLS when it has a TLSConfig
+func serve(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// The certificate comes from TLSConfig
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// clientCertificate is the verified certificate the client presented, or
+// nil without mutual TLS
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// recordClientCertificate puts the subject of the client's certificate on
+// the request's span, so a trace shows which service called
+func recordClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cert := clientCertificate(r); cert != nil {
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.TLSClientSubject(cert.Subject.String()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for commonName, valid for
+// 127.0.0.1 when it is a server certificate
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"portfolio"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "cluster CA")
+	serverCert, serverKey := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+	cfg := TLSConfig{
+		CertFile:     writeFile(t, dir, "tls.crt", serverCert),
+		KeyFile:      writeFile(t, dir, "tls.key", serverKey),
+		ClientCAFile: writeFile(t, dir, "ca.crt", ca.pem),
+	}
+	tlsConfig, err := newServerTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cn string
+	server := httptest.NewUnstartedServer(recordClientCertificate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cn = clientCertificate(r).Subject.CommonName
+	})))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	client := func(certPEM, keyPEM []byte) *http.Client {
+		config := &tls.Config{RootCAs: roots}
+		if certPEM != nil {
+			pair, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Certificates = []tls.Certificate{pair}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	resp, err := client(ca.issue(t, "python-service", x509.ExtKeyUsageClientAuth)).Get(server.URL)
+	if err != nil {
+		t.Fatalf("client with a certificate from the CA: %v", err)
+	}
+	resp.Body.Close()
+	if cn != "python-service" {
+		t.Errorf("client CN = %q, want python-service", cn)
+	}
+
+	other := newTestCA(t, "other CA")
+	for name, c := range map[string]*http.Client{
+		"no certificate":              client(nil, nil),
+		"certificate from another CA": client(other.issue(t, "intruder", x509.ExtKeyUsageClientAuth)),
+	} {
+		if resp, err := c.Get(server.URL); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: request succeeded", name)
+		}
+	}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "cluster CA")
+	cert, key := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := writeFile(t, dir, "tls.crt", cert), writeFile(t, dir, "tls.key", key)
+	_, otherKey := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+
+	config, err := newServerTLSConfig(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.NoClientCert || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("without a client CA: ClientAuth %v, MinVersion %x", config.ClientAuth, config.MinVersion)
+	}
+
+	for name, cfg := range map[string]TLSConfig{
+		"no key":            {CertFile: certFile},
+		"client CA only":    {ClientCAFile: writeFile(t, dir, "ca.crt", ca.pem)},
+		"key doesn't match": {CertFile: certFile, KeyFile: writeFile(t, dir, "other.key", otherKey)},
+		"empty client CA":   {CertFile: certFile, KeyFile: keyFile, ClientCAFile: writeFile(t, dir, "empty.crt", nil)},
+		"missing client CA": {CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing.crt")},
+	} {
+		if !cfg.Enabled() {
+			t.Errorf("%s: not enabled", name)
+		}
+		if _, err := newServerTLSConfig(cfg); err == nil {
+			t.Errorf("%s: succeeded", name)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "cluster CA")
+	cert, key := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+	cfg := TLSConfig{CertFile: writeFile(t, dir, "tls.crt", cert), KeyFile: writeFile(t, dir, "tls.key", key)}
+	reloader, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = reloader.serverConfig()
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	servedSerial := func() *big.Int {
+		t.Helper()
+		// A new transport per request, so each makes a new connection
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber
+	}
+	first := servedSerial()
+
+	if reloaded, err := reloader.reload(); reloaded || err != nil {
+		t.Errorf("reload of unchanged files = %v, %v, want nothing loaded", reloaded, err)
+	}
+
+	// As cert-manager renews it
+	renewed, renewedKey := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "tls.crt", renewed)
+	writeFile(t, dir, "tls.key", renewedKey)
+	if reloaded, err := reloader.reload(); !reloaded || err != nil {
+		t.Fatalf("reload of renewed files = %v, %v", reloaded, err)
+	}
+	second := servedSerial()
+	if second.Cmp(first) == 0 {
+		t.Error("still serving the old certificate after reloading")
+	}
+	block, _ := pem.Decode(renewed)
+	leaf, _ := x509.ParseCertificate(block.Bytes)
+	if reloader.expiry.Load() != leaf.NotAfter.Unix() {
+		t.Errorf("expiry = %d, want the renewed certificate's %d", reloader.expiry.Load(), leaf.NotAfter.Unix())
+	}
+
+	// Half way through a rotation the certificate doesn't match the key
+	third, _ := ca.issue(t, "go-service", x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "tls.crt", third)
+	if reloaded, err := reloader.reload(); reloaded || err == nil {
+		t.Errorf("reload of a mismatched pair = %v, %v, want an error", reloaded, err)
+	}
+	if servedSerial().Cmp(second) != 0 {
+		t.Error("a failed reload replaced the certificate being served")
+	}
+}
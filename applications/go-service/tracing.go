@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"os"
-	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -16,29 +18,17 @@ import (
 func initTracing() (*trace.TracerProvider, error) {
 	ctx := context.Background()
 
-	// Get Jaeger collector URL from environment
-	// Jaeger accepts OTLP HTTP on port 4318 (default) or 14268 (legacy HTTP)
-	jaegerHost := os.Getenv("JAEGER_COLLECTOR_HOST")
-	if jaegerHost == "" {
-		jaegerHost = "jaeger-query.monitoring.svc.cluster.local"
-	}
-
-	// Create OTLP HTTP exporter pointing to Jaeger collector
+	// Create OTLP HTTP exporter pointing to Jaeger collector. The endpoint
+	// is host and port only: the exporter adds the scheme and /v1/traces.
 	exporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint("http://"+jaegerHost+":4318/v1/traces"),
+		otlptracehttp.WithEndpoint(collectorHost()+":4318"),
 		otlptracehttp.WithInsecure(),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("go-service"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+	res, err := serviceResource(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -62,3 +52,57 @@ func initTracing() (*trace.TracerProvider, error) {
 	return tp, nil
 }
 
+// collectorHost is where traces, and OTLP metrics when enabled, are sent.
+// Jaeger accepts OTLP HTTP on port 4318 (default) or 14268 (legacy HTTP).
+func collectorHost() string {
+	if host := os.Getenv("JAEGER_COLLECTOR_HOST"); host != "" {
+		return host
+	}
+	return "jaeger-query.monitoring.svc.cluster.local"
+}
+
+// serviceResource describes this service to the trace and metric backends,
+// including which pod, node, and container is sending, so a trace shows the
+// replica that served it. OTEL_RESOURCE_ATTRIBUTES is applied last and can
+// override any of it. A detector that fails leaves its attributes out.
+func serviceResource(ctx context.Context) (*resource.Resource, error) {
+	attrs := append([]attribute.KeyValue{
+		semconv.ServiceName("go-service"),
+		semconv.ServiceVersion(version),
+	}, kubernetesAttributes()...)
+
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithContainer(),
+		resource.WithProcessPID(),
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.Warn("resource detection incomplete, continuing with the attributes found", "error", err)
+		err = nil
+	}
+	return res, err
+}
+
+// kubernetesAttributes reads the pod's identity from the downward API
+// variables the deployments set. Outside a cluster they are unset and
+// nothing is added.
+func kubernetesAttributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, v := range []struct {
+		env  string
+		attr func(string) attribute.KeyValue
+	}{
+		{"K8S_POD_NAME", semconv.K8SPodName},
+		{"K8S_NAMESPACE_NAME", semconv.K8SNamespaceName},
+		{"K8S_NODE_NAME", semconv.K8SNodeName},
+		{"K8S_CONTAINER_NAME", semconv.K8SContainerName},
+	} {
+		if val := os.Getenv(v.env); val != "" {
+			attrs = append(attrs, v.attr(val))
+		}
+	}
+	return attrs
+}
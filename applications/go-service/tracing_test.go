@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServiceResource(t *testing.T) {
+	t.Setenv("K8S_POD_NAME", "go-service-7d9f8-abcde")
+	t.Setenv("K8S_NAMESPACE_NAME", "applications")
+	t.Setenv("K8S_NODE_NAME", "aks-nodepool1-0")
+	t.Setenv("K8S_CONTAINER_NAME", "")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=staging,k8s.node.name=overridden")
+
+	res, err := serviceResource(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]string{}
+	for _, kv := range res.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	want := map[string]string{
+		"service.name":           "go-service",
+		"k8s.pod.name":           "go-service-7d9f8-abcde",
+		"k8s.namespace.name":     "applications",
+		"k8s.node.name":          "overridden",
+		"deployment.environment": "staging",
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %q, want %q", key, attrs[key], value)
+		}
+	}
+	if _, ok := attrs["k8s.container.name"]; ok {
+		t.Error("k8s.container.name set from an empty variable")
+	}
+	if attrs["host.name"] == "" || attrs["process.pid"] == "" {
+		t.Errorf("host.name or process.pid not detected: %v", attrs)
+	}
+}
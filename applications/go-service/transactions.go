@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+var errTransactionNotFound = errors.New("transaction not found")
+
+// TransactionSummary is the condensed view returned by the list endpoint
+type TransactionSummary struct {
+	TransactionID string `json:"transaction_id"`
+	CustomerID    string `json:"customer_id,omitempty"`
+	Status        string `json:"status"`
+	Currency      string `json:"currency"`
+	Total         Money  `json:"total"`
+	DiscountCode  string `json:"discount_code,omitempty"`
+	Timestamp     string `json:"timestamp"`
+}
+
+type TransactionListResponse struct {
+	Transactions []TransactionSummary `json:"transactions"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+}
+
+// listCursor marks the last row of a page. Pages are ordered newest first by
+// (created_at, id) so the cursor stays stable while new rows are inserted.
+type listCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c listCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListCursor(value string) (listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("decode cursor: %w", err)
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), ",")
+	if !found {
+		return listCursor{}, errors.New("malformed cursor")
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("parse cursor timestamp: %w", err)
+	}
+
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("parse cursor id: %w", err)
+	}
+
+	return listCursor{CreatedAt: ts, ID: parsedID}, nil
+}
+
+// parseListLimit reads the page size from the query string, applying the
+// default when absent and rejecting values outside 1..maxListLimit.
+func parseListLimit(value string) (int, error) {
+	if value == "" {
+		return defaultListLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+
+	return limit, nil
+}
+
+// transactionFilter narrows a transaction listing. Zero values mean "no
+// constraint" for every field.
+type transactionFilter struct {
+	CustomerID   *uuid.UUID
+	From         *time.Time
+	To           *time.Time
+	MinTotal     *Money
+	MaxTotal     *Money
+	DiscountCode string
+	Status       string
+	// Metadata matches transactions whose metadata contains every pair
+	Metadata map[string]string
+	// Notes matches a case-insensitive substring of the notes
+	Notes string
+}
+
+// parseTimeRange reads optional from/to query parameters, accepting either
+// RFC3339 timestamps or plain YYYY-MM-DD dates. A bare "to" date is treated as
+// inclusive of that whole day.
+func parseTimeRange(query url.Values) (from, to *time.Time, err error) {
+	if value := query.Get("from"); value != "" {
+		parsed, err := parseTimeParam(value, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid from: %w", err)
+		}
+		from = &parsed
+	}
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := parseTimeParam(value, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid to: %w", err)
+		}
+		to = &parsed
+	}
+
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, errors.New("from must be before to")
+	}
+
+	return from, to, nil
+}
+
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("expected RFC3339 timestamp or YYYY-MM-DD date")
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// parsePageParams reads the shared limit/cursor query parameters
+func parsePageParams(query url.Values) (int, *listCursor, error) {
+	limit, err := parseListLimit(query.Get("limit"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	value := query.Get("cursor")
+	if value == "" {
+		return limit, nil, nil
+	}
+
+	cursor, err := decodeListCursor(value)
+	if err != nil {
+		return 0, nil, errors.New("invalid cursor")
+	}
+	return limit, &cursor, nil
+}
+
+func (s *Server) listTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, cursor, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	response, err := s.store.ListTransactions(ctx, transactionFilter{From: from, To: to}, cursor, limit)
+	if err != nil {
+		http.Error(w, "Failed to list transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// queryBuilder accumulates WHERE conditions with numbered placeholders
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+// arg registers value as the next query argument and returns its placeholder
+func (qb *queryBuilder) arg(value any) string {
+	qb.args = append(qb.args, value)
+	return fmt.Sprintf("$%d", len(qb.args))
+}
+
+// where adds a condition; each %s in format is replaced by a placeholder for
+// the corresponding value.
+func (qb *queryBuilder) where(format string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, value := range values {
+		placeholders[i] = qb.arg(value)
+	}
+	qb.conditions = append(qb.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+func (qb *queryBuilder) whereClause() string {
+	if len(qb.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.conditions, " AND ")
+}
+
+func (f transactionFilter) apply(qb *queryBuilder) {
+	qb.where("deleted_at IS NULL")
+	if f.CustomerID != nil {
+		qb.where("customer_id = %s", *f.CustomerID)
+	}
+	if f.From != nil {
+		qb.where("created_at >= %s", *f.From)
+	}
+	if f.To != nil {
+		qb.where("created_at < %s", *f.To)
+	}
+	if f.MinTotal != nil {
+		qb.where("total >= %s", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		qb.where("total <= %s", *f.MaxTotal)
+	}
+	if f.DiscountCode != "" {
+		qb.where("discount_codes @> ARRAY[%s]::text[]", normalizeDiscountCode(f.DiscountCode))
+	}
+	if f.Status != "" {
+		qb.where("status = %s", f.Status)
+	}
+	if len(f.Metadata) > 0 {
+		contains, _ := json.Marshal(f.Metadata)
+		qb.where("metadata @> %s::jsonb", string(contains))
+	}
+	if f.Notes != "" {
+		qb.where("notes ILIKE %s", "%"+escapeLike(f.Notes)+"%")
+	}
+}
+
+// escapeLike makes s match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+const transactionSummaryColumns = `id, customer_id, status, currency, total, discount_code, created_at`
+
+func scanTransactionSummary(row pgx.Row) (TransactionSummary, listCursor, error) {
+	var (
+		id           uuid.UUID
+		customerID   pgtype.UUID
+		discountCode pgtype.Text
+		createdAt    time.Time
+		summary      TransactionSummary
+	)
+	if err := row.Scan(&id, &customerID, &summary.Status, &summary.Currency, &summary.Total, &discountCode, &createdAt); err != nil {
+		return TransactionSummary{}, listCursor{}, err
+	}
+
+	summary.TransactionID = id.String()
+	summary.DiscountCode = discountCode.String
+	summary.Timestamp = createdAt.UTC().Format(time.RFC3339)
+	if customerID.Valid {
+		summary.CustomerID = uuid.UUID(customerID.Bytes).String()
+	}
+	return summary, listCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// listTransactionSummaries returns one page of transactions matching filter,
+// newest first, with NextCursor set when more rows remain.
+func (s *Server) listTransactionSummaries(ctx context.Context, filter transactionFilter, cursor *listCursor, limit int) (TransactionListResponse, error) {
+	var qb queryBuilder
+	filter.apply(&qb)
+	if cursor != nil {
+		qb.where("(created_at, id) < (%s, %s)", cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	sql := `SELECT ` + transactionSummaryColumns + ` FROM transactions` + qb.whereClause() +
+		` ORDER BY created_at DESC, id DESC LIMIT ` + qb.arg(limit+1)
+
+	rows, err := s.readQuery(ctx, sql, qb.args...)
+	if err != nil {
+		return TransactionListResponse{}, fmt.Errorf("query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	response := TransactionListResponse{Transactions: []TransactionSummary{}}
+	var last listCursor
+	for rows.Next() {
+		summary, position, err := scanTransactionSummary(rows)
+		if err != nil {
+			return TransactionListResponse{}, fmt.Errorf("scan transaction: %w", err)
+		}
+
+		if len(response.Transactions) == limit {
+			response.NextCursor = last.encode()
+			break
+		}
+
+		response.Transactions = append(response.Transactions, summary)
+		last = position
+	}
+	if err := rows.Err(); err != nil {
+		return TransactionListResponse{}, fmt.Errorf("read transactions: %w", err)
+	}
+
+	return response, nil
+}
+
+func (s *Server) getTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	locale, localized, err := requestLocale(r)
+	if err != nil {
+		http.Error(w, "Invalid locale", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	response, err := s.store.LoadTransaction(ctx, transactionID)
+	if errors.Is(err, errTransactionNotFound) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	if localized {
+		response.Display = displayAmounts(locale, response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// deleteTransactionHandler soft-deletes a transaction, hiding it from the API,
+// stats, and reports until it is restored. Pending transactions hold stock
+// and must be captured or voided first.
+func (s *Server) deleteTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE transactions SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND status <> 'pending'
+	`, transactionID)
+	if err != nil {
+		http.Error(w, "Failed to delete transaction", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		var status TransactionStatus
+		err := s.db.QueryRow(ctx, `SELECT status FROM transactions WHERE id = $1 AND deleted_at IS NULL`, transactionID).Scan(&status)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+		case err != nil:
+			http.Error(w, "Failed to delete transaction", http.StatusInternalServerError)
+		default:
+			http.Error(w, "Pending transactions must be captured or voided before they are deleted", http.StatusConflict)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreTransactionHandler undoes a soft delete
+func (s *Server) restoreTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	tag, err := s.db.Exec(ctx, `UPDATE transactions SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, transactionID)
+	if err != nil {
+		http.Error(w, "Failed to restore transaction", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "No deleted transaction with that ID", http.StatusNotFound)
+		return
+	}
+
+	response, err := s.loadTransaction(ctx, transactionID)
+	if err != nil {
+		http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// loadTransaction reads a persisted transaction and its line items back into
+// the same shape returned by processTransactionHandler.
+func (s *Server) loadTransaction(ctx context.Context, transactionID uuid.UUID) (TransactionResponse, error) {
+	queries := New(s.db)
+	row, err := queries.GetTransaction(ctx, transactionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TransactionResponse{}, errTransactionNotFound
+	}
+	if err != nil {
+		return TransactionResponse{}, fmt.Errorf("query transaction: %w", err)
+	}
+
+	response := TransactionResponse{
+		TransactionID: transactionID.String(),
+		Status:        row.Status,
+		Currency:      row.Currency.String,
+		ExchangeRate:  row.ExchangeRate,
+		Subtotal:      row.Subtotal,
+		Tax:           row.Tax,
+		Discount:      row.Discount,
+		Tip:           row.Tip,
+		Shipping:      row.Shipping,
+		Total:         row.Total,
+		TaxRate:       row.TaxRate,
+		Region:        row.Region,
+		TaxInclusive:  row.TaxInclusive,
+		Rounding:      row.Rounding,
+		TaxExemption:  row.TaxExemption,
+		InvoiceNumber: row.InvoiceNumber,
+		Notes:         row.Notes,
+		Timestamp:     row.CreatedAt.Time.UTC().Format(time.RFC3339),
+	}
+	if err := json.Unmarshal(row.Metadata, &response.Metadata); err != nil {
+		return TransactionResponse{}, fmt.Errorf("decode transaction metadata: %w", err)
+	}
+	if row.CustomerID.Valid {
+		response.CustomerID = uuid.UUID(row.CustomerID.Bytes).String()
+	}
+	if row.DuplicateOf.Valid {
+		response.DuplicateOf = uuid.UUID(row.DuplicateOf.Bytes).String()
+	}
+
+	items, err := queries.ListTransactionItems(ctx, pgtype.UUID{Bytes: transactionID, Valid: true})
+	if err != nil {
+		return TransactionResponse{}, fmt.Errorf("query transaction items: %w", err)
+	}
+
+	response.Items = make([]Item, 0, len(items))
+	for _, row := range items {
+		item := Item{ID: row.ProductID, Name: row.Name, Category: row.Category, Price: row.UnitPrice, Quantity: int(row.Quantity)}
+		response.Items = append(response.Items, item)
+		response.Lines = append(response.Lines, TransactionLine{
+			Line:     len(response.Items),
+			ID:       item.ID,
+			Name:     item.Name,
+			Amount:   item.Price.Mul(item.Quantity),
+			Discount: row.Discount,
+			Tax:      row.Tax,
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestListCursorRoundTrip(t *testing.T) {
+	original := listCursor{
+		CreatedAt: time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	decoded, err := decodeListCursor(original.encode())
+	if err != nil {
+		t.Fatalf("decodeListCursor returned error: %v", err)
+	}
+
+	if !decoded.CreatedAt.Equal(original.CreatedAt) || decoded.ID != original.ID {
+		t.Errorf("cursor round trip mismatch: got %+v want %+v", decoded, original)
+	}
+}
+
+func TestDecodeListCursorRejectsGarbage(t *testing.T) {
+	for _, value := range []string{"not-base64!", "bm8tY29tbWE", "Zm9vLGJhcg"} {
+		if _, err := decodeListCursor(value); err == nil {
+			t.Errorf("decodeListCursor(%q) expected error", value)
+		}
+	}
+}
+
+func TestParseListLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", defaultListLimit, false},
+		{"10", 10, false},
+		{"200", 200, false},
+		{"0", 0, true},
+		{"201", 0, true},
+		{"abc", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseListLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseListLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseListLimit(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	from, to, err := parseTimeRange(url.Values{"from": {"2024-01-01"}, "to": {"2024-01-31"}})
+	if err != nil {
+		t.Fatalf("parseTimeRange returned error: %v", err)
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !from.Equal(want) {
+		t.Errorf("from = %v, want %v", from, want)
+	}
+	// A bare end date includes the whole day
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !to.Equal(want) {
+		t.Errorf("to = %v, want %v", to, want)
+	}
+
+	if _, _, err := parseTimeRange(url.Values{"from": {"2024-02-01T00:00:00Z"}, "to": {"2024-01-01T00:00:00Z"}}); err == nil {
+		t.Error("expected error when from is after to")
+	}
+	if _, _, err := parseTimeRange(url.Values{"from": {"yesterday"}}); err == nil {
+		t.Error("expected error for unparseable from")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The v2 contract carries every amount as integer minor units (cents) so
+// clients never see binary floating point, answers creation with 201 and a
+// Location header, and reports business-rule failures as 422 with a JSON
+// error body.
+
+type V2Item struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Category       string  `json:"category"`
+	UnitPriceCents int64   `json:"unit_price_cents"`
+	Quantity       int     `json:"quantity"`
+	WeightKg       float64 `json:"weight_kg,omitempty"`
+}
+
+type V2TransactionRequest struct {
+	Items         []V2Item       `json:"items"`
+	CustomerID    string         `json:"customer_id,omitempty"`
+	DiscountCode  string         `json:"discount_code,omitempty"`
+	DiscountCodes []string       `json:"discount_codes,omitempty"`
+	RedeemPoints  int64          `json:"redeem_points,omitempty"`
+	AuthorizeOnly bool           `json:"authorize_only,omitempty"`
+	TipCents      int64          `json:"tip_cents,omitempty"`
+	Region        string         `json:"region,omitempty"`
+	Currency      string         `json:"currency,omitempty"`
+	Metadata      map[string]any `json:"metadata,omitempty"`
+	Notes         string         `json:"notes,omitempty"`
+}
+
+type V2TransactionResponse struct {
+	TransactionID string          `json:"transaction_id"`
+	CustomerID    string          `json:"customer_id,omitempty"`
+	Status        string          `json:"status"`
+	Currency      string          `json:"currency"`
+	Items         []V2Item        `json:"items"`
+	SubtotalCents int64           `json:"subtotal_cents"`
+	DiscountCents int64           `json:"discount_cents"`
+	TaxCents      int64           `json:"tax_cents"`
+	TipCents      int64           `json:"tip_cents"`
+	ShippingCents int64           `json:"shipping_cents"`
+	TotalCents    int64           `json:"total_cents"`
+	Metadata      map[string]any  `json:"metadata,omitempty"`
+	Notes         string          `json:"notes,omitempty"`
+	CreatedAt     string          `json:"created_at"`
+	Display       *DisplayAmounts `json:"display,omitempty"`
+}
+
+type V2Error struct {
+	Status     int         `json:"status"`
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+type V2ErrorResponse struct {
+	Error V2Error `json:"error"`
+}
+
+func (req V2TransactionRequest) toV1() TransactionRequest {
+	items := make([]Item, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = Item{
+			ID:       item.ID,
+			Name:     item.Name,
+			Category: item.Category,
+			Price:    Money(item.UnitPriceCents),
+			Quantity: item.Quantity,
+			Weight:   item.WeightKg,
+		}
+	}
+	return TransactionRequest{
+		Items:         items,
+		CustomerID:    req.CustomerID,
+		DiscountCode:  req.DiscountCode,
+		DiscountCodes: req.DiscountCodes,
+		RedeemPoints:  req.RedeemPoints,
+		AuthorizeOnly: req.AuthorizeOnly,
+		Tip:           Money(req.TipCents),
+		Region:        req.Region,
+		Currency:      req.Currency,
+		Metadata:      req.Metadata,
+		Notes:         req.Notes,
+	}
+}
+
+func v2TransactionFromV1(response TransactionResponse) V2TransactionResponse {
+	items := make([]V2Item, len(response.Items))
+	for i, item := range response.Items {
+		items[i] = V2Item{
+			ID:             item.ID,
+			Name:           item.Name,
+			Category:       item.Category,
+			UnitPriceCents: item.Price.Cents(),
+			Quantity:       item.Quantity,
+			WeightKg:       item.Weight,
+		}
+	}
+	return V2TransactionResponse{
+		TransactionID: response.TransactionID,
+		CustomerID:    response.CustomerID,
+		Status:        response.Status,
+		Currency:      response.Currency,
+		Items:         items,
+		SubtotalCents: response.Subtotal.Cents(),
+		DiscountCents: response.Discount.Cents(),
+		TaxCents:      response.Tax.Cents(),
+		TipCents:      response.Tip.Cents(),
+		ShippingCents: response.Shipping.Cents(),
+		TotalCents:    response.Total.Cents(),
+		Metadata:      response.Metadata,
+		Notes:         response.Notes,
+		CreatedAt:     response.Timestamp,
+		Display:       response.Display,
+	}
+}
+
+func writeV2Error(w http.ResponseWriter, status int, message string, violations ...Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(V2ErrorResponse{Error: V2Error{Status: status, Message: message, Violations: violations}})
+}
+
+// v2ErrorStatus maps processing failures onto v2 status codes. A well-formed
+// request that fails validation or a business rule is a 422 in v2, where v1
+// used 400.
+func v2ErrorStatus(err error) (int, string) {
+	status, message := errorStatus(err)
+	if status == http.StatusBadRequest {
+		status = http.StatusUnprocessableEntity
+	}
+	return status, message
+}
+
+func (s *Server) v2CreateTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	locale, localized, err := requestLocale(r)
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, "Invalid locale")
+		return
+	}
+
+	var req V2TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "Invalid request body", decodeViolations(err)...)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Write)
+	defer cancel()
+
+	response, err := s.processTransactionOnce(ctx, w, r, req.toV1(), time.Now())
+	if err != nil {
+		status, message := v2ErrorStatus(err)
+		if status >= http.StatusInternalServerError {
+			reportError(r.Context(), err)
+		}
+		writeV2Error(w, status, message, errorViolations(err)...)
+		return
+	}
+	if localized {
+		response.Display = displayAmounts(locale, response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v2/transactions/"+response.TransactionID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(v2TransactionFromV1(response))
+}
+
+func (s *Server) v2GetTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+	locale, localized, err := requestLocale(r)
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, "Invalid locale")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeouts.Read)
+	defer cancel()
+
+	response, err := s.store.LoadTransaction(ctx, transactionID)
+	if errors.Is(err, errTransactionNotFound) {
+		writeV2Error(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		writeV2Error(w, http.StatusInternalServerError, "Failed to fetch transaction")
+		return
+	}
+	if localized {
+		response.Display = displayAmounts(locale, response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(v2TransactionFromV1(response))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Violation is one business rule or field a request failed
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the body of a 422 listing every violation
+type ValidationErrorResponse struct {
+	Error      string      `json:"error"`
+	Violations []Violation `json:"violations"`
+	// RequestID is the X-Request-Id of the rejected request, to quote when
+	// reporting it
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// validationError rejects a request with every violation found, not just
+// the first
+func validationError(message string, violations []Violation) error {
+	return &processError{Status: http.StatusUnprocessableEntity, Message: message, Violations: violations}
+}
+
+// errorViolations returns the violations carried by a processing error
+func errorViolations(err error) []Violation {
+	var perr *processError
+	if errors.As(err, &perr) {
+		return perr.Violations
+	}
+	return nil
+}
+
+func writeValidationError(w http.ResponseWriter, status int, message string, violations []Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ValidationErrorResponse{
+		Error:      message,
+		Violations: violations,
+		RequestID:  w.Header().Get(requestIDHeader),
+	})
+}
+
+// decodeViolations describes why a request body could not be decoded
+func decodeViolations(err error) []Violation {
+	var (
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		return []Violation{{Field: "body", Rule: "required", Message: "request body is empty"}}
+	case errors.As(err, &typeErr):
+		return []Violation{{Field: typeErr.Field, Rule: "type", Message: "must be a " + typeErr.Type.String()}}
+	case errors.As(err, &syntaxErr):
+		return []Violation{{Field: "body", Rule: "syntax", Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}}
+	}
+	return []Violation{{Field: "body", Rule: "invalid", Message: err.Error()}}
+}
+
+// Limits on the free-form fields stored with a transaction
+const (
+	maxMetadataKeys = 50
+	maxNotesLength  = 2000
+)
+
+// OrderLimits are the configurable business rules every transaction must
+// meet. Zero disables a limit; an empty Categories accepts any category.
+type OrderLimits struct {
+	MinOrderAmount     Money
+	MaxItems           int
+	MaxQuantityPerLine int
+	Categories         []string
+}
+
+func loadOrderLimits() OrderLimits {
+	var limits OrderLimits
+	if val := os.Getenv("MIN_ORDER_AMOUNT"); val != "" {
+		if parsed, err := parseMoney(val); err == nil && parsed >= 0 {
+			limits.MinOrderAmount = parsed
+		}
+	}
+	for env, field := range map[string]*int{
+		"MAX_ITEMS_PER_TRANSACTION": &limits.MaxItems,
+		"MAX_QUANTITY_PER_LINE":     &limits.MaxQuantityPerLine,
+	} {
+		if val := os.Getenv(env); val != "" {
+			if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+				*field = parsed
+			}
+		}
+	}
+	if val := os.Getenv("ITEM_CATEGORIES"); val != "" {
+		for _, category := range strings.Split(val, ",") {
+			if category = normalizeCategory(category); category != "" {
+				limits.Categories = append(limits.Categories, category)
+			}
+		}
+	}
+	return limits
+}
+
+// validateTransactionRequest checks every field of req and returns all the
+// violations found. With catalog pricing, items are identified by id and
+// their name, price, and category come from the catalog.
+func (l OrderLimits) validateTransactionRequest(req TransactionRequest, catalogPricing bool) []Violation {
+	var violations []Violation
+	if len(req.Items) == 0 {
+		violations = append(violations, Violation{Field: "items", Rule: "required", Message: "transaction must contain at least one item"})
+	}
+	violations = append(violations, l.checkItems(req.Items, !catalogPricing)...)
+
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		if catalogPricing {
+			if strings.TrimSpace(item.ID) == "" {
+				violations = append(violations, Violation{Field: field + ".id", Rule: "required", Message: "id is required"})
+			}
+		} else {
+			if strings.TrimSpace(item.Name) == "" {
+				violations = append(violations, Violation{Field: field + ".name", Rule: "required", Message: "name is required"})
+			}
+			if len(l.Categories) > 0 && !containsFold(l.Categories, normalizeCategory(item.Category)) {
+				violations = append(violations, Violation{
+					Field:   field + ".category",
+					Rule:    "known_category",
+					Message: fmt.Sprintf("unknown category %q", item.Category),
+				})
+			}
+		}
+		if item.Weight < 0 {
+			violations = append(violations, Violation{Field: field + ".weight", Rule: "non_negative", Message: "weight must not be negative"})
+		}
+	}
+
+	if req.CustomerID != "" {
+		if _, err := uuid.Parse(req.CustomerID); err != nil {
+			violations = append(violations, Violation{Field: "customer_id", Rule: "uuid", Message: "customer_id must be a valid UUID"})
+		}
+	}
+	if req.Tip < 0 {
+		violations = append(violations, Violation{Field: "tip", Rule: "non_negative", Message: "tip must not be negative"})
+	}
+	if req.RedeemPoints < 0 {
+		violations = append(violations, Violation{Field: "redeem_points", Rule: "non_negative", Message: "redeem_points must not be negative"})
+	}
+	if currency := normalizeCurrency(req.Currency); currency != "" && !validCurrencyCode(currency) {
+		violations = append(violations, Violation{Field: "currency", Rule: "iso4217", Message: "currency must be a three-letter ISO 4217 code"})
+	}
+	if len(req.Metadata) > maxMetadataKeys {
+		violations = append(violations, Violation{Field: "metadata", Rule: "max_keys", Message: fmt.Sprintf("at most %d metadata keys", maxMetadataKeys)})
+	}
+	for key := range req.Metadata {
+		if strings.TrimSpace(key) == "" {
+			violations = append(violations, Violation{Field: "metadata", Rule: "key_required", Message: "metadata keys must not be empty"})
+			break
+		}
+	}
+	if len([]rune(req.Notes)) > maxNotesLength {
+		violations = append(violations, Violation{Field: "notes", Rule: "max_length", Message: fmt.Sprintf("notes must be at most %d characters", maxNotesLength)})
+	}
+	return violations
+}
+
+// checkItems reports lines that cannot be priced and lines or orders over
+// the configured limits. Prices are skipped when they come from the catalog.
+func (l OrderLimits) checkItems(items []Item, checkPrices bool) []Violation {
+	var violations []Violation
+	if l.MaxItems > 0 && len(items) > l.MaxItems {
+		violations = append(violations, Violation{
+			Field:   "items",
+			Rule:    "max_items",
+			Message: fmt.Sprintf("at most %d items per transaction", l.MaxItems),
+		})
+	}
+
+	for i, item := range items {
+		field := fmt.Sprintf("items[%d]", i)
+		switch {
+		case item.Quantity <= 0:
+			violations = append(violations, Violation{Field: field + ".quantity", Rule: "positive", Message: "quantity must be at least 1"})
+		case l.MaxQuantityPerLine > 0 && item.Quantity > l.MaxQuantityPerLine:
+			violations = append(violations, Violation{
+				Field:   field + ".quantity",
+				Rule:    "max_quantity",
+				Message: fmt.Sprintf("at most %d units per line", l.MaxQuantityPerLine),
+			})
+		}
+		if checkPrices && item.Price < 0 {
+			violations = append(violations, Violation{Field: field + ".price", Rule: "non_negative", Message: "price must not be negative"})
+		}
+	}
+	if checkPrices {
+		violations = append(violations, checkAmounts(items)...)
+	}
+	return violations
+}
+
+// checkAmounts rejects lines whose price times quantity, and orders whose
+// subtotal, are too large to price without overflowing
+func checkAmounts(items []Item) []Violation {
+	var (
+		violations []Violation
+		subtotal   Money
+	)
+	for i, item := range items {
+		if item.Quantity <= 0 || item.Price < 0 {
+			continue
+		}
+		line, ok := item.Price.MulChecked(item.Quantity)
+		if !ok {
+			violations = append(violations, Violation{Field: fmt.Sprintf("items[%d]", i), Rule: "max_amount", Message: "price times quantity is too large"})
+			continue
+		}
+		if subtotal > math.MaxInt64-line {
+			violations = append(violations, Violation{Field: "items", Rule: "max_amount", Message: "order total is too large"})
+			break
+		}
+		subtotal += line
+	}
+	return violations
+}
+
+// checkMinimum compares the merchandise subtotal, in the reporting currency,
+// with the minimum order amount
+func (l OrderLimits) checkMinimum(subtotal Money) []Violation {
+	if l.MinOrderAmount > 0 && subtotal < l.MinOrderAmount {
+		return []Violation{{
+			Field:   "items",
+			Rule:    "min_order_amount",
+			Message: fmt.Sprintf("order subtotal must be at least %s", l.MinOrderAmount),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOrderLimitsCheckItems(t *testing.T) {
+	limits := OrderLimits{MaxItems: 2, MaxQuantityPerLine: 10}
+
+	tests := []struct {
+		name        string
+		items       []Item
+		checkPrices bool
+		want        []string
+	}{
+		{"valid", []Item{{Price: 100, Quantity: 1}, {Price: 0, Quantity: 10}}, true, nil},
+		{"zero quantity", []Item{{Price: 100, Quantity: 0}}, true, []string{"items[0].quantity:positive"}},
+		{"negative price", []Item{{Price: -1, Quantity: 1}}, true, []string{"items[0].price:non_negative"}},
+		{"catalog priced", []Item{{Price: -1, Quantity: 1}}, false, nil},
+		{"over quantity", []Item{{Price: 100, Quantity: 11}}, true, []string{"items[0].quantity:max_quantity"}},
+		{"every violation", []Item{{Price: 100, Quantity: 1}, {Price: -5, Quantity: -1}, {Price: 100, Quantity: 50}}, true,
+			[]string{"items:max_items", "items[1].quantity:positive", "items[1].price:non_negative", "items[2].quantity:max_quantity"}},
+	}
+
+	for _, tt := range tests {
+		got := limits.checkItems(tt.items, tt.checkPrices)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i, v := range got {
+			if v.Field+":"+v.Rule != tt.want[i] {
+				t.Errorf("%s: violation %d = %s:%s, want %s", tt.name, i, v.Field, v.Rule, tt.want[i])
+			}
+		}
+	}
+
+	if got := (OrderLimits{}).checkItems([]Item{{Price: 100, Quantity: 1000}}, true); len(got) != 0 {
+		t.Errorf("zero limits should be disabled, got %+v", got)
+	}
+
+	// Without a quantity limit, amounts that would overflow are refused
+	// rather than priced wrapped
+	for name, tt := range map[string]struct {
+		items []Item
+		want  string
+	}{
+		"largest line":    {[]Item{{Price: math.MaxInt64 / 4, Quantity: 4}}, ""},
+		"line overflows":  {[]Item{{Price: 1999, Quantity: math.MaxInt64 / 1000}}, "items[0]:max_amount"},
+		"total overflows": {[]Item{{Price: math.MaxInt64 / 2, Quantity: 1}, {Price: math.MaxInt64 / 2, Quantity: 1}, {Price: 2, Quantity: 1}}, "items:max_amount"},
+	} {
+		got := (OrderLimits{}).checkItems(tt.items, true)
+		if tt.want == "" && len(got) != 0 || tt.want != "" && (len(got) != 1 || got[0].Field+":"+got[0].Rule != tt.want) {
+			t.Errorf("%s: got %+v, want %q", name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderLimitsCheckMinimum(t *testing.T) {
+	limits := OrderLimits{MinOrderAmount: 1000}
+	if got := limits.checkMinimum(999); len(got) != 1 || got[0].Rule != "min_order_amount" {
+		t.Errorf("checkMinimum(9.99) = %+v", got)
+	}
+	if got := limits.checkMinimum(1000); len(got) != 0 {
+		t.Errorf("checkMinimum(10.00) = %+v", got)
+	}
+}
+
+func TestValidationErrorCarriesViolations(t *testing.T) {
+	err := validationError("Transaction failed validation", []Violation{{Field: "items", Rule: "max_items"}})
+	if status, _ := errorStatus(err); status != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", status)
+	}
+	if got := errorViolations(err); len(got) != 1 {
+		t.Errorf("errorViolations = %+v", got)
+	}
+	if got := errorViolations(clientError(http.StatusBadRequest, "bad")); got != nil {
+		t.Errorf("plain client error has violations %+v", got)
+	}
+}
+
+func TestValidateTransactionRequest(t *testing.T) {
+	limits := OrderLimits{Categories: []string{"food", "books"}}
+	valid := Item{Name: "Coffee", Category: "Food", Price: 350, Quantity: 1}
+
+	tests := []struct {
+		name    string
+		req     TransactionRequest
+		catalog bool
+		want    []string
+	}{
+		{"valid", TransactionRequest{Items: []Item{valid}, CustomerID: "6f1c1e9e-2f0b-4d5e-9a31-2b8d0f6a7c11", Currency: "usd"}, false, nil},
+		{"no items", TransactionRequest{}, false, []string{"items:required"}},
+		{"every field", TransactionRequest{
+			Items:        []Item{valid, {Category: "toys", Price: -1, Quantity: 1, Weight: -2}},
+			CustomerID:   "not-a-uuid",
+			Tip:          -100,
+			RedeemPoints: -5,
+			Currency:     "dollars",
+		}, false, []string{
+			"items[1].price:non_negative",
+			"items[1].name:required",
+			"items[1].category:known_category",
+			"items[1].weight:non_negative",
+			"customer_id:uuid",
+			"tip:non_negative",
+			"redeem_points:non_negative",
+			"currency:iso4217",
+		}},
+		{"oversized free-form fields", TransactionRequest{
+			Items:    []Item{valid},
+			Metadata: map[string]any{"": "blank"},
+			Notes:    strings.Repeat("n", maxNotesLength+1),
+		}, false, []string{"metadata:key_required", "notes:max_length"}},
+		{"catalog needs id", TransactionRequest{Items: []Item{{Category: "toys", Quantity: 1}}}, true, []string{"items[0].id:required"}},
+	}
+
+	for _, tt := range tests {
+		got := limits.validateTransactionRequest(tt.req, tt.catalog)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i, v := range got {
+			if v.Field+":"+v.Rule != tt.want[i] {
+				t.Errorf("%s: violation %d = %s:%s, want %s", tt.name, i, v.Field, v.Rule, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDecodeViolations(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{``, "body:required"},
+		{`{"items": [`, "body:invalid"},
+		{`{"items": [}`, "body:syntax"},
+		{`{"redeem_points": "many"}`, "redeem_points:type"},
+		{`{"customer_id": 7}`, "customer_id:type"},
+	}
+
+	for _, tt := range tests {
+		var req TransactionRequest
+		err := json.NewDecoder(strings.NewReader(tt.body)).Decode(&req)
+		got := decodeViolations(err)
+		if len(got) != 1 || got[0].Field+":"+got[0].Rule != tt.want {
+			t.Errorf("decodeViolations(%q) = %+v, want %s", tt.body, got, tt.want)
+		}
+	}
+}
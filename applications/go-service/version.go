@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// Build metadata, overridden at build time with:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.gitSHA=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	gitSHA    = "unknown"
+	buildTime = "unknown"
+)
+
+type VersionResponse struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	response := VersionResponse{
+		Service:   s.config.ServiceName,
+		Version:   version,
+		GitSHA:    gitSHA,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
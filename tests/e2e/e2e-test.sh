@@ -192,7 +192,7 @@ echo "=================================="
 # Test API Gateway → Go Service
 echo "Testing API Gateway → Go Service..."
 if kubectl exec -n "${NAMESPACE}" $(kubectl get pods -n "${NAMESPACE}" -l app=js-gateway -o jsonpath='{.items[0].metadata.name}') -- \
-    curl -s -f http://go-service:8080/health &>/dev/null; then
+    curl -s -f http://go-service:6060/health &>/dev/null; then
     echo -e "  ${GREEN}✓${NC} JS Gateway can reach Go Service"
 else
     echo -e "  ${RED}✗${NC} JS Gateway cannot reach Go Service"